@@ -0,0 +1,52 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/alenkacz/interpreter-book/pkg/compiled"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func runBuild(args []string) int {
+	flags := flag.NewFlagSet("build", flag.ExitOnError)
+	output := flags.String("o", "", "write the compiled program to the file instead of the source with "+compiled.Extension+" extension")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: monkey build [-o file] file\n\nCompiles the file, so that it can be run without parsing by monkey run.\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+	file := flags.Arg(0)
+
+	src, err := ioutil.ReadFile(file)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	program, err := compiled.Compile(string(src))
+	if err != nil {
+		printCompileError(file, err)
+		return 1
+	}
+	if *output == "" {
+		*output = strings.TrimSuffix(file, filepath.Ext(file)) + compiled.Extension
+	}
+	if err := ioutil.WriteFile(*output, compiled.Encode(program), 0644); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// printCompileError prints each line of the error prefixed by the file
+func printCompileError(file string, err error) {
+	for _, line := range strings.Split(err.Error(), "\n") {
+		fmt.Fprintf(os.Stderr, "%s:%s\n", file, line)
+	}
+}
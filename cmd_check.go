@@ -0,0 +1,54 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/alenkacz/interpreter-book/pkg/parser"
+	"github.com/alenkacz/interpreter-book/pkg/tokenizer"
+	"github.com/alenkacz/interpreter-book/pkg/typecheck"
+	"io/ioutil"
+	"os"
+)
+
+func runCheck(args []string) int {
+	flags := flag.NewFlagSet("check", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: monkey check files...\n\nReports type errors, exits with 1 when there are any.\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	exitCode := 0
+	for _, file := range flags.Args() {
+		src, err := ioutil.ReadFile(file)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			exitCode = 1
+			continue
+		}
+		p := parser.New(tokenizer.New(string(src)))
+		program := p.ParseProgram()
+		if len(p.Errors) != 0 {
+			printParseErrors(file, p)
+			exitCode = 1
+			continue
+		}
+		for _, e := range typecheck.Check(program) {
+			fmt.Printf("%s:%s\n", file, e)
+			exitCode = 1
+		}
+	}
+	return exitCode
+}
+
+// printParseErrors prints errors of the parser prefixed by the file and
+// their positions
+func printParseErrors(file string, p *parser.Parser) {
+	for i, e := range p.Errors {
+		fmt.Fprintf(os.Stderr, "%s:%s: %s\n", file, p.ErrorPositions[i], e)
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/alenkacz/interpreter-book/pkg/coverage"
+	"github.com/alenkacz/interpreter-book/pkg/eval"
+	"github.com/alenkacz/interpreter-book/pkg/object"
+	"github.com/alenkacz/interpreter-book/pkg/parser"
+	"github.com/alenkacz/interpreter-book/pkg/tokenizer"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+func runCover(args []string) int {
+	flags := flag.NewFlagSet("cover", flag.ExitOnError)
+	lcov := flags.String("lcov", "", "write LCOV tracefile to the file")
+	profile := flags.String("coverprofile", "", "write Go style cover profile to the file")
+	html := flags.String("html", "", "write HTML report to the file")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: monkey cover [--lcov file] [--coverprofile file] [--html file] files...\n\nRuns each file and reports percentage of executed statements.\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	exitCode := 0
+	var files []*coverage.File
+	for _, file := range flags.Args() {
+		src, err := ioutil.ReadFile(file)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			exitCode = 1
+			continue
+		}
+		p := parser.New(tokenizer.New(string(src)))
+		program := p.ParseProgram()
+		if len(p.Errors) != 0 {
+			printParseErrors(file, p)
+			exitCode = 1
+			continue
+		}
+		if err := eval.Expand(program); err != nil {
+			fmt.Fprintf(os.Stderr, "%s:%s\n", file, err)
+			exitCode = 1
+			continue
+		}
+		if err := eval.Resolve(program, nil); err != nil {
+			fmt.Fprintf(os.Stderr, "%s:%s\n", file, err)
+			exitCode = 1
+			continue
+		}
+		f := coverage.New(file, string(src), program)
+		if result, ok := f.Run(object.NewEnvironment(nil)).(*object.Error); ok {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", file, result.Print())
+			exitCode = 1
+		}
+		fmt.Printf("%s: %.1f%% of statements\n", file, f.Percent())
+		files = append(files, f)
+	}
+
+	reports := []struct {
+		path  string
+		write func(w io.Writer, files []*coverage.File) error
+	}{
+		{*lcov, coverage.WriteLCOV},
+		{*profile, coverage.WriteGoCover},
+		{*html, coverage.WriteHTML},
+	}
+	for _, r := range reports {
+		if r.path == "" {
+			continue
+		}
+		if err := writeFile(r.path, func(w io.Writer) error { return r.write(w, files) }); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			exitCode = 1
+		}
+	}
+	return exitCode
+}
+
+// writeFile creates the file and writes it by the function
+func writeFile(path string, write func(w io.Writer) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/alenkacz/interpreter-book/pkg/dap"
+	"os"
+)
+
+func runDap(args []string) int {
+	flags := flag.NewFlagSet("dap", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: monkey dap\n\nStarts debug adapter communicating over stdin and stdout.\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if err := dap.New(os.Stdin, os.Stdout).Serve(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
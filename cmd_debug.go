@@ -0,0 +1,61 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/alenkacz/interpreter-book/pkg/debug"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// lines is a flag value collecting line numbers of repeated flags
+type lines []int
+
+func (l *lines) String() string {
+	var s []string
+	for _, line := range *l {
+		s = append(s, strconv.Itoa(line))
+	}
+	return strings.Join(s, ",")
+}
+
+func (l *lines) Set(value string) error {
+	line, err := strconv.Atoi(value)
+	if err != nil || line < 1 {
+		return fmt.Errorf("invalid line number %q", value)
+	}
+	*l = append(*l, line)
+	return nil
+}
+
+func runDebug(args []string) int {
+	flags := flag.NewFlagSet("debug", flag.ExitOnError)
+	var breakpoints lines
+	flags.Var(&breakpoints, "break", "set breakpoint at the line, can be repeated")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: monkey debug [--break line]... file\n\nRuns the file in debugger paused before the first statement, type help for the list of commands.\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	src, err := ioutil.ReadFile(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	console := debug.NewConsole(string(src), os.Stdin, os.Stdout)
+	for _, line := range breakpoints {
+		console.SetBreakpoint(line)
+	}
+	if err := console.Run(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/alenkacz/interpreter-book/pkg/compiled"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+func runDisasm(args []string) int {
+	flags := flag.NewFlagSet("disasm", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: monkey disasm file\n\nLists instructions, constants and source positions of the file compiled by\nmonkey build. Sources are compiled first.\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+	file := flags.Arg(0)
+
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if filepath.Ext(file) != compiled.Extension {
+		program, err := compiled.Compile(string(data))
+		if err != nil {
+			printCompileError(file, err)
+			return 1
+		}
+		data = compiled.Encode(program)
+	}
+	if err := compiled.Disassemble(os.Stdout, data); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", file, err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"github.com/alenkacz/interpreter-book/pkg/format"
+	"io/ioutil"
+	"os"
+)
+
+func runFmt(args []string) int {
+	flags := flag.NewFlagSet("fmt", flag.ExitOnError)
+	check := flags.Bool("check", false, "list files whose formatting differs and exit with 1 if there are any")
+	write := flags.Bool("write", false, "write result to the source file instead of stdout")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: monkey fmt [--check] [--write] [files...]\n\nFormats files or stdin when no files are given.\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		if *write {
+			fmt.Fprintln(os.Stderr, "cannot use --write with stdin")
+			return 2
+		}
+		src, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		return formatFile("<stdin>", src, *check, false)
+	}
+
+	exitCode := 0
+	for _, file := range flags.Args() {
+		src, err := ioutil.ReadFile(file)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			exitCode = 1
+			continue
+		}
+		if code := formatFile(file, src, *check, *write); code != 0 {
+			exitCode = code
+		}
+	}
+	return exitCode
+}
+
+func formatFile(name string, src []byte, check bool, write bool) int {
+	formatted, err := format.Source(src)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+		return 1
+	}
+
+	switch {
+	case check:
+		if !bytes.Equal(src, formatted) {
+			fmt.Println(name)
+			return 1
+		}
+	case write:
+		if !bytes.Equal(src, formatted) {
+			info, err := os.Stat(name)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return 1
+			}
+			if err := ioutil.WriteFile(name, formatted, info.Mode()); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return 1
+			}
+		}
+	default:
+		os.Stdout.Write(formatted)
+	}
+	return 0
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/alenkacz/interpreter-book/pkg/lint"
+	"github.com/alenkacz/interpreter-book/pkg/parser"
+	"github.com/alenkacz/interpreter-book/pkg/tokenizer"
+	"io/ioutil"
+	"os"
+)
+
+// lintIssue is the machine-readable form of lint.Issue
+type lintIssue struct {
+	File    string `json:"file"`
+	Line    int    `json:"line"`
+	Column  int    `json:"column"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+func runLint(args []string) int {
+	flags := flag.NewFlagSet("lint", flag.ExitOnError)
+	asJSON := flags.Bool("json", false, "print issues as JSON array")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: monkey lint [--json] files...\n\nReports suspicious code, exits with 1 when there are any issues.\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	exitCode := 0
+	issues := []lintIssue{}
+	for _, file := range flags.Args() {
+		src, err := ioutil.ReadFile(file)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			exitCode = 1
+			continue
+		}
+		p := parser.New(tokenizer.New(string(src)))
+		program := p.ParseProgram()
+		if len(p.Errors) != 0 {
+			printParseErrors(file, p)
+			exitCode = 1
+			continue
+		}
+		for _, issue := range lint.Lint(program) {
+			issues = append(issues, lintIssue{
+				File:    file,
+				Line:    issue.Pos.Line,
+				Column:  issue.Pos.Column,
+				Rule:    issue.Rule,
+				Message: issue.Message,
+			})
+		}
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(issues)
+	} else {
+		for _, issue := range issues {
+			fmt.Printf("%s:%d:%d: %s: %s\n", issue.File, issue.Line, issue.Column, issue.Rule, issue.Message)
+		}
+	}
+	if len(issues) > 0 {
+		exitCode = 1
+	}
+	return exitCode
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/alenkacz/interpreter-book/pkg/eval"
+	"github.com/alenkacz/interpreter-book/pkg/object"
+	"github.com/alenkacz/interpreter-book/pkg/parser"
+	"github.com/alenkacz/interpreter-book/pkg/profile"
+	"github.com/alenkacz/interpreter-book/pkg/tokenizer"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+func runProfile(args []string) int {
+	flags := flag.NewFlagSet("profile", flag.ExitOnError)
+	format := flags.String("format", "text", "format of the report, text, collapsed or pprof")
+	output := flags.String("output", "", "write the report to the file instead of stdout")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: monkey profile [--format text|collapsed|pprof] [--output file] file\n\nRuns the file and reports time and calls of its functions.\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+	file := flags.Arg(0)
+
+	var write func(p *profile.Profiler, w io.Writer) error
+	switch *format {
+	case "text":
+		write = (*profile.Profiler).WriteText
+	case "collapsed":
+		write = (*profile.Profiler).WriteCollapsed
+	case "pprof":
+		write = func(p *profile.Profiler, w io.Writer) error { return p.WritePprof(w, file) }
+	default:
+		fmt.Fprintf(os.Stderr, "unknown format %q\n", *format)
+		return 2
+	}
+
+	src, err := ioutil.ReadFile(file)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	p := parser.New(tokenizer.New(string(src)))
+	program := p.ParseProgram()
+	if len(p.Errors) != 0 {
+		printParseErrors(file, p)
+		return 1
+	}
+	if err := eval.Expand(program); err != nil {
+		fmt.Fprintf(os.Stderr, "%s:%s\n", file, err)
+		return 1
+	}
+	if err := eval.Resolve(program, nil); err != nil {
+		fmt.Fprintf(os.Stderr, "%s:%s\n", file, err)
+		return 1
+	}
+
+	profiler := profile.New(program)
+	if result, ok := profiler.Run(program, object.NewEnvironment(nil)).(*object.Error); ok {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", file, result.Print())
+	}
+
+	w := io.Writer(os.Stdout)
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		defer f.Close()
+		w = f
+	}
+	if err := write(profiler, w); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/alenkacz/interpreter-book/pkg/ast"
+	"github.com/alenkacz/interpreter-book/pkg/compiled"
+	"github.com/alenkacz/interpreter-book/pkg/eval"
+	"github.com/alenkacz/interpreter-book/pkg/object"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+func runRun(args []string) int {
+	flags := flag.NewFlagSet("run", flag.ExitOnError)
+	noCache := flags.Bool("no-cache", false, "compile the source without using the cache")
+	checkOverflow := flags.Bool("check-overflow", false, "fail on integer overflow instead of promoting to bigint")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: monkey run [--no-cache] [--check-overflow] file\n\nRuns the source or the file compiled by monkey build and prints the value of\nthe program. Compiled sources are cached in the user cache directory.\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+	file := flags.Arg(0)
+
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	var program *ast.Program
+	if filepath.Ext(file) == compiled.Extension {
+		program, err = compiled.Decode(data)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", file, err)
+			return 1
+		}
+	} else {
+		program, err = load(string(data), *noCache)
+		if err != nil {
+			printCompileError(file, err)
+			return 1
+		}
+	}
+
+	in := eval.New()
+	in.CheckOverflow = *checkOverflow
+	result := in.Eval(program, object.NewEnvironment(nil))
+	if e, ok := result.(*object.Error); ok {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", file, e.Print())
+		return 1
+	}
+	if result != nil {
+		fmt.Println(result.Print())
+	}
+	return 0
+}
+
+// load compiles the source through the default cache, the source is just
+// compiled when the cache directory is not known
+func load(source string, noCache bool) (*ast.Program, error) {
+	if !noCache {
+		if cache, err := compiled.DefaultCache(); err == nil {
+			return cache.Load(source)
+		}
+	}
+	return compiled.Compile(source)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/alenkacz/interpreter-book/pkg/test"
+	"io"
+	"io/ioutil"
+	"os"
+	"regexp"
+)
+
+func runTest(args []string) int {
+	flags := flag.NewFlagSet("test", flag.ExitOnError)
+	run := flags.String("run", "", "run only tests with names matching the regular expression")
+	verbose := flags.Bool("v", false, "list passed tests too")
+	junit := flags.String("junit", "", "write results in the JUnit XML format to the file")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: monkey test [--run regexp] [-v] [--junit file] [paths...]\n\nRuns test_* functions of *%s files in the paths, the current directory by default.\n", test.FileSuffix)
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	runner := &test.Runner{}
+	if *run != "" {
+		filter, err := regexp.Compile(*run)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		runner.Filter = filter
+	}
+	paths := flags.Args()
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	files, err := test.Discover(paths)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	exitCode := 0
+	var results []test.Result
+	for _, file := range files {
+		src, err := ioutil.ReadFile(file)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			exitCode = 1
+			continue
+		}
+		fileResults, err := runner.RunFile(file, string(src))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			exitCode = 1
+			continue
+		}
+		results = append(results, fileResults...)
+	}
+	for _, r := range results {
+		if !r.Passed() {
+			exitCode = 1
+		}
+	}
+
+	test.WriteText(os.Stdout, results, *verbose)
+	if *junit != "" {
+		err := writeFile(*junit, func(w io.Writer) error { return test.WriteJUnit(w, results) })
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			exitCode = 1
+		}
+	}
+	return exitCode
+}
@@ -5,9 +5,36 @@ import (
 	"github.com/alenkacz/interpreter-book/pkg/repl"
 	"os"
 	"os/user"
+	"sort"
 )
 
+// commands are subcommands of the monkey binary, each returns exit code
+var commands = map[string]func(args []string) int{
+	"build":   runBuild,
+	"check":   runCheck,
+	"cover":   runCover,
+	"dap":     runDap,
+	"debug":   runDebug,
+	"disasm":  runDisasm,
+	"fmt":     runFmt,
+	"lint":    runLint,
+	"lsp":     runLsp,
+	"profile": runProfile,
+	"run":     runRun,
+	"test":    runTest,
+}
+
 func main() {
+	if len(os.Args) > 1 {
+		command, ok := commands[os.Args[1]]
+		if !ok {
+			fmt.Fprintf(os.Stderr, "unknown command %q\n", os.Args[1])
+			printUsage()
+			os.Exit(2)
+		}
+		os.Exit(command(os.Args[2:]))
+	}
+
 	user, err := user.Current()
 	if err != nil {
 		panic(err)
@@ -17,3 +44,16 @@ func main() {
 	fmt.Printf("Feel free to type in commands\n")
 	repl.Start(os.Stdin, os.Stdout)
 }
+
+func printUsage() {
+	var names []string
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Fprintf(os.Stderr, "usage: monkey [command] [arguments]\n\n")
+	fmt.Fprintf(os.Stderr, "Without command an interactive session is started. Commands:\n")
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "\t%s\n", name)
+	}
+}
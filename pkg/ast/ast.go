@@ -4,16 +4,27 @@ import (
 	"bytes"
 	"fmt"
 	"github.com/alenkacz/interpreter-book/pkg/token"
+	"math/big"
 	"strconv"
 	"strings"
 )
 
 type Node interface {
 	String() string
+	// Pos returns position of the first token of the node
+	Pos() token.Position
 }
 
 type Program struct {
 	Statements []Statement
+	Comments   []*Comment
+}
+
+func (p *Program) Pos() token.Position {
+	if len(p.Statements) > 0 {
+		return p.Statements[0].Pos()
+	}
+	return token.Position{}
 }
 
 func (p *Program) String() string {
@@ -26,45 +37,98 @@ return out.String()
 
 type Statement interface {
 	Node
+	// End returns position of the last token of the statement
+	End() token.Position
 	statementNode() // just to be able to distinguish betweet statement and expression
 }
 
+// Comment is a line comment, it is not part of the statements but it is kept
+// in the Program so that tools like formatter do not lose it
+type Comment struct {
+	Position token.Position
+	Text     string
+}
+
+func (c *Comment) Pos() token.Position { return c.Position }
+func (c *Comment) String() string {
+	return c.Text
+}
+
 type LetStatement struct {
+	Position    token.Position
+	EndPosition token.Position
+	// Identifier is nil when the statement destructures the value by Pattern
 	Identifier *token.Token
-	Value      Expression
+	// Pattern is the array or hash pattern of destructuring let statements
+	Pattern Pattern
+	// Type is the optional type annotation, nil when there is none
+	Type  *TypeAnnotation
+	Value Expression
+	// Local is the slot the name is bound to, nil when not resolved
+	Local *Local
 }
 
 func (*LetStatement) statementNode() {}
+func (l *LetStatement) Pos() token.Position { return l.Position }
+func (l *LetStatement) End() token.Position { return l.EndPosition }
+
+// Name returns the bound name, it is empty for destructuring let statements
 func (l *LetStatement) Name() string {
+	if l.Identifier == nil {
+		return ""
+	}
 	return l.Identifier.Literal
 }
 func (l *LetStatement) String() string {
-	return fmt.Sprintf("let %s = ;", l.Identifier)
+	if l.Pattern != nil {
+		return fmt.Sprintf("let %s = %s;", l.Pattern.String(), l.Value.String())
+	}
+	if l.Type != nil {
+		return fmt.Sprintf("let %s: %s = %s;", l.Identifier.Literal, l.Type.String(), l.Value.String())
+	}
+	return fmt.Sprintf("let %s = %s;", l.Identifier.Literal, l.Value.String())
 }
 
 type ReturnStatement struct {
+	Position    token.Position
+	EndPosition token.Position
 	ReturnValue Expression
 }
 
 func (*ReturnStatement) statementNode() {}
+func (l *ReturnStatement) Pos() token.Position { return l.Position }
+func (l *ReturnStatement) End() token.Position { return l.EndPosition }
 func (l *ReturnStatement) String() string {
-	return "return;"
+	return fmt.Sprintf("return %s;", l.ReturnValue.String())
 }
 
 type ExpressionStatement struct {
-	Expression Expression
+	EndPosition token.Position
+	Expression  Expression
 }
 
 func (*ExpressionStatement) statementNode() {}
+func (e *ExpressionStatement) Pos() token.Position {
+	if e.Expression == nil {
+		return token.Position{}
+	}
+	return e.Expression.Pos()
+}
+func (e *ExpressionStatement) End() token.Position { return e.EndPosition }
 func (e *ExpressionStatement) String() string {
 	return e.Expression.String()
 }
 
 type BlockStatement struct {
-	Statements []Statement
+	// positions of the braces
+	Position    token.Position
+	EndPosition token.Position
+	Statements  []Statement
 }
 
 func (*BlockStatement) statementNode() {}
+func (b *BlockStatement) Pos() token.Position { return b.Position }
+func (b *BlockStatement) End() token.Position { return b.EndPosition }
 func (b *BlockStatement) String() string {
 	var buf bytes.Buffer
 	for _, s := range b.Statements {
@@ -79,62 +143,97 @@ type Expression interface {
 }
 
 type IntegerLiteral struct {
+	Position token.Position
 	Value int64
 }
 func (*IntegerLiteral) expressionNode() {}
+func (e *IntegerLiteral) Pos() token.Position { return e.Position }
 func (i *IntegerLiteral) String() string {
 	return fmt.Sprintf("%d", i.Value)
 }
 
+type BigIntegerLiteral struct {
+	Position token.Position
+	Value *big.Int
+}
+func (*BigIntegerLiteral) expressionNode() {}
+func (e *BigIntegerLiteral) Pos() token.Position { return e.Position }
+func (i *BigIntegerLiteral) String() string {
+	return i.Value.String() + "n"
+}
+
 type StringLiteral struct {
+	Position token.Position
 	Value string
 }
 func (*StringLiteral) expressionNode() {}
+func (e *StringLiteral) Pos() token.Position { return e.Position }
 func (i *StringLiteral) String() string {
 	return i.Value
 }
 
+// Local is the location of a variable resolved ahead of evaluation. Depth
+// is the number of environments between the one referring to the variable
+// and the one binding it, Slot is index of the variable in the binding
+// environment or -1 for global variables looked up by name there.
+type Local struct {
+	Depth int
+	Slot  int
+}
+
 type Identifier struct {
+	Position token.Position
 	Name string
+	// Local is the location of the variable, nil when not resolved
+	Local *Local
 }
 func (*Identifier) expressionNode() {}
+func (e *Identifier) Pos() token.Position { return e.Position }
 func (i *Identifier) String() string {
 	return i.Name
 }
 
 type Boolean struct {
+	Position token.Position
 	Value bool
 }
 func (*Boolean) expressionNode() {}
+func (e *Boolean) Pos() token.Position { return e.Position }
 func (i *Boolean) String() string {
 	return strconv.FormatBool(i.Value)
 }
 
 type InfixExpression struct {
+	Position token.Position
 	Left Expression
 	Right Expression
 	Operator string
 }
 func (*InfixExpression) expressionNode() {}
+func (e *InfixExpression) Pos() token.Position { return e.Position }
 func (i *InfixExpression) String() string {
 	return fmt.Sprintf("(%s %s %s)", i.Left.String(), i.Operator, i.Right.String())
 }
 
 type PrefixExpression struct {
+	Position token.Position
 	Right Expression
 	Operator string
 }
 func (*PrefixExpression) expressionNode() {}
+func (e *PrefixExpression) Pos() token.Position { return e.Position }
 func (i *PrefixExpression) String() string {
 	return fmt.Sprintf("(%s%s)", i.Operator, i.Right.String())
 }
 
 type IfExpression struct {
+	Position token.Position
 	Condition Expression
 	Block *BlockStatement
 	Alternative *BlockStatement
 }
 func (*IfExpression) expressionNode() {}
+func (e *IfExpression) Pos() token.Position { return e.Position }
 func (i *IfExpression) String() string {
 	var buf bytes.Buffer
 	buf.WriteString(fmt.Sprintf("if(%s) {\n", i.Condition.String()))
@@ -148,23 +247,119 @@ func (i *IfExpression) String() string {
 }
 
 type FunctionLiteral struct {
+	Position token.Position
 	Params []*Identifier
+	// ParamTypes are optional type annotations of Params, they are either
+	// nil or have the same length as Params with nil for missing annotations
+	ParamTypes []*TypeAnnotation
+	// ParamPatterns destructure arguments, they are either nil or have the
+	// same length as Params with nil for plain names. Params of patterns are
+	// identifiers with empty names.
+	ParamPatterns []Pattern
+	// Defaults are values of parameters missing in calls, they are either
+	// nil or have the same length as Params with nil for required
+	// parameters. Parameters with defaults come after the required ones.
+	Defaults []Expression
+	// Variadic functions collect the remaining arguments into an array
+	// bound to the last parameter
+	Variadic bool
+	// ReturnType is the optional return type annotation
+	ReturnType *TypeAnnotation
 	Block *BlockStatement
+	// Locals are names of slots of environments of calls, nil when not
+	// resolved
+	Locals []string
 }
 func (*FunctionLiteral) expressionNode() {}
+func (e *FunctionLiteral) Pos() token.Position { return e.Position }
 func (f *FunctionLiteral) String() string {
 	var paramNames []string
-	for _, i := range f.Params {
-		paramNames = append(paramNames, i.String())
+	for i, p := range f.Params {
+		name := p.String()
+		if pattern := f.ParamPattern(i); pattern != nil {
+			name = pattern.String()
+		}
+		if f.Variadic && i == len(f.Params)-1 {
+			name = "..." + name
+		}
+		if t := f.ParamType(i); t != nil {
+			name += ": " + t.String()
+		}
+		if d := f.ParamDefault(i); d != nil {
+			name += " = " + d.String()
+		}
+		paramNames = append(paramNames, name)
+	}
+	if f.ReturnType != nil {
+		return fmt.Sprintf("fn(%s): %s{ %s }", strings.Join(paramNames, ","), f.ReturnType.String(), f.Block.String())
 	}
 	return fmt.Sprintf("fn(%s){ %s }", strings.Join(paramNames, ","), f.Block.String())
 }
 
+// ParamType returns type annotation of i-th parameter or nil
+func (f *FunctionLiteral) ParamType(i int) *TypeAnnotation {
+	if i < len(f.ParamTypes) {
+		return f.ParamTypes[i]
+	}
+	return nil
+}
+
+// ParamPattern returns pattern of i-th parameter or nil
+func (f *FunctionLiteral) ParamPattern(i int) Pattern {
+	if i < len(f.ParamPatterns) {
+		return f.ParamPatterns[i]
+	}
+	return nil
+}
+
+// ParamDefault returns default value of i-th parameter or nil
+func (f *FunctionLiteral) ParamDefault(i int) Expression {
+	if i < len(f.Defaults) {
+		return f.Defaults[i]
+	}
+	return nil
+}
+
+// Arity returns the minimal and maximal number of arguments of the
+// function, the maximum is -1 for variadic functions
+func (f *FunctionLiteral) Arity() (int, int) {
+	required := len(f.Params)
+	if f.Variadic {
+		required--
+	}
+	for required > 0 && f.ParamDefault(required-1) != nil {
+		required--
+	}
+	if f.Variadic {
+		return required, -1
+	}
+	return required, len(f.Params)
+}
+
+// MacroLiteral is a macro definition, macros are bound by top-level let
+// statements and expanded before evaluation
+type MacroLiteral struct {
+	Position token.Position
+	Params []*Identifier
+	Block *BlockStatement
+}
+func (*MacroLiteral) expressionNode() {}
+func (e *MacroLiteral) Pos() token.Position { return e.Position }
+func (m *MacroLiteral) String() string {
+	var paramNames []string
+	for _, p := range m.Params {
+		paramNames = append(paramNames, p.String())
+	}
+	return fmt.Sprintf("macro(%s){ %s }", strings.Join(paramNames, ","), m.Block.String())
+}
+
 type CallExpression struct {
+	Position token.Position
 	Function *Identifier
 	Params []Expression
 }
 func (*CallExpression) expressionNode() {}
+func (e *CallExpression) Pos() token.Position { return e.Position }
 func (f *CallExpression) String() string {
 	var paramExpressions []string
 	for _, p := range f.Params {
@@ -173,10 +368,33 @@ func (f *CallExpression) String() string {
 	return fmt.Sprintf("%s(%s)", f.Function.Name, strings.Join(paramExpressions, ", "))
 }
 
+// SpreadExpression passes elements of an array as separate arguments of a
+// call, as in f(...args)
+type SpreadExpression struct {
+	Position token.Position
+	Value Expression
+}
+func (*SpreadExpression) expressionNode() {}
+func (e *SpreadExpression) Pos() token.Position { return e.Position }
+func (e *SpreadExpression) String() string { return "..." + e.Value.String() }
+
+// NamedArgument passes the value to the parameter of the name, as in
+// f(b: 2). Named arguments follow the positional ones.
+type NamedArgument struct {
+	Position token.Position
+	Name string
+	Value Expression
+}
+func (*NamedArgument) expressionNode() {}
+func (e *NamedArgument) Pos() token.Position { return e.Position }
+func (e *NamedArgument) String() string { return e.Name + ": " + e.Value.String() }
+
 type Array struct {
+	Position token.Position
 	Items []Expression
 }
 func (*Array) expressionNode() {}
+func (e *Array) Pos() token.Position { return e.Position }
 func (a *Array) String() string {
 	var buf bytes.Buffer
 	buf.WriteString("[")
@@ -191,10 +409,84 @@ func (a *Array) String() string {
 }
 
 type IndexExpression struct {
+	Position token.Position
 	Left Expression
 	Index Expression
 }
 func (*IndexExpression) expressionNode() {}
+func (e *IndexExpression) Pos() token.Position { return e.Position }
 func (i *IndexExpression) String() string {
 	return fmt.Sprintf("(%s[%s])", i.Left.String(), i.Index.String())
-}
\ No newline at end of file
+}
+
+// TypeAnnotation is a name of a type like int or str, the names are checked
+// by the type checker, evaluation ignores annotations
+type TypeAnnotation struct {
+	Position token.Position
+	Name string
+}
+func (t *TypeAnnotation) Pos() token.Position { return t.Position }
+func (t *TypeAnnotation) String() string {
+	return t.Name
+}
+
+// HashLiteral is a hash with keys and values in the order of the source
+type HashLiteral struct {
+	Position token.Position
+	Pairs    []*HashPair
+}
+
+type HashPair struct {
+	Key   Expression
+	Value Expression
+}
+
+func (*HashLiteral) expressionNode() {}
+func (e *HashLiteral) Pos() token.Position { return e.Position }
+func (h *HashLiteral) String() string {
+	var pairs []string
+	for _, pair := range h.Pairs {
+		pairs = append(pairs, pair.Key.String()+": "+pair.Value.String())
+	}
+	return "{" + strings.Join(pairs, ", ") + "}"
+}
+
+// MatchExpression evaluates body of the first arm whose pattern matches the
+// value and whose guard, when present, is true
+type MatchExpression struct {
+	Position token.Position
+	// EndPosition is position of the closing brace
+	EndPosition token.Position
+	Value       Expression
+	Arms        []*MatchArm
+}
+
+func (*MatchExpression) expressionNode() {}
+func (e *MatchExpression) Pos() token.Position { return e.Position }
+func (m *MatchExpression) String() string {
+	var arms []string
+	for _, arm := range m.Arms {
+		arms = append(arms, arm.String())
+	}
+	return fmt.Sprintf("match(%s) { %s }", m.Value.String(), strings.Join(arms, ", "))
+}
+
+// MatchArm is a single arm of a match expression, names bound by the pattern
+// are visible only in the guard and the body
+type MatchArm struct {
+	Pattern Pattern
+	// Guard is the optional condition following if, nil when there is none
+	Guard Expression
+	Body  Expression
+	// Locals are names of slots of the environment of the arm, nil when not
+	// resolved
+	Locals []string
+}
+
+func (a *MatchArm) Pos() token.Position { return a.Pattern.Pos() }
+func (a *MatchArm) String() string {
+	if a.Guard != nil {
+		return fmt.Sprintf("%s if %s => %s", a.Pattern.String(), a.Guard.String(), a.Body.String())
+	}
+	return fmt.Sprintf("%s => %s", a.Pattern.String(), a.Body.String())
+}
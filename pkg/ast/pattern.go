@@ -0,0 +1,103 @@
+package ast
+
+import (
+	"github.com/alenkacz/interpreter-book/pkg/token"
+	"strings"
+)
+
+// Pattern is matched against a value, patterns may bind names to parts of
+// the value
+type Pattern interface {
+	Node
+	patternNode()
+}
+
+// WildcardPattern is _ matching any value without binding it
+type WildcardPattern struct {
+	Position token.Position
+}
+
+func (*WildcardPattern) patternNode()          {}
+func (p *WildcardPattern) Pos() token.Position { return p.Position }
+func (p *WildcardPattern) String() string      { return "_" }
+
+// LiteralPattern matches values equal to an integer, string or boolean
+// literal, negative integers are prefix expressions
+type LiteralPattern struct {
+	Value Expression
+}
+
+func (*LiteralPattern) patternNode()          {}
+func (p *LiteralPattern) Pos() token.Position { return p.Value.Pos() }
+func (p *LiteralPattern) String() string      { return p.Value.String() }
+
+// BindingPattern matches any value and binds it to the name
+type BindingPattern struct {
+	Position token.Position
+	Name     string
+	// Local is the slot the name is bound to, nil when not resolved
+	Local *Local
+}
+
+func (*BindingPattern) patternNode()          {}
+func (p *BindingPattern) Pos() token.Position { return p.Position }
+func (p *BindingPattern) String() string      { return p.Name }
+
+// ArrayPattern matches arrays element by element. Without Rest the array
+// must have exactly as many elements as the pattern, otherwise the remaining
+// elements are matched by Rest as an array.
+type ArrayPattern struct {
+	Position token.Position
+	Elements []Pattern
+	// Rest is the pattern following ..., nil when there is none
+	Rest Pattern
+}
+
+func (*ArrayPattern) patternNode()          {}
+func (p *ArrayPattern) Pos() token.Position { return p.Position }
+func (p *ArrayPattern) String() string {
+	var elements []string
+	for _, e := range p.Elements {
+		elements = append(elements, e.String())
+	}
+	if p.Rest != nil {
+		elements = append(elements, "..."+p.Rest.String())
+	}
+	return "[" + strings.Join(elements, ", ") + "]"
+}
+
+// HashPattern matches hashes having all keys of the pattern, other keys are
+// ignored. Keys are literals, a shorthand {name} is the key "name" bound to
+// name.
+type HashPattern struct {
+	Position token.Position
+	Pairs    []*HashPatternPair
+}
+
+type HashPatternPair struct {
+	Key   Expression
+	Value Pattern
+}
+
+func (*HashPattern) patternNode()          {}
+func (p *HashPattern) Pos() token.Position { return p.Position }
+func (p *HashPattern) String() string {
+	var pairs []string
+	for _, pair := range p.Pairs {
+		pairs = append(pairs, pair.Key.String()+": "+pair.Value.String())
+	}
+	return "{" + strings.Join(pairs, ", ") + "}"
+}
+
+// DefaultPattern is an element of an array pattern or a value of a hash
+// pattern with a default used when the element or the key is missing
+type DefaultPattern struct {
+	Pattern Pattern
+	Default Expression
+}
+
+func (*DefaultPattern) patternNode()          {}
+func (p *DefaultPattern) Pos() token.Position { return p.Pattern.Pos() }
+func (p *DefaultPattern) String() string {
+	return p.Pattern.String() + " = " + p.Default.String()
+}
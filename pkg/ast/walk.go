@@ -0,0 +1,541 @@
+package ast
+
+import "fmt"
+
+// Visitor's Visit method is invoked for each node encountered by Walk. If
+// the result visitor w is not nil, Walk visits each of the children of node
+// with the visitor w, followed by a call of w.Visit(nil).
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+// Walk traverses the AST in depth-first order.
+func Walk(v Visitor, node Node) {
+	if v = v.Visit(node); v == nil {
+		return
+	}
+
+	switch n := node.(type) {
+	case *Program:
+		for _, s := range n.Statements {
+			walkIfPresent(v, s)
+		}
+	case *LetStatement:
+		walkIfPresent(v, n.Pattern)
+		walkIfPresent(v, n.Value)
+	case *ReturnStatement:
+		walkIfPresent(v, n.ReturnValue)
+	case *ExpressionStatement:
+		walkIfPresent(v, n.Expression)
+	case *BlockStatement:
+		for _, s := range n.Statements {
+			walkIfPresent(v, s)
+		}
+	case *PrefixExpression:
+		walkIfPresent(v, n.Right)
+	case *InfixExpression:
+		walkIfPresent(v, n.Left)
+		walkIfPresent(v, n.Right)
+	case *IfExpression:
+		walkIfPresent(v, n.Condition)
+		walkIfPresent(v, n.Block)
+		walkIfPresent(v, n.Alternative)
+	case *FunctionLiteral:
+		for i, p := range n.Params {
+			walkIfPresent(v, p)
+			walkIfPresent(v, n.ParamPattern(i))
+			walkIfPresent(v, n.ParamDefault(i))
+		}
+		walkIfPresent(v, n.Block)
+	case *MacroLiteral:
+		for _, p := range n.Params {
+			walkIfPresent(v, p)
+		}
+		walkIfPresent(v, n.Block)
+	case *CallExpression:
+		walkIfPresent(v, n.Function)
+		for _, p := range n.Params {
+			walkIfPresent(v, p)
+		}
+	case *SpreadExpression:
+		walkIfPresent(v, n.Value)
+	case *NamedArgument:
+		walkIfPresent(v, n.Value)
+	case *Array:
+		for _, item := range n.Items {
+			walkIfPresent(v, item)
+		}
+	case *IndexExpression:
+		walkIfPresent(v, n.Left)
+		walkIfPresent(v, n.Index)
+	case *HashLiteral:
+		for _, pair := range n.Pairs {
+			walkIfPresent(v, pair.Key)
+			walkIfPresent(v, pair.Value)
+		}
+	case *MatchExpression:
+		walkIfPresent(v, n.Value)
+		for _, arm := range n.Arms {
+			walkIfPresent(v, arm)
+		}
+	case *MatchArm:
+		walkIfPresent(v, n.Pattern)
+		walkIfPresent(v, n.Guard)
+		walkIfPresent(v, n.Body)
+	case *LiteralPattern:
+		walkIfPresent(v, n.Value)
+	case *ArrayPattern:
+		for _, e := range n.Elements {
+			walkIfPresent(v, e)
+		}
+		walkIfPresent(v, n.Rest)
+	case *HashPattern:
+		for _, pair := range n.Pairs {
+			walkIfPresent(v, pair.Key)
+			walkIfPresent(v, pair.Value)
+		}
+	case *DefaultPattern:
+		walkIfPresent(v, n.Pattern)
+		walkIfPresent(v, n.Default)
+	case *IntegerLiteral, *BigIntegerLiteral, *StringLiteral, *Boolean, *Identifier, *Comment, *TypeAnnotation,
+		*WildcardPattern, *BindingPattern:
+		// leaves
+	default:
+		panic(fmt.Sprintf("ast.Walk: unexpected node type %T", n))
+	}
+
+	v.Visit(nil)
+}
+
+// walkIfPresent skips children missing because of parse errors, including
+// typed nil pointers
+func walkIfPresent(v Visitor, node Node) {
+	if !isNil(node) {
+		Walk(v, node)
+	}
+}
+
+func isNil(node Node) bool {
+	switch n := node.(type) {
+	case nil:
+		return true
+	case *BlockStatement:
+		return n == nil
+	case *Identifier:
+		return n == nil
+	case *MatchArm:
+		return n == nil
+	}
+	return false
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// Inspect traverses the AST in depth-first order calling f for each node
+// followed by f(nil) once its children are visited. Children of the node are
+// skipped when f returns false.
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
+
+// ModifierFunc returns replacement of the node, returning the node itself
+// keeps it unchanged.
+type ModifierFunc func(Node) Node
+
+// Modify rewrites the AST bottom-up, children of the node are modified before
+// modifier is applied to the node itself. Nodes are modified in place, the
+// returned node is the replacement of the root.
+func Modify(node Node, modifier ModifierFunc) Node {
+	switch n := node.(type) {
+	case *Program:
+		for i, s := range n.Statements {
+			n.Statements[i] = modifyStatement(s, modifier)
+		}
+	case *LetStatement:
+		n.Pattern = modifyPattern(n.Pattern, modifier)
+		n.Value = modifyExpression(n.Value, modifier)
+	case *ReturnStatement:
+		n.ReturnValue = modifyExpression(n.ReturnValue, modifier)
+	case *ExpressionStatement:
+		n.Expression = modifyExpression(n.Expression, modifier)
+	case *BlockStatement:
+		for i, s := range n.Statements {
+			n.Statements[i] = modifyStatement(s, modifier)
+		}
+	case *PrefixExpression:
+		n.Right = modifyExpression(n.Right, modifier)
+	case *InfixExpression:
+		n.Left = modifyExpression(n.Left, modifier)
+		n.Right = modifyExpression(n.Right, modifier)
+	case *IfExpression:
+		n.Condition = modifyExpression(n.Condition, modifier)
+		n.Block = modifyBlock(n.Block, modifier)
+		n.Alternative = modifyBlock(n.Alternative, modifier)
+	case *FunctionLiteral:
+		for i, p := range n.Params {
+			n.Params[i] = modifyIdentifier(p, modifier)
+		}
+		for i, p := range n.ParamPatterns {
+			n.ParamPatterns[i] = modifyPattern(p, modifier)
+		}
+		for i, d := range n.Defaults {
+			n.Defaults[i] = modifyExpression(d, modifier)
+		}
+		n.Block = modifyBlock(n.Block, modifier)
+	case *MacroLiteral:
+		for i, p := range n.Params {
+			n.Params[i] = modifyIdentifier(p, modifier)
+		}
+		n.Block = modifyBlock(n.Block, modifier)
+	case *CallExpression:
+		n.Function = modifyIdentifier(n.Function, modifier)
+		for i, p := range n.Params {
+			n.Params[i] = modifyExpression(p, modifier)
+		}
+	case *SpreadExpression:
+		n.Value = modifyExpression(n.Value, modifier)
+	case *NamedArgument:
+		n.Value = modifyExpression(n.Value, modifier)
+	case *Array:
+		for i, item := range n.Items {
+			n.Items[i] = modifyExpression(item, modifier)
+		}
+	case *IndexExpression:
+		n.Left = modifyExpression(n.Left, modifier)
+		n.Index = modifyExpression(n.Index, modifier)
+	case *HashLiteral:
+		for _, pair := range n.Pairs {
+			pair.Key = modifyExpression(pair.Key, modifier)
+			pair.Value = modifyExpression(pair.Value, modifier)
+		}
+	case *MatchExpression:
+		n.Value = modifyExpression(n.Value, modifier)
+		for i, arm := range n.Arms {
+			if arm == nil {
+				continue
+			}
+			modified, ok := Modify(arm, modifier).(*MatchArm)
+			if !ok {
+				panic(fmt.Sprintf("ast.Modify: %T cannot replace match arm", modified))
+			}
+			n.Arms[i] = modified
+		}
+	case *MatchArm:
+		n.Pattern = modifyPattern(n.Pattern, modifier)
+		n.Guard = modifyExpression(n.Guard, modifier)
+		n.Body = modifyExpression(n.Body, modifier)
+	case *LiteralPattern:
+		n.Value = modifyExpression(n.Value, modifier)
+	case *ArrayPattern:
+		for i, e := range n.Elements {
+			n.Elements[i] = modifyPattern(e, modifier)
+		}
+		n.Rest = modifyPattern(n.Rest, modifier)
+	case *HashPattern:
+		for _, pair := range n.Pairs {
+			pair.Key = modifyExpression(pair.Key, modifier)
+			pair.Value = modifyPattern(pair.Value, modifier)
+		}
+	case *DefaultPattern:
+		n.Pattern = modifyPattern(n.Pattern, modifier)
+		n.Default = modifyExpression(n.Default, modifier)
+	}
+
+	return modifier(node)
+}
+
+func modifyStatement(s Statement, modifier ModifierFunc) Statement {
+	if s == nil {
+		return nil
+	}
+	modified, ok := Modify(s, modifier).(Statement)
+	if !ok {
+		panic(fmt.Sprintf("ast.Modify: %T cannot replace statement %T", modified, s))
+	}
+	return modified
+}
+
+func modifyExpression(e Expression, modifier ModifierFunc) Expression {
+	if e == nil {
+		return nil
+	}
+	modified, ok := Modify(e, modifier).(Expression)
+	if !ok {
+		panic(fmt.Sprintf("ast.Modify: %T cannot replace expression %T", modified, e))
+	}
+	return modified
+}
+
+func modifyPattern(p Pattern, modifier ModifierFunc) Pattern {
+	if p == nil {
+		return nil
+	}
+	modified, ok := Modify(p, modifier).(Pattern)
+	if !ok {
+		panic(fmt.Sprintf("ast.Modify: %T cannot replace pattern %T", modified, p))
+	}
+	return modified
+}
+
+func modifyBlock(b *BlockStatement, modifier ModifierFunc) *BlockStatement {
+	if b == nil {
+		return nil
+	}
+	modified, ok := Modify(b, modifier).(*BlockStatement)
+	if !ok {
+		panic(fmt.Sprintf("ast.Modify: %T cannot replace block statement", modified))
+	}
+	return modified
+}
+
+func modifyIdentifier(i *Identifier, modifier ModifierFunc) *Identifier {
+	if i == nil {
+		return nil
+	}
+	modified, ok := Modify(i, modifier).(*Identifier)
+	if !ok {
+		panic(fmt.Sprintf("ast.Modify: %T cannot replace identifier", modified))
+	}
+	return modified
+}
+
+// Copy returns a deep copy of the node, so the copy can be modified without
+// changing the original. Tokens of let statements and values of big integer
+// literals are shared as they are never modified.
+func Copy(node Node) Node {
+	switch n := node.(type) {
+	case *Program:
+		c := *n
+		c.Statements = copyStatements(n.Statements)
+		c.Comments = nil
+		for _, comment := range n.Comments {
+			c.Comments = append(c.Comments, Copy(comment).(*Comment))
+		}
+		return &c
+	case *LetStatement:
+		c := *n
+		c.Pattern = copyPattern(n.Pattern)
+		if n.Type != nil {
+			c.Type = Copy(n.Type).(*TypeAnnotation)
+		}
+		c.Value = copyExpression(n.Value)
+		return &c
+	case *ReturnStatement:
+		c := *n
+		c.ReturnValue = copyExpression(n.ReturnValue)
+		return &c
+	case *ExpressionStatement:
+		c := *n
+		c.Expression = copyExpression(n.Expression)
+		return &c
+	case *BlockStatement:
+		c := *n
+		c.Statements = copyStatements(n.Statements)
+		return &c
+	case *PrefixExpression:
+		c := *n
+		c.Right = copyExpression(n.Right)
+		return &c
+	case *InfixExpression:
+		c := *n
+		c.Left = copyExpression(n.Left)
+		c.Right = copyExpression(n.Right)
+		return &c
+	case *IfExpression:
+		c := *n
+		c.Condition = copyExpression(n.Condition)
+		c.Block = copyBlock(n.Block)
+		c.Alternative = copyBlock(n.Alternative)
+		return &c
+	case *FunctionLiteral:
+		c := *n
+		c.Params = copyIdentifiers(n.Params)
+		c.ParamTypes = nil
+		for _, t := range n.ParamTypes {
+			if t != nil {
+				t = Copy(t).(*TypeAnnotation)
+			}
+			c.ParamTypes = append(c.ParamTypes, t)
+		}
+		c.ParamPatterns = nil
+		for _, p := range n.ParamPatterns {
+			c.ParamPatterns = append(c.ParamPatterns, copyPattern(p))
+		}
+		c.Defaults = copyExpressions(n.Defaults)
+		if n.ReturnType != nil {
+			c.ReturnType = Copy(n.ReturnType).(*TypeAnnotation)
+		}
+		c.Block = copyBlock(n.Block)
+		return &c
+	case *MacroLiteral:
+		c := *n
+		c.Params = copyIdentifiers(n.Params)
+		c.Block = copyBlock(n.Block)
+		return &c
+	case *CallExpression:
+		c := *n
+		if n.Function != nil {
+			c.Function = Copy(n.Function).(*Identifier)
+		}
+		c.Params = copyExpressions(n.Params)
+		return &c
+	case *SpreadExpression:
+		c := *n
+		c.Value = copyExpression(n.Value)
+		return &c
+	case *NamedArgument:
+		c := *n
+		c.Value = copyExpression(n.Value)
+		return &c
+	case *Array:
+		c := *n
+		c.Items = copyExpressions(n.Items)
+		return &c
+	case *IndexExpression:
+		c := *n
+		c.Left = copyExpression(n.Left)
+		c.Index = copyExpression(n.Index)
+		return &c
+	case *HashLiteral:
+		c := *n
+		c.Pairs = nil
+		for _, pair := range n.Pairs {
+			c.Pairs = append(c.Pairs, &HashPair{Key: copyExpression(pair.Key), Value: copyExpression(pair.Value)})
+		}
+		return &c
+	case *MatchExpression:
+		c := *n
+		c.Value = copyExpression(n.Value)
+		c.Arms = nil
+		for _, arm := range n.Arms {
+			if arm != nil {
+				arm = Copy(arm).(*MatchArm)
+			}
+			c.Arms = append(c.Arms, arm)
+		}
+		return &c
+	case *MatchArm:
+		c := *n
+		c.Pattern = copyPattern(n.Pattern)
+		c.Guard = copyExpression(n.Guard)
+		c.Body = copyExpression(n.Body)
+		return &c
+	case *WildcardPattern:
+		c := *n
+		return &c
+	case *LiteralPattern:
+		c := *n
+		c.Value = copyExpression(n.Value)
+		return &c
+	case *BindingPattern:
+		c := *n
+		return &c
+	case *ArrayPattern:
+		c := *n
+		c.Elements = nil
+		for _, e := range n.Elements {
+			c.Elements = append(c.Elements, copyPattern(e))
+		}
+		c.Rest = copyPattern(n.Rest)
+		return &c
+	case *HashPattern:
+		c := *n
+		c.Pairs = nil
+		for _, pair := range n.Pairs {
+			c.Pairs = append(c.Pairs, &HashPatternPair{Key: copyExpression(pair.Key), Value: copyPattern(pair.Value)})
+		}
+		return &c
+	case *DefaultPattern:
+		c := *n
+		c.Pattern = copyPattern(n.Pattern)
+		c.Default = copyExpression(n.Default)
+		return &c
+	case *IntegerLiteral:
+		c := *n
+		return &c
+	case *BigIntegerLiteral:
+		c := *n
+		return &c
+	case *StringLiteral:
+		c := *n
+		return &c
+	case *Boolean:
+		c := *n
+		return &c
+	case *Identifier:
+		c := *n
+		return &c
+	case *Comment:
+		c := *n
+		return &c
+	case *TypeAnnotation:
+		c := *n
+		return &c
+	}
+	panic(fmt.Sprintf("ast.Copy: unexpected node type %T", node))
+}
+
+func copyStatements(statements []Statement) []Statement {
+	if statements == nil {
+		return nil
+	}
+	result := make([]Statement, len(statements))
+	for i, s := range statements {
+		if s != nil {
+			result[i] = Copy(s).(Statement)
+		}
+	}
+	return result
+}
+
+func copyExpressions(expressions []Expression) []Expression {
+	if expressions == nil {
+		return nil
+	}
+	result := make([]Expression, len(expressions))
+	for i, e := range expressions {
+		result[i] = copyExpression(e)
+	}
+	return result
+}
+
+func copyExpression(e Expression) Expression {
+	if e == nil {
+		return nil
+	}
+	return Copy(e).(Expression)
+}
+
+func copyPattern(p Pattern) Pattern {
+	if p == nil {
+		return nil
+	}
+	return Copy(p).(Pattern)
+}
+
+func copyBlock(b *BlockStatement) *BlockStatement {
+	if b == nil {
+		return nil
+	}
+	return Copy(b).(*BlockStatement)
+}
+
+func copyIdentifiers(identifiers []*Identifier) []*Identifier {
+	if identifiers == nil {
+		return nil
+	}
+	result := make([]*Identifier, len(identifiers))
+	for i, identifier := range identifiers {
+		if identifier != nil {
+			result[i] = Copy(identifier).(*Identifier)
+		}
+	}
+	return result
+}
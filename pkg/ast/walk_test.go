@@ -0,0 +1,130 @@
+package ast_test
+
+import (
+	"fmt"
+	"github.com/alenkacz/interpreter-book/pkg/ast"
+	"github.com/alenkacz/interpreter-book/pkg/parser"
+	"github.com/alenkacz/interpreter-book/pkg/tokenizer"
+	"strings"
+	"testing"
+)
+
+func parse(t *testing.T, input string) *ast.Program {
+	p := parser.New(tokenizer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors) != 0 {
+		t.Fatalf("%q: parser errors %v", input, p.Errors)
+	}
+	return program
+}
+
+func TestInspect(t *testing.T) {
+	program := parse(t, `let f = fn(a) { if (a > 1) { [a][0] } else { -a } }; f(2);`)
+
+	var visited []string
+	ast.Inspect(program, func(node ast.Node) bool {
+		if node != nil {
+			visited = append(visited, strings.TrimPrefix(fmt.Sprintf("%T", node), "*ast."))
+		}
+		return true
+	})
+
+	expected := "Program LetStatement FunctionLiteral Identifier BlockStatement ExpressionStatement " +
+		"IfExpression InfixExpression Identifier IntegerLiteral BlockStatement ExpressionStatement " +
+		"IndexExpression Array Identifier IntegerLiteral BlockStatement ExpressionStatement " +
+		"PrefixExpression Identifier ExpressionStatement CallExpression Identifier IntegerLiteral"
+	if strings.Join(visited, " ") != expected {
+		t.Errorf("unexpected traversal.\nexpected=%s\ngot=     %s", expected, strings.Join(visited, " "))
+	}
+}
+
+func TestInspectSkipsChildren(t *testing.T) {
+	program := parse(t, `let f = fn(a) { a + 1 }; f(1) + 2;`)
+
+	count := 0
+	ast.Inspect(program, func(node ast.Node) bool {
+		if _, ok := node.(*ast.FunctionLiteral); ok {
+			return false
+		}
+		if _, ok := node.(*ast.IntegerLiteral); ok {
+			count++
+		}
+		return true
+	})
+	if count != 2 {
+		t.Errorf("expected 2 integers outside of function literal, got %d", count)
+	}
+}
+
+func TestModify(t *testing.T) {
+	turnOneIntoTwo := func(node ast.Node) ast.Node {
+		integer, ok := node.(*ast.IntegerLiteral)
+		if !ok || integer.Value != 1 {
+			return node
+		}
+		return &ast.IntegerLiteral{Position: integer.Position, Value: 2}
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1;", "2"},
+		{"1 + 3;", "(2 + 3)"},
+		{"-1;", "(-2)"},
+		{"[1, 1][1];", "([2, 2][2])"},
+		{"let a = 1;", "let a = 2;"},
+		{"return 1;", "return 2;"},
+		{"if (1) { 1 } else { 1 }", "if(2) {\n2} else {\n2}\n"},
+		{"fn(a) { 1 }", "fn(a){ 2 }"},
+		{"macro(a) { 1 }", "macro(a){ 2 }"},
+		{"f(1, a);", "f(2, a)"},
+	}
+	for _, tt := range tests {
+		modified := ast.Modify(parse(t, tt.input), turnOneIntoTwo)
+		if modified.String() != tt.expected {
+			t.Errorf("%q: expected=%q, got=%q", tt.input, tt.expected, modified.String())
+		}
+	}
+}
+
+func TestModifyReplacesIdentifiers(t *testing.T) {
+	rename := func(node ast.Node) ast.Node {
+		if ident, ok := node.(*ast.Identifier); ok && ident.Name == "a" {
+			return &ast.Identifier{Position: ident.Position, Name: "b"}
+		}
+		return node
+	}
+	modified := ast.Modify(parse(t, "let f = fn(a) { a(a) };"), rename)
+	if modified.String() != "let f = fn(b){ b(b) };" {
+		t.Errorf("unexpected result %q", modified.String())
+	}
+}
+
+func TestCopy(t *testing.T) {
+	inputs := []string{
+		`let f = fn(a: int): int { if (a > 1) { [a][0] } else { -a } }; f(2);`,
+		`let m = macro(a) { quote(unquote(a) + 1) }; return 18446744073709551616n; "s" // comment`,
+		`let [a, {b = c}, ...d] = e; let f = fn([g], {h: i = j}) { g };`,
+		`let f = fn(a, b: int = a + 1, ...c) { g(a, ...c) };`,
+		`match ({"a": [b]}) { -1 => c, [d, ...e] if d > f => {g: e}, {"a": [h]} => h, _ => i }`,
+	}
+	for _, input := range inputs {
+		program := parse(t, input)
+		original := program.String()
+		copied := ast.Copy(program)
+		if copied.String() != original {
+			t.Errorf("%q: copy differs, expected=%q, got=%q", input, original, copied.String())
+		}
+
+		ast.Modify(copied, func(node ast.Node) ast.Node {
+			if ident, ok := node.(*ast.Identifier); ok {
+				return &ast.Identifier{Position: ident.Position, Name: "x"}
+			}
+			return node
+		})
+		if program.String() != original {
+			t.Errorf("%q: modification of the copy changed the original to %q", input, program.String())
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package compiled
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/alenkacz/interpreter-book/pkg/ast"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// Cache stores compiled programs in a directory, the files are named by
+// hash of the source so that changed sources are compiled again
+type Cache struct {
+	Dir string
+}
+
+// DefaultCache returns the cache in the cache directory of the user
+func DefaultCache() (*Cache, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return nil, err
+	}
+	return &Cache{Dir: filepath.Join(dir, "monkey")}, nil
+}
+
+// Path returns the file of the compiled source
+func (c *Cache) Path(source string) string {
+	hash := sha256.Sum256([]byte(strconv.Itoa(Version) + "\x00" + source))
+	return filepath.Join(c.Dir, hex.EncodeToString(hash[:])+Extension)
+}
+
+// Load returns the compiled source from the cache, the source is compiled
+// and stored when it is not cached. Failures to store the program are
+// ignored, the program is just compiled again next time.
+func (c *Cache) Load(source string) (*ast.Program, error) {
+	path := c.Path(source)
+	if data, err := ioutil.ReadFile(path); err == nil {
+		if program, err := Decode(data); err == nil {
+			return program, nil
+		}
+	}
+
+	program, err := Compile(source)
+	if err != nil {
+		return nil, err
+	}
+	c.store(path, Encode(program))
+	return program, nil
+}
+
+// store writes the file through a temporary file, so that other processes
+// never read partially written programs
+func (c *Cache) store(path string, data []byte) error {
+	if err := os.MkdirAll(c.Dir, 0755); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(c.Dir, "tmp-*")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
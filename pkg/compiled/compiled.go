@@ -0,0 +1,137 @@
+// Package compiled stores programs in a binary format, so that they can be
+// loaded without parsing, macro expansion, optimisation and resolution.
+//
+// A compiled program starts with the Magic bytes and the format Version
+// followed by the constant pool and the main chunk. Chunks are the code of
+// the top-level and of each function literal, functions are stored in the
+// pool and referred to by their index. A chunk consists of instructions and
+// a line table. Instructions are the nodes of the syntax tree in pre-order,
+// an opcode followed by operands and child instructions. The line table
+// holds positions of the nodes in the same order, lines are stored as
+// differences from the previous position. Integers are encoded as varints,
+// comments of the source are not kept.
+package compiled
+
+import (
+	"errors"
+	"fmt"
+	"github.com/alenkacz/interpreter-book/pkg/ast"
+	"github.com/alenkacz/interpreter-book/pkg/eval"
+	"github.com/alenkacz/interpreter-book/pkg/optimize"
+	"github.com/alenkacz/interpreter-book/pkg/parser"
+	"github.com/alenkacz/interpreter-book/pkg/tokenizer"
+	"strings"
+)
+
+// Magic are the first bytes of compiled programs
+const Magic = "\x00mkc"
+
+// Version of the format, programs of other versions cannot be loaded
+const Version = 2
+
+// Extension is the file extension of compiled programs
+const Extension = ".mkc"
+
+type opcode byte
+
+const (
+	opNil opcode = iota
+	opLet
+	opReturn
+	opExpression
+	opBlock
+	opInteger
+	opBigInt
+	opString
+	opTrue
+	opFalse
+	opIdentifier
+	opPrefix
+	opInfix
+	opIf
+	opFunction
+	opMacro
+	opCall
+	opSpread
+	opNamed
+	opArray
+	opIndex
+	opHash
+	opMatch
+	opType
+	opWildcardPattern
+	opLiteralPattern
+	opBindingPattern
+	opArrayPattern
+	opHashPattern
+	opDefaultPattern
+)
+
+var opcodeNames = [...]string{
+	opNil:             "NIL",
+	opLet:             "LET",
+	opReturn:          "RETURN",
+	opExpression:      "EXPRESSION",
+	opBlock:           "BLOCK",
+	opInteger:         "INTEGER",
+	opBigInt:          "BIGINT",
+	opString:          "STRING",
+	opTrue:            "TRUE",
+	opFalse:           "FALSE",
+	opIdentifier:      "IDENTIFIER",
+	opPrefix:          "PREFIX",
+	opInfix:           "INFIX",
+	opIf:              "IF",
+	opFunction:        "FUNCTION",
+	opMacro:           "MACRO",
+	opCall:            "CALL",
+	opSpread:          "SPREAD",
+	opNamed:           "NAMED",
+	opArray:           "ARRAY",
+	opIndex:           "INDEX",
+	opHash:            "HASH",
+	opMatch:           "MATCH",
+	opType:            "TYPE",
+	opWildcardPattern: "WILDCARD",
+	opLiteralPattern:  "LITERAL",
+	opBindingPattern:  "BINDING",
+	opArrayPattern:    "ARRAY_PATTERN",
+	opHashPattern:     "HASH_PATTERN",
+	opDefaultPattern:  "DEFAULT",
+}
+
+func (op opcode) String() string {
+	if int(op) < len(opcodeNames) {
+		return opcodeNames[op]
+	}
+	return fmt.Sprintf("OPCODE(%d)", op)
+}
+
+// kinds of constants
+const (
+	constString byte = iota
+	constBigInt
+	constFunction
+)
+
+// Compile parses the source, expands its macros, optimises it and resolves
+// its names
+func Compile(source string) (*ast.Program, error) {
+	p := parser.New(tokenizer.New(source))
+	program := p.ParseProgram()
+	if len(p.Errors) != 0 {
+		var messages []string
+		for i, e := range p.Errors {
+			messages = append(messages, fmt.Sprintf("%s: %s", p.ErrorPositions[i], e))
+		}
+		return nil, errors.New(strings.Join(messages, "\n"))
+	}
+	if err := eval.Expand(program); err != nil {
+		return nil, err
+	}
+	optimize.Program(program)
+	if err := eval.Resolve(program, nil); err != nil {
+		return nil, err
+	}
+	return program, nil
+}
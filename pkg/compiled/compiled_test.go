@@ -0,0 +1,222 @@
+package compiled
+
+import (
+	"fmt"
+	"github.com/alenkacz/interpreter-book/pkg/ast"
+	"github.com/alenkacz/interpreter-book/pkg/eval"
+	"github.com/alenkacz/interpreter-book/pkg/object"
+	"github.com/alenkacz/interpreter-book/pkg/parser"
+	"github.com/alenkacz/interpreter-book/pkg/tokenizer"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+const source = `let unless = macro(c, body) { quote(if (!unquote(c)) { unquote(body) }) };
+let limit: int = 10;
+let big = 100000000000000000000;
+let f = fn(a: int, [b, c] = [a, 2], ...d): array {
+  let g = fn(x) {
+    x + a
+  };
+  match (d) {
+    [x, ...y] if x > 0 => [g(b), c, x, y],
+    {"k": v} => v,
+    _ => unless(false, -a)
+  }
+};
+let {"n": n = "none"} = {};
+[f(1), f(1, [3, 4], 5, 6), f(2, [0, 0], {"k": "v"}), f(a: 3), n, big, quote(limit + unquote(limit)), "a" == "a"]`
+
+func describe(program *ast.Program) []string {
+	var nodes []string
+	ast.Inspect(program, func(node ast.Node) bool {
+		if node == nil {
+			return false
+		}
+		d := fmt.Sprintf("%T %s", node, node.Pos())
+		switch node := node.(type) {
+		case *ast.Identifier:
+			d += fmt.Sprintf(" %v", node.Local)
+		case *ast.LetStatement:
+			d += fmt.Sprintf(" %v %s", node.Local, node.EndPosition)
+		case *ast.BindingPattern:
+			d += fmt.Sprintf(" %v", node.Local)
+		case *ast.FunctionLiteral:
+			d += fmt.Sprintf(" %q", node.Locals)
+		case *ast.MatchArm:
+			d += fmt.Sprintf(" %q", node.Locals)
+		}
+		nodes = append(nodes, d)
+		return true
+	})
+	return nodes
+}
+
+func TestRoundTrip(t *testing.T) {
+	program, err := Compile(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := Decode(Encode(program))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if loaded.String() != program.String() {
+		t.Errorf("unexpected program.\nexpected=%s\ngot=     %s", program.String(), loaded.String())
+	}
+	expected, actual := describe(program), describe(loaded)
+	if strings.Join(actual, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("unexpected nodes.\nexpected=%s\ngot=     %s", expected, actual)
+	}
+	result := eval.Eval(loaded, object.NewEnvironment(nil)).Print()
+	if expected := eval.Eval(program, object.NewEnvironment(nil)).Print(); result != expected {
+		t.Errorf("expected %s, got %s", expected, result)
+	}
+}
+
+func TestCheckOverflow(t *testing.T) {
+	program, err := Compile("let max = 9223372036854775807; [max + 1, 2 * 9223372036854775807]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	in := eval.New()
+	in.CheckOverflow = true
+	expected := "integer overflow: 9223372036854775807 + 1"
+	if result := in.Eval(program, object.NewEnvironment(nil)).Print(); result != expected {
+		t.Errorf("expected %s, got %s", expected, result)
+	}
+	expected = "[9223372036854775808, 18446744073709551614]"
+	if result := eval.Eval(program, object.NewEnvironment(nil)).Print(); result != expected {
+		t.Errorf("expected %s, got %s", expected, result)
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x 2;", "1:7: expected next token to be =, got int instead"},
+		{"let m = macro(a) { 1 }; m(1)", "1:25: macro m must return a quote, got INTEGER"},
+		{"let f = fn() { g() };", "1:16: identifier not found: g"},
+	}
+	for _, tt := range tests {
+		_, err := Compile(tt.input)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("%q: expected error %q, got %v", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	program, err := Compile(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := Encode(program)
+	newer := append([]byte(Magic), Version+1)
+
+	tests := []struct {
+		name     string
+		data     []byte
+		expected string
+	}{
+		{"empty", nil, "not a compiled program"},
+		{"magic", []byte("let x = 1;"), "not a compiled program"},
+		{"version", append(newer, data[len(newer):]...), "unsupported version of compiled program 3, expected 2"},
+		{"truncated", data[:len(data)-1], "invalid compiled program: truncated data"},
+		{"trailing", append(data[:len(data):len(data)], 0), "invalid compiled program: unexpected data after the main chunk"},
+	}
+	for _, tt := range tests {
+		_, err := Decode(tt.data)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("%s: expected error %q, got %v", tt.name, tt.expected, err)
+		}
+	}
+
+	// no prefix of the program may be loaded or crash the decoder
+	for i := range data {
+		if _, err := Decode(data[:i]); err == nil {
+			t.Errorf("prefix of %d bytes was loaded", i)
+		}
+	}
+}
+
+func TestCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cache := &Cache{Dir: dir}
+
+	if _, err := cache.Load("let x = ;"); err == nil {
+		t.Errorf("expected error of invalid source")
+	}
+	program, err := cache.Load("let x = 1; x + 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if program.String() != "let x = 1;2" {
+		t.Errorf("unexpected program %s", program.String())
+	}
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != 1 || files[0].Name() != strings.TrimPrefix(cache.Path("let x = 1; x + 1"), dir+string(os.PathSeparator)) {
+		t.Fatalf("unexpected files in cache %v", files)
+	}
+
+	// the cached program is loaded instead of the source
+	other, _ := Compile("2")
+	if err := ioutil.WriteFile(cache.Path("let x = 1; x + 1"), Encode(other), 0644); err != nil {
+		t.Fatal(err)
+	}
+	program, err = cache.Load("let x = 1; x + 1")
+	if err != nil || program.String() != "2" {
+		t.Errorf("expected cached program, got %v %v", program, err)
+	}
+
+	// broken files are replaced
+	ioutil.WriteFile(cache.Path("3"), []byte(Magic), 0644)
+	if program, err := cache.Load("3"); err != nil || program.String() != "3" {
+		t.Errorf("expected compiled program, got %v %v", program, err)
+	}
+	if data, _ := ioutil.ReadFile(cache.Path("3")); len(data) == len(Magic) {
+		t.Errorf("broken file was not replaced")
+	}
+}
+
+// BenchmarkOptimize compares evaluation of a compiled program with the same
+// program compiled without optimisations
+func BenchmarkOptimize(b *testing.B) {
+	input := `let day = 60 * 60 * 24;
+let week = 7 * day;
+let sum = fn(n, total) {
+  if (n == 0) { total } else { sum(n - 1, total + n * (week / day) - 2 * 3) }
+};
+sum(200, 0)`
+	optimized, err := Compile(input)
+	if err != nil {
+		b.Fatal(err)
+	}
+	plain := parser.New(tokenizer.New(input)).ParseProgram()
+	if err := eval.Resolve(plain, nil); err != nil {
+		b.Fatal(err)
+	}
+	if result, expected := eval.Eval(optimized, object.NewEnvironment(nil)).Print(), eval.Eval(plain, object.NewEnvironment(nil)).Print(); result != expected {
+		b.Fatalf("expected %s, got %s", expected, result)
+	}
+
+	for _, bb := range []struct {
+		name    string
+		program *ast.Program
+	}{{"plain", plain}, {"optimized", optimized}} {
+		b.Run(bb.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				eval.Eval(bb.program, object.NewEnvironment(nil))
+			}
+		})
+	}
+}
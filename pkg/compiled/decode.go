@@ -0,0 +1,518 @@
+package compiled
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/alenkacz/interpreter-book/pkg/ast"
+	"github.com/alenkacz/interpreter-book/pkg/token"
+	"io"
+	"math/big"
+)
+
+// ErrVersion is returned when loading a program compiled by another version
+// of the format
+var ErrVersion = errors.New("unsupported version of compiled program")
+
+type constant struct {
+	kind  byte
+	value string
+	// chunk of functions
+	chunk *chunkDecoder
+}
+
+// decodeError is raised by panic on malformed input and recovered by Decode
+type decodeError struct {
+	err error
+}
+
+// Decode loads the program encoded by Encode
+func Decode(data []byte) (program *ast.Program, err error) {
+	defer recoverError(&err)
+	_, main := readProgram(data)
+	return main.program(), nil
+}
+
+// recoverError sets the error raised by fail
+func recoverError(err *error) {
+	if r := recover(); r != nil {
+		e, ok := r.(decodeError)
+		if !ok {
+			panic(r)
+		}
+		*err = e.err
+	}
+}
+
+// readProgram checks the header and returns the constant pool and the main
+// chunk, chunks of functions are decoded when they are referenced
+func readProgram(data []byte) ([]constant, *chunkDecoder) {
+	r := bytes.NewReader(data)
+	magic := make([]byte, len(Magic))
+	if _, err := io.ReadFull(r, magic); err != nil || string(magic) != Magic {
+		panic(decodeError{errors.New("not a compiled program")})
+	}
+	if version := readUint(r); version != Version {
+		panic(decodeError{fmt.Errorf("%w %d, expected %d", ErrVersion, version, Version)})
+	}
+	constants := make([]constant, readCount(r))
+	for i := range constants {
+		constants[i].kind = readByte(r)
+		switch constants[i].kind {
+		case constString, constBigInt:
+			constants[i].value = readString(r)
+		case constFunction:
+			constants[i].chunk = readChunk(r, constants)
+		default:
+			fail("unknown kind of constant %d", constants[i].kind)
+		}
+	}
+	main := readChunk(r, constants)
+	if r.Len() != 0 {
+		fail("unexpected data after the main chunk")
+	}
+	return constants, main
+}
+
+func fail(format string, args ...interface{}) {
+	panic(decodeError{fmt.Errorf("invalid compiled program: "+format, args...)})
+}
+
+// chunkDecoder reads instructions and line table of a chunk
+type chunkDecoder struct {
+	constants []constant
+	code      *bytes.Reader
+	lines     *bytes.Reader
+	line      int
+	// list receives the instructions as they are read when disassembling
+	list  *listing
+	depth int
+	// label of the next instruction in the listing
+	label string
+}
+
+func readChunk(r *bytes.Reader, constants []constant) *chunkDecoder {
+	code := readBytes(r)
+	lines := readBytes(r)
+	return &chunkDecoder{constants: constants, code: bytes.NewReader(code), lines: bytes.NewReader(lines), line: 1}
+}
+
+// op reads the opcode of the next instruction, absent nodes are not listed
+func (c *chunkDecoder) op() opcode {
+	offset := c.offset()
+	op := opcode(readByte(c.code))
+	label := c.label
+	c.label = ""
+	if c.list != nil && op != opNil {
+		name := op.String()
+		if label != "" {
+			name = label + ": " + name
+		}
+		c.list.instruction(offset, c.depth, name)
+	}
+	return op
+}
+
+// part reads a part of the instruction which is not an instruction itself,
+// e.g. a parameter of a function, it is listed on its own line with the
+// nodes read by read nested under it
+func (c *chunkDecoder) part(name string, read func()) {
+	if c.list != nil {
+		c.list.instruction(c.offset(), c.depth+1, name)
+	}
+	c.depth++
+	read()
+	c.depth--
+	if c.list != nil {
+		c.list.end(c.depth)
+	}
+}
+
+// labelled sets the label of the next instruction, it is used for optional
+// nodes which are told apart by their position
+func (c *chunkDecoder) labelled(label string) *chunkDecoder {
+	c.label = label
+	return c
+}
+
+// offset returns offset of the next instruction in the chunk
+func (c *chunkDecoder) offset() int {
+	return int(c.code.Size()) - c.code.Len()
+}
+
+// begin lists the header of the chunk, which is read before instructions
+func (c *chunkDecoder) begin(name string) {
+	if c.list != nil {
+		c.list.instruction(c.offset(), 0, name)
+	}
+}
+
+func (c *chunkDecoder) flush() {
+	if c.list != nil {
+		c.list.flush()
+	}
+}
+
+func (c *chunkDecoder) operand(format string, args ...interface{}) {
+	if c.list != nil {
+		c.list.operand(fmt.Sprintf(format, args...))
+	}
+}
+
+func (c *chunkDecoder) uint() int {
+	n := readUint(c.code)
+	c.operand("%d", n)
+	return n
+}
+
+// count reads a number of nodes which is listed with the label, it is used
+// when the number does not follow the opcode
+func (c *chunkDecoder) count(label string) int {
+	n := readUint(c.code)
+	c.operand("%s: %d", label, n)
+	return n
+}
+
+func (c *chunkDecoder) int() int64 {
+	n, err := binary.ReadVarint(c.code)
+	if err != nil {
+		fail("truncated instructions")
+	}
+	c.operand("%d", n)
+	return n
+}
+
+func (c *chunkDecoder) bool(label string) bool {
+	b := readByte(c.code) != 0
+	c.operand("%s: %t", label, b)
+	return b
+}
+
+func (c *chunkDecoder) constant(kind byte) *constant {
+	i := readUint(c.code)
+	if i >= len(c.constants) || c.constants[i].kind != kind {
+		fail("invalid constant %d", i)
+	}
+	c.operand("#%d", i)
+	return &c.constants[i]
+}
+
+func (c *chunkDecoder) string() string {
+	s := c.constant(constString).value
+	c.operand("%q", s)
+	return s
+}
+
+func (c *chunkDecoder) pos() token.Position {
+	delta, err := binary.ReadVarint(c.lines)
+	if err != nil {
+		fail("truncated line table")
+	}
+	c.line += int(delta)
+	pos := token.Position{Line: c.line, Column: readUint(c.lines)}
+	if c.list != nil {
+		c.list.position(pos)
+	}
+	return pos
+}
+
+func (c *chunkDecoder) local() *ast.Local {
+	depth := readUint(c.code)
+	if depth == 0 {
+		c.operand("global")
+		return nil
+	}
+	local := &ast.Local{Depth: depth - 1, Slot: readUint(c.code) - 1}
+	c.operand("local %d:%d", local.Depth, local.Slot)
+	return local
+}
+
+func (c *chunkDecoder) names() []string {
+	n := readUint(c.code)
+	if n == 0 {
+		c.operand("unresolved")
+		return nil
+	}
+	if n-1 > c.code.Len() {
+		fail("truncated instructions")
+	}
+	c.operand("slots")
+	names := make([]string, n-1)
+	for i := range names {
+		names[i] = c.string()
+	}
+	return names
+}
+
+func (c *chunkDecoder) identifier() *ast.Identifier {
+	return &ast.Identifier{Position: c.pos(), Name: c.string(), Local: c.local()}
+}
+
+func (c *chunkDecoder) program() *ast.Program {
+	c.begin("PROGRAM")
+	program := &ast.Program{}
+	for n := c.uint(); n > 0; n-- {
+		program.Statements = append(program.Statements, c.statement())
+	}
+	c.flush()
+	return program
+}
+
+func (c *chunkDecoder) statement() ast.Statement {
+	stmt, ok := c.node().(ast.Statement)
+	if !ok {
+		fail("expected statement")
+	}
+	return stmt
+}
+
+// expression reads an expression, nil for opNil
+func (c *chunkDecoder) expression() ast.Expression {
+	node := c.node()
+	if node == nil {
+		return nil
+	}
+	exp, ok := node.(ast.Expression)
+	if !ok {
+		fail("expected expression, got %T", node)
+	}
+	return exp
+}
+
+// pattern reads a pattern, nil for opNil
+func (c *chunkDecoder) pattern() ast.Pattern {
+	node := c.node()
+	if node == nil {
+		return nil
+	}
+	pattern, ok := node.(ast.Pattern)
+	if !ok {
+		fail("expected pattern, got %T", node)
+	}
+	return pattern
+}
+
+func (c *chunkDecoder) block() *ast.BlockStatement {
+	node := c.node()
+	if node == nil {
+		return nil
+	}
+	block, ok := node.(*ast.BlockStatement)
+	if !ok {
+		fail("expected block, got %T", node)
+	}
+	return block
+}
+
+func (c *chunkDecoder) annotation() *ast.TypeAnnotation {
+	node := c.node()
+	if node == nil {
+		return nil
+	}
+	t, ok := node.(*ast.TypeAnnotation)
+	if !ok {
+		fail("expected type annotation, got %T", node)
+	}
+	return t
+}
+
+func (c *chunkDecoder) expressions() []ast.Expression {
+	expressions := []ast.Expression{}
+	for n := c.uint(); n > 0; n-- {
+		expressions = append(expressions, c.expression())
+	}
+	return expressions
+}
+
+func (c *chunkDecoder) node() ast.Node {
+	c.depth++
+	op := c.op()
+	defer func() {
+		c.depth--
+		if c.list != nil && op != opNil {
+			c.list.end(c.depth)
+		}
+	}()
+	switch op {
+	case opNil:
+		return nil
+	case opLet:
+		let := &ast.LetStatement{Position: c.pos(), EndPosition: c.pos()}
+		if c.bool("named") {
+			let.Identifier = &token.Token{Type: token.IDENT, Pos: c.pos(), Literal: c.string()}
+		} else {
+			let.Pattern = c.pattern()
+		}
+		let.Type = c.labelled("type").annotation()
+		let.Value = c.expression()
+		let.Local = c.local()
+		return let
+	case opReturn:
+		return &ast.ReturnStatement{Position: c.pos(), EndPosition: c.pos(), ReturnValue: c.expression()}
+	case opExpression:
+		return &ast.ExpressionStatement{EndPosition: c.pos(), Expression: c.expression()}
+	case opBlock:
+		block := &ast.BlockStatement{Position: c.pos(), EndPosition: c.pos()}
+		for n := c.uint(); n > 0; n-- {
+			block.Statements = append(block.Statements, c.statement())
+		}
+		return block
+	case opInteger:
+		return &ast.IntegerLiteral{Position: c.pos(), Value: c.int()}
+	case opBigInt:
+		pos := c.pos()
+		s := c.constant(constBigInt).value
+		value, ok := new(big.Int).SetString(s, 10)
+		if !ok {
+			fail("invalid big integer")
+		}
+		c.operand("%s", s)
+		return &ast.BigIntegerLiteral{Position: pos, Value: value}
+	case opString:
+		return &ast.StringLiteral{Position: c.pos(), Value: c.string()}
+	case opTrue, opFalse:
+		return &ast.Boolean{Position: c.pos(), Value: op == opTrue}
+	case opIdentifier:
+		return c.identifier()
+	case opPrefix:
+		return &ast.PrefixExpression{Position: c.pos(), Operator: c.string(), Right: c.expression()}
+	case opInfix:
+		return &ast.InfixExpression{Position: c.pos(), Operator: c.string(), Left: c.expression(), Right: c.expression()}
+	case opIf:
+		return &ast.IfExpression{Position: c.pos(), Condition: c.expression(), Block: c.block(), Alternative: c.labelled("else").block()}
+	case opFunction:
+		return c.constant(constFunction).chunk.function()
+	case opMacro:
+		macro := &ast.MacroLiteral{Position: c.pos()}
+		for n := c.uint(); n > 0; n-- {
+			macro.Params = append(macro.Params, c.identifier())
+		}
+		macro.Block = c.block()
+		return macro
+	case opCall:
+		return &ast.CallExpression{Position: c.pos(), Function: c.identifier(), Params: c.expressions()}
+	case opSpread:
+		return &ast.SpreadExpression{Position: c.pos(), Value: c.expression()}
+	case opNamed:
+		return &ast.NamedArgument{Position: c.pos(), Name: c.string(), Value: c.expression()}
+	case opArray:
+		return &ast.Array{Position: c.pos(), Items: c.expressions()}
+	case opIndex:
+		return &ast.IndexExpression{Position: c.pos(), Left: c.expression(), Index: c.expression()}
+	case opHash:
+		hash := &ast.HashLiteral{Position: c.pos()}
+		for n := c.uint(); n > 0; n-- {
+			hash.Pairs = append(hash.Pairs, &ast.HashPair{Key: c.expression(), Value: c.expression()})
+		}
+		return hash
+	case opMatch:
+		match := &ast.MatchExpression{Position: c.pos(), EndPosition: c.pos(), Value: c.expression()}
+		for n := c.count("arms"); n > 0; n-- {
+			c.part("arm", func() {
+				match.Arms = append(match.Arms, &ast.MatchArm{Pattern: c.pattern(), Guard: c.labelled("guard").expression(), Body: c.expression(), Locals: c.names()})
+			})
+		}
+		return match
+	case opType:
+		return &ast.TypeAnnotation{Position: c.pos(), Name: c.string()}
+	case opWildcardPattern:
+		return &ast.WildcardPattern{Position: c.pos()}
+	case opLiteralPattern:
+		return &ast.LiteralPattern{Value: c.expression()}
+	case opBindingPattern:
+		return &ast.BindingPattern{Position: c.pos(), Name: c.string(), Local: c.local()}
+	case opArrayPattern:
+		array := &ast.ArrayPattern{Position: c.pos()}
+		for n := c.uint(); n > 0; n-- {
+			array.Elements = append(array.Elements, c.pattern())
+		}
+		array.Rest = c.labelled("rest").pattern()
+		return array
+	case opHashPattern:
+		hash := &ast.HashPattern{Position: c.pos()}
+		for n := c.uint(); n > 0; n-- {
+			hash.Pairs = append(hash.Pairs, &ast.HashPatternPair{Key: c.expression(), Value: c.pattern()})
+		}
+		return hash
+	case opDefaultPattern:
+		return &ast.DefaultPattern{Pattern: c.pattern(), Default: c.labelled("default").expression()}
+	default:
+		fail("unknown opcode %d", op)
+	}
+	return nil
+}
+
+// function reads the function literal from its chunk, the chunk is read
+// from its start so the same constant can be loaded more than once
+func (c *chunkDecoder) function() *ast.FunctionLiteral {
+	c.code.Seek(0, io.SeekStart)
+	c.lines.Seek(0, io.SeekStart)
+	c.line = 1
+	c.begin("FUNCTION")
+
+	fn := &ast.FunctionLiteral{Position: c.pos(), Params: []*ast.Identifier{}}
+	var patterns []ast.Pattern
+	var types []*ast.TypeAnnotation
+	var defaults []ast.Expression
+	for n := c.uint(); n > 0; n-- {
+		c.part("param", func() {
+			fn.Params = append(fn.Params, c.identifier())
+			patterns = append(patterns, c.labelled("pattern").pattern())
+			types = append(types, c.labelled("type").annotation())
+			defaults = append(defaults, c.labelled("default").expression())
+		})
+	}
+	for i := range fn.Params {
+		if patterns[i] != nil {
+			fn.ParamPatterns = patterns
+		}
+		if types[i] != nil {
+			fn.ParamTypes = types
+		}
+		if defaults[i] != nil {
+			fn.Defaults = defaults
+		}
+	}
+	fn.Variadic = c.bool("variadic")
+	fn.ReturnType = c.labelled("returns").annotation()
+	fn.Block = c.block()
+	fn.Locals = c.names()
+	c.flush()
+	return fn
+}
+
+func readByte(r *bytes.Reader) byte {
+	b, err := r.ReadByte()
+	if err != nil {
+		fail("truncated data")
+	}
+	return b
+}
+
+func readUint(r *bytes.Reader) int {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		fail("truncated data")
+	}
+	return int(n)
+}
+
+// readCount reads number of items which take at least a byte each
+func readCount(r *bytes.Reader) int {
+	n := readUint(r)
+	if n > r.Len() {
+		fail("truncated data")
+	}
+	return n
+}
+
+func readBytes(r *bytes.Reader) []byte {
+	b := make([]byte, readCount(r))
+	r.Read(b)
+	return b
+}
+
+func readString(r *bytes.Reader) string {
+	return string(readBytes(r))
+}
@@ -0,0 +1,114 @@
+package compiled
+
+import (
+	"fmt"
+	"github.com/alenkacz/interpreter-book/pkg/token"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Disassemble writes a listing of the compiled program: the constant pool,
+// instructions of each function and of the main chunk. Each instruction is
+// listed with its offset in the chunk, the source position from the line
+// table, the opcode indented by nesting and its operands. Further positions
+// of an instruction are listed among its operands with @, operands read
+// after the children of an instruction are listed on a line starting with
+// "...". Absent optional nodes are left out and present ones are labelled,
+// parameters of functions and arms of match expressions are listed on lines
+// of their own.
+func Disassemble(w io.Writer, data []byte) (err error) {
+	defer recoverError(&err)
+	constants, main := readProgram(data)
+
+	l := &listing{}
+	fmt.Fprintf(&l.out, "version %d\n\nconstants:\n", Version)
+	for i, c := range constants {
+		switch c.kind {
+		case constString:
+			fmt.Fprintf(&l.out, "%6d  string %q\n", i, c.value)
+		case constBigInt:
+			fmt.Fprintf(&l.out, "%6d  bigint %s\n", i, c.value)
+		case constFunction:
+			fmt.Fprintf(&l.out, "%6d  function\n", i)
+		}
+	}
+	for i, c := range constants {
+		if c.kind == constFunction {
+			fmt.Fprintf(&l.out, "\nfunction #%d:\n", i)
+			c.chunk.list = l
+			c.chunk.function()
+			c.chunk.list = nil
+		}
+	}
+	fmt.Fprintf(&l.out, "\nmain:\n")
+	main.list = l
+	main.program()
+
+	_, err = io.WriteString(w, l.out.String())
+	return err
+}
+
+// listing collects lines of the disassembly, the current instruction is
+// written when the next one starts
+type listing struct {
+	out strings.Builder
+	// current instruction
+	line    strings.Builder
+	pending bool
+	offset  int
+	// first position of the instruction, empty if it has none
+	pos string
+	// depth of the instruction whose children were listed, its further
+	// operands are listed on a continuation line
+	depth int
+}
+
+func (l *listing) instruction(offset, depth int, name string) {
+	l.flush()
+	l.pending = true
+	l.offset = offset
+	l.pos = ""
+	l.line.WriteString(strings.Repeat("  ", depth))
+	l.line.WriteString(name)
+}
+
+// end is called after the instruction and its children were read
+func (l *listing) end(depth int) {
+	l.flush()
+	l.depth = depth
+}
+
+func (l *listing) continuation() {
+	if !l.pending {
+		l.instruction(-1, l.depth, "...")
+	}
+}
+
+func (l *listing) position(pos token.Position) {
+	l.continuation()
+	if l.pos == "" {
+		l.pos = pos.String()
+		return
+	}
+	l.operand("@" + pos.String())
+}
+
+func (l *listing) operand(s string) {
+	l.continuation()
+	l.line.WriteString(" ")
+	l.line.WriteString(s)
+}
+
+func (l *listing) flush() {
+	if !l.pending {
+		return
+	}
+	offset := ""
+	if l.offset >= 0 {
+		offset = strconv.Itoa(l.offset)
+	}
+	fmt.Fprintf(&l.out, "%6s  %-8s%s\n", offset, l.pos, l.line.String())
+	l.line.Reset()
+	l.pending = false
+}
@@ -0,0 +1,74 @@
+package compiled
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDisassemble(t *testing.T) {
+	program, err := Compile("let f = fn(x, y = 2) {\n  match (x) { n if n > y => n, _ => y }\n};\nf(21, y: 1)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := Disassemble(&out, Encode(program)); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `version 2
+
+constants:
+     0  string "f"
+     1  string "x"
+     2  string "y"
+     3  string "n"
+     4  string ">"
+     5  function
+
+function #5:
+     0  1:9     FUNCTION 2
+     1  1:12      param #1 "x" local 0:0
+     7  1:15      param #2 "y" local 0:1
+    12  1:19        default: INTEGER 2
+                ... variadic: false
+    16  1:22      BLOCK @3:1 1
+    18  2:39        EXPRESSION
+    19  2:3           MATCH @2:39
+    20  2:10            IDENTIFIER #1 "x" local 0:0
+                      ... arms: 2
+    25                  arm
+    25  2:15              BINDING #3 "n" local 0:0
+    29  2:20              guard: INFIX #4 ">"
+    31  2:20                IDENTIFIER #3 "n" local 0:0
+    35  2:24                IDENTIFIER #2 "y" local 1:1
+    39  2:29              IDENTIFIER #3 "n" local 0:0
+                        ... slots #3 "n"
+    45                  arm
+    45  2:32              WILDCARD
+    47  2:37              IDENTIFIER #2 "y" local 1:1
+                        ... slots
+                ... slots #1 "x" #2 "y"
+
+main:
+     0          PROGRAM 2
+     1  1:1       LET @3:2 named: true @1:5 #0 "f"
+     5              FUNCTION #5
+                  ... global
+     8  4:11      EXPRESSION
+     9  4:1         CALL @4:1 #0 "f" local 0:-1 2
+    14  4:3           INTEGER 21
+    16  4:7           NAMED #2 "y"
+    18  4:10            INTEGER 1
+`
+	if out.String() != expected {
+		t.Errorf("unexpected listing.\nexpected=%s\ngot=     %s", expected, out.String())
+	}
+
+	out.Reset()
+	if err := Disassemble(&out, []byte("f(21)")); err == nil || err.Error() != "not a compiled program" {
+		t.Errorf("expected error of invalid program, got %v", err)
+	}
+	if out.Len() != 0 {
+		t.Errorf("expected no listing of invalid program, got %s", out.String())
+	}
+}
@@ -0,0 +1,362 @@
+package compiled
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"github.com/alenkacz/interpreter-book/pkg/ast"
+	"github.com/alenkacz/interpreter-book/pkg/token"
+)
+
+// Encode returns the program in the binary format, the program should be
+// returned by Compile so that it is loaded with its macros expanded and
+// names resolved
+func Encode(program *ast.Program) []byte {
+	p := &pool{strings: make(map[string]int)}
+	main := p.chunk()
+	main.uint(len(program.Statements))
+	for _, stmt := range program.Statements {
+		main.node(stmt)
+	}
+
+	var out bytes.Buffer
+	out.WriteString(Magic)
+	writeUint(&out, Version)
+	writeUint(&out, p.count)
+	out.Write(p.buf.Bytes())
+	main.writeTo(&out)
+	return out.Bytes()
+}
+
+// pool is the constant pool, strings are stored only once
+type pool struct {
+	buf     bytes.Buffer
+	count   int
+	strings map[string]int
+}
+
+func (p *pool) chunk() *chunkEncoder {
+	return &chunkEncoder{pool: p, line: 1}
+}
+
+func (p *pool) string(s string) int {
+	if i, ok := p.strings[s]; ok {
+		return i
+	}
+	p.buf.WriteByte(constString)
+	writeString(&p.buf, s)
+	p.strings[s] = p.count
+	p.count++
+	return p.count - 1
+}
+
+func (p *pool) bigInt(s string) int {
+	p.buf.WriteByte(constBigInt)
+	writeString(&p.buf, s)
+	p.count++
+	return p.count - 1
+}
+
+func (p *pool) function(c *chunkEncoder) int {
+	p.buf.WriteByte(constFunction)
+	c.writeTo(&p.buf)
+	p.count++
+	return p.count - 1
+}
+
+// chunkEncoder writes instructions and line table of a chunk
+type chunkEncoder struct {
+	pool  *pool
+	code  bytes.Buffer
+	lines bytes.Buffer
+	// line of the previous position
+	line int
+}
+
+func (c *chunkEncoder) writeTo(out *bytes.Buffer) {
+	writeUint(out, c.code.Len())
+	out.Write(c.code.Bytes())
+	writeUint(out, c.lines.Len())
+	out.Write(c.lines.Bytes())
+}
+
+func (c *chunkEncoder) op(op opcode) {
+	c.code.WriteByte(byte(op))
+}
+
+func (c *chunkEncoder) uint(n int) {
+	writeUint(&c.code, n)
+}
+
+func (c *chunkEncoder) int(n int64) {
+	var buf [binary.MaxVarintLen64]byte
+	c.code.Write(buf[:binary.PutVarint(buf[:], n)])
+}
+
+func (c *chunkEncoder) bool(b bool) {
+	if b {
+		c.code.WriteByte(1)
+	} else {
+		c.code.WriteByte(0)
+	}
+}
+
+func (c *chunkEncoder) string(s string) {
+	c.uint(c.pool.string(s))
+}
+
+func (c *chunkEncoder) pos(pos token.Position) {
+	var buf [binary.MaxVarintLen64]byte
+	c.lines.Write(buf[:binary.PutVarint(buf[:], int64(pos.Line-c.line))])
+	writeUint(&c.lines, pos.Column)
+	c.line = pos.Line
+}
+
+// local writes the location as depth and slot shifted by one, zero stands
+// for unresolved names
+func (c *chunkEncoder) local(local *ast.Local) {
+	if local == nil {
+		c.uint(0)
+		return
+	}
+	c.uint(local.Depth + 1)
+	c.uint(local.Slot + 1)
+}
+
+// names writes the names of slots, zero count stands for nil
+func (c *chunkEncoder) names(names []string) {
+	if names == nil {
+		c.uint(0)
+		return
+	}
+	c.uint(len(names) + 1)
+	for _, name := range names {
+		c.string(name)
+	}
+}
+
+func (c *chunkEncoder) identifier(ident *ast.Identifier) {
+	c.pos(ident.Position)
+	c.string(ident.Name)
+	c.local(ident.Local)
+}
+
+// node writes the node, nil is written as opNil
+func (c *chunkEncoder) node(node ast.Node) {
+	switch node := node.(type) {
+	case nil:
+		c.op(opNil)
+	case *ast.LetStatement:
+		c.op(opLet)
+		c.pos(node.Position)
+		c.pos(node.EndPosition)
+		if node.Identifier != nil {
+			c.bool(true)
+			c.pos(node.Identifier.Pos)
+			c.string(node.Identifier.Literal)
+		} else {
+			c.bool(false)
+			c.node(node.Pattern)
+		}
+		c.annotation(node.Type)
+		c.node(node.Value)
+		c.local(node.Local)
+	case *ast.ReturnStatement:
+		c.op(opReturn)
+		c.pos(node.Position)
+		c.pos(node.EndPosition)
+		c.node(node.ReturnValue)
+	case *ast.ExpressionStatement:
+		c.op(opExpression)
+		c.pos(node.EndPosition)
+		c.node(node.Expression)
+	case *ast.BlockStatement:
+		c.block(node)
+	case *ast.IntegerLiteral:
+		c.op(opInteger)
+		c.pos(node.Position)
+		c.int(node.Value)
+	case *ast.BigIntegerLiteral:
+		c.op(opBigInt)
+		c.pos(node.Position)
+		c.uint(c.pool.bigInt(node.Value.String()))
+	case *ast.StringLiteral:
+		c.op(opString)
+		c.pos(node.Position)
+		c.string(node.Value)
+	case *ast.Boolean:
+		if node.Value {
+			c.op(opTrue)
+		} else {
+			c.op(opFalse)
+		}
+		c.pos(node.Position)
+	case *ast.Identifier:
+		c.op(opIdentifier)
+		c.identifier(node)
+	case *ast.PrefixExpression:
+		c.op(opPrefix)
+		c.pos(node.Position)
+		c.string(node.Operator)
+		c.node(node.Right)
+	case *ast.InfixExpression:
+		c.op(opInfix)
+		c.pos(node.Position)
+		c.string(node.Operator)
+		c.node(node.Left)
+		c.node(node.Right)
+	case *ast.IfExpression:
+		c.op(opIf)
+		c.pos(node.Position)
+		c.node(node.Condition)
+		c.block(node.Block)
+		c.block(node.Alternative)
+	case *ast.FunctionLiteral:
+		c.op(opFunction)
+		c.uint(c.pool.function(c.function(node)))
+	case *ast.MacroLiteral:
+		c.op(opMacro)
+		c.pos(node.Position)
+		c.uint(len(node.Params))
+		for _, p := range node.Params {
+			c.identifier(p)
+		}
+		c.block(node.Block)
+	case *ast.CallExpression:
+		c.op(opCall)
+		c.pos(node.Position)
+		c.identifier(node.Function)
+		c.expressions(node.Params)
+	case *ast.SpreadExpression:
+		c.op(opSpread)
+		c.pos(node.Position)
+		c.node(node.Value)
+	case *ast.NamedArgument:
+		c.op(opNamed)
+		c.pos(node.Position)
+		c.string(node.Name)
+		c.node(node.Value)
+	case *ast.Array:
+		c.op(opArray)
+		c.pos(node.Position)
+		c.expressions(node.Items)
+	case *ast.IndexExpression:
+		c.op(opIndex)
+		c.pos(node.Position)
+		c.node(node.Left)
+		c.node(node.Index)
+	case *ast.HashLiteral:
+		c.op(opHash)
+		c.pos(node.Position)
+		c.uint(len(node.Pairs))
+		for _, pair := range node.Pairs {
+			c.node(pair.Key)
+			c.node(pair.Value)
+		}
+	case *ast.MatchExpression:
+		c.op(opMatch)
+		c.pos(node.Position)
+		c.pos(node.EndPosition)
+		c.node(node.Value)
+		c.uint(len(node.Arms))
+		for _, arm := range node.Arms {
+			c.node(arm.Pattern)
+			c.node(arm.Guard)
+			c.node(arm.Body)
+			c.names(arm.Locals)
+		}
+	case *ast.WildcardPattern:
+		c.op(opWildcardPattern)
+		c.pos(node.Position)
+	case *ast.LiteralPattern:
+		c.op(opLiteralPattern)
+		c.node(node.Value)
+	case *ast.BindingPattern:
+		c.op(opBindingPattern)
+		c.pos(node.Position)
+		c.string(node.Name)
+		c.local(node.Local)
+	case *ast.ArrayPattern:
+		c.op(opArrayPattern)
+		c.pos(node.Position)
+		c.uint(len(node.Elements))
+		for _, element := range node.Elements {
+			c.node(element)
+		}
+		c.node(node.Rest)
+	case *ast.HashPattern:
+		c.op(opHashPattern)
+		c.pos(node.Position)
+		c.uint(len(node.Pairs))
+		for _, pair := range node.Pairs {
+			c.node(pair.Key)
+			c.node(pair.Value)
+		}
+	case *ast.DefaultPattern:
+		c.op(opDefaultPattern)
+		c.node(node.Pattern)
+		c.node(node.Default)
+	default:
+		panic(fmt.Sprintf("compiled: cannot encode %T", node))
+	}
+}
+
+func (c *chunkEncoder) block(block *ast.BlockStatement) {
+	if block == nil {
+		c.op(opNil)
+		return
+	}
+	c.op(opBlock)
+	c.pos(block.Position)
+	c.pos(block.EndPosition)
+	c.uint(len(block.Statements))
+	for _, stmt := range block.Statements {
+		c.node(stmt)
+	}
+}
+
+func (c *chunkEncoder) annotation(t *ast.TypeAnnotation) {
+	if t == nil {
+		c.op(opNil)
+		return
+	}
+	c.op(opType)
+	c.pos(t.Position)
+	c.string(t.Name)
+}
+
+func (c *chunkEncoder) expressions(expressions []ast.Expression) {
+	c.uint(len(expressions))
+	for _, e := range expressions {
+		c.node(e)
+	}
+}
+
+// function returns chunk of the function literal, nested functions are
+// added to the pool before it
+func (c *chunkEncoder) function(fn *ast.FunctionLiteral) *chunkEncoder {
+	f := c.pool.chunk()
+	f.pos(fn.Position)
+	f.uint(len(fn.Params))
+	for i, p := range fn.Params {
+		f.identifier(p)
+		f.node(fn.ParamPattern(i))
+		f.annotation(fn.ParamType(i))
+		f.node(fn.ParamDefault(i))
+	}
+	f.bool(fn.Variadic)
+	f.annotation(fn.ReturnType)
+	f.block(fn.Block)
+	f.names(fn.Locals)
+	return f
+}
+
+func writeUint(buf *bytes.Buffer, n int) {
+	var b [binary.MaxVarintLen64]byte
+	buf.Write(b[:binary.PutUvarint(b[:], uint64(n))])
+}
+
+func writeString(buf *bytes.Buffer, s string) {
+	writeUint(buf, len(s))
+	buf.WriteString(s)
+}
@@ -0,0 +1,209 @@
+// Package coverage measures which statements and branches of Monkey programs
+// are executed and writes the results as LCOV, Go cover profile or HTML.
+package coverage
+
+import (
+	"github.com/alenkacz/interpreter-book/pkg/ast"
+	"github.com/alenkacz/interpreter-book/pkg/eval"
+	"github.com/alenkacz/interpreter-book/pkg/object"
+	"github.com/alenkacz/interpreter-book/pkg/token"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Statement is a let, return or expression statement of the file
+type Statement struct {
+	Node  ast.Statement
+	Count int
+	// Segments are the parts of the source of the statement not covered by
+	// nested statements, e.g. a let statement binding function literal
+	// without its body
+	Segments []Segment
+}
+
+// Segment is a range of the source, the end is exclusive
+type Segment struct {
+	Start token.Position
+	End   token.Position
+}
+
+// Branch is an if expression counting evaluations of its consequence and
+// alternative, the alternative is counted even when it is missing
+type Branch struct {
+	Node        *ast.IfExpression
+	Consequence int
+	Alternative int
+}
+
+// File collects coverage of a single source file
+type File struct {
+	Filename   string
+	Source     string
+	Program    *ast.Program
+	Statements []*Statement
+	Branches   []*Branch
+
+	statements map[ast.Statement]*Statement
+	branches   map[*ast.IfExpression]*Branch
+	// mu guards the counts changed by tracers of spawned tasks
+	mu sync.Mutex
+}
+
+// New returns coverage of the parsed source with all counts zero.
+func New(filename string, source string, program *ast.Program) *File {
+	f := &File{
+		Filename:   filename,
+		Source:     source,
+		Program:    program,
+		statements: make(map[ast.Statement]*Statement),
+		branches:   make(map[*ast.IfExpression]*Branch),
+	}
+	lines := strings.Split(source, "\n")
+
+	// parents of nested statements, the segments of statements are split
+	// around their children
+	var stack []*Statement
+	children := make(map[*Statement][]*Statement)
+	ast.Inspect(program, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.LetStatement, *ast.ReturnStatement, *ast.ExpressionStatement:
+			stmt := &Statement{Node: node.(ast.Statement)}
+			f.Statements = append(f.Statements, stmt)
+			f.statements[stmt.Node] = stmt
+		case *ast.IfExpression:
+			b := &Branch{Node: node}
+			f.Branches = append(f.Branches, b)
+			f.branches[node] = b
+		}
+		return true
+	})
+	// the statements are sorted by position to find their parents
+	sort.SliceStable(f.Statements, func(i, j int) bool {
+		return f.Statements[i].Node.Pos().Before(f.Statements[j].Node.Pos())
+	})
+	sort.SliceStable(f.Branches, func(i, j int) bool {
+		return f.Branches[i].Node.Pos().Before(f.Branches[j].Node.Pos())
+	})
+	for _, stmt := range f.Statements {
+		for len(stack) > 0 && !stmt.Node.Pos().Before(end(lines, stack[len(stack)-1].Node)) {
+			stack = stack[:len(stack)-1]
+		}
+		if len(stack) > 0 {
+			parent := stack[len(stack)-1]
+			children[parent] = append(children[parent], stmt)
+		}
+		stack = append(stack, stmt)
+	}
+
+	for _, stmt := range f.Statements {
+		start := stmt.Node.Pos()
+		for _, child := range children[stmt] {
+			if start.Before(child.Node.Pos()) {
+				stmt.Segments = append(stmt.Segments, Segment{Start: start, End: child.Node.Pos()})
+			}
+			start = end(lines, child.Node)
+		}
+		if stop := end(lines, stmt.Node); start.Before(stop) {
+			stmt.Segments = append(stmt.Segments, Segment{Start: start, End: stop})
+		}
+	}
+	return f
+}
+
+// end returns the position after the last token of the statement, the
+// statements only know the start of their last token
+func end(lines []string, stmt ast.Statement) token.Position {
+	pos := stmt.End()
+	if pos.Line < 1 || pos.Line > len(lines) {
+		return pos
+	}
+	line := lines[pos.Line-1]
+	i := pos.Column - 1
+	if i >= len(line) {
+		return token.Position{Line: pos.Line, Column: pos.Column + 1}
+	}
+	switch {
+	case line[i] == '"':
+		if j := strings.IndexByte(line[i+1:], '"'); j >= 0 {
+			i += j + 2
+		} else {
+			i = len(line)
+		}
+	case isWord(line[i]):
+		for i < len(line) && isWord(line[i]) {
+			i++
+		}
+	default:
+		i++
+	}
+	return token.Position{Line: pos.Line, Column: i + 1}
+}
+
+func isWord(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// Tracer returns tracer of the evaluator counting statements and branches
+// of the file, nodes of other programs are ignored. Spawned tasks are counted
+// too.
+func (f *File) Tracer() *eval.Tracer {
+	t := &eval.Tracer{
+		Statement: func(stmt ast.Statement, env *object.Environment) error {
+			if s, ok := f.statements[stmt]; ok {
+				f.mu.Lock()
+				s.Count++
+				f.mu.Unlock()
+			}
+			return nil
+		},
+		Branch: func(expr *ast.IfExpression, taken bool) {
+			if b, ok := f.branches[expr]; ok {
+				f.mu.Lock()
+				if taken {
+					b.Consequence++
+				} else {
+					b.Alternative++
+				}
+				f.mu.Unlock()
+			}
+		},
+	}
+	t.Spawn = func() *eval.Tracer { return t }
+	return t
+}
+
+// Run evaluates the program of the file collecting its coverage.
+func (f *File) Run(env *object.Environment) object.Object {
+	in := eval.New()
+	in.Trace = f.Tracer()
+	return in.Eval(f.Program, env)
+}
+
+// Lines returns execution counts of lines where statements start, the count
+// of a line is the highest count of its statements.
+func (f *File) Lines() map[int]int {
+	lines := make(map[int]int)
+	for _, stmt := range f.Statements {
+		line := stmt.Node.Pos().Line
+		if count, ok := lines[line]; !ok || stmt.Count > count {
+			lines[line] = stmt.Count
+		}
+	}
+	return lines
+}
+
+// Percent returns percentage of executed statements, files without
+// statements are fully covered.
+func (f *File) Percent() float64 {
+	if len(f.Statements) == 0 {
+		return 100
+	}
+	covered := 0
+	for _, stmt := range f.Statements {
+		if stmt.Count > 0 {
+			covered++
+		}
+	}
+	return 100 * float64(covered) / float64(len(f.Statements))
+}
@@ -0,0 +1,149 @@
+package coverage
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/alenkacz/interpreter-book/pkg/object"
+	"github.com/alenkacz/interpreter-book/pkg/parser"
+	"github.com/alenkacz/interpreter-book/pkg/tokenizer"
+	"strings"
+	"testing"
+)
+
+const source = `let sign = fn(n) {
+  if (n < 0) {
+    "negative"
+  } else {
+    "positive"
+  }
+};
+let unused = fn() { 1 };
+sign(1);
+sign(2);`
+
+func run(t *testing.T) *File {
+	program := parser.New(tokenizer.New(source)).ParseProgram()
+	f := New("sign.mk", source, program)
+	if result := f.Run(object.NewEnvironment(nil)); result.Print() != "positive" {
+		t.Fatalf("unexpected result %s", result.Print())
+	}
+	return f
+}
+
+func TestCounts(t *testing.T) {
+	f := run(t)
+
+	var statements []string
+	for _, stmt := range f.Statements {
+		var segments []string
+		for _, s := range stmt.Segments {
+			segments = append(segments, fmt.Sprintf("%s-%s", s.Start, s.End))
+		}
+		statements = append(statements, fmt.Sprintf("%d %s", stmt.Count, strings.Join(segments, " ")))
+	}
+	expected := []string{
+		"1 1:1-2:3 6:4-7:3",
+		"2 2:3-3:5 3:15-5:5 5:15-6:4",
+		"0 3:5-3:15",
+		"2 5:5-5:15",
+		"1 8:1-8:21 8:22-8:25",
+		"0 8:21-8:22",
+		"1 9:1-9:9",
+		"1 10:1-10:9",
+	}
+	if strings.Join(statements, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected statements\n%s\ngot\n%s", strings.Join(expected, "\n"), strings.Join(statements, "\n"))
+	}
+
+	if len(f.Branches) != 1 || f.Branches[0].Consequence != 0 || f.Branches[0].Alternative != 2 {
+		t.Errorf("unexpected branches %+v", f.Branches)
+	}
+	if f.Percent() != 75 {
+		t.Errorf("expected 75%% of statements covered, got %.1f", f.Percent())
+	}
+}
+
+func TestLCOV(t *testing.T) {
+	var b bytes.Buffer
+	if err := WriteLCOV(&b, []*File{run(t)}); err != nil {
+		t.Fatal(err)
+	}
+	expected := `TN:
+SF:sign.mk
+BRDA:2,0,0,0
+BRDA:2,0,1,2
+BRF:2
+BRH:1
+DA:1,1
+DA:2,2
+DA:3,0
+DA:5,2
+DA:8,1
+DA:9,1
+DA:10,1
+LF:7
+LH:6
+end_of_record
+`
+	if b.String() != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, b.String())
+	}
+}
+
+func TestGoCover(t *testing.T) {
+	var b bytes.Buffer
+	if err := WriteGoCover(&b, []*File{run(t)}); err != nil {
+		t.Fatal(err)
+	}
+	// blocks are sorted by position, trailing parts of statements around
+	// nested statements are left out
+	expected := `mode: count
+sign.mk:1.1,2.3 1 1
+sign.mk:2.3,3.5 1 2
+sign.mk:3.5,3.15 1 0
+sign.mk:5.5,5.15 1 2
+sign.mk:8.1,8.21 1 1
+sign.mk:8.21,8.22 1 0
+sign.mk:9.1,9.9 1 1
+sign.mk:10.1,10.9 1 1
+`
+	if b.String() != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, b.String())
+	}
+}
+
+func TestHTML(t *testing.T) {
+	var b bytes.Buffer
+	if err := WriteHTML(&b, []*File{run(t)}); err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		`<option value="0">sign.mk (75.0%)</option>`,
+		`<span class="uncovered" title="0">&#34;negative&#34;</span>`,
+		`<span class="partial" title="consequence never taken">if</span>`,
+		`<span class="covered" title="1">sign(1);</span>`,
+	} {
+		if !strings.Contains(b.String(), expected) {
+			t.Errorf("report does not contain %s:\n%s", expected, b.String())
+		}
+	}
+}
+
+func TestSpawn(t *testing.T) {
+	input := `let work = fn(n) {
+  if (n > 1) { n } else { 0 }
+};
+let tasks = [spawn(work, 1), spawn(work, 2), spawn(work, 3)];
+[await(tasks[0]), await(tasks[1]), await(tasks[2])]`
+	program := parser.New(tokenizer.New(input)).ParseProgram()
+	f := New("work.mk", input, program)
+	if result := f.Run(object.NewEnvironment(nil)); result.Print() != "[0, 2, 3]" {
+		t.Fatalf("unexpected result %s", result.Print())
+	}
+	if count := f.Lines()[2]; count != 3 {
+		t.Errorf("expected 3 evaluations of the body of work, got %d", count)
+	}
+	if b := f.Branches[0]; b.Consequence != 2 || b.Alternative != 1 {
+		t.Errorf("unexpected branch counts %d %d", b.Consequence, b.Alternative)
+	}
+}
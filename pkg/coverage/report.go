@@ -0,0 +1,225 @@
+package coverage
+
+import (
+	"bufio"
+	"fmt"
+	"html/template"
+	"io"
+	"sort"
+)
+
+// WriteLCOV writes line and branch coverage of the files in the LCOV
+// tracefile format. Both arms of each if expression are reported as
+// branches, arms of if expressions that were never evaluated are marked
+// with a dash.
+func WriteLCOV(w io.Writer, files []*File) error {
+	b := bufio.NewWriter(w)
+	for _, f := range files {
+		fmt.Fprintf(b, "TN:\nSF:%s\n", f.Filename)
+
+		hit := 0
+		for i, branch := range f.Branches {
+			line := branch.Node.Pos().Line
+			for arm, count := range []int{branch.Consequence, branch.Alternative} {
+				taken := "-"
+				if branch.Consequence+branch.Alternative > 0 {
+					taken = fmt.Sprint(count)
+				}
+				if count > 0 {
+					hit++
+				}
+				fmt.Fprintf(b, "BRDA:%d,%d,%d,%s\n", line, i, arm, taken)
+			}
+		}
+		fmt.Fprintf(b, "BRF:%d\nBRH:%d\n", 2*len(f.Branches), hit)
+
+		counts := f.Lines()
+		var lines []int
+		for line := range counts {
+			lines = append(lines, line)
+		}
+		sort.Ints(lines)
+		hit = 0
+		for _, line := range lines {
+			if counts[line] > 0 {
+				hit++
+			}
+			fmt.Fprintf(b, "DA:%d,%d\n", line, counts[line])
+		}
+		fmt.Fprintf(b, "LF:%d\nLH:%d\nend_of_record\n", len(lines), hit)
+	}
+	return b.Flush()
+}
+
+// WriteGoCover writes coverage of the files in the format of Go cover
+// profiles in the count mode. The first segment of each statement is a block
+// of one statement, blocks of a file are sorted by position. The other
+// segments would be blocks without statements, they are left out.
+func WriteGoCover(w io.Writer, files []*File) error {
+	b := bufio.NewWriter(w)
+	fmt.Fprintf(b, "mode: count\n")
+	for _, f := range files {
+		var blocks []*Statement
+		for _, stmt := range f.Statements {
+			if len(stmt.Segments) != 0 {
+				blocks = append(blocks, stmt)
+			}
+		}
+		sort.SliceStable(blocks, func(i, j int) bool {
+			a, b := blocks[i].Segments[0], blocks[j].Segments[0]
+			if a.Start != b.Start {
+				return a.Start.Before(b.Start)
+			}
+			return a.End.Before(b.End)
+		})
+		for _, stmt := range blocks {
+			s := stmt.Segments[0]
+			fmt.Fprintf(b, "%s:%d.%d,%d.%d 1 %d\n", f.Filename,
+				s.Start.Line, s.Start.Column, s.End.Line, s.End.Column, stmt.Count)
+		}
+	}
+	return b.Flush()
+}
+
+// span is a part of the source rendered in the HTML report
+type span struct {
+	Text  string
+	Class string
+	Title string
+}
+
+type htmlFile struct {
+	Name    string
+	Percent float64
+	Spans   []span
+}
+
+// spans splits the source into segments of statements and the text between
+// them
+func (f *File) spans() []span {
+	offsets := []int{0}
+	for i, c := range f.Source {
+		if c == '\n' {
+			offsets = append(offsets, i+1)
+		}
+	}
+	offset := func(line int, column int) int {
+		if line < 1 || line > len(offsets) {
+			return len(f.Source)
+		}
+		o := offsets[line-1] + column - 1
+		if o > len(f.Source) {
+			return len(f.Source)
+		}
+		return o
+	}
+
+	type block struct {
+		start int
+		end   int
+		count int
+	}
+	var blocks []block
+	for _, stmt := range f.Statements {
+		for _, s := range stmt.Segments {
+			blocks = append(blocks, block{offset(s.Start.Line, s.Start.Column), offset(s.End.Line, s.End.Column), stmt.Count})
+		}
+	}
+	sort.SliceStable(blocks, func(i, j int) bool { return blocks[i].start < blocks[j].start })
+
+	var spans []span
+	pos := 0
+	for _, b := range blocks {
+		if b.start < pos {
+			continue
+		}
+		if b.start > pos {
+			spans = append(spans, span{Text: f.Source[pos:b.start]})
+		}
+		class := "covered"
+		if b.count == 0 {
+			class = "uncovered"
+		}
+		spans = append(spans, span{Text: f.Source[b.start:b.end], Class: class, Title: fmt.Sprintf("%d", b.count)})
+		pos = b.end
+	}
+	if pos < len(f.Source) {
+		spans = append(spans, span{Text: f.Source[pos:]})
+	}
+
+	// if expressions with an arm never taken are marked on their keyword
+	for _, branch := range f.Branches {
+		if branch.Consequence > 0 && branch.Alternative > 0 {
+			continue
+		}
+		at := offset(branch.Node.Pos().Line, branch.Node.Pos().Column)
+		spans = markBranch(spans, at, branch)
+	}
+	return spans
+}
+
+// markBranch splits the span containing the if keyword at the offset and
+// marks the keyword as partially covered
+func markBranch(spans []span, at int, branch *Branch) []span {
+	pos := 0
+	for i, s := range spans {
+		if at < pos || at+2 > pos+len(s.Text) || s.Class != "covered" {
+			pos += len(s.Text)
+			continue
+		}
+		title := "consequence never taken"
+		if branch.Consequence > 0 {
+			title = "alternative never taken"
+		}
+		split := []span{
+			{Text: s.Text[:at-pos], Class: s.Class, Title: s.Title},
+			{Text: s.Text[at-pos : at-pos+2], Class: "partial", Title: title},
+			{Text: s.Text[at-pos+2:], Class: s.Class, Title: s.Title},
+		}
+		return append(spans[:i], append(split, spans[i+1:]...)...)
+	}
+	return spans
+}
+
+var page = template.Must(template.New("coverage").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Coverage</title>
+<style>
+body { background: #1e1e1e; color: #808080; font-family: monospace; }
+select { margin: 1em 0; }
+pre { margin: 0; }
+.covered { color: #2ecc71; }
+.uncovered { color: #e74c3c; }
+.partial { color: #f1c40f; text-decoration: underline; }
+</style>
+</head>
+<body>
+<select id="files" onchange="show(this.value)">
+{{range $i, $f := .}}<option value="{{$i}}">{{$f.Name}} ({{printf "%.1f" $f.Percent}}%)</option>
+{{end}}</select>
+{{range $i, $f := .}}<pre class="file" id="file{{$i}}"{{if $i}} style="display: none"{{end}}>{{range $f.Spans}}{{if .Class}}<span class="{{.Class}}" title="{{.Title}}">{{.Text}}</span>{{else}}{{.Text}}{{end}}{{end}}</pre>
+{{end}}<script>
+function show(i) {
+	var files = document.getElementsByClassName("file");
+	for (var j = 0; j < files.length; j++) {
+		files[j].style.display = "none";
+	}
+	document.getElementById("file" + i).style.display = "block";
+}
+</script>
+</body>
+</html>
+`))
+
+// WriteHTML writes a page showing the source of the files with executed
+// statements in green, statements never executed in red and if expressions
+// with an arm never taken underlined in yellow.
+func WriteHTML(w io.Writer, files []*File) error {
+	var data []htmlFile
+	for _, f := range files {
+		data = append(data, htmlFile{Name: f.Filename, Percent: f.Percent(), Spans: f.spans()})
+	}
+	return page.Execute(w, data)
+}
@@ -0,0 +1,496 @@
+// Package dap implements a Debug Adapter Protocol server debugging a single
+// Monkey program, it communicates over a pair of streams, typically stdin and
+// stdout.
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/alenkacz/interpreter-book/pkg/ast"
+	"github.com/alenkacz/interpreter-book/pkg/debug"
+	"github.com/alenkacz/interpreter-book/pkg/eval"
+	"github.com/alenkacz/interpreter-book/pkg/object"
+	"github.com/alenkacz/interpreter-book/pkg/parser"
+	"github.com/alenkacz/interpreter-book/pkg/tokenizer"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// threadID is the only thread of the program
+const threadID = 1
+
+var errNotPaused = errors.New("program is not paused")
+
+// Server handles requests of a single debugging session. The program runs in
+// its own goroutine, requests inspecting its state are served only while it
+// is paused.
+type Server struct {
+	in *bufio.Reader
+
+	// mu guards writes to out and state shared with the program goroutine
+	mu  sync.Mutex
+	out io.Writer
+	seq int
+
+	debugger *debug.Debugger
+	path     string
+	program  *ast.Program
+	// lines with statements, breakpoints can be set only there
+	statements  map[int]bool
+	stopOnEntry bool
+
+	launched   bool
+	configured bool
+	running    bool
+	// the first pause is reported as entry
+	entered  bool
+	paused   bool
+	stopping bool
+	resume   chan debug.Action
+	done     chan struct{}
+
+	// handles are values of variablesReference, they are valid until the
+	// program continues
+	handles map[int]interface{}
+}
+
+func New(in io.Reader, out io.Writer) *Server {
+	s := &Server{
+		in:      bufio.NewReader(in),
+		out:     out,
+		resume:  make(chan debug.Action),
+		done:    make(chan struct{}),
+		handles: make(map[int]interface{}),
+	}
+	s.debugger = debug.New(s.pause)
+	return s
+}
+
+type handler func(s *Server, args json.RawMessage) (interface{}, error)
+
+var handlers map[string]handler
+
+func init() {
+	handlers = map[string]handler{
+		"initialize":        (*Server).initialize,
+		"launch":            (*Server).launch,
+		"setBreakpoints":    (*Server).setBreakpoints,
+		"configurationDone": (*Server).configurationDone,
+		"threads":           (*Server).threads,
+		"stackTrace":        (*Server).stackTrace,
+		"scopes":            (*Server).scopes,
+		"variables":         (*Server).variables,
+		"evaluate":          (*Server).evaluate,
+		"continue":          resumeWith(debug.Continue),
+		"next":              resumeWith(debug.StepOver),
+		"stepIn":            resumeWith(debug.StepIn),
+		"stepOut":           resumeWith(debug.StepOut),
+	}
+}
+
+// Serve handles requests until disconnect request or end of the input.
+func (s *Server) Serve() error {
+	for {
+		msg, err := readMessage(s.in)
+		if err == io.EOF {
+			s.stop()
+			return nil
+		}
+		if err != nil {
+			s.stop()
+			return err
+		}
+		if msg.Type != "request" {
+			continue
+		}
+
+		if msg.Command == "disconnect" {
+			s.stop()
+			return s.respond(msg, nil, nil)
+		}
+
+		h, ok := handlers[msg.Command]
+		if !ok {
+			if err := s.respond(msg, nil, fmt.Errorf("unsupported command %s", msg.Command)); err != nil {
+				return err
+			}
+			continue
+		}
+		body, err := h(s, msg.Arguments)
+		if err := s.respond(msg, body, err); err != nil {
+			return err
+		}
+		if msg.Command == "initialize" {
+			// breakpoints are expected only after the response
+			s.event("initialized", nil)
+		}
+	}
+}
+
+func (s *Server) send(msg *message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seq++
+	msg.Seq = s.seq
+	return writeMessage(s.out, msg)
+}
+
+func (s *Server) respond(request *message, body interface{}, err error) error {
+	success := err == nil
+	response := &message{Type: "response", RequestSeq: request.Seq, Command: request.Command, Success: &success}
+	if err != nil {
+		response.Message = err.Error()
+	} else if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		response.Body = encoded
+	}
+	return s.send(response)
+}
+
+func (s *Server) event(name string, body interface{}) error {
+	event := &message{Type: "event", Event: name}
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		event.Body = encoded
+	}
+	return s.send(event)
+}
+
+func decode(args json.RawMessage, v interface{}) error {
+	if len(args) == 0 {
+		return nil
+	}
+	return json.Unmarshal(args, v)
+}
+
+func (s *Server) initialize(args json.RawMessage) (interface{}, error) {
+	return map[string]interface{}{
+		"supportsConfigurationDoneRequest": true,
+		"supportsEvaluateForHovers":        true,
+	}, nil
+}
+
+func (s *Server) launch(args json.RawMessage) (interface{}, error) {
+	var a LaunchArguments
+	if err := decode(args, &a); err != nil {
+		return nil, err
+	}
+	src, err := ioutil.ReadFile(a.Program)
+	if err != nil {
+		return nil, err
+	}
+	p := parser.New(tokenizer.New(string(src)))
+	program := p.ParseProgram()
+	if len(p.Errors) != 0 {
+		return nil, errors.New(strings.Join(p.Errors, "\n"))
+	}
+	if err := eval.Expand(program); err != nil {
+		return nil, err
+	}
+	if err := eval.Resolve(program, nil); err != nil {
+		return nil, err
+	}
+
+	s.path = a.Program
+	s.program = program
+	s.stopOnEntry = a.StopOnEntry
+	s.statements = make(map[int]bool)
+	ast.Inspect(program, func(node ast.Node) bool {
+		if stmt, ok := node.(ast.Statement); ok {
+			s.statements[stmt.Pos().Line] = true
+		}
+		return true
+	})
+	s.launched = true
+	s.start()
+	return nil, nil
+}
+
+func (s *Server) configurationDone(args json.RawMessage) (interface{}, error) {
+	s.configured = true
+	s.start()
+	return nil, nil
+}
+
+func (s *Server) setBreakpoints(args json.RawMessage) (interface{}, error) {
+	var a SetBreakpointsArguments
+	if err := decode(args, &a); err != nil {
+		return nil, err
+	}
+
+	s.debugger.ClearBreakpoints()
+	breakpoints := []Breakpoint{}
+	for _, b := range a.Breakpoints {
+		// without program all lines are accepted, they are verified once
+		// it is loaded
+		if s.program != nil && !s.statements[b.Line] {
+			breakpoints = append(breakpoints, Breakpoint{Line: b.Line, Message: "no statement on the line"})
+			continue
+		}
+		s.debugger.SetBreakpoint(b.Line)
+		breakpoints = append(breakpoints, Breakpoint{Verified: true, Line: b.Line})
+	}
+	return map[string]interface{}{"breakpoints": breakpoints}, nil
+}
+
+// start runs the program once it is launched and configured
+func (s *Server) start() {
+	if !s.launched || !s.configured || s.running {
+		return
+	}
+	s.running = true
+
+	go func() {
+		defer close(s.done)
+		result, err := s.debugger.Run(s.program, object.NewEnvironment(nil))
+		exitCode := 0
+		switch {
+		case err != nil:
+			exitCode = 1
+		case result != nil && result.Type() == object.ERROR:
+			s.event("output", OutputEvent{Category: "stderr", Output: result.Print() + "\n"})
+			exitCode = 1
+		case result != nil:
+			s.event("output", OutputEvent{Category: "console", Output: result.Print() + "\n"})
+		}
+		s.event("exited", ExitedEvent{ExitCode: exitCode})
+		s.event("terminated", nil)
+	}()
+}
+
+// pause is called by the debugger in the program goroutine, it blocks until
+// the client resumes the program
+func (s *Server) pause(stmt ast.Statement) debug.Action {
+	line := stmt.Pos().Line
+	breakpoint := false
+	for _, l := range s.debugger.Breakpoints() {
+		breakpoint = breakpoint || l == line
+	}
+
+	s.mu.Lock()
+	if s.stopping {
+		s.mu.Unlock()
+		return debug.Stop
+	}
+	reason := "step"
+	if breakpoint {
+		reason = "breakpoint"
+	}
+	if !s.entered {
+		s.entered = true
+		if !s.stopOnEntry && !breakpoint {
+			s.mu.Unlock()
+			return debug.Continue
+		}
+		if s.stopOnEntry {
+			reason = "entry"
+		}
+	}
+	s.paused = true
+	s.mu.Unlock()
+
+	s.event("stopped", StoppedEvent{Reason: reason, ThreadID: threadID, AllThreadsStopped: true})
+	return <-s.resume
+}
+
+func (s *Server) isPaused() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.paused
+}
+
+// resumeWith returns handler resuming the paused program with the action
+func resumeWith(action debug.Action) handler {
+	return func(s *Server, args json.RawMessage) (interface{}, error) {
+		s.mu.Lock()
+		if !s.paused {
+			s.mu.Unlock()
+			return nil, errNotPaused
+		}
+		s.paused = false
+		s.mu.Unlock()
+
+		s.handles = make(map[int]interface{})
+		s.resume <- action
+		if action == debug.Continue {
+			return map[string]interface{}{"allThreadsContinued": true}, nil
+		}
+		return nil, nil
+	}
+}
+
+// stop aborts the running program and waits until it finishes
+func (s *Server) stop() {
+	if !s.running {
+		return
+	}
+	s.mu.Lock()
+	s.stopping = true
+	paused := s.paused
+	s.paused = false
+	s.mu.Unlock()
+	if paused {
+		s.resume <- debug.Stop
+	}
+	<-s.done
+}
+
+func (s *Server) threads(args json.RawMessage) (interface{}, error) {
+	return map[string]interface{}{"threads": []Thread{{ID: threadID, Name: "main"}}}, nil
+}
+
+func (s *Server) stackTrace(args json.RawMessage) (interface{}, error) {
+	if !s.isPaused() {
+		return nil, errNotPaused
+	}
+	frames := []StackFrame{}
+	for i, f := range s.debugger.Frames() {
+		frames = append(frames, StackFrame{
+			ID:     i,
+			Name:   f.Name,
+			Source: Source{Name: filepath.Base(s.path), Path: s.path},
+			Line:   f.Pos.Line,
+			Column: f.Pos.Column,
+		})
+	}
+	return map[string]interface{}{"stackFrames": frames, "totalFrames": len(frames)}, nil
+}
+
+// frame returns the paused frame with the id
+func (s *Server) frame(id int) (*debug.Frame, error) {
+	if !s.isPaused() {
+		return nil, errNotPaused
+	}
+	frames := s.debugger.Frames()
+	if id < 0 || id >= len(frames) {
+		return nil, fmt.Errorf("unknown frame %d", id)
+	}
+	return frames[id], nil
+}
+
+func (s *Server) handle(value interface{}) int {
+	id := len(s.handles) + 1
+	s.handles[id] = value
+	return id
+}
+
+// scopes are the environments of the frame from the innermost one
+func (s *Server) scopes(args json.RawMessage) (interface{}, error) {
+	var a FrameArguments
+	if err := decode(args, &a); err != nil {
+		return nil, err
+	}
+	frame, err := s.frame(a.FrameID)
+	if err != nil {
+		return nil, err
+	}
+
+	scopes := []Scope{}
+	level := 0
+	for env := frame.Env; env != nil; env = env.Outer() {
+		name := "Locals"
+		if env.Outer() == nil {
+			name = "Globals"
+		} else if level > 0 {
+			name = fmt.Sprintf("Outer %d", level)
+		}
+		scopes = append(scopes, Scope{Name: name, VariablesReference: s.handle(env)})
+		level++
+	}
+	return map[string]interface{}{"scopes": scopes}, nil
+}
+
+func (s *Server) variables(args json.RawMessage) (interface{}, error) {
+	var a VariablesArguments
+	if err := decode(args, &a); err != nil {
+		return nil, err
+	}
+	if !s.isPaused() {
+		return nil, errNotPaused
+	}
+
+	variables := []Variable{}
+	switch value := s.handles[a.VariablesReference].(type) {
+	case *object.Environment:
+		for _, name := range value.Names() {
+			v, _ := value.Get(name)
+			variables = append(variables, s.variable(name, v))
+		}
+	case *object.Array:
+		for i, element := range value.Elements {
+			variables = append(variables, s.variable(fmt.Sprintf("[%d]", i), element))
+		}
+	case *object.Hash:
+		for _, key := range value.Keys {
+			pair := value.Pairs[key]
+			name := pair.Key.Print()
+			if key.Type == object.STRING {
+				name = fmt.Sprintf("%q", name)
+			}
+			variables = append(variables, s.variable("["+name+"]", pair.Value))
+		}
+	default:
+		return nil, fmt.Errorf("unknown variables reference %d", a.VariablesReference)
+	}
+	return map[string]interface{}{"variables": variables}, nil
+}
+
+// variable renders the value, elements of arrays and hashes can be expanded
+func (s *Server) variable(name string, value object.Object) Variable {
+	v := Variable{Name: name, Value: "null"}
+	if value == nil {
+		return v
+	}
+	v.Value = value.Print()
+	v.Type = string(value.Type())
+	switch value := value.(type) {
+	case *object.Array:
+		if len(value.Elements) > 0 {
+			v.VariablesReference = s.handle(value)
+		}
+	case *object.Hash:
+		if len(value.Keys) > 0 {
+			v.VariablesReference = s.handle(value)
+		}
+	}
+	return v
+}
+
+func (s *Server) evaluate(args json.RawMessage) (interface{}, error) {
+	var a EvaluateArguments
+	if err := decode(args, &a); err != nil {
+		return nil, err
+	}
+	id := 0
+	if a.FrameID != nil {
+		id = *a.FrameID
+	}
+	frame, err := s.frame(id)
+	if err != nil {
+		return nil, err
+	}
+	if frame.Env == nil {
+		return nil, errors.New("frame has no environment yet")
+	}
+
+	value, err := debug.Evaluate(a.Expression, frame.Env)
+	if err != nil {
+		return nil, err
+	}
+	if value.Type() == object.ERROR {
+		return nil, errors.New(value.Print())
+	}
+	v := s.variable("", value)
+	return map[string]interface{}{"result": v.Value, "type": v.Type, "variablesReference": v.VariablesReference}, nil
+}
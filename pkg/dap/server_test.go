@@ -0,0 +1,309 @@
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const source = `let xs = [1, 2];
+let add = fn(a, b) {
+  let sum = a + b;
+  sum
+};
+let x = add(1, 2);
+add(x, len(xs))`
+
+type client struct {
+	t        *testing.T
+	in       io.WriteCloser
+	messages chan *message
+	seq      int
+	served   chan error
+}
+
+func newClient(t *testing.T) *client {
+	serverIn, clientOut := io.Pipe()
+	clientIn, serverOut := io.Pipe()
+	c := &client{t: t, in: clientOut, messages: make(chan *message, 100), served: make(chan error, 1)}
+
+	go func() {
+		c.served <- New(serverIn, serverOut).Serve()
+		serverOut.Close()
+	}()
+	go func() {
+		r := bufio.NewReader(clientIn)
+		for {
+			msg, err := readMessage(r)
+			if err != nil {
+				close(c.messages)
+				return
+			}
+			c.messages <- msg
+		}
+	}()
+	return c
+}
+
+// request sends the request and returns its successful response body
+func (c *client) request(command string, args interface{}, body interface{}) {
+	c.t.Helper()
+	response := c.send(command, args)
+	if response.Success == nil || !*response.Success {
+		c.t.Fatalf("%s failed: %s", command, response.Message)
+	}
+	if body != nil {
+		if err := json.Unmarshal(response.Body, body); err != nil {
+			c.t.Fatalf("%s: %v", command, err)
+		}
+	}
+}
+
+func (c *client) send(command string, args interface{}) *message {
+	c.t.Helper()
+	c.seq++
+	encoded, _ := json.Marshal(args)
+	if err := writeMessage(c.in, &message{Seq: c.seq, Type: "request", Command: command, Arguments: encoded}); err != nil {
+		c.t.Fatal(err)
+	}
+	for {
+		msg := c.next()
+		if msg.Type == "response" && msg.RequestSeq == c.seq {
+			return msg
+		}
+	}
+}
+
+// event waits for the event skipping other messages, body of the event is
+// decoded into body
+func (c *client) event(name string, body interface{}) {
+	c.t.Helper()
+	for {
+		msg := c.next()
+		if msg.Type == "event" && msg.Event == name {
+			if body != nil {
+				json.Unmarshal(msg.Body, body)
+			}
+			return
+		}
+	}
+}
+
+func (c *client) next() *message {
+	c.t.Helper()
+	select {
+	case msg, ok := <-c.messages:
+		if !ok {
+			c.t.Fatal("connection closed")
+		}
+		return msg
+	case <-time.After(5 * time.Second):
+		c.t.Fatal("timeout waiting for message")
+	}
+	return nil
+}
+
+func (c *client) position() string {
+	c.t.Helper()
+	var trace struct {
+		StackFrames []StackFrame `json:"stackFrames"`
+	}
+	c.request("stackTrace", map[string]int{"threadId": threadID}, &trace)
+	var frames string
+	for i, f := range trace.StackFrames {
+		if i > 0 {
+			frames += " "
+		}
+		frames += fmt.Sprintf("%s:%d", f.Name, f.Line)
+	}
+	return frames
+}
+
+func launch(t *testing.T, stopOnEntry bool, breakpoints ...int) *client {
+	dir, err := ioutil.TempDir("", "dap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, "program.mk")
+	if err := ioutil.WriteFile(path, []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := newClient(t)
+	c.request("initialize", map[string]string{"adapterID": "monkey"}, nil)
+	c.event("initialized", nil)
+	c.request("launch", LaunchArguments{Program: path, StopOnEntry: stopOnEntry}, nil)
+
+	var sourceBreakpoints []SourceBreakpoint
+	for _, line := range breakpoints {
+		sourceBreakpoints = append(sourceBreakpoints, SourceBreakpoint{Line: line})
+	}
+	var set struct {
+		Breakpoints []Breakpoint `json:"breakpoints"`
+	}
+	c.request("setBreakpoints", SetBreakpointsArguments{Source: Source{Path: path}, Breakpoints: sourceBreakpoints}, &set)
+	for i, b := range set.Breakpoints {
+		if !b.Verified {
+			t.Errorf("breakpoint %d at line %d not verified: %s", i, b.Line, b.Message)
+		}
+	}
+	c.request("configurationDone", nil, nil)
+	return c
+}
+
+func (c *client) disconnect() {
+	c.t.Helper()
+	c.request("disconnect", nil, nil)
+	if err := <-c.served; err != nil {
+		c.t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestStepping(t *testing.T) {
+	c := launch(t, true)
+
+	var stopped StoppedEvent
+	steps := []struct {
+		command  string
+		reason   string
+		position string
+	}{
+		{"", "entry", "<main>:1"},
+		{"next", "step", "<main>:2"},
+		{"next", "step", "<main>:6"},
+		{"stepIn", "step", "add:3 <main>:6"},
+		{"next", "step", "add:4 <main>:6"},
+		{"stepOut", "step", "<main>:7"},
+	}
+	for _, step := range steps {
+		if step.command != "" {
+			c.request(step.command, map[string]int{"threadId": threadID}, nil)
+		}
+		c.event("stopped", &stopped)
+		if stopped.Reason != step.reason {
+			t.Errorf("%s: expected reason %s, got %s", step.command, step.reason, stopped.Reason)
+		}
+		if position := c.position(); position != step.position {
+			t.Errorf("%s: expected position %s, got %s", step.command, step.position, position)
+		}
+	}
+
+	c.request("continue", map[string]int{"threadId": threadID}, nil)
+	var output OutputEvent
+	c.event("output", &output)
+	if output.Output != "5\n" {
+		t.Errorf("unexpected output %q", output.Output)
+	}
+	var exited ExitedEvent
+	c.event("exited", &exited)
+	c.event("terminated", nil)
+	c.disconnect()
+}
+
+func TestInspection(t *testing.T) {
+	c := launch(t, false, 4)
+
+	var stopped StoppedEvent
+	c.event("stopped", &stopped)
+	if stopped.Reason != "breakpoint" || c.position() != "add:4 <main>:6" {
+		t.Fatalf("unexpected stop %+v at %s", stopped, c.position())
+	}
+
+	var scopes struct {
+		Scopes []Scope `json:"scopes"`
+	}
+	c.request("scopes", FrameArguments{FrameID: 0}, &scopes)
+	var names []string
+	for _, s := range scopes.Scopes {
+		names = append(names, s.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"Locals", "Globals"}) {
+		t.Fatalf("unexpected scopes %v", names)
+	}
+
+	variables := func(reference int) []string {
+		var body struct {
+			Variables []Variable `json:"variables"`
+		}
+		c.request("variables", VariablesArguments{VariablesReference: reference}, &body)
+		var result []string
+		for _, v := range body.Variables {
+			result = append(result, fmt.Sprintf("%s=%s", v.Name, v.Value))
+			if v.Name == "xs" {
+				result = append(result, fmt.Sprintf("%v", variablesOf(c, v.VariablesReference)))
+			}
+		}
+		return result
+	}
+	locals := variables(scopes.Scopes[0].VariablesReference)
+	if !reflect.DeepEqual(locals, []string{"a=1", "b=2", "sum=3"}) {
+		t.Errorf("unexpected locals %v", locals)
+	}
+	globals := variables(scopes.Scopes[1].VariablesReference)
+	if len(globals) != 3 || globals[1] != "xs=[1, 2]" || globals[2] != "[[0]=1 [1]=2]" {
+		t.Errorf("unexpected globals %v", globals)
+	}
+
+	var result struct {
+		Result string `json:"result"`
+	}
+	c.request("evaluate", map[string]interface{}{"expression": "sum * 10", "frameId": 0, "context": "watch"}, &result)
+	if result.Result != "30" {
+		t.Errorf("unexpected evaluation %q", result.Result)
+	}
+	c.request("evaluate", map[string]interface{}{"expression": "len(xs)", "frameId": 1, "context": "watch"}, &result)
+	if result.Result != "2" {
+		t.Errorf("unexpected evaluation %q", result.Result)
+	}
+	if response := c.send("evaluate", map[string]interface{}{"expression": "missing", "frameId": 0}); *response.Success {
+		t.Errorf("expected failure for undefined name")
+	}
+
+	// the second call stops at the breakpoint too, the program is stopped
+	// by disconnect
+	c.request("continue", map[string]int{"threadId": threadID}, nil)
+	c.event("stopped", &stopped)
+	c.request("evaluate", map[string]interface{}{"expression": "sum"}, &result)
+	if result.Result != "5" {
+		t.Errorf("unexpected evaluation %q", result.Result)
+	}
+	c.disconnect()
+}
+
+func variablesOf(c *client, reference int) []string {
+	var body struct {
+		Variables []Variable `json:"variables"`
+	}
+	c.request("variables", VariablesArguments{VariablesReference: reference}, &body)
+	var result []string
+	for _, v := range body.Variables {
+		result = append(result, fmt.Sprintf("%s=%s", v.Name, v.Value))
+	}
+	return result
+}
+
+func TestUnverifiedBreakpoint(t *testing.T) {
+	c := launch(t, false)
+
+	var set struct {
+		Breakpoints []Breakpoint `json:"breakpoints"`
+	}
+	c.request("setBreakpoints", SetBreakpointsArguments{Breakpoints: []SourceBreakpoint{{Line: 5}, {Line: 100}}}, &set)
+	for _, b := range set.Breakpoints {
+		if b.Verified {
+			t.Errorf("breakpoint at line %d should not be verified", b.Line)
+		}
+	}
+	if response := c.send("stackTrace", nil); *response.Success {
+		t.Errorf("expected stack trace to fail while running")
+	}
+	c.disconnect()
+}
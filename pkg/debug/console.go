@@ -0,0 +1,297 @@
+package debug
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/alenkacz/interpreter-book/pkg/ast"
+	"github.com/alenkacz/interpreter-book/pkg/eval"
+	"github.com/alenkacz/interpreter-book/pkg/object"
+	"github.com/alenkacz/interpreter-book/pkg/parser"
+	"github.com/alenkacz/interpreter-book/pkg/tokenizer"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const PROMPT = "(mdb) "
+
+// Console is an interactive terminal debugger of a single program
+type Console struct {
+	*Debugger
+
+	in    *bufio.Scanner
+	out   io.Writer
+	lines []string
+	// frame selected for inspection, 0 is the innermost one
+	selected int
+	// input ended, the program runs to its end without pausing
+	detached bool
+}
+
+type consoleCommand struct {
+	usage string
+	help  string
+	// run handles the command, returned action resumes the evaluation
+	run func(c *Console, args []string) (Action, bool)
+}
+
+var consoleCommands map[string]*consoleCommand
+
+// aliases are short names of console commands
+var aliases = map[string]string{
+	"b":  "break",
+	"c":  "continue",
+	"s":  "step",
+	"n":  "next",
+	"o":  "out",
+	"p":  "print",
+	"bt": "where",
+	"l":  "list",
+	"q":  "quit",
+	"h":  "help",
+}
+
+func init() {
+	consoleCommands = map[string]*consoleCommand{
+		"break": {"break line", "set breakpoint at the line", func(c *Console, args []string) (Action, bool) {
+			if line, ok := c.line(args); ok {
+				c.SetBreakpoint(line)
+				fmt.Fprintf(c.out, "breakpoint at line %d\n", line)
+			}
+			return 0, false
+		}},
+		"clear": {"clear line", "remove breakpoint from the line", func(c *Console, args []string) (Action, bool) {
+			if line, ok := c.line(args); ok {
+				c.ClearBreakpoint(line)
+			}
+			return 0, false
+		}},
+		"breakpoints": {"breakpoints", "list breakpoints", func(c *Console, args []string) (Action, bool) {
+			for _, line := range c.Breakpoints() {
+				fmt.Fprintf(c.out, "line %d: %s\n", line, c.source(line))
+			}
+			return 0, false
+		}},
+		"continue": {"continue", "run until the next breakpoint", func(c *Console, args []string) (Action, bool) {
+			return Continue, true
+		}},
+		"step": {"step", "step to the next statement, entering functions", func(c *Console, args []string) (Action, bool) {
+			return StepIn, true
+		}},
+		"next": {"next", "step to the next statement of the current function", func(c *Console, args []string) (Action, bool) {
+			return StepOver, true
+		}},
+		"out": {"out", "run until the current function returns", func(c *Console, args []string) (Action, bool) {
+			return StepOut, true
+		}},
+		"where": {"where", "print the call stack", func(c *Console, args []string) (Action, bool) {
+			for i, f := range c.Frames() {
+				marker := " "
+				if i == c.selected {
+					marker = "*"
+				}
+				fmt.Fprintf(c.out, "%s #%d %s at %s\n", marker, i, f.Name, f.Pos)
+			}
+			return 0, false
+		}},
+		"frame": {"frame n", "select frame n of the call stack for inspection", func(c *Console, args []string) (Action, bool) {
+			n, err := argument(args)
+			if err != nil || n < 0 || n >= len(c.Frames()) {
+				fmt.Fprintf(c.out, "usage: frame n, where n is between 0 and %d\n", len(c.Frames())-1)
+				return 0, false
+			}
+			c.selected = n
+			f := c.Frames()[n]
+			fmt.Fprintf(c.out, "#%d %s at %s\n", n, f.Name, f.Pos)
+			return 0, false
+		}},
+		"vars": {"vars", "print variables of the selected frame and its outer environments", func(c *Console, args []string) (Action, bool) {
+			level := 0
+			for env := c.env(); env != nil; env = env.Outer() {
+				fmt.Fprintf(c.out, "environment %d:\n", level)
+				for _, name := range env.Names() {
+					value, _ := env.Get(name)
+					fmt.Fprintf(c.out, "  %s = %s\n", name, describe(value))
+				}
+				level++
+			}
+			return 0, false
+		}},
+		"print": {"print expression", "evaluate the expression in the selected frame", func(c *Console, args []string) (Action, bool) {
+			env := c.env()
+			if env == nil {
+				fmt.Fprintln(c.out, "no environment in the selected frame")
+				return 0, false
+			}
+			value, err := Evaluate(strings.Join(args, " "), env)
+			if err != nil {
+				fmt.Fprintln(c.out, err)
+				return 0, false
+			}
+			fmt.Fprintln(c.out, describe(value))
+			return 0, false
+		}},
+		"list": {"list", "print source around the current line", func(c *Console, args []string) (Action, bool) {
+			current := c.Frames()[c.selected].Pos.Line
+			for line := current - 3; line <= current+3; line++ {
+				if line < 1 || line > len(c.lines) {
+					continue
+				}
+				marker := "  "
+				if line == current {
+					marker = "=>"
+				}
+				fmt.Fprintf(c.out, "%s %3d  %s\n", marker, line, c.source(line))
+			}
+			return 0, false
+		}},
+		"quit": {"quit", "stop the program", func(c *Console, args []string) (Action, bool) {
+			return Stop, true
+		}},
+		"help": {"help", "print this help", func(c *Console, args []string) (Action, bool) {
+			c.help()
+			return 0, false
+		}},
+	}
+}
+
+// NewConsole returns debugger of the source reading commands from in.
+func NewConsole(source string, in io.Reader, out io.Writer) *Console {
+	c := &Console{
+		in:    bufio.NewScanner(in),
+		out:   out,
+		lines: strings.Split(source, "\n"),
+	}
+	c.Debugger = New(c.pause)
+	return c
+}
+
+// Run evaluates the source pausing before its first statement.
+func (c *Console) Run() error {
+	p := parser.New(tokenizer.New(strings.Join(c.lines, "\n")))
+	program := p.ParseProgram()
+	if len(p.Errors) != 0 {
+		return errors.New(strings.Join(p.Errors, "\n"))
+	}
+	if err := eval.Expand(program); err != nil {
+		return err
+	}
+	if err := eval.Resolve(program, nil); err != nil {
+		return err
+	}
+
+	result, err := c.Debugger.Run(program, object.NewEnvironment(nil))
+	if err != nil {
+		return err
+	}
+	if result != nil {
+		fmt.Fprintf(c.out, "program finished: %s\n", describe(result))
+	} else {
+		fmt.Fprintln(c.out, "program finished")
+	}
+	return nil
+}
+
+func (c *Console) pause(stmt ast.Statement) Action {
+	if c.detached {
+		return Continue
+	}
+	c.selected = 0
+	frame := c.Frames()[0]
+	fmt.Fprintf(c.out, "%s at %s\n", frame.Name, stmt.Pos())
+	fmt.Fprintf(c.out, "=> %3d  %s\n", stmt.Pos().Line, c.source(stmt.Pos().Line))
+
+	for {
+		fmt.Fprint(c.out, PROMPT)
+		if !c.in.Scan() {
+			fmt.Fprintln(c.out)
+			c.detached = true
+			return Continue
+		}
+		fields := strings.Fields(c.in.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		name := fields[0]
+		if alias, ok := aliases[name]; ok {
+			name = alias
+		}
+		command, ok := consoleCommands[name]
+		if !ok {
+			fmt.Fprintf(c.out, "unknown command %q, type help for the list of commands\n", fields[0])
+			continue
+		}
+		if action, resume := command.run(c, fields[1:]); resume {
+			return action
+		}
+	}
+}
+
+// env returns environment of the selected frame
+func (c *Console) env() *object.Environment {
+	return c.Frames()[c.selected].Env
+}
+
+func (c *Console) source(line int) string {
+	if line < 1 || line > len(c.lines) {
+		return ""
+	}
+	return c.lines[line-1]
+}
+
+func (c *Console) line(args []string) (int, bool) {
+	line, err := argument(args)
+	if err != nil || line < 1 || line > len(c.lines) {
+		fmt.Fprintf(c.out, "expected line number between 1 and %d\n", len(c.lines))
+		return 0, false
+	}
+	return line, true
+}
+
+func (c *Console) help() {
+	shortcuts := make(map[string]string)
+	for alias, name := range aliases {
+		shortcuts[name] = alias
+	}
+	for _, name := range []string{"break", "clear", "breakpoints", "continue", "step", "next", "out", "where", "frame", "vars", "print", "list", "quit", "help"} {
+		command := consoleCommands[name]
+		usage := command.usage
+		if alias, ok := shortcuts[name]; ok {
+			usage += " (" + alias + ")"
+		}
+		fmt.Fprintf(c.out, "  %-24s %s\n", usage, command.help)
+	}
+}
+
+func argument(args []string) (int, error) {
+	if len(args) != 1 {
+		return 0, errors.New("expected one argument")
+	}
+	return strconv.Atoi(args[0])
+}
+
+// describe prints the value on a single line, bodies of functions are left
+// out
+func describe(obj object.Object) string {
+	switch obj := obj.(type) {
+	case nil:
+		return "null"
+	case *object.Function:
+		params := make([]string, len(obj.Params))
+		for i, p := range obj.Params {
+			params[i] = p.Name
+			if i < len(obj.ParamPatterns) && obj.ParamPatterns[i] != nil {
+				params[i] = obj.ParamPatterns[i].String()
+			}
+			if obj.Variadic && i == len(obj.Params)-1 {
+				params[i] = "..." + params[i]
+			}
+			if i < len(obj.Defaults) && obj.Defaults[i] != nil {
+				params[i] += " = " + obj.Defaults[i].String()
+			}
+		}
+		return fmt.Sprintf("fn(%s) {...}", strings.Join(params, ", "))
+	}
+	return obj.Print()
+}
@@ -0,0 +1,75 @@
+package debug
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+const source = `let add = fn(a, b) {
+  let sum = a + b;
+  sum
+};
+let x = add(1, 2);
+let y = add(x, 3);
+y`
+
+func TestConsole(t *testing.T) {
+	commands := []string{"break 2", "c", "where", "vars", "print a + b", "out", "p x", "s", "s", "bt", "frame 1", "p x", "c"}
+	expected := `<main> at 1:1
+=>   1  let add = fn(a, b) {
+(mdb) breakpoint at line 2
+(mdb) add at 2:3
+=>   2    let sum = a + b;
+(mdb) * #0 add at 2:3
+  #1 <main> at 5:1
+(mdb) environment 0:
+  a = 1
+  b = 2
+environment 1:
+  add = fn(a, b) {...}
+(mdb) 3
+(mdb) <main> at 6:1
+=>   6  let y = add(x, 3);
+(mdb) 3
+(mdb) add at 2:3
+=>   2    let sum = a + b;
+(mdb) add at 3:3
+=>   3    sum
+(mdb) * #0 add at 3:3
+  #1 <main> at 6:1
+(mdb) #1 <main> at 6:1
+(mdb) 3
+(mdb) program finished: 6
+`
+
+	var out bytes.Buffer
+	in := strings.NewReader(strings.Join(commands, "\n") + "\n")
+	if err := NewConsole(source, in, &out).Run(); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if out.String() != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, out.String())
+	}
+}
+
+func TestConsoleQuit(t *testing.T) {
+	var out bytes.Buffer
+	err := NewConsole(source, strings.NewReader("unknown\nq\n"), &out).Run()
+	if err != ErrStopped {
+		t.Errorf("expected ErrStopped, got %v", err)
+	}
+	if !strings.Contains(out.String(), `unknown command "unknown"`) {
+		t.Errorf("unexpected output %q", out.String())
+	}
+}
+
+func TestConsoleEndOfInput(t *testing.T) {
+	var out bytes.Buffer
+	if err := NewConsole(source, strings.NewReader(""), &out).Run(); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if !strings.HasSuffix(out.String(), "program finished: 6\n") {
+		t.Errorf("unexpected output %q", out.String())
+	}
+}
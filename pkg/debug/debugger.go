@@ -0,0 +1,261 @@
+// Package debug implements stepping through Monkey programs with breakpoints
+// on top of the tracing hooks of the evaluator.
+package debug
+
+import (
+	"errors"
+	"github.com/alenkacz/interpreter-book/pkg/ast"
+	"github.com/alenkacz/interpreter-book/pkg/eval"
+	"github.com/alenkacz/interpreter-book/pkg/object"
+	"github.com/alenkacz/interpreter-book/pkg/parser"
+	"github.com/alenkacz/interpreter-book/pkg/token"
+	"github.com/alenkacz/interpreter-book/pkg/tokenizer"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Action tells the debugger how to continue after a pause
+type Action int
+
+const (
+	// Continue runs until the next breakpoint
+	Continue Action = iota
+	// StepIn pauses at the next statement, entering called functions
+	StepIn
+	// StepOver pauses at the next statement of the current function
+	StepOver
+	// StepOut pauses once the current function returns
+	StepOut
+	// Stop aborts the evaluation
+	Stop
+)
+
+// ErrStopped is returned by Run when the evaluation was aborted by Stop
+var ErrStopped = errors.New("evaluation stopped")
+
+// MainFrame is the name of the frame of the top-level statements
+const MainFrame = "<main>"
+
+// Frame is a function being evaluated
+type Frame struct {
+	// Name of the called function
+	Name string
+	// Call is the call expression of the frame, nil for the main frame
+	Call *ast.CallExpression
+	// Pos is the position of the statement evaluated in the frame
+	Pos token.Position
+	// Env is the environment of the statement evaluated in the frame, nil
+	// before the first statement of the function
+	Env *object.Environment
+}
+
+// TaskFrame is the name of the outermost frame of spawned tasks
+const TaskFrame = "<task>"
+
+// Debugger pauses evaluation on breakpoints and when stepping. Breakpoints
+// can be changed from other goroutines while the program runs. Spawned tasks
+// are stepped through separately, they pause only at breakpoints until
+// stepped and only one goroutine is paused at a time.
+type Debugger struct {
+	// Pause is called when the evaluation stops before the statement, the
+	// evaluation continues according to the returned action
+	Pause func(stmt ast.Statement) Action
+
+	mu          sync.Mutex
+	breakpoints map[int]bool
+	stopped     bool
+	// paused is the program or task in Pause
+	paused *thread
+
+	// pausing serializes calls of Pause
+	pausing sync.Mutex
+}
+
+// thread is the stepping state of the program or of a spawned task, it is
+// changed only by the goroutine evaluating it
+type thread struct {
+	d      *Debugger
+	frames []*Frame
+	action Action
+	// depth of the frame where the step started
+	depth int
+	// line and depth of the last pause, statements on the same line are
+	// not paused at again
+	pausedLine  int
+	pausedDepth int
+}
+
+// New returns debugger pausing at the first statement.
+func New(pause func(stmt ast.Statement) Action) *Debugger {
+	return &Debugger{Pause: pause, breakpoints: make(map[int]bool)}
+}
+
+// SetBreakpoint sets breakpoint at the line.
+func (d *Debugger) SetBreakpoint(line int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.breakpoints[line] = true
+}
+
+// ClearBreakpoint removes breakpoint from the line.
+func (d *Debugger) ClearBreakpoint(line int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.breakpoints, line)
+}
+
+// ClearBreakpoints removes all breakpoints.
+func (d *Debugger) ClearBreakpoints() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.breakpoints = make(map[int]bool)
+}
+
+// Breakpoints returns lines with breakpoints.
+func (d *Debugger) Breakpoints() []int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var lines []int
+	for line := range d.breakpoints {
+		lines = append(lines, line)
+	}
+	sort.Ints(lines)
+	return lines
+}
+
+func (d *Debugger) hasBreakpoint(line int) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.breakpoints[line]
+}
+
+func (d *Debugger) isStopped() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.stopped
+}
+
+// Frames returns the call stack of the paused program or task starting with
+// the innermost frame, it is valid only while the evaluation is paused.
+func (d *Debugger) Frames() []*Frame {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.paused == nil {
+		return nil
+	}
+	frames := make([]*Frame, len(d.paused.frames))
+	for i, f := range d.paused.frames {
+		frames[len(frames)-1-i] = f
+	}
+	return frames
+}
+
+// Run evaluates the program in the environment.
+func (d *Debugger) Run(program *ast.Program, env *object.Environment) (object.Object, error) {
+	d.mu.Lock()
+	d.stopped = false
+	d.mu.Unlock()
+	in := eval.New()
+	in.Trace = d.tracer(&thread{d: d, frames: []*Frame{{Name: MainFrame}}, action: StepIn})
+	result := in.Eval(program, env)
+	if d.isStopped() {
+		return nil, ErrStopped
+	}
+	return result, nil
+}
+
+func (d *Debugger) tracer(t *thread) *eval.Tracer {
+	return &eval.Tracer{
+		Statement: t.statement,
+		Call:      t.call,
+		Return:    t.ret,
+		Spawn: func() *eval.Tracer {
+			return d.tracer(&thread{d: d, frames: []*Frame{{Name: TaskFrame}}, action: Continue})
+		},
+	}
+}
+
+// statement pauses before the statement when needed, it fails once the
+// evaluation was stopped so that the program and all tasks finish
+func (t *thread) statement(stmt ast.Statement, env *object.Environment) error {
+	d := t.d
+	if d.isStopped() {
+		return ErrStopped
+	}
+	frame := t.frames[len(t.frames)-1]
+	frame.Pos = stmt.Pos()
+	frame.Env = env
+
+	depth := len(t.frames)
+	line := stmt.Pos().Line
+	if line == t.pausedLine && depth == t.pausedDepth {
+		return nil
+	}
+	t.pausedLine = 0
+
+	var pause bool
+	switch t.action {
+	case StepIn:
+		pause = true
+	case StepOver:
+		pause = depth <= t.depth
+	case StepOut:
+		pause = depth < t.depth
+	}
+	if !pause && !d.hasBreakpoint(line) {
+		return nil
+	}
+
+	d.pausing.Lock()
+	defer d.pausing.Unlock()
+	if d.isStopped() {
+		return ErrStopped
+	}
+	t.pausedLine = line
+	t.pausedDepth = depth
+	d.mu.Lock()
+	d.paused = t
+	d.mu.Unlock()
+	t.action = d.Pause(stmt)
+	t.depth = depth
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.paused = nil
+	if t.action == Stop {
+		d.stopped = true
+		return ErrStopped
+	}
+	return nil
+}
+
+func (t *thread) call(call *ast.CallExpression, function object.Object, env *object.Environment) {
+	if _, ok := function.(*object.Function); ok {
+		t.frames = append(t.frames, &Frame{Name: call.Function.Name, Call: call, Pos: call.Position})
+	}
+}
+
+func (t *thread) ret(call *ast.CallExpression, function object.Object, result object.Object) {
+	if _, ok := function.(*object.Function); ok {
+		t.frames = t.frames[:len(t.frames)-1]
+		// the caller continues on the line it was paused at
+		t.pausedLine = 0
+	}
+}
+
+// Evaluate evaluates the expression in the environment without tracing, it
+// is used to inspect values of paused programs.
+func Evaluate(expression string, env *object.Environment) (object.Object, error) {
+	p := parser.New(tokenizer.New(expression))
+	program := p.ParseProgram()
+	if len(p.Errors) != 0 {
+		return nil, errors.New(strings.Join(p.Errors, "\n"))
+	}
+
+	result := eval.Eval(program, env)
+	if result == nil {
+		return object.NULL, nil
+	}
+	return result, nil
+}
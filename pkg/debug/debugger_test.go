@@ -0,0 +1,149 @@
+package debug
+
+import (
+	"fmt"
+	"github.com/alenkacz/interpreter-book/pkg/ast"
+	"github.com/alenkacz/interpreter-book/pkg/object"
+	"github.com/alenkacz/interpreter-book/pkg/parser"
+	"github.com/alenkacz/interpreter-book/pkg/tokenizer"
+	"reflect"
+	"testing"
+)
+
+func TestStepping(t *testing.T) {
+	input := `let inc = fn(n) {
+  n + 1
+};
+let twice = fn(n) {
+  let once = inc(n);
+  inc(once)
+};
+twice(1);
+inc(5);`
+
+	tests := []struct {
+		name        string
+		breakpoints []int
+		actions     []Action
+		// paused statements as frame names and lines
+		expected []string
+	}{
+		{"continue", nil, []Action{Continue}, []string{"<main>:1"}},
+		{"breakpoints", []int{2, 9}, []Action{Continue, Continue, Continue, Continue, Continue}, []string{"<main>:1", "inc:2", "inc:2", "<main>:9", "inc:2"}},
+		{
+			"step in",
+			nil,
+			[]Action{StepIn, StepIn, StepIn, StepIn, StepIn, StepIn, StepIn, StepIn, Continue},
+			[]string{"<main>:1", "<main>:4", "<main>:8", "twice:5", "inc:2", "twice:6", "inc:2", "<main>:9", "inc:2"},
+		},
+		{
+			"step over",
+			nil,
+			[]Action{StepOver, StepOver, StepIn, StepOver, StepOver, StepOver},
+			[]string{"<main>:1", "<main>:4", "<main>:8", "twice:5", "twice:6", "<main>:9"},
+		},
+		{
+			"step out",
+			nil,
+			[]Action{StepOver, StepOver, StepIn, StepIn, StepOut, StepOut, Continue},
+			[]string{"<main>:1", "<main>:4", "<main>:8", "twice:5", "inc:2", "twice:6", "<main>:9"},
+		},
+		{
+			// breakpoints are hit also when stepping over
+			"step over breakpoint",
+			[]int{2},
+			[]Action{StepOver, StepOver, StepOver, StepOver, Continue, Continue, Continue},
+			[]string{"<main>:1", "<main>:4", "<main>:8", "inc:2", "twice:6", "inc:2", "inc:2"},
+		},
+	}
+
+	for _, tt := range tests {
+		var paused []string
+		var d *Debugger
+		d = New(func(stmt ast.Statement) Action {
+			frame := d.Frames()[0]
+			paused = append(paused, fmt.Sprintf("%s:%d", frame.Name, stmt.Pos().Line))
+			if len(paused) > len(tt.actions) {
+				return Stop
+			}
+			return tt.actions[len(paused)-1]
+		})
+		for _, line := range tt.breakpoints {
+			d.SetBreakpoint(line)
+		}
+
+		program := parser.New(tokenizer.New(input)).ParseProgram()
+		result, err := d.Run(program, object.NewEnvironment(nil))
+		if err != nil {
+			t.Errorf("%s: unexpected error %v, paused at %v", tt.name, err, paused)
+			continue
+		}
+		if result.Print() != "6" {
+			t.Errorf("%s: unexpected result %s", tt.name, result.Print())
+		}
+		if !reflect.DeepEqual(paused, tt.expected) {
+			t.Errorf("%s: expected pauses %v, got %v", tt.name, tt.expected, paused)
+		}
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	env := object.NewEnvironment(nil)
+	env.Set("x", &object.Integer{Value: 2})
+	inner := object.NewEnvironment(env)
+
+	result, err := Evaluate("x * 3", inner)
+	if err != nil || result.Print() != "6" {
+		t.Errorf("unexpected result %v, error %v", result, err)
+	}
+	if _, err := Evaluate("x *", inner); err == nil {
+		t.Errorf("expected parse error")
+	}
+}
+
+func TestSpawn(t *testing.T) {
+	input := `let square = fn(x) { x * x };
+let work = fn(n) {
+  let s = square(n);
+  s + 1
+};
+let tasks = [spawn(work, 1), spawn(work, 2), spawn(work, 3)];
+[await(tasks[0]), await(tasks[1]), await(tasks[2])]`
+
+	tests := []struct {
+		name    string
+		actions []Action
+		// paused statements as frame names, depths and lines
+		expected []string
+		err      error
+	}{
+		{"continue", []Action{Continue, Continue, Continue, Continue}, []string{"<main>:1:1", "<task>:1:3", "<task>:1:3", "<task>:1:3"}, nil},
+		{"step in", []Action{Continue, StepIn, Continue, Continue, Continue}, []string{"<main>:1:1", "<task>:1:3", "square:2:1", "<task>:1:3", "<task>:1:3"}, nil},
+		{"stop", []Action{Continue, Stop}, []string{"<main>:1:1", "<task>:1:3"}, ErrStopped},
+	}
+	for _, tt := range tests {
+		var paused []string
+		var d *Debugger
+		d = New(func(stmt ast.Statement) Action {
+			frames := d.Frames()
+			paused = append(paused, fmt.Sprintf("%s:%d:%d", frames[0].Name, len(frames), stmt.Pos().Line))
+			if len(paused) > len(tt.actions) {
+				return Stop
+			}
+			return tt.actions[len(paused)-1]
+		})
+		d.SetBreakpoint(3)
+
+		program := parser.New(tokenizer.New(input)).ParseProgram()
+		result, err := d.Run(program, object.NewEnvironment(nil))
+		if err != tt.err {
+			t.Errorf("%s: expected error %v, got %v", tt.name, tt.err, err)
+		}
+		if err == nil && result.Print() != "[2, 5, 10]" {
+			t.Errorf("%s: unexpected result %s", tt.name, result.Print())
+		}
+		if !reflect.DeepEqual(paused, tt.expected) {
+			t.Errorf("%s: expected pauses %v, got %v", tt.name, tt.expected, paused)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package eval
+
+import (
+	"math"
+	"math/big"
+
+	"github.com/alenkacz/interpreter-book/pkg/object"
+)
+
+func (in *Interpreter) evalIntegerArithmetic(left int64, right int64, operator string) object.Object {
+	var result int64
+	ok := true
+	switch operator {
+	case "+":
+		result, ok = addInt64(left, right)
+	case "-":
+		result, ok = subInt64(left, right)
+	case "*":
+		result, ok = mulInt64(left, right)
+	case "/":
+		if right == 0 {
+			return newError("division by zero: %d / %d", left, right)
+		}
+		// math.MinInt64 / -1 is the only quotient that does not fit
+		ok = !(left == math.MinInt64 && right == -1)
+		result = left / right
+	case "%":
+		if right == 0 {
+			return newError("modulo by zero: %d %% %d", left, right)
+		}
+		result = left % right
+	default:
+		return newError("unsupported operator %s%s%s", object.INTEGER, operator, object.INTEGER)
+	}
+	if !ok {
+		if in.CheckOverflow {
+			return newError("integer overflow: %d %s %d", left, operator, right)
+		}
+		return evalBigIntInfix(big.NewInt(left), big.NewInt(right), operator)
+	}
+	return &object.Integer{Value: result}
+}
+
+func evalBigIntInfix(left *big.Int, right *big.Int, operator string) object.Object {
+	switch operator {
+	case "+":
+		return &object.BigInt{Value: new(big.Int).Add(left, right)}
+	case "-":
+		return &object.BigInt{Value: new(big.Int).Sub(left, right)}
+	case "*":
+		return &object.BigInt{Value: new(big.Int).Mul(left, right)}
+	case "/":
+		if right.Sign() == 0 {
+			return newError("division by zero: %s / %s", left, right)
+		}
+		// Quo and Rem truncate towards zero the same way int64 operators do
+		return &object.BigInt{Value: new(big.Int).Quo(left, right)}
+	case "%":
+		if right.Sign() == 0 {
+			return newError("modulo by zero: %s %% %s", left, right)
+		}
+		return &object.BigInt{Value: new(big.Int).Rem(left, right)}
+	case "==":
+		return boolResultToObject(left.Cmp(right) == 0)
+	case "!=":
+		return boolResultToObject(left.Cmp(right) != 0)
+	case "<":
+		return boolResultToObject(left.Cmp(right) < 0)
+	case ">":
+		return boolResultToObject(left.Cmp(right) > 0)
+	default:
+		return newError("unsupported operator %s%s%s", object.BIGINT, operator, object.BIGINT)
+	}
+}
+
+// isBigIntOperation reports whether both operands are integers and at least
+// one of them is a BigInt, in which case the other one gets promoted.
+func isBigIntOperation(left object.Object, right object.Object) bool {
+	isInteger := func(o object.Object) bool {
+		return o.Type() == object.INTEGER || o.Type() == object.BIGINT
+	}
+	return isInteger(left) && isInteger(right) &&
+		(left.Type() == object.BIGINT || right.Type() == object.BIGINT)
+}
+
+func toBigInt(o object.Object) *big.Int {
+	switch o := o.(type) {
+	case *object.BigInt:
+		return o.Value
+	case *object.Integer:
+		return big.NewInt(o.Value)
+	}
+	return nil
+}
+
+func addInt64(a, b int64) (int64, bool) {
+	c := a + b
+	return c, (c > a) == (b > 0)
+}
+
+func subInt64(a, b int64) (int64, bool) {
+	c := a - b
+	return c, (c < a) == (b > 0)
+}
+
+func mulInt64(a, b int64) (int64, bool) {
+	if a == 0 || b == 0 {
+		return 0, true
+	}
+	c := a * b
+	if (a == -1 && b == math.MinInt64) || (b == -1 && a == math.MinInt64) {
+		return c, false
+	}
+	return c, c/b == a
+}
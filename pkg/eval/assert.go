@@ -0,0 +1,162 @@
+package eval
+
+import (
+	"fmt"
+	"github.com/alenkacz/interpreter-book/pkg/object"
+	"strings"
+)
+
+// assert fails when the condition is not truthy, the optional second
+// argument is added to the message of the failure
+func assert(args ...object.Object) object.Object {
+	if len(args) != 1 && len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=1 or 2", len(args))
+	}
+	if isTruthy(args[0]) {
+		return object.NULL
+	}
+	if len(args) == 2 {
+		return newError("assertion failed: %s", args[1].Print())
+	}
+	return newError("assertion failed")
+}
+
+// assertEqual fails when the actual value in the first argument is not
+// equal to the expected value in the second one, the message of the failure
+// lists the differences
+func assertEqual(args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2", len(args))
+	}
+	var diff []string
+	difference(&diff, "", args[0], args[1])
+	if len(diff) == 0 {
+		return object.NULL
+	}
+	return newError("assert_eq failed:\n%s", strings.Join(diff, "\n"))
+}
+
+// difference appends lines describing differences of the values, path is
+// the index expression of the compared elements of arrays
+func difference(diff *[]string, path string, actual object.Object, expected object.Object) {
+	prefix := ""
+	if path != "" {
+		prefix = path + ": "
+	}
+	switch {
+	case actual.Type() == object.ARRAY && expected.Type() == object.ARRAY:
+		a := actual.(*object.Array).Elements
+		e := expected.(*object.Array).Elements
+		for i := 0; i < len(a) && i < len(e); i++ {
+			difference(diff, fmt.Sprintf("%s[%d]", path, i), a[i], e[i])
+		}
+		if len(a) != len(e) {
+			*diff = append(*diff, fmt.Sprintf("%slength: expected %d, got %d", prefix, len(e), len(a)))
+		}
+	case actual.Type() == object.STRING && expected.Type() == object.STRING:
+		a := actual.(*object.String).Value
+		e := expected.(*object.String).Value
+		if a == e {
+			return
+		}
+		if !strings.Contains(a, "\n") && !strings.Contains(e, "\n") {
+			*diff = append(*diff, fmt.Sprintf("%sexpected %q, got %q", prefix, e, a))
+			return
+		}
+		*diff = append(*diff, prefix+"lines differ (- expected, + actual):")
+		*diff = append(*diff, diffLines(strings.Split(e, "\n"), strings.Split(a, "\n"))...)
+	case !equal(actual, expected):
+		*diff = append(*diff, fmt.Sprintf("%sexpected %s, got %s", prefix, describe(expected), describe(actual)))
+	}
+}
+
+func equal(a object.Object, b object.Object) bool {
+	if isNumber(a) && isNumber(b) {
+		return toBigInt(a).Cmp(toBigInt(b)) == 0
+	}
+	if a.Type() != b.Type() {
+		return false
+	}
+	switch a := a.(type) {
+	case *object.String:
+		return a.Value == b.(*object.String).Value
+	case *object.Array:
+		elements := b.(*object.Array).Elements
+		if len(a.Elements) != len(elements) {
+			return false
+		}
+		for i := range a.Elements {
+			if !equal(a.Elements[i], elements[i]) {
+				return false
+			}
+		}
+		return true
+	case *object.Hash:
+		pairs := b.(*object.Hash).Pairs
+		if len(a.Pairs) != len(pairs) {
+			return false
+		}
+		for key, pair := range a.Pairs {
+			other, ok := pairs[key]
+			if !ok || !equal(pair.Value, other.Value) {
+				return false
+			}
+		}
+		return true
+	}
+	// booleans and null are singletons, functions are compared by identity
+	return a == b
+}
+
+func isNumber(obj object.Object) bool {
+	return obj.Type() == object.INTEGER || obj.Type() == object.BIGINT
+}
+
+// describe prints strings quoted so they are not confused with other values
+func describe(obj object.Object) string {
+	if s, ok := obj.(*object.String); ok {
+		return fmt.Sprintf("%q", s.Value)
+	}
+	return obj.Print()
+}
+
+// diffLines returns the lines of the longest common subsequence indented by
+// two spaces, lines only in expected prefixed by "- " and lines only in
+// actual prefixed by "+ "
+func diffLines(expected []string, actual []string) []string {
+	// common[i][j] is length of the longest common subsequence of
+	// expected[i:] and actual[j:]
+	common := make([][]int, len(expected)+1)
+	for i := range common {
+		common[i] = make([]int, len(actual)+1)
+	}
+	for i := len(expected) - 1; i >= 0; i-- {
+		for j := len(actual) - 1; j >= 0; j-- {
+			if expected[i] == actual[j] {
+				common[i][j] = common[i+1][j+1] + 1
+			} else if common[i+1][j] >= common[i][j+1] {
+				common[i][j] = common[i+1][j]
+			} else {
+				common[i][j] = common[i][j+1]
+			}
+		}
+	}
+
+	var lines []string
+	i, j := 0, 0
+	for i < len(expected) || j < len(actual) {
+		switch {
+		case i < len(expected) && j < len(actual) && expected[i] == actual[j]:
+			lines = append(lines, "  "+expected[i])
+			i++
+			j++
+		case j == len(actual) || i < len(expected) && common[i+1][j] >= common[i][j+1]:
+			lines = append(lines, "- "+expected[i])
+			i++
+		default:
+			lines = append(lines, "+ "+actual[j])
+			j++
+		}
+	}
+	return lines
+}
@@ -2,103 +2,132 @@ package eval
 
 import "github.com/alenkacz/interpreter-book/pkg/object"
 
-var builtins = map[string]*object.BuiltIn {
-	"len": {
-		Fn: func(args ...object.Object) object.Object {
-			if len(args) != 1 {
-				return newError("wrong number of arguments. got=%d, want=1",
-					len(args))
-			}
-			switch arg := args[0].(type) {
-			case *object.String:
-				return &object.Integer{Value: int64(len(arg.Value))}
-			case *object.Array:
-				return &object.Integer{Value: int64(len(arg.Elements))}
-			default:
-				return newError("argument to `len` not supported, got %s",
-					args[0].Type())
-			}
+// standardBuiltins returns the builtin functions registered by New
+func standardBuiltins() map[string]*object.BuiltIn {
+	return map[string]*object.BuiltIn {
+		"len": {
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, want=1",
+						len(args))
+				}
+				switch arg := args[0].(type) {
+				case *object.String:
+					return &object.Integer{Value: int64(len(arg.Value))}
+				case *object.Array:
+					return &object.Integer{Value: int64(len(arg.Elements))}
+				case *object.Hash:
+					return &object.Integer{Value: int64(len(arg.Keys))}
+				default:
+					return newError("argument to `len` not supported, got %s",
+						args[0].Type())
+				}
+			},
 		},
-	},
-	"first": {
-		Fn: func(args ...object.Object) object.Object {
-			if len(args) != 1 {
-				return newError("wrong number of arguments. got=%d, want=1",
-					len(args))
-			}
-			switch arg := args[0].(type) {
-			case *object.Array:
-				if len(arg.Elements) == 0 {
-					return object.NULL
-				} else {
-					return arg.Elements[0]
+		"first": {
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, want=1",
+						len(args))
 				}
-			default:
-				return newError("argument to `first` not supported, got %s",
-					args[0].Type())
-			}
+				switch arg := args[0].(type) {
+				case *object.Array:
+					if len(arg.Elements) == 0 {
+						return object.NULL
+					} else {
+						return arg.Elements[0]
+					}
+				default:
+					return newError("argument to `first` not supported, got %s",
+						args[0].Type())
+				}
+			},
 		},
-	},
-	"last": {
-		Fn: func(args ...object.Object) object.Object {
-			if len(args) != 1 {
-				return newError("wrong number of arguments. got=%d, want=1",
-					len(args))
-			}
-			switch arg := args[0].(type) {
-			case *object.Array:
-				if len(arg.Elements) == 0 {
-					return object.NULL
-				} else {
-					return arg.Elements[len(arg.Elements)-1]
+		"last": {
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, want=1",
+						len(args))
 				}
-			default:
-				return newError("argument to `last` not supported, got %s",
-					args[0].Type())
-			}
+				switch arg := args[0].(type) {
+				case *object.Array:
+					if len(arg.Elements) == 0 {
+						return object.NULL
+					} else {
+						return arg.Elements[len(arg.Elements)-1]
+					}
+				default:
+					return newError("argument to `last` not supported, got %s",
+						args[0].Type())
+				}
+			},
 		},
-	},
-	"rest": {
-		Fn: func(args ...object.Object) object.Object {
-			if len(args) != 1 {
-				return newError("wrong number of arguments. got=%d, want=1",
-					len(args))
-			}
-			switch arg := args[0].(type) {
-			case *object.Array:
-				if len(arg.Elements) == 0 {
-					return object.NULL
-				} else {
-					var result []object.Object
-					for i, el := range arg.Elements {
-						if i != 0 {
-							result = append(result, el)
+		"rest": {
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, want=1",
+						len(args))
+				}
+				switch arg := args[0].(type) {
+				case *object.Array:
+					if len(arg.Elements) == 0 {
+						return object.NULL
+					} else {
+						var result []object.Object
+						for i, el := range arg.Elements {
+							if i != 0 {
+								result = append(result, el)
+							}
 						}
+						return &object.Array{Elements: result}
 					}
-					return &object.Array{Elements: result}
+				default:
+					return newError("argument to `last` not supported, got %s",
+						args[0].Type())
+				}
+			},
+		},
+		"push": {
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) != 2 {
+					return newError("wrong number of arguments. got=%d, want=2",
+						len(args))
 				}
-			default:
-				return newError("argument to `last` not supported, got %s",
-					args[0].Type())
-			}
+				if args[0].Type() != object.ARRAY {
+					return newError("argument to `push` must be ARRAY, got %s",
+						args[0].Type())
+				}
+				arr := args[0].(*object.Array)
+				length := len(arr.Elements)
+				newElements := make([]object.Object, length+1, length+1)
+				copy(newElements, arr.Elements)
+				newElements[length] = args[1]
+				return &object.Array{Elements: newElements}
+			},
+		},
+		"assert": {
+			Fn: assert,
+		},
+		"assert_eq": {
+			Fn: assertEqual,
+		},
+		"await": {
+			Fn: await,
+		},
+		"channel": {
+			Fn: channel,
+		},
+		"send": {
+			Fn: send,
+		},
+		"recv": {
+			Fn: recv,
+		},
+		"close": {
+			Fn: closeChannel,
 		},
-	},
-	"push": {
-		Fn: func(args ...object.Object) object.Object {
-			if len(args) != 2 {
-				return newError("wrong number of arguments. got=%d, want=2",
-					len(args))
-			}
-			if args[0].Type() != object.ARRAY {
-				return newError("argument to `push` must be ARRAY, got %s",
-					args[0].Type())
-			}
-			arr := args[0].(*object.Array)
-			length := len(arr.Elements)
-			newElements := make([]object.Object, length+1, length+1)
-			copy(newElements, arr.Elements)
-			newElements[length] = args[1]
-			return &object.Array{Elements: newElements}
+		"select": {
+			Fn: selectChannel,
 		},
-	},
+	}
 }
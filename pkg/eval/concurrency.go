@@ -0,0 +1,144 @@
+package eval
+
+import (
+	"github.com/alenkacz/interpreter-book/pkg/object"
+	"reflect"
+)
+
+// spawn calls the function with the rest of arguments in a new goroutine
+// and returns the task to await
+func (in *Interpreter) spawn(args ...object.Object) object.Object {
+	if len(args) == 0 {
+		return newError("wrong number of arguments. got=0, want=at least 1")
+	}
+	function, ok := args[0].(*object.Function)
+	if !ok {
+		return newError("argument to `spawn` must be FUNCTION, got %s", args[0].Type())
+	}
+	params := args[1:]
+	in = in.traceSpawn()
+	return object.NewTask(func() object.Object {
+		env := enclose(function.Environment, function.Locals)
+		if err := in.bindArguments(function, "spawned function", params, nil, env); err != nil {
+			return err
+		}
+		result := in.Eval(function.Block, env)
+		if r, ok := result.(*object.ReturnValue); ok {
+			return r.Value
+		}
+		if result == nil {
+			return object.NULL
+		}
+		return result
+	})
+}
+
+// await returns the result of the task once it finishes, errors of the task
+// are returned as they are
+func await(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+	task, ok := args[0].(*object.Task)
+	if !ok {
+		return newError("argument to `await` must be TASK, got %s", args[0].Type())
+	}
+	return task.Wait()
+}
+
+// channel returns a new channel, the optional argument is its capacity
+func channel(args ...object.Object) object.Object {
+	switch len(args) {
+	case 0:
+		return object.NewChannel(0)
+	case 1:
+		capacity, ok := args[0].(*object.Integer)
+		if !ok || capacity.Value < 0 {
+			return newError("capacity of channel must be non-negative INTEGER, got %s", describe(args[0]))
+		}
+		return object.NewChannel(int(capacity.Value))
+	}
+	return newError("wrong number of arguments. got=%d, want=0 or 1", len(args))
+}
+
+func send(args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2", len(args))
+	}
+	ch, ok := args[0].(*object.Channel)
+	if !ok {
+		return newError("argument to `send` must be CHANNEL, got %s", args[0].Type())
+	}
+	if !ch.Send(args[1]) {
+		return newError("send to closed channel")
+	}
+	return object.NULL
+}
+
+// recv returns the next value sent to the channel, it returns null once the
+// channel is closed and all values were received
+func recv(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+	ch, ok := args[0].(*object.Channel)
+	if !ok {
+		return newError("argument to `recv` must be CHANNEL, got %s", args[0].Type())
+	}
+	if value, ok := ch.Recv(); ok {
+		return value
+	}
+	return object.NULL
+}
+
+func closeChannel(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+	ch, ok := args[0].(*object.Channel)
+	if !ok {
+		return newError("argument to `close` must be CHANNEL, got %s", args[0].Type())
+	}
+	if !ch.Close() {
+		return newError("close of closed channel")
+	}
+	return object.NULL
+}
+
+// selectChannel waits until one of the cases can proceed. Cases are arrays,
+// [channel] receives from the channel and [channel, value] sends the value.
+// It returns the index of the chosen case and the received value, which is
+// null for sends and closed channels.
+func selectChannel(args ...object.Object) (result object.Object) {
+	if len(args) == 0 {
+		return newError("wrong number of arguments. got=0, want=at least 1")
+	}
+	cases := make([]reflect.SelectCase, len(args))
+	for i, arg := range args {
+		c, ok := arg.(*object.Array)
+		if !ok || len(c.Elements) == 0 || len(c.Elements) > 2 {
+			return newError("case of `select` must be [channel] or [channel, value], got %s", describe(arg))
+		}
+		ch, ok := c.Elements[0].(*object.Channel)
+		if !ok {
+			return newError("case of `select` must be [channel] or [channel, value], got %s", describe(arg))
+		}
+		cases[i] = reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ch.Chan())}
+		if len(c.Elements) == 2 {
+			cases[i].Dir = reflect.SelectSend
+			cases[i].Send = reflect.ValueOf(&c.Elements[1]).Elem()
+		}
+	}
+
+	defer func() {
+		if recover() != nil {
+			result = newError("send to closed channel")
+		}
+	}()
+	chosen, value, ok := reflect.Select(cases)
+	received := object.Object(object.NULL)
+	if ok {
+		received = value.Interface().(object.Object)
+	}
+	return &object.Array{Elements: []object.Object{&object.Integer{Value: int64(chosen)}, received}}
+}
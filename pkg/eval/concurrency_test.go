@@ -0,0 +1,65 @@
+package eval
+
+import (
+	"github.com/alenkacz/interpreter-book/pkg/object"
+	"github.com/alenkacz/interpreter-book/pkg/parser"
+	"github.com/alenkacz/interpreter-book/pkg/tokenizer"
+	"sync"
+	"testing"
+)
+
+func TestConcurrency(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let t = spawn(fn(a, b) { a + b }, 1, 2); await(t)`, "3"},
+		{`let f = fn(n) { if (n < 2) { return n; } await(spawn(f, n - 1)) + await(spawn(f, n - 2)) }; f(10)`, "55"},
+		{`let t = spawn(fn() { 1 }); [await(t), await(t)]`, "[1, 1]"},
+		{`let ch = channel(); spawn(fn() { send(ch, 1); send(ch, 2); close(ch) }); [recv(ch), recv(ch), recv(ch)]`, "[1, 2, null]"},
+		{`let ch = channel(2); send(ch, "a"); send(ch, "b"); close(ch); [recv(ch), recv(ch), recv(ch)]`, "[a, b, null]"},
+		{`let produce = fn(ch, n) { if (n > 0) { send(ch, n); produce(ch, n - 1) } else { close(ch) } };
+let total = fn(ch, sum) { let v = recv(ch); if (v) { total(ch, sum + v) } else { sum } };
+let ch = channel();
+spawn(produce, ch, 100);
+total(ch, 0)`, "5050"},
+		{`let a = channel(); let b = channel(1); send(b, 5); select([a], [b])`, "[1, 5]"},
+		{`let a = channel(); let b = channel(1); select([a], [b, 7]); recv(b)`, "7"},
+		{`let a = channel(); close(a); select([a])`, "[0, null]"},
+		{`let x = 1; let t = spawn(fn() { x + 1 }); await(t)`, "2"},
+		{`let t = spawn(fn() { missing }); await(t)`, "identifier not found: missing"},
+		{`let t = spawn(fn() { 1 }, 2); await(t)`, "wrong number of arguments to spawned function. got=1, want=0"},
+		{`spawn(1)`, "argument to `spawn` must be FUNCTION, got INTEGER"},
+		{`await(1)`, "argument to `await` must be TASK, got INTEGER"},
+		{`channel(-1)`, "capacity of channel must be non-negative INTEGER, got -1"},
+		{`let ch = channel(); close(ch); close(ch)`, "close of closed channel"},
+		{`let ch = channel(); close(ch); send(ch, 1)`, "send to closed channel"},
+		{`let ch = channel(); close(ch); select([ch, 1])`, "send to closed channel"},
+		{`select([1])`, "case of `select` must be [channel] or [channel, value], got [1]"},
+	}
+	for _, tt := range tests {
+		actual := testEval(tt.input)
+		if actual == nil || actual.Print() != tt.expected {
+			t.Errorf("%s: expected %q, got %v", tt.input, tt.expected, actual)
+		}
+	}
+}
+
+func TestConcurrentEnvironment(t *testing.T) {
+	env := object.NewEnvironment(nil)
+	Eval(parser.New(tokenizer.New(`let shared = 0; let f = fn(n) { let shared = n; shared };`)).ParseProgram(), env)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			program := parser.New(tokenizer.New(`let shared = shared + 1; f(shared)`)).ParseProgram()
+			Resolve(program, env)
+			if result := Eval(program, env); result.Type() == object.ERROR {
+				t.Errorf("unexpected error %s", result.Print())
+			}
+		}()
+	}
+	wg.Wait()
+}
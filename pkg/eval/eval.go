@@ -4,13 +4,18 @@ import (
 	"fmt"
 	"github.com/alenkacz/interpreter-book/pkg/ast"
 	"github.com/alenkacz/interpreter-book/pkg/object"
+	"math/big"
 )
 
-func Eval(node ast.Node, env *object.Environment) object.Object {
+// Eval evaluates the node in the environment
+func (in *Interpreter) Eval(node ast.Node, env *object.Environment) object.Object {
 	switch node.(type) {
 	case *ast.IntegerLiteral:
 		integer, _ := node.(*ast.IntegerLiteral)
 		return &object.Integer{ Value: integer.Value }
+	case *ast.BigIntegerLiteral:
+		integer, _ := node.(*ast.BigIntegerLiteral)
+		return &object.BigInt{ Value: integer.Value }
 	case *ast.StringLiteral:
 		str, _ := node.(*ast.StringLiteral)
 		return &object.String{ Value: str.Value }
@@ -23,43 +28,56 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		}
 	case *ast.PrefixExpression:
 		prefix, _ := node.(*ast.PrefixExpression)
-		value := Eval(prefix.Right, env)
+		value := in.Eval(prefix.Right, env)
+		if isError(value) {
+			return value
+		}
 		switch prefix.Operator {
 		case "!":
 			return evalBang(value)
 		case "-":
-			return evalPrefixMinus(value)
+			return in.evalPrefixMinus(value)
 		default:
 			newError("unknown operator %s. %v", prefix.Operator, prefix)
 		}
 	case *ast.InfixExpression:
 		infix, _ := node.(*ast.InfixExpression)
-		left := Eval(infix.Left, env)
-		right := Eval(infix.Right, env)
-		return evalInfixOperator(left, right, infix.Operator)
+		left := in.Eval(infix.Left, env)
+		if isError(left) {
+			return left
+		}
+		right := in.Eval(infix.Right, env)
+		if isError(right) {
+			return right
+		}
+		return in.evalInfixOperator(left, right, infix.Operator)
 	case *ast.IfExpression:
 		ifExp, _ := node.(*ast.IfExpression)
-		cond := Eval(ifExp.Condition, env)
+		cond := in.Eval(ifExp.Condition, env)
+		if isError(cond) {
+			return cond
+		}
+		in.traceBranch(ifExp, isTruthy(cond))
 		if isTruthy(cond) {
-			return Eval(ifExp.Block, env)
+			return in.Eval(ifExp.Block, env)
 		} else if ifExp.Alternative != nil {
-			return Eval(ifExp.Alternative, env)
+			return in.Eval(ifExp.Alternative, env)
 		} else {
 			return object.NULL
 		}
 	case *ast.BlockStatement:
-		return evalBlockStatement(node.(*ast.BlockStatement), env)
+		return in.evalBlockStatement(node.(*ast.BlockStatement), env)
 	case *ast.ReturnStatement:
-		return &object.ReturnValue{Eval(node.(*ast.ReturnStatement).ReturnValue, env)}
+		return &object.ReturnValue{in.Eval(node.(*ast.ReturnStatement).ReturnValue, env)}
 	case *ast.ExpressionStatement:
 		exp, _ := node.(*ast.ExpressionStatement)
-		return Eval(exp.Expression, env)
+		return in.Eval(exp.Expression, env)
 	case *ast.LetStatement:
-		evalLetStatement(node.(*ast.LetStatement), env)
+		return in.evalLetStatement(node.(*ast.LetStatement), env)
 	case *ast.Identifier:
 		identifier := node.(*ast.Identifier)
-		if builtin, ok := env.Get(identifier.Name); ok {
-			return builtin
+		if value, ok := lookup(identifier, env); ok {
+			return value
 		}
 		return newError("identifier not found: " + identifier.Name)
 	case *ast.FunctionLiteral:
@@ -68,44 +86,86 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 			Environment: env,
 			Block: funcLiteral.Block,
 			Params: funcLiteral.Params,
+			ParamPatterns: funcLiteral.ParamPatterns,
+			Defaults: funcLiteral.Defaults,
+			Variadic: funcLiteral.Variadic,
+			Locals: funcLiteral.Locals,
 		}
+	case *ast.MacroLiteral:
+		return newError("macro literals must be bound by top-level let statements")
+	case *ast.SpreadExpression:
+		return newError("spread is allowed only in arguments of calls")
+	case *ast.NamedArgument:
+		return newError("named arguments are allowed only in calls")
 	case *ast.CallExpression:
 		callExp := node.(*ast.CallExpression)
-		function, ok := env.Get(callExp.Function.Name)
+		if callExp.Function.Name == "quote" {
+			if len(callExp.Params) != 1 {
+				return newError("wrong number of arguments to quote. got=%d, want=1", len(callExp.Params))
+			}
+			return in.quote(callExp.Params[0], env)
+		}
+		function, ok := lookup(callExp.Function, env)
 		if ok {
-			return applyFunction(function, callExp, env)
+			return in.applyFunction(function, callExp, env)
 		}
-		builtin, ok := builtins[callExp.Function.Name]
+		builtin, ok := in.builtins[callExp.Function.Name]
 		if ok {
-			return applyFunction(builtin, callExp, env)
+			return in.applyFunction(builtin, callExp, env)
 		}
 		return newError(fmt.Sprintf("expecting function %s but got %T", callExp.Function.Name, function))
 	case *ast.Array:
 		arr := node.(*ast.Array)
 		var res []object.Object
 		for _, it := range arr.Items {
-			res = append(res, Eval(it, env))
+			item := in.Eval(it, env)
+			if isError(item) {
+				return item
+			}
+			res = append(res, item)
 		}
 		return &object.Array{Elements: res}
+	case *ast.HashLiteral:
+		return in.evalHashLiteral(node.(*ast.HashLiteral), env)
+	case *ast.MatchExpression:
+		return in.evalMatchExpression(node.(*ast.MatchExpression), env)
 	case *ast.IndexExpression:
 		indexExpression := node.(*ast.IndexExpression)
-		left := Eval(indexExpression.Left, env)
+		left := in.Eval(indexExpression.Left, env)
 		if left.Type() == object.ERROR {
 			return left
 		}
-		index := Eval(indexExpression.Index, env)
+		index := in.Eval(indexExpression.Index, env)
 		if index.Type() == object.ERROR {
 			return index
 		}
 		switch {
-		case left.Type() == object.ARRAY && index.Type() == object.INTEGER:
+		case left.Type() == object.ARRAY && isNumber(index):
 			arrayObject := left.(*object.Array)
-			idx := index.(*object.Integer).Value
+			var idx int64 = -1
+			switch index := index.(type) {
+			case *object.Integer:
+				idx = index.Value
+			case *object.BigInt:
+				// big integers index arrays when they fit into int64
+				if index.Value.IsInt64() {
+					idx = index.Value.Int64()
+				}
+			}
 			max := int64(len(arrayObject.Elements) - 1)
 			if idx < 0 || idx > max {
 				return object.NULL
 			}
 			return arrayObject.Elements[idx]
+		case left.Type() == object.HASH:
+			key, ok := index.(object.Hashable)
+			if !ok {
+				return newError("unusable as hash key: %s", index.Type())
+			}
+			if value, ok := left.(*object.Hash).Get(key); ok {
+				return value
+			}
+			return object.NULL
 		default:
 			return newError("index operator not supported: %s", left.Type())
 		}
@@ -113,7 +173,10 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		var result object.Object
 		program, _ := node.(*ast.Program)
 		for _, stmt := range program.Statements {
-			result = Eval(stmt, env)
+			if err := in.traceStatement(stmt, env); err != nil {
+				return err
+			}
+			result = in.Eval(stmt, env)
 			switch result.(type) {
 			case *object.ReturnValue:
 				return result.(*object.ReturnValue).Value
@@ -126,6 +189,10 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 	return nil
 }
 
+func isError(obj object.Object) bool {
+	return obj != nil && obj.Type() == object.ERROR
+}
+
 func isTruthy(obj object.Object) bool {
 	switch obj {
 	case object.NULL:
@@ -139,38 +206,195 @@ func isTruthy(obj object.Object) bool {
 	}
 }
 
-func applyFunction(function object.Object, callExp *ast.CallExpression, env *object.Environment) object.Object {
+func (in *Interpreter) applyFunction(function object.Object, callExp *ast.CallExpression, env *object.Environment) object.Object {
 	switch function.Type() {
 	case object.FUNCTION:
 		funcLiteral, _ := function.(*object.Function)
-		closureEnv := object.NewEnvironment(env)
-		evalArgs := evaluateExpressions(callExp.Params, env)
+		closureEnv := enclose(funcLiteral.Environment, funcLiteral.Locals)
+		evalArgs := in.evaluateArguments(callExp.Params, env)
 		if len(evalArgs) > 0 && evalArgs[0].Type() == object.ERROR {
 			return evalArgs[0]
 		}
-		for i, evaluated := range evalArgs {
-			closureEnv.Set(funcLiteral.Params[i].Name, evaluated)
+		named, err := in.evaluateNamedArguments(callExp.Params, env)
+		if err != nil {
+			return err
 		}
-		return Eval(funcLiteral.Block, closureEnv)
+		if err := in.bindArguments(funcLiteral, callExp.Function.Name, evalArgs, named, closureEnv); err != nil {
+			return err
+		}
+		in.traceCall(callExp, function, env)
+		result := in.Eval(funcLiteral.Block, closureEnv)
+		in.traceReturn(callExp, function, result)
+		return result
 	case object.BUILTINFN:
 		builtin, _ := function.(*object.BuiltIn)
-		evalArgs := evaluateExpressions(callExp.Params, env)
+		for _, param := range callExp.Params {
+			if _, ok := param.(*ast.NamedArgument); ok {
+				return newError("builtin %s does not accept named arguments", callExp.Function.Name)
+			}
+		}
+		evalArgs := in.evaluateArguments(callExp.Params, env)
 		if len(evalArgs) > 0 && evalArgs[0].Type() == object.ERROR {
 			return evalArgs[0]
 		}
-		return builtin.Fn(evalArgs...)
+		in.traceCall(callExp, function, env)
+		result := builtin.Fn(evalArgs...)
+		in.traceReturn(callExp, function, result)
+		return result
 	default:
 		return newError(fmt.Sprintf("expecting function but got %T", function))
 	}
 }
 
-func evaluateExpressions(expressions []ast.Expression, env *object.Environment) []object.Object {
+// namedArgument is an evaluated named argument of a call
+type namedArgument struct {
+	name  string
+	value object.Object
+}
+
+// bindArguments binds the arguments to parameters of the function, named
+// arguments are bound to the parameters of their names. Missing arguments
+// are replaced by defaults evaluated after the previous parameters are
+// bound.
+func (in *Interpreter) bindArguments(function *object.Function, name string, args []object.Object, named []namedArgument, env *object.Environment) *object.Error {
+	min, max := function.Arity()
+	if (len(named) == 0 && len(args) < min) || (max >= 0 && len(args) > max) {
+		return newError("wrong number of arguments to %s. got=%d, want=%s", name, len(args), arity(min, max))
+	}
+	byName := make(map[string]object.Object, len(named))
+	for _, arg := range named {
+		i := paramIndex(function, arg.name)
+		_, given := byName[arg.name]
+		switch {
+		case i < 0:
+			return newError("unknown argument %s to %s", arg.name, name)
+		case function.Variadic && i == len(function.Params)-1:
+			return newError("rest parameter %s of %s cannot be named", arg.name, name)
+		case i < len(args) || given:
+			return newError("argument %s to %s is given more than once", arg.name, name)
+		}
+		byName[arg.name] = arg.value
+	}
+	for i, param := range function.Params {
+		var value object.Object
+		namedValue, isNamed := byName[param.Name]
+		switch {
+		case function.Variadic && i == len(function.Params)-1:
+			rest := []object.Object{}
+			if i < len(args) {
+				rest = args[i:]
+			}
+			value = &object.Array{Elements: rest}
+		case i < len(args):
+			value = args[i]
+		case isNamed:
+			value = namedValue
+		case i >= len(function.Defaults) || function.Defaults[i] == nil:
+			return newError("missing argument %s to %s", paramName(function, i), name)
+		default:
+			value = in.Eval(function.Defaults[i], env)
+			if err, ok := value.(*object.Error); ok {
+				return err
+			}
+		}
+		if i < len(function.ParamPatterns) && function.ParamPatterns[i] != nil {
+			if err := in.destructure(function.ParamPatterns[i], value, env); err != nil {
+				return err
+			}
+			continue
+		}
+		bind(env, param.Local, param.Name, value)
+	}
+	return nil
+}
+
+// arity describes the expected number of arguments
+func arity(min int, max int) string {
+	switch {
+	case max < 0:
+		return fmt.Sprintf("at least %d", min)
+	case min == max:
+		return fmt.Sprintf("%d", min)
+	case min+1 == max:
+		return fmt.Sprintf("%d or %d", min, max)
+	}
+	return fmt.Sprintf("%d to %d", min, max)
+}
+
+// paramIndex returns index of the parameter of the name, -1 when there is
+// none
+func paramIndex(function *object.Function, name string) int {
+	for i, param := range function.Params {
+		if param.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// paramName describes i-th parameter, parameters destructuring arguments
+// are described by their patterns
+func paramName(function *object.Function, i int) string {
+	if i < len(function.ParamPatterns) && function.ParamPatterns[i] != nil {
+		return function.ParamPatterns[i].String()
+	}
+	return function.Params[i].Name
+}
+
+// evaluateArguments evaluates positional arguments of a call, elements of
+// spread arrays are passed as separate arguments
+func (in *Interpreter) evaluateArguments(expressions []ast.Expression, env *object.Environment) []object.Object {
+	var result []object.Object
+	for _, param := range expressions {
+		if _, ok := param.(*ast.NamedArgument); ok {
+			continue
+		}
+		spread, ok := param.(*ast.SpreadExpression)
+		if !ok {
+			evaluated := in.Eval(param, env)
+			if evaluated.Type() == object.ERROR {
+				return []object.Object{evaluated}
+			}
+			result = append(result, evaluated)
+			continue
+		}
+		evaluated := in.Eval(spread.Value, env)
+		if evaluated.Type() == object.ERROR {
+			return []object.Object{evaluated}
+		}
+		array, ok := evaluated.(*object.Array)
+		if !ok {
+			return []object.Object{newError("cannot spread %s, expected array", describe(evaluated))}
+		}
+		result = append(result, array.Elements...)
+	}
+	return result
+}
+
+// evaluateNamedArguments evaluates named arguments of a call in order
+func (in *Interpreter) evaluateNamedArguments(expressions []ast.Expression, env *object.Environment) ([]namedArgument, *object.Error) {
+	var result []namedArgument
+	for _, param := range expressions {
+		arg, ok := param.(*ast.NamedArgument)
+		if !ok {
+			continue
+		}
+		value := in.Eval(arg.Value, env)
+		if err, ok := value.(*object.Error); ok {
+			return nil, err
+		}
+		result = append(result, namedArgument{name: arg.Name, value: value})
+	}
+	return result, nil
+}
+
+func (in *Interpreter) evaluateExpressions(expressions []ast.Expression, env *object.Environment) []object.Object {
 	var result []object.Object
 	for _, param := range expressions {
-		evaluated := Eval(param, env)
+		evaluated := in.Eval(param, env)
 		if evaluated.Type() == object.ERROR {
 			// return on first error
-			return result
+			return []object.Object{evaluated}
 		}
 		result = append(result, evaluated)
 	}
@@ -179,14 +403,57 @@ func evaluateExpressions(expressions []ast.Expression, env *object.Environment)
 
 
 
-func evalLetStatement(stmt *ast.LetStatement, env *object.Environment) {
-	env.Set(stmt.Identifier.Literal, Eval(stmt.Value, env))
+// enclose returns environment of a function call or match arm, variables of
+// resolved code are stored in slots
+func enclose(outer *object.Environment, locals []string) *object.Environment {
+	if locals == nil {
+		return object.NewEnvironment(outer)
+	}
+	return object.NewFrame(outer, locals)
 }
 
-func evalBlockStatement(block *ast.BlockStatement, env *object.Environment) object.Object {
+// lookup returns value of the variable, resolved identifiers are found in
+// their slots
+func lookup(ident *ast.Identifier, env *object.Environment) (object.Object, bool) {
+	if ident.Local == nil {
+		return env.Get(ident.Name)
+	}
+	return env.GetLocal(ident.Local.Depth, ident.Local.Slot, ident.Name)
+}
+
+// bind sets value of the variable in env, into its slot when resolved
+func bind(env *object.Environment, local *ast.Local, name string, value object.Object) {
+	if local == nil || local.Slot < 0 {
+		env.Set(name, value)
+		return
+	}
+	env.SetLocal(local.Slot, value)
+}
+
+// evalLetStatement binds the value, it returns an error only when the value
+// cannot be destructured
+func (in *Interpreter) evalLetStatement(stmt *ast.LetStatement, env *object.Environment) object.Object {
+	value := in.Eval(stmt.Value, env)
+	if isError(value) {
+		return value
+	}
+	if stmt.Pattern == nil {
+		bind(env, stmt.Local, stmt.Identifier.Literal, value)
+		return nil
+	}
+	if err := in.destructure(stmt.Pattern, value, env); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (in *Interpreter) evalBlockStatement(block *ast.BlockStatement, env *object.Environment) object.Object {
 	var result object.Object
 	for _, stmt := range block.Statements {
-		result = Eval(stmt, env)
+		if err := in.traceStatement(stmt, env); err != nil {
+			return err
+		}
+		result = in.Eval(stmt, env)
 		switch result.(type) {
 		case *object.ReturnValue:
 			return result
@@ -197,7 +464,10 @@ func evalBlockStatement(block *ast.BlockStatement, env *object.Environment) obje
 	return result
 }
 
-func evalInfixOperator(left object.Object, right object.Object, operator string) object.Object {
+func (in *Interpreter) evalInfixOperator(left object.Object, right object.Object, operator string) object.Object {
+	if isBigIntOperation(left, right) {
+		return evalBigIntInfix(toBigInt(left), toBigInt(right), operator)
+	}
 	switch operator {
 	case "+":
 		if left.Type() == object.INTEGER {
@@ -206,7 +476,7 @@ func evalInfixOperator(left object.Object, right object.Object, operator string)
 			if !leftok || !rightok {
 				return newError("infix operator + works only with integers on both sides. Got %s+%s", left.Type(), right.Type())
 			}
-			return &object.Integer{leftInt.Value + rightInt.Value}
+			return in.evalIntegerArithmetic(leftInt.Value, rightInt.Value, operator)
 		} else if left.Type() == object.STRING {
 			leftStr, leftok := left.(*object.String)
 			rightStr, rightok := right.(*object.String)
@@ -217,27 +487,13 @@ func evalInfixOperator(left object.Object, right object.Object, operator string)
 		} else {
 			return newError("infix operator + works only with integers and strings. Got %s+%s", left.Type(), right.Type())
 		}
-	case "-":
+	case "-", "*", "/", "%":
 		leftInt, leftok := left.(*object.Integer)
 		rightInt, rightok := right.(*object.Integer)
 		if !leftok || !rightok {
-			return newError("infix operator - works only with integers. Got %s-%s", left.Type(), right.Type())
+			return newError("infix operator %s works only with integers. Got %s%s%s", operator, left.Type(), operator, right.Type())
 		}
-		return &object.Integer{leftInt.Value - rightInt.Value}
-	case "*":
-		leftInt, leftok := left.(*object.Integer)
-		rightInt, rightok := right.(*object.Integer)
-		if !leftok || !rightok {
-			return newError("infix operator * works only with integers. Got %s*%s", left.Type(), right.Type())
-		}
-		return &object.Integer{leftInt.Value * rightInt.Value}
-	case "/":
-		leftInt, leftok := left.(*object.Integer)
-		rightInt, rightok := right.(*object.Integer)
-		if !leftok || !rightok {
-			return newError("infix operator * works only with integers. Got %s*%s", left.Type(), right.Type())
-		}
-		return &object.Integer{leftInt.Value / rightInt.Value}
+		return in.evalIntegerArithmetic(leftInt.Value, rightInt.Value, operator)
 	default:
 		return evalEqualityExpression(left, right, operator)
 	}
@@ -245,7 +501,13 @@ func evalInfixOperator(left object.Object, right object.Object, operator string)
 
 func evalEqualityExpression(left object.Object, right object.Object, operator string) object.Object {
 	if left.Type() != right.Type() {
-		return object.FALSE
+		switch operator {
+		case "==":
+			return object.FALSE
+		case "!=":
+			return object.TRUE
+		}
+		return newError("unsupported operator %s%s%s", left.Type(), operator, right.Type())
 	}
 	if left.Type() == object.INTEGER {
 		leftVal := left.(*object.Integer).Value
@@ -259,32 +521,17 @@ func evalEqualityExpression(left object.Object, right object.Object, operator st
 			return boolResultToObject(leftVal > rightVal)
 		case "<":
 			return boolResultToObject(leftVal < rightVal)
-		default:
-			return newError("unsupported operator %s%s%s", left.Type(), operator, right.Type())
-		}
-	} else if left.Type() == object.BOOLEAN {
-		switch operator {
-		case "==":
-			return boolResultToObject(left == right)
-		case "!=":
-			return boolResultToObject(left != right)
-		default:
-			return newError("unsupported operator %s%s%s", left.Type(), operator, right.Type())
-		}
-	} else {
-		leftVal := left.(*object.String).Value
-		rightVal := right.(*object.String).Value
-
-		switch operator {
-		case "==":
-			return boolResultToObject(leftVal == rightVal)
-		case "!=":
-			return boolResultToObject(leftVal != rightVal)
-		default:
-			return newError("unsupported operator %s%s%s", left.Type(), operator, right.Type())
 		}
+		return newError("unsupported operator %s%s%s", left.Type(), operator, right.Type())
 	}
-	return nil
+	// strings, arrays and hashes are compared by their contents
+	switch operator {
+	case "==":
+		return boolResultToObject(equal(left, right))
+	case "!=":
+		return boolResultToObject(!equal(left, right))
+	}
+	return newError("unsupported operator %s%s%s", left.Type(), operator, right.Type())
 }
 
 func boolResultToObject(b bool) object.Object {
@@ -305,13 +552,16 @@ func evalBang(value object.Object) object.Object {
 	}
 }
 
-func evalPrefixMinus(value object.Object) object.Object {
+func (in *Interpreter) evalPrefixMinus(value object.Object) object.Object {
+	if value.Type() == object.BIGINT {
+		return &object.BigInt{Value: new(big.Int).Neg(value.(*object.BigInt).Value)}
+	}
 	if value.Type() != object.INTEGER {
 		return newError("unknown operator: -%s", value.Type())
 	}
 
 	integer := value.(*object.Integer).Value
-	return &object.Integer{Value: -integer}
+	return in.evalIntegerArithmetic(0, integer, "-")
 }
 
 func newError(format string, a ...interface{}) *object.Error {
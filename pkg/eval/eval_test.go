@@ -1,9 +1,12 @@
 package eval
 
 import (
+	"fmt"
+	"github.com/alenkacz/interpreter-book/pkg/ast"
 	"github.com/alenkacz/interpreter-book/pkg/object"
 	"github.com/alenkacz/interpreter-book/pkg/parser"
 	"github.com/alenkacz/interpreter-book/pkg/tokenizer"
+	"strings"
 	"testing"
 )
 
@@ -27,6 +30,9 @@ func TestEvalIntegerExpression(t *testing.T) {
 		{"3 * 3 * 3 + 10", 37},
 		{"3 * (3 * 3) + 10", 37},
 		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
+		{"10 % 3", 1},
+		{"-10 % 3", -1},
+		{"2 + 10 % 4 * 3", 8},
 	}
 	for _, tt := range tests {
 		evaluated := testEval(tt.input)
@@ -34,6 +40,38 @@ func TestEvalIntegerExpression(t *testing.T) {
 	}
 }
 
+func TestEvalBigIntExpression(t *testing.T) {
+	tests := []struct {
+		input string
+		expected string
+	}{
+		{"5n", "5"},
+		{"-5n", "-5"},
+		{"9223372036854775807 + 1", "9223372036854775808"},
+		{"-9223372036854775807 - 2", "-9223372036854775809"},
+		{"4611686018427387904 * 2", "9223372036854775808"},
+		{"(-9223372036854775807 - 1) / -1", "9223372036854775808"},
+		{"100000000000000000000", "100000000000000000000"},
+		{"100000000000000000000 * 100000000000000000000", "10000000000000000000000000000000000000000"},
+		{"100000000000000000000 - 99999999999999999999", "1"},
+		{"10n / 3", "3"},
+		{"-10n % 3", "-1"},
+		{"2 + 3n", "5"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		result, ok := evaluated.(*object.BigInt)
+		if !ok {
+			t.Errorf("%s: object is not BigInt. got=%T (%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if result.Print() != tt.expected {
+			t.Errorf("%s: object has wrong value. got=%s, want=%s",
+				tt.input, result.Print(), tt.expected)
+		}
+	}
+}
+
 func TestEvalStringExpression(t *testing.T) {
 	tests := []struct {
 		input string
@@ -49,10 +87,14 @@ func TestEvalStringExpression(t *testing.T) {
 }
 
 func testEval(input string) object.Object {
+	return testEvalWith(standard, input)
+}
+
+func testEvalWith(in *Interpreter, input string) object.Object {
 	l := tokenizer.New(input)
 	p := parser.New(l)
 	program := p.ParseProgram()
-	return Eval(program, object.NewEnvironment(object.NewEnvironment(nil)))
+	return in.Eval(program, object.NewEnvironment(object.NewEnvironment(nil)))
 }
 
 func testIntegerObject(t *testing.T, obj object.Object, expected int64, input string) bool {
@@ -111,6 +153,22 @@ func TestEvalBooleanExpression(t *testing.T) {
 		{"\"aaa\" == \"aaa\"", true},
 		{"\"aaa\" == \"bbb\"", false},
 		{"\"aaa\" != \"aaa\"", false},
+		{"5n == 5", true},
+		{"5 != 5n", false},
+		{"100000000000000000000 > 9223372036854775807", true},
+		{"-100000000000000000000 < 1n", true},
+		{`{"a": 1} == {"a": 1}`, true},
+		{`{"a": 1} != {"a": 1}`, false},
+		{`{"a": 1} == {"a": 2}`, false},
+		{`{"a": [1, {"b": 2}]} == {"a": [1, {"b": 2}]}`, true},
+		{`{"a": 1} == {"a": 1, "b": 2}`, false},
+		{`{} == []`, false},
+		{`{} != []`, true},
+		{`{"a": 1} == 1`, false},
+		{`{"a": 1} != "a"`, true},
+		{`[1, 2] == [1, 2]`, true},
+		{`[1, 2] != [2, 1]`, true},
+		{`1 != "1"`, true},
 
 	}
 	for _, tt := range tests {
@@ -162,6 +220,14 @@ func TestErrorHandling(t *testing.T) {
 			"if (10 > 1) { true + false; }",
 			"infix operator + works only with integers and strings. Got BOOLEAN+BOOLEAN",
 		},
+		{
+			`{"a": 1} < {"a": 2}`,
+			"unsupported operator HASH<HASH",
+		},
+		{
+			`{"a": 1} > 1`,
+			"unsupported operator HASH>INTEGER",
+		},
 		{
 			`
 132
@@ -174,6 +240,30 @@ return 1;
 `,
 			"infix operator + works only with integers and strings. Got BOOLEAN+BOOLEAN",
 		},
+		{
+			"1 / 0",
+			"division by zero: 1 / 0",
+		},
+		{
+			"let zero = 0; 10 % zero",
+			"modulo by zero: 10 % 0",
+		},
+		{
+			"1 / 0n",
+			"division by zero: 1 / 0",
+		},
+		{
+			"10 % true",
+			"infix operator % works only with integers. Got INTEGER%BOOLEAN",
+		},
+		// runtime errors of operands are not hidden
+		{"let x = 1 / 0; 5", "division by zero: 1 / 0"},
+		{"if (1 / 0) { 1 } else { 2 }", "division by zero: 1 / 0"},
+		{"(1 / 0) + 1", "division by zero: 1 / 0"},
+		{"1 + 2 % 0", "modulo by zero: 2 % 0"},
+		{"-(1 / 0)", "division by zero: 1 / 0"},
+		{"[1 / 0, 2]", "division by zero: 1 / 0"},
+		{"let [a, b] = [1, 2 / 0];", "division by zero: 2 / 0"},
 	}
 	for _, tt := range tests {
 		evaluated := testEval(tt.input)
@@ -190,6 +280,39 @@ return 1;
 	}
 }
 
+func TestCheckOverflow(t *testing.T) {
+	in := New()
+	in.CheckOverflow = true
+
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"9223372036854775807 + 1", "integer overflow: 9223372036854775807 + 1"},
+		{"-9223372036854775807 - 2", "integer overflow: -9223372036854775807 - 2"},
+		{"4611686018427387904 * 2", "integer overflow: 4611686018427387904 * 2"},
+		{"(-9223372036854775807 - 1) / -1", "integer overflow: -9223372036854775808 / -1"},
+	}
+	for _, tt := range tests {
+		evaluated := testEvalWith(in, tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("%s: no error object returned. got=%T(%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q",
+				tt.expectedMessage, errObj.Message)
+		}
+	}
+
+	testIntegerObject(t, testEvalWith(in, "4611686018427387903 * 2 + 1"), 9223372036854775807, "4611686018427387903 * 2 + 1")
+	// other interpreters are not affected
+	if result := testEval("9223372036854775807 + 1"); result.Print() != "9223372036854775808" {
+		t.Errorf("expected promotion to bigint, got %s", result.Print())
+	}
+}
+
 func TestIfElseExpressions(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -297,6 +420,47 @@ func TestFunctionObject(t *testing.T) {
 	}
 }
 
+func TestFunctionArguments(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let f = fn(a, b) { a + b }; f(1)`, "wrong number of arguments to f. got=1, want=2"},
+		{`let f = fn(a, b) { a + b }; f(1, 2, 3)`, "wrong number of arguments to f. got=3, want=2"},
+		{`let f = fn(a, b = 10) { a + b }; [f(1), f(1, 2)]`, "[11, 3]"},
+		{`let f = fn(a, b = a * 2, c = b + 1) { [a, b, c] }; f(1)`, "[1, 2, 3]"},
+		{`let f = fn(a = missing) { a }; f()`, "identifier not found: missing"},
+		{`let f = fn(a = 1, b = 2, c = 3) { a }; f(1, 2, 3, 4)`, "wrong number of arguments to f. got=4, want=0 to 3"},
+		{`let f = fn(a, b = 1) { a }; f()`, "wrong number of arguments to f. got=0, want=1 or 2"},
+		{`let f = fn(a, ...rest) { [a, rest] }; [f(1), f(1, 2, 3)]`, "[[1, []], [1, [2, 3]]]"},
+		{`let f = fn(a, ...rest) { a }; f()`, "wrong number of arguments to f. got=0, want=at least 1"},
+		{`let f = fn(a, b, c) { a + b + c }; let args = [2, 3]; f(1, ...args)`, "6"},
+		{`let f = fn(...all) { all }; f(...[], 1, ...[2, 3])`, "[1, 2, 3]"},
+		{`len(...["abc"])`, "3"},
+		{`let f = fn(a) { a }; f(...1)`, "cannot spread 1, expected array"},
+		{`let f = fn(a) { a }; f(...[1, 2])`, "wrong number of arguments to f. got=2, want=1"},
+		{`fn(a, b = 1, ...c) { a }`, "fn(a, b = 1, ...c) {\na\n}"},
+		{`let f = fn(a, b) { [a, b] }; f(b: 5, a: 1)`, "[1, 5]"},
+		{`let f = fn(a, b = 2, c = 3) { [a, b, c] }; f(1, c: 4)`, "[1, 2, 4]"},
+		{`let f = fn(a, b = a + 1, ...rest) { [a, b, rest] }; f(a: 1)`, "[1, 2, []]"},
+		{`let f = fn(a, b) { a }; f(b: 1)`, "missing argument a to f"},
+		{`let f = fn([a, b], c) { a }; f(c: 1)`, "missing argument [a, b] to f"},
+		{`let f = fn(a, b) { a }; f(1, c: 2)`, "unknown argument c to f"},
+		{`let f = fn(a, b) { a }; f(1, a: 2)`, "argument a to f is given more than once"},
+		{`let f = fn(a, b) { a }; f(b: 1, b: 2)`, "argument b to f is given more than once"},
+		{`let f = fn(a, ...rest) { a }; f(1, rest: [2])`, "rest parameter rest of f cannot be named"},
+		{`let f = fn(a) { a }; f(1, 2, a: 3)`, "wrong number of arguments to f. got=2, want=1"},
+		{`let f = fn(a) { a }; f(a: 1 / 0)`, "division by zero: 1 / 0"},
+		{`len(a: "abc")`, "builtin len does not accept named arguments"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Print() != tt.expected {
+			t.Errorf("%s: expected %q, got %q", tt.input, tt.expected, evaluated.Print())
+		}
+	}
+}
+
 func TestLetStatements(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -348,6 +512,42 @@ func TestBuiltinFunctions(t *testing.T) {
 	}
 }
 
+func TestAssertions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`assert(1 < 2)`, ""},
+		{`assert(1 > 2)`, "assertion failed"},
+		{`assert(false, "too small")`, "assertion failed: too small"},
+		{`assert()`, "wrong number of arguments. got=0, want=1 or 2"},
+		{`assert_eq([1, [2, 3]], [1, [2, 3]])`, ""},
+		{`assert_eq(9223372036854775807 + 1 - 1, 9223372036854775807)`, ""},
+		{`assert_eq(1 + 1, 3)`, "assert_eq failed:\nexpected 3, got 2"},
+		{`assert_eq("1", 1)`, "assert_eq failed:\nexpected 1, got \"1\""},
+		{`assert_eq([1, [2, 3]], [1, [4, 3], 5])`, "assert_eq failed:\n[1][0]: expected 4, got 2\nlength: expected 3, got 2"},
+		{"assert_eq(\"a\nb\nc\", \"a\nc\nd\")", "assert_eq failed:\nlines differ (- expected, + actual):\n  a\n+ b\n  c\n- d"},
+		{`assert_eq(1, missing)`, "identifier not found: missing"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if tt.expected == "" {
+			if evaluated != object.NULL {
+				t.Errorf("%s: expected null, got %s", tt.input, evaluated.Print())
+			}
+			continue
+		}
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("%s: object is not Error. got=%T (%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expected {
+			t.Errorf("%s: wrong error message. expected=%q, got=%q", tt.input, tt.expected, errObj.Message)
+		}
+	}
+}
+
 func TestArrayLiterals(t *testing.T) {
 	input := "[1, 2 * 2, 3 + 3]"
 	evaluated := testEval(input)
@@ -408,6 +608,18 @@ func TestArrayIndexExpressions(t *testing.T) {
 			"[1, 2, 3][-1]",
 			nil,
 		},
+		{
+			"[1, 2, 3][1n]",
+			2,
+		},
+		{
+			"[1, 2, 3][100000000000000000000 - 99999999999999999999]",
+			2,
+		},
+		{
+			"[1, 2, 3][100000000000000000000]",
+			nil,
+		},
 	}
 	for _, tt := range tests {
 		evaluated := testEval(tt.input)
@@ -418,4 +630,44 @@ func TestArrayIndexExpressions(t *testing.T) {
 			testNullObject(t, evaluated)
 		}
 	}
-}
\ No newline at end of file
+}
+func TestTrace(t *testing.T) {
+	input := `let add = fn(a, b) {
+  if (a > b) { a + b }
+};
+add(len("ab"), 1);`
+
+	var events []string
+	in := New()
+	in.Trace = &Tracer{
+		Statement: func(stmt ast.Statement, env *object.Environment) error {
+			events = append(events, fmt.Sprintf("statement %d", stmt.Pos().Line))
+			return nil
+		},
+		Branch: func(expr *ast.IfExpression, taken bool) {
+			events = append(events, fmt.Sprintf("branch %d %t", expr.Pos().Line, taken))
+		},
+		Call: func(call *ast.CallExpression, function object.Object, env *object.Environment) {
+			events = append(events, "call "+call.Function.Name)
+		},
+		Return: func(call *ast.CallExpression, function object.Object, result object.Object) {
+			events = append(events, "return "+call.Function.Name+" "+result.Print())
+		},
+	}
+	testEvalWith(in, input)
+
+	expected := []string{
+		"statement 1",
+		"statement 4",
+		"call len",
+		"return len 2",
+		"call add",
+		"statement 2",
+		"branch 2 true",
+		"statement 2",
+		"return add 3",
+	}
+	if strings.Join(events, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected events\n%s\ngot\n%s", strings.Join(expected, "\n"), strings.Join(events, "\n"))
+	}
+}
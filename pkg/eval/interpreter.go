@@ -0,0 +1,60 @@
+package eval
+
+import (
+	"github.com/alenkacz/interpreter-book/pkg/ast"
+	"github.com/alenkacz/interpreter-book/pkg/object"
+	"sort"
+)
+
+// Interpreter evaluates programs with its own builtin functions and options,
+// so that hosts can run differently configured interpreters side by side.
+// Programs can be evaluated by the same interpreter in multiple goroutines,
+// the options must not be changed meanwhile.
+type Interpreter struct {
+	builtins map[string]*object.BuiltIn
+	// CheckOverflow makes integer arithmetic return an error when the result
+	// does not fit into int64 instead of promoting it to an
+	// arbitrary-precision BigInt.
+	CheckOverflow bool
+	// Trace is the tracer notified during evaluation, nil when the
+	// evaluation is not traced. It is notified from goroutines of spawned
+	// tasks too.
+	Trace *Tracer
+}
+
+// New returns interpreter with the standard builtin functions
+func New() *Interpreter {
+	in := &Interpreter{builtins: standardBuiltins()}
+	in.Register("spawn", in.spawn)
+	return in
+}
+
+// standard evaluates programs of the package-level functions
+var standard = New()
+
+// Register adds the builtin function, it replaces the builtin of the same
+// name. Builtins must not be registered while programs are evaluated.
+func (in *Interpreter) Register(name string, fn object.BuiltinFunction) {
+	in.builtins[name] = &object.BuiltIn{Fn: fn}
+}
+
+// BuiltinNames returns sorted names of the builtin functions
+func (in *Interpreter) BuiltinNames() []string {
+	result := make([]string, 0, len(in.builtins))
+	for name := range in.builtins {
+		result = append(result, name)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// Eval evaluates the node by an interpreter with the standard builtins and
+// default options
+func Eval(node ast.Node, env *object.Environment) object.Object {
+	return standard.Eval(node, env)
+}
+
+// BuiltinNames returns names of the standard builtin functions
+func BuiltinNames() []string {
+	return standard.BuiltinNames()
+}
@@ -0,0 +1,85 @@
+package eval
+
+import (
+	"fmt"
+	"github.com/alenkacz/interpreter-book/pkg/ast"
+	"github.com/alenkacz/interpreter-book/pkg/object"
+	"github.com/alenkacz/interpreter-book/pkg/parser"
+	"github.com/alenkacz/interpreter-book/pkg/tokenizer"
+	"sync"
+	"testing"
+)
+
+func TestRegister(t *testing.T) {
+	in := New()
+	in.Register("double", func(args ...object.Object) object.Object {
+		return &object.Integer{Value: 2 * args[0].(*object.Integer).Value}
+	})
+
+	program := parser.New(tokenizer.New("double(21)")).ParseProgram()
+	if err := in.Resolve(program, nil); err != nil {
+		t.Fatal(err)
+	}
+	if result := in.Eval(program, object.NewEnvironment(nil)); result.Print() != "42" {
+		t.Errorf("expected 42, got %s", result.Print())
+	}
+
+	// builtins of other interpreters are not affected
+	if err := Resolve(program, nil); err == nil || err.Error() != "1:1: identifier not found: double" {
+		t.Errorf("unexpected error %v", err)
+	}
+	for _, name := range BuiltinNames() {
+		if name == "double" {
+			t.Errorf("double registered by the standard interpreter")
+		}
+	}
+}
+
+// TestParallelEvaluation is meant to be run with the race detector, programs
+// share the global environment and two differently configured interpreters
+func TestParallelEvaluation(t *testing.T) {
+	library := `let square = fn(x) { x * x };
+let sum = fn(items, total = 0) { match (items) { [] => total, [head, ...others] => sum(others, total + head) } };
+let limit = 9223372036854775807;`
+	globals := object.NewEnvironment(nil)
+	Eval(parser.New(tokenizer.New(library)).ParseProgram(), globals)
+
+	checked := New()
+	checked.CheckOverflow = true
+	var calls sync.Map
+	traced := New()
+	traced.Trace = &Tracer{Call: func(call *ast.CallExpression, function object.Object, env *object.Environment) {
+		calls.Store(call.Function.Name, true)
+	}}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			input := fmt.Sprintf(`let n = %d; [sum([square(n), n]), limit + 1]`, i)
+			program := parser.New(tokenizer.New(input)).ParseProgram()
+			in := []*Interpreter{standard, checked, traced}[i%3]
+			if err := in.Resolve(program, globals); err != nil {
+				t.Error(err)
+				return
+			}
+			result := in.Eval(program, object.NewEnvironment(globals)).Print()
+			expected := fmt.Sprintf("[%d, 9223372036854775808]", i*i+i)
+			if in == checked {
+				expected = "integer overflow: 9223372036854775807 + 1"
+			}
+			if result != expected {
+				t.Errorf("%s: expected %s, got %s", input, expected, result)
+			}
+
+			// all programs write the same global
+			in.Eval(parser.New(tokenizer.New(`let shared = n;`)).ParseProgram(), globals)
+		}(i)
+	}
+	wg.Wait()
+
+	if _, ok := calls.Load("square"); !ok {
+		t.Errorf("calls were not traced")
+	}
+}
@@ -0,0 +1,187 @@
+package eval
+
+import (
+	"fmt"
+	"github.com/alenkacz/interpreter-book/pkg/ast"
+	"github.com/alenkacz/interpreter-book/pkg/object"
+	"github.com/alenkacz/interpreter-book/pkg/token"
+)
+
+// maxExpansionDepth limits expansion of macros returning calls of macros
+const maxExpansionDepth = 100
+
+// quote returns the node unevaluated with calls of unquote replaced by
+// their evaluated arguments. The node is copied, so the same quote can be
+// evaluated again with other values.
+func (in *Interpreter) quote(node ast.Node, env *object.Environment) object.Object {
+	var err *object.Error
+	node = ast.Modify(ast.Copy(node), func(node ast.Node) ast.Node {
+		call, ok := node.(*ast.CallExpression)
+		if !ok || call.Function.Name != "unquote" || err != nil {
+			return node
+		}
+		if len(call.Params) != 1 {
+			err = newError("wrong number of arguments to unquote. got=%d, want=1", len(call.Params))
+			return node
+		}
+		value := in.Eval(call.Params[0], env)
+		if e, ok := value.(*object.Error); ok {
+			err = e
+			return node
+		}
+		unquoted, e := toNode(value, call.Position)
+		if e != nil {
+			err = e
+			return node
+		}
+		return unquoted
+	})
+	if err != nil {
+		return err
+	}
+	return &object.Quote{Node: node}
+}
+
+// toNode converts the value to an expression evaluating to it
+func toNode(value object.Object, pos token.Position) (ast.Expression, *object.Error) {
+	switch value := value.(type) {
+	case *object.Integer:
+		return &ast.IntegerLiteral{Position: pos, Value: value.Value}, nil
+	case *object.BigInt:
+		return &ast.BigIntegerLiteral{Position: pos, Value: value.Value}, nil
+	case *object.String:
+		return &ast.StringLiteral{Position: pos, Value: value.Value}, nil
+	case *object.Boolean:
+		return &ast.Boolean{Position: pos, Value: value.Value}, nil
+	case *object.Array:
+		array := &ast.Array{Position: pos}
+		for _, element := range value.Elements {
+			item, err := toNode(element, pos)
+			if err != nil {
+				return nil, err
+			}
+			array.Items = append(array.Items, item)
+		}
+		return array, nil
+	case *object.Hash:
+		hash := &ast.HashLiteral{Position: pos}
+		for _, key := range value.Keys {
+			pair := value.Pairs[key]
+			k, err := toNode(pair.Key, pos)
+			if err != nil {
+				return nil, err
+			}
+			v, err := toNode(pair.Value, pos)
+			if err != nil {
+				return nil, err
+			}
+			hash.Pairs = append(hash.Pairs, &ast.HashPair{Key: k, Value: v})
+		}
+		return hash, nil
+	case *object.Quote:
+		if expression, ok := value.Node.(ast.Expression); ok {
+			// the same quote can be unquoted more than once
+			return ast.Copy(expression).(ast.Expression), nil
+		}
+	}
+	return nil, newError("cannot unquote %s", value.Type())
+}
+
+// Expand defines macros of the program and expands their calls, it is a
+// shortcut for DefineMacros and ExpandMacros with a new environment.
+func Expand(program *ast.Program) error {
+	env := object.NewEnvironment(nil)
+	DefineMacros(program, env)
+	return ExpandMacros(program, env)
+}
+
+// DefineMacros removes top-level let statements binding macro literals from
+// the program and binds the macros in env.
+func DefineMacros(program *ast.Program, env *object.Environment) {
+	var statements []ast.Statement
+	for _, stmt := range program.Statements {
+		if let, ok := stmt.(*ast.LetStatement); ok {
+			if macro, ok := let.Value.(*ast.MacroLiteral); ok && let.Pattern == nil {
+				env.Set(let.Name(), &object.Macro{Environment: env, Params: macro.Params, Block: macro.Block})
+				continue
+			}
+		}
+		statements = append(statements, stmt)
+	}
+	program.Statements = statements
+}
+
+// ExpandMacros replaces calls of macros bound in env by the code they
+// return. Bodies of macros are evaluated with parameters bound to quoted
+// arguments and they must return a quote. The returned code is expanded
+// again, so macros can use other macros.
+func ExpandMacros(program *ast.Program, env *object.Environment) error {
+	_, err := expand(program, env, 0)
+	return err
+}
+
+func expand(node ast.Node, env *object.Environment, depth int) (ast.Node, error) {
+	var err error
+	node = ast.Modify(node, func(node ast.Node) ast.Node {
+		call, ok := node.(*ast.CallExpression)
+		if !ok || err != nil {
+			return node
+		}
+		value, _ := env.Get(call.Function.Name)
+		macro, ok := value.(*object.Macro)
+		if !ok {
+			return node
+		}
+		if depth == maxExpansionDepth {
+			err = fmt.Errorf("%s: expansion of macro %s is nested too deep", call.Position, call.Function.Name)
+			return node
+		}
+		for _, param := range call.Params {
+			if _, ok := param.(*ast.NamedArgument); ok {
+				err = fmt.Errorf("%s: macro %s does not accept named arguments", param.Pos(), call.Function.Name)
+				return node
+			}
+		}
+		if len(call.Params) != len(macro.Params) {
+			err = fmt.Errorf("%s: macro %s expects %d arguments, got %d", call.Position, call.Function.Name, len(macro.Params), len(call.Params))
+			return node
+		}
+
+		macroEnv := object.NewEnvironment(macro.Environment)
+		for i, param := range macro.Params {
+			macroEnv.Set(param.Name, &object.Quote{Node: call.Params[i]})
+		}
+		result := standard.Eval(macro.Block, macroEnv)
+		if r, ok := result.(*object.ReturnValue); ok {
+			result = r.Value
+		}
+		quoted, ok := result.(*object.Quote)
+		if !ok {
+			if e, ok := result.(*object.Error); ok {
+				err = fmt.Errorf("%s: expansion of macro %s failed: %s", call.Position, call.Function.Name, e.Message)
+			} else {
+				err = fmt.Errorf("%s: macro %s must return a quote, got %s", call.Position, call.Function.Name, describeType(result))
+			}
+			return node
+		}
+		if _, ok := quoted.Node.(ast.Expression); !ok {
+			err = fmt.Errorf("%s: macro %s must return a quoted expression", call.Position, call.Function.Name)
+			return node
+		}
+
+		expanded, e := expand(ast.Copy(quoted.Node), env, depth+1)
+		if e != nil {
+			err = e
+			return node
+		}
+		return expanded
+	})
+	return node, err
+}
+
+func describeType(obj object.Object) string {
+	if obj == nil {
+		return "nothing"
+	}
+	return string(obj.Type())
+}
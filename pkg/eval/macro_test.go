@@ -0,0 +1,176 @@
+package eval
+
+import (
+	"github.com/alenkacz/interpreter-book/pkg/ast"
+	"github.com/alenkacz/interpreter-book/pkg/object"
+	"github.com/alenkacz/interpreter-book/pkg/parser"
+	"github.com/alenkacz/interpreter-book/pkg/tokenizer"
+	"testing"
+)
+
+func TestQuoteUnquote(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`quote(5)`, `5`},
+		{`quote(5 + 8)`, `(5 + 8)`},
+		{`quote(foobar)`, `foobar`},
+		{`quote(unquote(4 + 4))`, `8`},
+		{`quote(8 + unquote(4 + 4))`, `(8 + 8)`},
+		{`let foobar = 8; quote(unquote(foobar) + foobar)`, `(8 + foobar)`},
+		{`quote(unquote(true == false))`, `false`},
+		{`quote(unquote("a" + "b"))`, `ab`},
+		{`quote(unquote([1, 2]))`, `[1, 2]`},
+		{`quote(unquote({"a": [1]}))`, `{a: [1]}`},
+		{`quote(unquote(quote(4 + 4)))`, `(4 + 4)`},
+		{`let q = quote(4 + 4); quote(unquote(4 + 4) + unquote(q))`, `(8 + (4 + 4))`},
+		// quotes are copied, so the same quote gives different results
+		{`let f = fn(x) { quote(unquote(x) * 2) }; f(1); f(3)`, `(3 * 2)`},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		quote, ok := evaluated.(*object.Quote)
+		if !ok {
+			t.Errorf("%s: expected *object.Quote, got=%T (%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if quote.Node.String() != tt.expected {
+			t.Errorf("%s: expected=%q, got=%q", tt.input, tt.expected, quote.Node.String())
+		}
+	}
+}
+
+func TestQuoteErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`quote(1, 2)`, "wrong number of arguments to quote. got=2, want=1"},
+		{`quote(unquote())`, "wrong number of arguments to unquote. got=0, want=1"},
+		{`quote(unquote(fn() { 1 }))`, "cannot unquote FUNCTION"},
+		{`quote(unquote(missing))`, "identifier not found: missing"},
+		{`macro(x) { x }`, "macro literals must be bound by top-level let statements"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		err, ok := evaluated.(*object.Error)
+		if !ok || err.Message != tt.expected {
+			t.Errorf("%s: expected error %q, got=%+v", tt.input, tt.expected, evaluated)
+		}
+	}
+}
+
+func parseProgram(t *testing.T, input string) *ast.Program {
+	p := parser.New(tokenizer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors) != 0 {
+		t.Fatalf("%s: parser errors %v", input, p.Errors)
+	}
+	return program
+}
+
+func TestDefineMacros(t *testing.T) {
+	program := parseProgram(t, `let number = 1;
+let function = fn(x, y) { x + y };
+let mymacro = macro(x, y) { x + y; };`)
+	env := object.NewEnvironment(nil)
+	DefineMacros(program, env)
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("wrong number of statements. got=%d", len(program.Statements))
+	}
+	for _, name := range []string{"number", "function"} {
+		if _, ok := env.Get(name); ok {
+			t.Errorf("%s should not be defined", name)
+		}
+	}
+	value, ok := env.Get("mymacro")
+	macro, isMacro := value.(*object.Macro)
+	if !ok || !isMacro {
+		t.Fatalf("macro not in environment, got %+v", value)
+	}
+	if len(macro.Params) != 2 || macro.Params[0].Name != "x" || macro.Params[1].Name != "y" {
+		t.Errorf("wrong macro parameters %v", macro.Params)
+	}
+	if macro.Block.String() != "(x + y)" {
+		t.Errorf("wrong macro body %q", macro.Block.String())
+	}
+}
+
+func TestExpandMacros(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			`let infixExpression = macro() { quote(1 + 2); }; infixExpression();`,
+			`(1 + 2)`,
+		},
+		{
+			`let reverse = macro(a, b) { quote(unquote(b) - unquote(a)); }; reverse(2 + 2, 10 - 5);`,
+			`((10 - 5) - (2 + 2))`,
+		},
+		{
+			`let unless = macro(condition, consequence, alternative) {
+  quote(if (!(unquote(condition))) { unquote(consequence); } else { unquote(alternative); });
+};
+unless(10 > 5, first([1]), last([2]));`,
+			`if((!(10 > 5))) {
+first([1])} else {
+last([2])}
+`,
+		},
+		// macros can use other macros and compute the code they return
+		{
+			`let twice = macro(x) { quote(unquote(x) + unquote(x)) };
+let quadruple = macro(x) { quote(twice(twice(unquote(x)))) };
+let square = macro(x) { if (true) { return quote(unquote(x) * unquote(x)); } };
+quadruple(square(a));`,
+			`(((a * a) + (a * a)) + ((a * a) + (a * a)))`,
+		},
+	}
+	for _, tt := range tests {
+		program := parseProgram(t, tt.input)
+		if err := Expand(program); err != nil {
+			t.Errorf("%s: unexpected error %v", tt.input, err)
+			continue
+		}
+		if program.String() != tt.expected {
+			t.Errorf("%s: expected=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+}
+
+func TestExpandMacrosErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let m = macro(a) { quote(a) }; m();`, "1:32: macro m expects 1 arguments, got 0"},
+		{`let m = macro(a) { quote(a) }; m(a: 1);`, "1:34: macro m does not accept named arguments"},
+		{`let m = macro() { 1 }; m();`, "1:24: macro m must return a quote, got INTEGER"},
+		{`let m = macro() { missing }; m();`, "1:30: expansion of macro m failed: identifier not found: missing"},
+		{`let m = macro() { quote(m()) }; m();`, "1:25: expansion of macro m is nested too deep"},
+	}
+	for _, tt := range tests {
+		err := Expand(parseProgram(t, tt.input))
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("%s: expected error %q, got %v", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func TestEvalExpandedMacros(t *testing.T) {
+	program := parseProgram(t, `let unless = macro(condition, consequence, alternative) {
+  quote(if (!(unquote(condition))) { unquote(consequence); } else { unquote(alternative); });
+};
+let check = fn(n) { unless(n > 5, "small", "large") };
+[check(1), check(10)]`)
+	if err := Expand(program); err != nil {
+		t.Fatal(err)
+	}
+	if result := Eval(program, object.NewEnvironment(nil)); result.Print() != "[small, large]" {
+		t.Errorf("unexpected result %s", result.Print())
+	}
+}
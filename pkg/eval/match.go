@@ -0,0 +1,143 @@
+package eval
+
+import (
+	"github.com/alenkacz/interpreter-book/pkg/ast"
+	"github.com/alenkacz/interpreter-book/pkg/object"
+)
+
+func (in *Interpreter) evalHashLiteral(hash *ast.HashLiteral, env *object.Environment) object.Object {
+	result := object.NewHash()
+	for _, pair := range hash.Pairs {
+		key := in.Eval(pair.Key, env)
+		if key.Type() == object.ERROR {
+			return key
+		}
+		hashable, ok := key.(object.Hashable)
+		if !ok {
+			return newError("unusable as hash key: %s", key.Type())
+		}
+		value := in.Eval(pair.Value, env)
+		if value.Type() == object.ERROR {
+			return value
+		}
+		result.Set(hashable, value)
+	}
+	return result
+}
+
+// evalMatchExpression evaluates the first arm matching the value. Each arm
+// has its own environment, so names bound by its pattern are visible only in
+// its guard and body.
+func (in *Interpreter) evalMatchExpression(match *ast.MatchExpression, env *object.Environment) object.Object {
+	value := in.Eval(match.Value, env)
+	if value.Type() == object.ERROR {
+		return value
+	}
+	for _, arm := range match.Arms {
+		armEnv := enclose(env, arm.Locals)
+		matched, err := in.matchPattern(arm.Pattern, value, armEnv)
+		if err != nil {
+			return err
+		}
+		if !matched {
+			continue
+		}
+		if arm.Guard != nil {
+			guard := in.Eval(arm.Guard, armEnv)
+			if guard.Type() == object.ERROR {
+				return guard
+			}
+			if !isTruthy(guard) {
+				continue
+			}
+		}
+		return in.Eval(arm.Body, armEnv)
+	}
+	return newError("no match for %s", describe(value))
+}
+
+// destructure binds names of the pattern to parts of the value, it fails
+// when the value does not match the pattern
+func (in *Interpreter) destructure(pattern ast.Pattern, value object.Object, env *object.Environment) *object.Error {
+	matched, err := in.matchPattern(pattern, value, env)
+	if err != nil {
+		return err
+	}
+	if !matched {
+		return newError("cannot destructure %s with %s", describe(value), pattern)
+	}
+	return nil
+}
+
+// matchPattern reports whether the value matches the pattern and binds names
+// of the pattern in env. Bindings of a pattern that does not match may be
+// left in env.
+func (in *Interpreter) matchPattern(pattern ast.Pattern, value object.Object, env *object.Environment) (bool, *object.Error) {
+	switch pattern := pattern.(type) {
+	case *ast.DefaultPattern:
+		if value == nil {
+			// the element is missing
+			value = in.Eval(pattern.Default, env)
+			if err, ok := value.(*object.Error); ok {
+				return false, err
+			}
+		}
+		return in.matchPattern(pattern.Pattern, value, env)
+	case *ast.WildcardPattern:
+		return true, nil
+	case *ast.BindingPattern:
+		bind(env, pattern.Local, pattern.Name, value)
+		return true, nil
+	case *ast.LiteralPattern:
+		literal := in.Eval(pattern.Value, env)
+		if err, ok := literal.(*object.Error); ok {
+			return false, err
+		}
+		return equal(literal, value), nil
+	case *ast.ArrayPattern:
+		array, ok := value.(*object.Array)
+		if !ok || pattern.Rest == nil && len(array.Elements) > len(pattern.Elements) {
+			return false, nil
+		}
+		for i, element := range pattern.Elements {
+			var value object.Object
+			if i < len(array.Elements) {
+				value = array.Elements[i]
+			} else if _, ok := element.(*ast.DefaultPattern); !ok {
+				return false, nil
+			}
+			if matched, err := in.matchPattern(element, value, env); !matched || err != nil {
+				return false, err
+			}
+		}
+		if pattern.Rest == nil {
+			return true, nil
+		}
+		var rest []object.Object
+		if len(array.Elements) > len(pattern.Elements) {
+			rest = make([]object.Object, len(array.Elements)-len(pattern.Elements))
+			copy(rest, array.Elements[len(pattern.Elements):])
+		}
+		return in.matchPattern(pattern.Rest, &object.Array{Elements: rest}, env)
+	case *ast.HashPattern:
+		hash, ok := value.(*object.Hash)
+		if !ok {
+			return false, nil
+		}
+		for _, pair := range pattern.Pairs {
+			key, ok := in.Eval(pair.Key, env).(object.Hashable)
+			if !ok {
+				return false, newError("unusable as hash key: %s", pair.Key)
+			}
+			element, ok := hash.Get(key)
+			if _, isDefault := pair.Value.(*ast.DefaultPattern); !ok && !isDefault {
+				return false, nil
+			}
+			if matched, err := in.matchPattern(pair.Value, element, env); !matched || err != nil {
+				return false, err
+			}
+		}
+		return true, nil
+	}
+	return false, newError("unknown pattern %s", pattern)
+}
@@ -0,0 +1,104 @@
+package eval
+
+import (
+	"testing"
+)
+
+func TestHashLiterals(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{}`, `{}`},
+		{`let two = "two"; {"one": 10 - 9, two: 1 + 1, 3: 3, true: 4}`, `{one: 1, two: 2, 3: 3, true: 4}`},
+		{`{"a": 1, "b": 2, "a": 3}`, `{a: 3, b: 2}`},
+		{`{"a": 1}["a"]`, `1`},
+		{`{"a": 1}["b"]`, `null`},
+		{`{1: "one"}[1]`, `one`},
+		{`{1: "one"}[1n]`, `one`},
+		{`{true: "yes"}[5 > 1]`, `yes`},
+		{`len({"a": 1, "b": 2})`, `2`},
+		{`{"a": 1}[[1]]`, `unusable as hash key: ARRAY`},
+		{`{fn(x) { x }: 1}`, `unusable as hash key: FUNCTION`},
+		{`{"a": missing}`, `identifier not found: missing`},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Print() != tt.expected {
+			t.Errorf("%s: expected %q, got %q", tt.input, tt.expected, evaluated.Print())
+		}
+	}
+}
+
+func TestMatchExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`match (1) { 1 => "one", _ => "other" }`, `one`},
+		{`match (2) { 1 => "one", _ => "other" }`, `other`},
+		{`match (-1) { -1 => "minus one" }`, `minus one`},
+		{`match (1n) { 1 => "one" }`, `one`},
+		{`match ("a") { "b" => 1, "a" => 2 }`, `2`},
+		{`match (false) { true => 1, false => 0 }`, `0`},
+		{`match (5) { n => n * 2 }`, `10`},
+		{`match (5) { n if n > 10 => "big", n if n > 1 => "small", _ => "tiny" }`, `small`},
+		{`match ([]) { [] => "empty", _ => "other" }`, `empty`},
+		{`match ([1, 2]) { [a] => a, [a, b] => a + b }`, `3`},
+		{`match ([1, 2, 3]) { [a, b] => 0, [a, ...rest] => rest }`, `[2, 3]`},
+		{`match ([1]) { [a, ...rest] => rest }`, `[]`},
+		{`match ([1, 2]) { [_, ...] => "non-empty" }`, `non-empty`},
+		{`match ([1, [2, 3]]) { [1, [x, 3]] => x }`, `2`},
+		{`match ("abc") { [] => 1, _ => 2 }`, `2`},
+		{`match ({"name": "Ann", "age": 30}) { {name, "age": 30} => name }`, `Ann`},
+		{`match ({"name": "Ann"}) { {age} => age, {name: n} => n }`, `Ann`},
+		{`match ({1: [1, 2]}) { {1: [a, ...r]} => r }`, `[2]`},
+		{`match ([1]) { {} => 1, _ => 2 }`, `2`},
+		// bindings are scoped to the arm
+		{`let a = 1; match (2) { a => a }; a`, `1`},
+		{`match ([1, 2]) { [a, 3] => 0, [b, c] => a }`, `identifier not found: a`},
+		{`match (3) { 1 => 1 }`, `no match for 3`},
+		{`match ("x") { "y" => 1 }`, `no match for "x"`},
+		{`match (missing) { _ => 1 }`, `identifier not found: missing`},
+		{`match (1) { n if missing => 1 }`, `identifier not found: missing`},
+		{`let f = fn(xs) { match (xs) { [] => 0, [x, ...rest] => x + f(rest) } }; f([1, 2, 3])`, `6`},
+		{`match (1) { 1 => {"one": 1} }`, `{one: 1}`},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Print() != tt.expected {
+			t.Errorf("%s: expected %q, got %q", tt.input, tt.expected, evaluated.Print())
+		}
+	}
+}
+
+func TestDestructuring(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let [a, b, ...rest] = [1, 2, 3, 4]; [a, b, rest]`, `[1, 2, [3, 4]]`},
+		{`let [a, ...rest] = [1]; rest`, `[]`},
+		{`let {name, age} = {"name": "Ann", "age": 30, "x": 1}; [name, age]`, `[Ann, 30]`},
+		{`let {name: [first, _], pos: {x}} = {"name": ["A", "B"], "pos": {"x": 1}}; [first, x]`, `[A, 1]`},
+		{`let [a, b = a + 1, c = 10] = [1]; [a, b, c]`, `[1, 2, 10]`},
+		{`let {a = 1, b: [c] = [2]} = {}; [a, c]`, `[1, 2]`},
+		{`let {a = 1} = {"a": false}; a`, `false`},
+		{`let [a, b] = [1]; a`, `cannot destructure [1] with [a, b]`},
+		{`let [a] = [1, 2]; a`, `cannot destructure [1, 2] with [a]`},
+		{`let {a} = {"b": 1}; a`, `cannot destructure {b: 1} with {a: a}`},
+		{`let [a] = "a"; a`, `cannot destructure "a" with [a]`},
+		{`let [a] = missing; a`, `identifier not found: missing`},
+		{`let [a = missing] = []; a`, `identifier not found: missing`},
+		{`let f = fn([a, b], {c = 3}) { a + b + c }; f([1, 2], {})`, `6`},
+		{`let f = fn(x, [y, ...z]) { x + len(z) }; f(1, [2, 3, 4])`, `3`},
+		{`let f = fn([a]) { a }; f(1)`, `cannot destructure 1 with [a]`},
+		{`fn([a], {b}) { a }`, "fn([a], {b: b}) {\na\n}"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Print() != tt.expected {
+			t.Errorf("%s: expected %q, got %q", tt.input, tt.expected, evaluated.Print())
+		}
+	}
+}
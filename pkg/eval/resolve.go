@@ -0,0 +1,232 @@
+package eval
+
+import (
+	"fmt"
+	"github.com/alenkacz/interpreter-book/pkg/ast"
+	"github.com/alenkacz/interpreter-book/pkg/object"
+)
+
+// Resolve annotates identifiers of the program with locations of their
+// variables, so that environments of function calls and match arms store
+// variables in slots instead of maps. Variables of the top-level are looked
+// up by name. Bodies of functions are resolved after the code around them,
+// so they can refer to names bound later.
+//
+// The returned error reports the first name which is not bound anywhere,
+// names bound in env, e.g. by previous input of the REPL, are known. The
+// program is annotated even when an error is returned. Builtin functions are
+// the standard ones.
+func Resolve(program *ast.Program, env *object.Environment) error {
+	return standard.Resolve(program, env)
+}
+
+// Resolve resolves the program as the package-level Resolve with builtin
+// functions of the interpreter
+func (in *Interpreter) Resolve(program *ast.Program, env *object.Environment) error {
+	r := &resolver{env: env, builtins: in.builtins}
+	r.scope = &scope{globals: make(map[string]bool)}
+	for _, stmt := range program.Statements {
+		if stmt != nil {
+			r.inspect(stmt)
+		}
+	}
+	for i := 0; i < len(r.functions); i++ {
+		r.function(r.functions[i])
+	}
+	return r.err
+}
+
+type resolver struct {
+	env      *object.Environment
+	builtins map[string]*object.BuiltIn
+	scope    *scope
+	// function literals whose bodies are resolved after the current scope
+	functions []pendingFunction
+	err       error
+}
+
+type pendingFunction struct {
+	fn    *ast.FunctionLiteral
+	scope *scope
+}
+
+// scope corresponds to an environment created during evaluation
+type scope struct {
+	outer *scope
+	// names of slots of the environment
+	names []string
+	slots map[string]int
+	// globals are names bound at the top-level, nil in other scopes
+	globals map[string]bool
+}
+
+func newScope(outer *scope) *scope {
+	return &scope{outer: outer, names: []string{}, slots: make(map[string]int)}
+}
+
+// declare returns location of the name bound in the scope, it is nil for
+// the top-level where names are bound by name
+func (s *scope) declare(name string) *ast.Local {
+	if s.globals != nil {
+		s.globals[name] = true
+		return nil
+	}
+	slot, ok := s.slots[name]
+	if !ok {
+		slot = len(s.names)
+		s.names = append(s.names, name)
+		s.slots[name] = slot
+	}
+	return &ast.Local{Depth: 0, Slot: slot}
+}
+
+func (r *resolver) inspect(node ast.Node) {
+	ast.Inspect(node, r.visit)
+}
+
+func (r *resolver) visit(node ast.Node) bool {
+	switch node := node.(type) {
+	case *ast.LetStatement:
+		if node.Value != nil {
+			r.inspect(node.Value)
+		}
+		if node.Pattern != nil {
+			r.pattern(node.Pattern)
+		} else if node.Identifier != nil {
+			node.Local = r.scope.declare(node.Name())
+		}
+		return false
+	case *ast.Identifier:
+		r.reference(node, false)
+	case *ast.CallExpression:
+		if node.Function.Name == "quote" {
+			// only arguments of unquote are evaluated
+			for _, p := range node.Params {
+				r.unquoted(p)
+			}
+			return false
+		}
+		r.reference(node.Function, true)
+		for _, p := range node.Params {
+			if p != nil {
+				r.inspect(p)
+			}
+		}
+		return false
+	case *ast.FunctionLiteral:
+		r.functions = append(r.functions, pendingFunction{fn: node, scope: r.scope})
+		return false
+	case *ast.MatchExpression:
+		if node.Value != nil {
+			r.inspect(node.Value)
+		}
+		outer := r.scope
+		for _, arm := range node.Arms {
+			r.scope = newScope(outer)
+			r.pattern(arm.Pattern)
+			if arm.Guard != nil {
+				r.inspect(arm.Guard)
+			}
+			if arm.Body != nil {
+				r.inspect(arm.Body)
+			}
+			arm.Locals = r.scope.names
+		}
+		r.scope = outer
+		return false
+	case *ast.MacroLiteral:
+		return false
+	}
+	return true
+}
+
+// function resolves parameters and body of the function in a new scope,
+// defaults can refer to the previous parameters
+func (r *resolver) function(f pendingFunction) {
+	r.scope = newScope(f.scope)
+	for i, param := range f.fn.Params {
+		if d := f.fn.ParamDefault(i); d != nil {
+			r.inspect(d)
+		}
+		if pattern := f.fn.ParamPattern(i); pattern != nil {
+			r.pattern(pattern)
+		} else {
+			param.Local = r.scope.declare(param.Name)
+		}
+	}
+	if f.fn.Block != nil {
+		r.inspect(f.fn.Block)
+	}
+	f.fn.Locals = r.scope.names
+}
+
+// pattern declares names bound by the pattern, defaults are resolved before
+// the names they are used for
+func (r *resolver) pattern(pattern ast.Pattern) {
+	switch pattern := pattern.(type) {
+	case *ast.BindingPattern:
+		pattern.Local = r.scope.declare(pattern.Name)
+	case *ast.DefaultPattern:
+		r.inspect(pattern.Default)
+		r.pattern(pattern.Pattern)
+	case *ast.ArrayPattern:
+		for _, element := range pattern.Elements {
+			r.pattern(element)
+		}
+		if pattern.Rest != nil {
+			r.pattern(pattern.Rest)
+		}
+	case *ast.HashPattern:
+		for _, pair := range pattern.Pairs {
+			r.pattern(pair.Value)
+		}
+	}
+}
+
+// unquoted resolves arguments of unquote calls in the quoted node
+func (r *resolver) unquoted(node ast.Node) {
+	ast.Inspect(node, func(node ast.Node) bool {
+		call, ok := node.(*ast.CallExpression)
+		if !ok || call.Function.Name != "unquote" {
+			return true
+		}
+		for _, p := range call.Params {
+			if p != nil {
+				r.inspect(p)
+			}
+		}
+		return false
+	})
+}
+
+// reference resolves the identifier, builtin functions can only be called
+func (r *resolver) reference(ident *ast.Identifier, call bool) {
+	depth := 0
+	s := r.scope
+	for ; s.globals == nil; s = s.outer {
+		if slot, ok := s.slots[ident.Name]; ok {
+			ident.Local = &ast.Local{Depth: depth, Slot: slot}
+			return
+		}
+		depth++
+	}
+	if _, ok := r.builtins[ident.Name]; ok && call {
+		return
+	}
+	if !s.globals[ident.Name] && !r.bound(ident.Name) {
+		if r.err == nil {
+			r.err = fmt.Errorf("%s: identifier not found: %s", ident.Position, ident.Name)
+		}
+		return
+	}
+	ident.Local = &ast.Local{Depth: depth, Slot: -1}
+}
+
+// bound reports whether the name is bound in the environment of the program
+func (r *resolver) bound(name string) bool {
+	if r.env == nil {
+		return false
+	}
+	_, ok := r.env.Get(name)
+	return ok
+}
@@ -0,0 +1,138 @@
+package eval
+
+import (
+	"fmt"
+	"github.com/alenkacz/interpreter-book/pkg/ast"
+	"github.com/alenkacz/interpreter-book/pkg/object"
+	"github.com/alenkacz/interpreter-book/pkg/parser"
+	"github.com/alenkacz/interpreter-book/pkg/tokenizer"
+	"strings"
+	"testing"
+)
+
+func TestResolve(t *testing.T) {
+	input := `let a = 1;
+let f = fn(x, [y], z = x) {
+  let w = x;
+  let g = fn() { w + a + later };
+  let later = y;
+  match (z) { [v] if v => v, _ => g() }
+};
+f(1, [2]);`
+	program := parser.New(tokenizer.New(input)).ParseProgram()
+	if err := Resolve(program, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	var references []string
+	var locals []string
+	ast.Inspect(program, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.Identifier:
+			if node.Local != nil {
+				references = append(references, fmt.Sprintf("%s@%d:%d", node.Name, node.Local.Depth, node.Local.Slot))
+			}
+		case *ast.FunctionLiteral:
+			locals = append(locals, strings.Join(node.Locals, " "))
+		case *ast.MatchArm:
+			locals = append(locals, strings.Join(node.Locals, " "))
+		}
+		return true
+	})
+
+	// parameters are annotated too, the pattern parameter has no slot
+	expectedReferences := "x@0:0 z@0:2 x@0:0 x@0:0 w@1:3 a@2:-1 later@1:5 y@0:1 z@0:2 v@0:0 v@0:0 g@1:4 f@0:-1"
+	if strings.Join(references, " ") != expectedReferences {
+		t.Errorf("unexpected references.\nexpected=%s\ngot=     %s", expectedReferences, strings.Join(references, " "))
+	}
+	expectedLocals := []string{"x y z w g later", "", "v", ""}
+	if strings.Join(locals, "|") != strings.Join(expectedLocals, "|") {
+		t.Errorf("unexpected locals %q", locals)
+	}
+}
+
+func TestResolveErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let f = fn() { g() }; let g = fn() { 1 }; f();`, ""},
+		{`len([1]); let a = quote(b + unquote(1));`, ""},
+		{`known + 1`, ""},
+		{`x; let x = 1;`, "1:1: identifier not found: x"},
+		{`let f = fn(a = b, b = 1) { a };`, "1:16: identifier not found: b"},
+		{`let f = len;`, "1:9: identifier not found: len"},
+		{`match (1) { a => a }; a`, "1:23: identifier not found: a"},
+		{`let q = quote(a + unquote(b));`, "1:27: identifier not found: b"},
+		{`if (false) { missing() }`, "1:14: identifier not found: missing"},
+	}
+	for _, tt := range tests {
+		env := object.NewEnvironment(nil)
+		env.Set("known", &object.Integer{Value: 1})
+		err := Resolve(parser.New(tokenizer.New(tt.input)).ParseProgram(), env)
+		actual := ""
+		if err != nil {
+			actual = err.Error()
+		}
+		if actual != tt.expected {
+			t.Errorf("%s: expected error %q, got %q", tt.input, tt.expected, actual)
+		}
+	}
+}
+
+func TestResolvedEvaluation(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let adder = fn(x) { fn(y) { x + y } }; let add = adder(1); add(2)`, "3"},
+		{`let x = 1; let f = fn() { let g = fn() { x }; let r = g(); let x = 2; [r, g()] }; f()`, "[1, 2]"},
+		{`let f = fn(n) { if (n < 1) { 0 } else { n + f(n - 1) } }; f(10)`, "55"},
+		{`let f = fn(a, [b, c] = [a, 2], ...d) { [a, b, c, d] }; f(1)`, "[1, 1, 2, []]"},
+		{`let b = 2; let f = fn(a, b = 1, c = b) { [a, b, c] }; f(c: b, a: 1)`, "[1, 1, 2]"},
+		{`let f = fn(x) { match (x) { [a, ...b] if a > 0 => b, n => n } }; [f([1, 2]), f([0])]`, "[[2], [0]]"},
+		{`let f = fn() { if (false) { let y = 1; }; y }; f()`, "identifier not found: y"},
+		{`let f = fn() { let a = 1; let a = a + 1; a }; f()`, "2"},
+		// functions see bindings of their closures, not of their callers
+		{`let f = fn() { y }; let g = fn() { let y = 1; f() }; g()`, "identifier not found: y"},
+	}
+	for _, tt := range tests {
+		program := parser.New(tokenizer.New(tt.input)).ParseProgram()
+		unresolved := Eval(program, object.NewEnvironment(nil)).Print()
+		Resolve(program, nil)
+		resolved := Eval(program, object.NewEnvironment(nil)).Print()
+		if resolved != tt.expected || unresolved != tt.expected {
+			t.Errorf("%s: expected %q, got %q and %q when resolved", tt.input, tt.expected, unresolved, resolved)
+		}
+	}
+}
+
+// BenchmarkResolved compares evaluation of resolved code, whose variables are
+// stored in slots, with the same code looking variables up by name
+func BenchmarkResolved(b *testing.B) {
+	input := `let offset = 0;
+let fib = fn(n) {
+  let a = n - 1;
+  let b = n - 2;
+  if (n < 2) { n + offset } else { fib(a) + fib(b) }
+};
+fib(15)`
+	resolved := parser.New(tokenizer.New(input)).ParseProgram()
+	if err := Resolve(resolved, nil); err != nil {
+		b.Fatal(err)
+	}
+	unresolved := parser.New(tokenizer.New(input)).ParseProgram()
+
+	for _, bb := range []struct {
+		name    string
+		program *ast.Program
+	}{{"unresolved", unresolved}, {"resolved", resolved}} {
+		b.Run(bb.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if result := Eval(bb.program, object.NewEnvironment(nil)); result.Print() != "610" {
+					b.Fatalf("unexpected result %s", result.Print())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package eval
+
+import (
+	"fmt"
+	"github.com/alenkacz/interpreter-book/pkg/ast"
+	"github.com/alenkacz/interpreter-book/pkg/object"
+	"github.com/alenkacz/interpreter-book/pkg/token"
+	"sort"
+	"strings"
+)
+
+// Save returns a program of let statements binding the names bound directly
+// in env, sorted by name. Evaluating the formatted program in a new
+// environment restores the bindings. Functions and macros are saved only
+// when they were defined in env or in an environment env was forked from,
+// restored functions refer to the restored bindings. Values that cannot be
+// saved, such as tasks, channels, null and closures of other environments,
+// are left out and reported by the error, the program contains the rest.
+func Save(env *object.Environment) (*ast.Program, error) {
+	bindings := env.Bindings()
+	names := make([]string, 0, len(bindings))
+	for name := range bindings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	program := &ast.Program{}
+	var skipped []string
+	for _, name := range names {
+		value, ok := saveValue(bindings[name], env)
+		if !ok {
+			skipped = append(skipped, name)
+			continue
+		}
+		program.Statements = append(program.Statements, &ast.LetStatement{
+			Identifier: &token.Token{Type: token.IDENT, Literal: name},
+			Value:      value,
+		})
+	}
+	if len(skipped) != 0 {
+		return program, fmt.Errorf("cannot save %s", strings.Join(skipped, ", "))
+	}
+	return program, nil
+}
+
+func saveValue(value object.Object, env *object.Environment) (ast.Expression, bool) {
+	switch value := value.(type) {
+	case *object.Function:
+		if !env.ForkOf(value.Environment) {
+			return nil, false
+		}
+		return &ast.FunctionLiteral{
+			Params:        value.Params,
+			ParamPatterns: value.ParamPatterns,
+			Defaults:      value.Defaults,
+			Variadic:      value.Variadic,
+			Block:         ast.Copy(value.Block).(*ast.BlockStatement),
+		}, true
+	case *object.Macro:
+		if !env.ForkOf(value.Environment) {
+			return nil, false
+		}
+		return &ast.MacroLiteral{Params: value.Params, Block: ast.Copy(value.Block).(*ast.BlockStatement)}, true
+	case *object.Quote:
+		expression, ok := value.Node.(ast.Expression)
+		if !ok {
+			return nil, false
+		}
+		return &ast.CallExpression{
+			Function: &ast.Identifier{Name: "quote"},
+			Params:   []ast.Expression{ast.Copy(expression).(ast.Expression)},
+		}, true
+	case *object.Array:
+		array := &ast.Array{}
+		for _, element := range value.Elements {
+			item, ok := saveValue(element, env)
+			if !ok {
+				return nil, false
+			}
+			array.Items = append(array.Items, item)
+		}
+		return array, true
+	case *object.Hash:
+		hash := &ast.HashLiteral{}
+		for _, key := range value.Keys {
+			pair := value.Pairs[key]
+			k, ok := saveValue(pair.Key, env)
+			if !ok {
+				return nil, false
+			}
+			v, ok := saveValue(pair.Value, env)
+			if !ok {
+				return nil, false
+			}
+			hash.Pairs = append(hash.Pairs, &ast.HashPair{Key: k, Value: v})
+		}
+		return hash, true
+	}
+	expression, err := toNode(value, token.Position{})
+	return expression, err == nil
+}
@@ -0,0 +1,135 @@
+package eval
+
+import (
+	"fmt"
+	"github.com/alenkacz/interpreter-book/pkg/format"
+	"github.com/alenkacz/interpreter-book/pkg/object"
+	"github.com/alenkacz/interpreter-book/pkg/parser"
+	"github.com/alenkacz/interpreter-book/pkg/tokenizer"
+	"sync"
+	"testing"
+)
+
+func evalIn(input string, env *object.Environment) string {
+	program := parser.New(tokenizer.New(input)).ParseProgram()
+	if err := Resolve(program, env); err != nil {
+		return err.Error()
+	}
+	if result := Eval(program, env); result != nil {
+		return result.Print()
+	}
+	return ""
+}
+
+func TestFork(t *testing.T) {
+	base := object.NewEnvironment(nil)
+	evalIn(`let config = {"greeting": "hello"}; let greet = fn(name) { config["greeting"] + " " + name };`, base)
+
+	fork := base.Fork()
+	evalIn(`let config = {"greeting": "hi"}; let extra = 1;`, fork)
+	if result := evalIn(`greet("fork")`, fork); result != "hello fork" {
+		t.Errorf("functions of base must refer to base, got %s", result)
+	}
+	if result := evalIn(`config["greeting"]`, fork); result != "hi" {
+		t.Errorf("expected binding of fork, got %s", result)
+	}
+	if _, ok := base.Get("extra"); ok {
+		t.Errorf("binding of fork visible in base")
+	}
+	if result := evalIn(`config["greeting"]`, base); result != "hello" {
+		t.Errorf("base changed by fork, got %s", result)
+	}
+
+	// forks of a snapshot do not see later changes of base
+	snapshot := base.Snapshot()
+	evalIn(`let config = {"greeting": "hey"};`, base)
+	for i := 0; i < 2; i++ {
+		if result := evalIn(`config["greeting"]`, snapshot.Fork()); result != "hello" {
+			t.Errorf("snapshot changed by base, got %s", result)
+		}
+	}
+	if !fork.ForkOf(base) || base.ForkOf(fork) || !snapshot.Fork().Fork().ForkOf(base) {
+		t.Errorf("unexpected origin of forks")
+	}
+}
+
+// TestParallelForks is meant to be run with the race detector, each request
+// forks the same base environment
+func TestParallelForks(t *testing.T) {
+	base := object.NewEnvironment(nil)
+	evalIn(`let double = fn(x) { x * 2 }; let n = 0;`, base)
+	snapshot := base.Snapshot()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			env := snapshot.Fork()
+			if i%2 == 0 {
+				env = base.Fork()
+			}
+			input := fmt.Sprintf(`let n = %d; double(n)`, i)
+			if result := evalIn(input, env); result != fmt.Sprint(2*i) {
+				t.Errorf("%s: expected %d, got %s", input, 2*i, result)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if result := evalIn(`n`, base); result != "0" {
+		t.Errorf("base changed by forks, got %s", result)
+	}
+}
+
+func TestSave(t *testing.T) {
+	env := object.NewEnvironment(nil)
+	evalIn(`let add = fn(a, [b, c] = [1, 2], ...rest) { a + b + c };
+let values = [1, 100000000000000000000, "s", true, {"k": [add]}, quote(x + 1)];
+let ch = channel();
+let nothing = if (false) { 1 };
+let makeAdder = fn(n) { fn(x) { x + n } };
+let inc = makeAdder(1);`, env)
+	fork := env.Fork()
+	evalIn(`let local = add(1);`, fork)
+
+	program, err := Save(fork)
+	if err == nil || err.Error() != "cannot save ch, inc, nothing" {
+		t.Errorf("unexpected error %v", err)
+	}
+	expected := `let add = fn(a, [b, c] = [1, 2], ...rest) {
+  a + b + c;
+};
+let local = 4;
+let makeAdder = fn(n) {
+  fn(x) {
+    x + n;
+  };
+};
+let values = [1, 100000000000000000000n, "s", true, {"k": [fn(a, [b, c] = [1, 2], ...rest) {
+  a + b + c;
+}]}, quote(x + 1)];
+`
+	source := format.Program(program)
+	if source != expected {
+		t.Errorf("unexpected program.\nexpected=%s\ngot=     %s", expected, source)
+	}
+	restored := object.NewEnvironment(nil)
+	evalIn(source, restored)
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`add(local)`, "7"},
+		{`let addTwo = makeAdder(2); addTwo(3)`, "5"},
+		{`let g = values[4]["k"][0]; g(1, [2, 3])`, "6"},
+		{`values[5]`, "QUOTE((x + 1))"},
+	}
+	for _, tt := range tests {
+		// each input is evaluated in forks so that its bindings do not leak
+		for _, env := range []*object.Environment{fork.Fork(), restored.Fork()} {
+			if result := evalIn(tt.input, env); result != tt.expected {
+				t.Errorf("%s: expected %s, got %s", tt.input, tt.expected, result)
+			}
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package eval
+
+import (
+	"github.com/alenkacz/interpreter-book/pkg/ast"
+	"github.com/alenkacz/interpreter-book/pkg/object"
+)
+
+// Tracer receives events of the evaluation, it is used by debuggers and
+// other tools observing running programs. Any of the functions can be nil.
+// A tracer is called from a single goroutine, spawned tasks are traced by
+// tracers returned by Spawn.
+type Tracer struct {
+	// Statement is called before each statement is evaluated with the
+	// environment the statement is evaluated in. The evaluation fails with
+	// the returned error when it is not nil.
+	Statement func(stmt ast.Statement, env *object.Environment) error
+	// Branch is called after the condition of the if expression is
+	// evaluated, taken tells whether the consequence is evaluated
+	Branch func(expr *ast.IfExpression, taken bool)
+	// Call is called when the function is applied to already evaluated
+	// arguments, env is the environment of the caller
+	Call func(call *ast.CallExpression, function object.Object, env *object.Environment)
+	// Return is called when the function applied by call returns
+	Return func(call *ast.CallExpression, function object.Object, result object.Object)
+	// Spawn is called when a task is spawned and returns the tracer of the
+	// task, tasks are not traced when it is nil. It may be called from
+	// goroutines of other tasks.
+	Spawn func() *Tracer
+}
+
+func (in *Interpreter) traceStatement(stmt ast.Statement, env *object.Environment) *object.Error {
+	if in.Trace != nil && in.Trace.Statement != nil {
+		if err := in.Trace.Statement(stmt, env); err != nil {
+			return newError("%s", err)
+		}
+	}
+	return nil
+}
+
+func (in *Interpreter) traceBranch(expr *ast.IfExpression, taken bool) {
+	if in.Trace != nil && in.Trace.Branch != nil {
+		in.Trace.Branch(expr, taken)
+	}
+}
+
+func (in *Interpreter) traceCall(call *ast.CallExpression, function object.Object, env *object.Environment) {
+	if in.Trace != nil && in.Trace.Call != nil {
+		in.Trace.Call(call, function, env)
+	}
+}
+
+func (in *Interpreter) traceReturn(call *ast.CallExpression, function object.Object, result object.Object) {
+	if in.Trace != nil && in.Trace.Return != nil {
+		in.Trace.Return(call, function, result)
+	}
+}
+
+// traceSpawn returns interpreter evaluating a spawned task, it differs only
+// by the tracer
+func (in *Interpreter) traceSpawn() *Interpreter {
+	if in.Trace == nil {
+		return in
+	}
+	task := *in
+	task.Trace = nil
+	if in.Trace.Spawn != nil {
+		task.Trace = in.Trace.Spawn()
+	}
+	return &task
+}
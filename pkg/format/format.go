@@ -0,0 +1,399 @@
+// Package format implements canonical formatting of Monkey source code.
+package format
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/alenkacz/interpreter-book/pkg/ast"
+	"github.com/alenkacz/interpreter-book/pkg/parser"
+	"github.com/alenkacz/interpreter-book/pkg/token"
+	"github.com/alenkacz/interpreter-book/pkg/tokenizer"
+	"strings"
+)
+
+const indentation = "  "
+
+// Source formats the source code, it fails when the source cannot be parsed.
+func Source(src []byte) ([]byte, error) {
+	p := parser.New(tokenizer.New(string(src)))
+	program := p.ParseProgram()
+	if len(p.Errors) != 0 {
+		return nil, errors.New(strings.Join(p.Errors, "\n"))
+	}
+	return []byte(Program(program)), nil
+}
+
+// Program returns canonical source code of the program including comments.
+func Program(program *ast.Program) string {
+	p := &printer{comments: program.Comments}
+	p.statements(program.Statements, token.Position{})
+	return p.buf.String()
+}
+
+// Node returns canonical source code of the node, comments are not included.
+func Node(node ast.Node) string {
+	p := &printer{}
+	switch node := node.(type) {
+	case *ast.Program:
+		return Program(&ast.Program{Statements: node.Statements})
+	case ast.Statement:
+		p.statement(node)
+	case ast.Expression:
+		p.expression(node, parser.LOWEST)
+	}
+	return p.buf.String()
+}
+
+type printer struct {
+	buf   bytes.Buffer
+	depth int
+
+	comments []*ast.Comment
+	// index of the next comment to be printed
+	next int
+	// source line of the last printed statement or comment, 0 at the start
+	// of a block
+	lastLine int
+}
+
+func (p *printer) write(s string) {
+	p.buf.WriteString(s)
+}
+
+func (p *printer) indent() {
+	p.write(strings.Repeat(indentation, p.depth))
+}
+
+// separate keeps one empty line between statements that were separated by
+// empty lines in the source
+func (p *printer) separate(line int) {
+	if p.lastLine > 0 && line > p.lastLine+1 {
+		p.write("\n")
+	}
+}
+
+// statements prints statements each on its own line together with comments
+// in front of the end position, zero end prints all remaining comments
+func (p *printer) statements(statements []ast.Statement, end token.Position) {
+	for _, stmt := range statements {
+		p.commentsBefore(stmt.Pos())
+		p.separate(stmt.Pos().Line)
+		p.indent()
+		p.statement(stmt)
+		p.lastLine = stmt.End().Line
+		p.trailingComment(p.lastLine)
+		p.write("\n")
+	}
+	p.commentsBefore(end)
+}
+
+func (p *printer) commentsBefore(pos token.Position) {
+	for p.next < len(p.comments) {
+		c := p.comments[p.next]
+		if pos.Line != 0 && !c.Position.Before(pos) {
+			return
+		}
+		p.separate(c.Position.Line)
+		p.indent()
+		p.write(c.Text)
+		p.write("\n")
+		p.lastLine = c.Position.Line
+		p.next++
+	}
+}
+
+func (p *printer) trailingComment(line int) {
+	if p.next < len(p.comments) && p.comments[p.next].Position.Line == line {
+		p.write(" ")
+		p.write(p.comments[p.next].Text)
+		p.next++
+	}
+}
+
+func (p *printer) statement(stmt ast.Statement) {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		p.write("let ")
+		if stmt.Pattern != nil {
+			p.pattern(stmt.Pattern)
+		} else {
+			p.write(stmt.Identifier.Literal)
+		}
+		if stmt.Type != nil {
+			p.write(": " + stmt.Type.Name)
+		}
+		p.write(" = ")
+		p.expression(stmt.Value, parser.LOWEST)
+		p.write(";")
+	case *ast.ReturnStatement:
+		p.write("return ")
+		p.expression(stmt.ReturnValue, parser.LOWEST)
+		p.write(";")
+	case *ast.ExpressionStatement:
+		p.expression(stmt.Expression, parser.LOWEST)
+		if _, ok := stmt.Expression.(*ast.IfExpression); !ok {
+			p.write(";")
+		}
+	case *ast.BlockStatement:
+		p.block(stmt)
+	default:
+		panic(fmt.Sprintf("format: unexpected statement %T", stmt))
+	}
+}
+
+func (p *printer) block(block *ast.BlockStatement) {
+	hasComments := p.next < len(p.comments) && p.comments[p.next].Position.Before(block.End())
+	if len(block.Statements) == 0 && !hasComments {
+		p.write("{}")
+		return
+	}
+
+	p.write("{\n")
+	p.depth++
+	lastLine := p.lastLine
+	p.lastLine = 0
+	p.statements(block.Statements, block.End())
+	p.lastLine = lastLine
+	p.depth--
+	p.indent()
+	p.write("}")
+}
+
+// expression prints the expression, it is wrapped in parens when its
+// precedence is lower than the precedence required by the context
+func (p *printer) expression(exp ast.Expression, precedence int) {
+	switch exp := exp.(type) {
+	case *ast.IntegerLiteral:
+		p.write(exp.String())
+	case *ast.BigIntegerLiteral:
+		p.write(exp.String())
+	case *ast.StringLiteral:
+		p.write("\"" + exp.Value + "\"")
+	case *ast.Boolean:
+		p.write(exp.String())
+	case *ast.Identifier:
+		p.write(exp.Name)
+	case *ast.PrefixExpression:
+		p.parenthesize(parser.PREFIX < precedence, func() {
+			p.write(exp.Operator)
+			p.expression(exp.Right, parser.PREFIX)
+		})
+	case *ast.InfixExpression:
+		operatorPrecedence := parser.OperatorPrecedence(exp.Operator)
+		p.parenthesize(operatorPrecedence < precedence, func() {
+			p.expression(exp.Left, operatorPrecedence)
+			p.write(" " + exp.Operator + " ")
+			// operators are left associative so the right side needs parens
+			// already for the same precedence
+			p.expression(exp.Right, operatorPrecedence+1)
+		})
+	case *ast.IndexExpression:
+		p.expression(exp.Left, parser.INDEX)
+		p.write("[")
+		p.expression(exp.Index, parser.LOWEST)
+		p.write("]")
+	case *ast.CallExpression:
+		p.write(exp.Function.Name)
+		p.write("(")
+		p.expressionList(exp.Params)
+		p.write(")")
+	case *ast.SpreadExpression:
+		p.write("...")
+		p.expression(exp.Value, parser.LOWEST)
+	case *ast.NamedArgument:
+		p.write(exp.Name)
+		p.write(": ")
+		p.expression(exp.Value, parser.LOWEST)
+	case *ast.Array:
+		p.write("[")
+		p.expressionList(exp.Items)
+		p.write("]")
+	case *ast.IfExpression:
+		p.write("if (")
+		p.expression(exp.Condition, parser.LOWEST)
+		p.write(") ")
+		p.block(exp.Block)
+		if exp.Alternative != nil {
+			p.write(" else ")
+			p.block(exp.Alternative)
+		}
+	case *ast.FunctionLiteral:
+		p.write("fn(")
+		for i, param := range exp.Params {
+			if i > 0 {
+				p.write(", ")
+			}
+			if exp.Variadic && i == len(exp.Params)-1 {
+				p.write("...")
+			}
+			if pattern := exp.ParamPattern(i); pattern != nil {
+				p.pattern(pattern)
+			} else {
+				p.write(param.Name)
+			}
+			if t := exp.ParamType(i); t != nil {
+				p.write(": " + t.Name)
+			}
+			if d := exp.ParamDefault(i); d != nil {
+				p.write(" = ")
+				p.expression(d, parser.LOWEST)
+			}
+		}
+		p.write(")")
+		if exp.ReturnType != nil {
+			p.write(": " + exp.ReturnType.Name)
+		}
+		p.write(" ")
+		p.block(exp.Block)
+	case *ast.MacroLiteral:
+		p.write("macro(")
+		for i, param := range exp.Params {
+			if i > 0 {
+				p.write(", ")
+			}
+			p.write(param.Name)
+		}
+		p.write(") ")
+		p.block(exp.Block)
+	case *ast.HashLiteral:
+		p.write("{")
+		for i, pair := range exp.Pairs {
+			if i > 0 {
+				p.write(", ")
+			}
+			p.expression(pair.Key, parser.LOWEST)
+			p.write(": ")
+			p.expression(pair.Value, parser.LOWEST)
+		}
+		p.write("}")
+	case *ast.MatchExpression:
+		p.match(exp)
+	default:
+		panic(fmt.Sprintf("format: unexpected expression %T", exp))
+	}
+}
+
+// match prints each arm of the match expression on its own line
+func (p *printer) match(match *ast.MatchExpression) {
+	p.write("match (")
+	p.expression(match.Value, parser.LOWEST)
+	p.write(") {\n")
+	p.depth++
+	lastLine := p.lastLine
+	p.lastLine = 0
+	for _, arm := range match.Arms {
+		p.commentsBefore(arm.Pos())
+		p.indent()
+		p.pattern(arm.Pattern)
+		if arm.Guard != nil {
+			p.write(" if ")
+			p.expression(arm.Guard, parser.LOWEST)
+		}
+		p.write(" => ")
+		p.expression(arm.Body, parser.LOWEST)
+		p.write(",\n")
+		p.lastLine = arm.Pos().Line
+	}
+	p.commentsBefore(match.EndPosition)
+	p.lastLine = lastLine
+	p.depth--
+	p.indent()
+	p.write("}")
+}
+
+func (p *printer) pattern(pattern ast.Pattern) {
+	switch pattern := pattern.(type) {
+	case *ast.WildcardPattern:
+		p.write("_")
+	case *ast.BindingPattern:
+		p.write(pattern.Name)
+	case *ast.LiteralPattern:
+		p.expression(pattern.Value, parser.LOWEST)
+	case *ast.ArrayPattern:
+		p.write("[")
+		for i, element := range pattern.Elements {
+			if i > 0 {
+				p.write(", ")
+			}
+			p.pattern(element)
+		}
+		if pattern.Rest != nil {
+			if len(pattern.Elements) > 0 {
+				p.write(", ")
+			}
+			p.write("...")
+			if _, ok := pattern.Rest.(*ast.WildcardPattern); !ok {
+				p.pattern(pattern.Rest)
+			}
+		}
+		p.write("]")
+	case *ast.HashPattern:
+		p.write("{")
+		for i, pair := range pattern.Pairs {
+			if i > 0 {
+				p.write(", ")
+			}
+			key, ok := pair.Key.(*ast.StringLiteral)
+			if !ok || !isName(key.Value) {
+				p.expression(pair.Key, parser.LOWEST)
+				p.write(": ")
+				p.pattern(pair.Value)
+				continue
+			}
+			p.write(key.Value)
+			// the shorthand {name = default} binds the key to the same name
+			value := pair.Value
+			if d, ok := value.(*ast.DefaultPattern); ok {
+				value = d.Pattern
+			}
+			if binding, ok := value.(*ast.BindingPattern); !ok || binding.Name != key.Value {
+				p.write(": ")
+				p.pattern(pair.Value)
+			} else if d, ok := pair.Value.(*ast.DefaultPattern); ok {
+				p.write(" = ")
+				p.expression(d.Default, parser.LOWEST)
+			}
+		}
+		p.write("}")
+	case *ast.DefaultPattern:
+		p.pattern(pattern.Pattern)
+		p.write(" = ")
+		p.expression(pattern.Default, parser.LOWEST)
+	default:
+		panic(fmt.Sprintf("format: unexpected pattern %T", pattern))
+	}
+}
+
+// isName reports whether the string can be written as an identifier, keys of
+// hash patterns are written without quotes then
+func isName(s string) bool {
+	if s == "" || token.GetKeyword(s) != nil {
+		return false
+	}
+	for _, c := range s {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *printer) expressionList(expressions []ast.Expression) {
+	for i, e := range expressions {
+		if i > 0 {
+			p.write(", ")
+		}
+		p.expression(e, parser.LOWEST)
+	}
+}
+
+func (p *printer) parenthesize(parens bool, print func()) {
+	if parens {
+		p.write("(")
+	}
+	print()
+	if parens {
+		p.write(")")
+	}
+}
@@ -0,0 +1,129 @@
+package format
+
+import (
+	"github.com/alenkacz/interpreter-book/pkg/parser"
+	"github.com/alenkacz/interpreter-book/pkg/tokenizer"
+	"testing"
+)
+
+func TestSource(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			"let   x=5;",
+			"let x = 5;\n",
+		},
+		{
+			"return a+b*c;",
+			"return a + b * c;\n",
+		},
+		{
+			"(a + b) * c; a + (b + c); (a + b) + c; -(a + b); (-a)[1]; a - (b - c)",
+			"(a + b) * c;\na + (b + c);\na + b + c;\n-(a + b);\n(-a)[1];\na - (b - c);\n",
+		},
+		{
+			"let add = fn(a,b){a+b}; add(1,2)",
+			"let add = fn(a, b) {\n  a + b;\n};\nadd(1, 2);\n",
+		},
+		{
+			"if (x > 1) { \"big\" } else { if (x < 0) { \"negative\" } }",
+			"if (x > 1) {\n  \"big\";\n} else {\n  if (x < 0) {\n    \"negative\";\n  }\n}\n",
+		},
+		{
+			"let f = fn() {}; [1, 2n, true][0]; 100000000000000000000",
+			"let f = fn() {};\n[1, 2n, true][0];\n100000000000000000000n;\n",
+		},
+		{
+			"let x:int=1; let f = fn(a:int,b ,c: str):bool{true};",
+			"let x: int = 1;\nlet f = fn(a: int, b, c: str): bool {\n  true;\n};\n",
+		},
+		{
+			"let m = macro(a,b){quote(unquote(a)+unquote(b))};",
+			"let m = macro(a, b) {\n  quote(unquote(a) + unquote(b));\n};\n",
+		},
+		{
+			`let h = {"a":1,2:[x]}; h["a"]`,
+			"let h = {\"a\": 1, 2: [x]};\nh[\"a\"];\n",
+		},
+		{
+			`match(x){-1=>"m", n if n>1 => {"n": n}, [a,...]=>a, [...r]=>r, {name, "first name": f, age: [_]} => name,
+			// fallback
+			_=>0}`,
+			"match (x) {\n  -1 => \"m\",\n  n if n > 1 => {\"n\": n},\n  [a, ...] => a,\n  [...r] => r,\n  {name, \"first name\": f, age: [_]} => name,\n  // fallback\n  _ => 0,\n};\n",
+		},
+		{
+			`let [a,b=1,...r]=x; let {name,"age":age=1,pos:{x = 0},"a b":c}=y; let f=fn([a],{b=2}:hash){a+b};`,
+			"let [a, b = 1, ...r] = x;\nlet {name, age = 1, pos: {x = 0}, \"a b\": c} = y;\nlet f = fn([a], {b = 2}: hash) {\n  a + b;\n};\n",
+		},
+		{
+			`let f=fn(a,b:int=a+1,...c){g(a,...c,...[b],d:b+1,e:{"k":a})};`,
+			"let f = fn(a, b: int = a + 1, ...c) {\n  g(a, ...c, ...[b], d: b + 1, e: {\"k\": a});\n};\n",
+		},
+		{
+			"let a = 1;\n\n\n\nlet b = 2;\nlet c = 3;",
+			"let a = 1;\n\nlet b = 2;\nlet c = 3;\n",
+		},
+		{
+			`// header comment
+
+let add = fn(a, b) { // adds numbers
+
+  // the sum
+  a + b
+  // end of body
+};
+let x = 1; // trailing
+// last comment
+`,
+			`// header comment
+
+let add = fn(a, b) {
+  // adds numbers
+
+  // the sum
+  a + b;
+  // end of body
+};
+let x = 1; // trailing
+// last comment
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		actual, err := Source([]byte(tt.input))
+		if err != nil {
+			t.Errorf("%q: unexpected error %v", tt.input, err)
+			continue
+		}
+		if string(actual) != tt.expected {
+			t.Errorf("%q: expected=%q, got=%q", tt.input, tt.expected, string(actual))
+		}
+
+		again, err := Source(actual)
+		if err != nil || string(again) != string(actual) {
+			t.Errorf("%q: formatting is not idempotent, got=%q (%v)", tt.input, string(again), err)
+		}
+
+		if original, formatted := parse(t, tt.input), parse(t, string(actual)); original != formatted {
+			t.Errorf("%q: formatting changed the program. expected=%q, got=%q", tt.input, original, formatted)
+		}
+	}
+}
+
+func TestSourceError(t *testing.T) {
+	if _, err := Source([]byte("let = 5;")); err == nil {
+		t.Errorf("expected error for invalid source")
+	}
+}
+
+func parse(t *testing.T, input string) string {
+	p := parser.New(tokenizer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors) != 0 {
+		t.Fatalf("%q: parser errors %v", input, p.Errors)
+	}
+	return program.String()
+}
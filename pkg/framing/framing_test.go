@@ -0,0 +1,50 @@
+package framing
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	for _, body := range []string{`{"a":1}`, ``, `{"b":"ü"}`} {
+		if err := Write(&buf, []byte(body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r := bufio.NewReader(&buf)
+	for _, expected := range []string{`{"a":1}`, ``, `{"b":"ü"}`} {
+		body, err := Read(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(body) != expected {
+			t.Errorf("expected %s, got %s", expected, body)
+		}
+	}
+	if _, err := Read(r); err != io.EOF {
+		t.Errorf("expected EOF, got %v", err)
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"Content-Length: -1\r\n\r\n", `invalid Content-Length header "-1"`},
+		{"Content-Length: x\r\n\r\n", `invalid Content-Length header "x"`},
+		{"Content-Type: text\r\n\r\n", `invalid Content-Length header ""`},
+		{"Content-Length: 67108865\r\n\r\n", "message of 67108865 bytes exceeds limit of 67108864 bytes"},
+		{"Content-Length: 5\r\n\r\n{}", "unexpected EOF"},
+	}
+	for _, tt := range tests {
+		_, err := Read(bufio.NewReader(strings.NewReader(tt.input)))
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("%q: expected error %q, got %v", tt.input, tt.expected, err)
+		}
+	}
+}
@@ -0,0 +1,426 @@
+// Package lineedit implements a minimal line editor for interactive terminals
+// with cursor movement, history, reverse history search and tab completion.
+package lineedit
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// ErrInterrupted is returned by ReadLine when the user presses Ctrl-C.
+var ErrInterrupted = errors.New("interrupted")
+
+// Completer returns all completions of the word in front of the cursor.
+type Completer func(word string) []string
+
+const (
+	ctrlA     = 1
+	ctrlB     = 2
+	ctrlC     = 3
+	ctrlD     = 4
+	ctrlE     = 5
+	ctrlF     = 6
+	ctrlG     = 7
+	ctrlH     = 8
+	tab       = 9
+	ctrlJ     = 10
+	ctrlK     = 11
+	ctrlL     = 12
+	enter     = 13
+	ctrlN     = 14
+	ctrlP     = 16
+	ctrlR     = 18
+	ctrlU     = 21
+	ctrlW     = 23
+	esc       = 27
+	backspace = 127
+)
+
+// keys decoded from escape sequences, they are outside of the unicode range
+const (
+	keyUnknown rune = unicode.MaxRune + 1 + iota
+	keyUp
+	keyDown
+	keyRight
+	keyLeft
+	keyHome
+	keyEnd
+	keyDelete
+)
+
+type Editor struct {
+	in  *bufio.Reader
+	out io.Writer
+
+	fd  uintptr
+	raw bool
+
+	History  *History
+	Complete Completer
+}
+
+// New returns editor reading key presses from the terminal in. The terminal
+// is switched into raw mode only while a line is being read.
+func New(in *os.File, out io.Writer) *Editor {
+	e := newEditor(in, out)
+	e.fd = in.Fd()
+	e.raw = true
+	return e
+}
+
+func newEditor(in io.Reader, out io.Writer) *Editor {
+	return &Editor{
+		in:      bufio.NewReader(in),
+		out:     out,
+		History: &History{},
+	}
+}
+
+// IsTerminal reports whether the file is an interactive terminal.
+func IsTerminal(f *os.File) bool {
+	return isTerminal(f.Fd())
+}
+
+type state struct {
+	e      *Editor
+	prompt string
+
+	buf []rune
+	pos int
+
+	// index of the history entry being edited, len(entries) is the new line
+	historyIndex int
+	// the new line saved while browsing history
+	saved []rune
+}
+
+// ReadLine prints the prompt and reads one line. It returns io.EOF when the
+// input ends or the user presses Ctrl-D on an empty line and ErrInterrupted
+// on Ctrl-C.
+func (e *Editor) ReadLine(prompt string) (string, error) {
+	if e.raw {
+		restore, err := makeRaw(e.fd)
+		if err != nil {
+			return "", err
+		}
+		defer restore()
+	}
+
+	s := &state{e: e, prompt: prompt, historyIndex: len(e.History.Entries())}
+	s.refresh()
+	for {
+		key, err := e.readKey()
+		if err != nil {
+			if err == io.EOF && len(s.buf) > 0 {
+				io.WriteString(e.out, "\r\n")
+				return string(s.buf), nil
+			}
+			return "", err
+		}
+
+		switch key {
+		case enter, ctrlJ:
+			io.WriteString(e.out, "\r\n")
+			return string(s.buf), nil
+		case ctrlC:
+			io.WriteString(e.out, "^C\r\n")
+			return "", ErrInterrupted
+		case ctrlD:
+			if len(s.buf) == 0 {
+				io.WriteString(e.out, "\r\n")
+				return "", io.EOF
+			}
+			s.deleteRange(s.pos, s.pos+1)
+		case ctrlA, keyHome:
+			s.pos = 0
+		case ctrlE, keyEnd:
+			s.pos = len(s.buf)
+		case ctrlB, keyLeft:
+			if s.pos > 0 {
+				s.pos--
+			}
+		case ctrlF, keyRight:
+			if s.pos < len(s.buf) {
+				s.pos++
+			}
+		case backspace, ctrlH:
+			if s.pos > 0 {
+				s.deleteRange(s.pos-1, s.pos)
+			}
+		case keyDelete:
+			s.deleteRange(s.pos, s.pos+1)
+		case ctrlK:
+			s.deleteRange(s.pos, len(s.buf))
+		case ctrlU:
+			s.deleteRange(0, s.pos)
+		case ctrlW:
+			start := s.pos
+			for start > 0 && s.buf[start-1] == ' ' {
+				start--
+			}
+			for start > 0 && s.buf[start-1] != ' ' {
+				start--
+			}
+			s.deleteRange(start, s.pos)
+		case ctrlL:
+			io.WriteString(e.out, "\x1b[H\x1b[2J")
+		case ctrlP, keyUp:
+			s.historyPrev()
+		case ctrlN, keyDown:
+			s.historyNext()
+		case tab:
+			s.complete()
+		case ctrlR:
+			submit, err := s.reverseSearch()
+			if err != nil {
+				return "", err
+			}
+			if submit {
+				io.WriteString(e.out, "\r\n")
+				return string(s.buf), nil
+			}
+		default:
+			if unicode.IsPrint(key) {
+				s.insert([]rune{key})
+			}
+		}
+		s.refresh()
+	}
+}
+
+func (e *Editor) readKey() (rune, error) {
+	r, _, err := e.in.ReadRune()
+	if err != nil || r != esc {
+		return r, err
+	}
+
+	next, _, err := e.in.ReadRune()
+	if err != nil {
+		return 0, err
+	}
+	switch next {
+	case 'O':
+		final, _, err := e.in.ReadRune()
+		if err != nil {
+			return 0, err
+		}
+		return decodeEscape("", final), nil
+	case '[':
+		// CSI sequence is parameter bytes followed by a single final byte
+		var params strings.Builder
+		for {
+			b, _, err := e.in.ReadRune()
+			if err != nil {
+				return 0, err
+			}
+			if b >= 0x40 && b <= 0x7e {
+				return decodeEscape(params.String(), b), nil
+			}
+			params.WriteRune(b)
+		}
+	default:
+		return keyUnknown, nil
+	}
+}
+
+func decodeEscape(params string, final rune) rune {
+	switch final {
+	case 'A':
+		return keyUp
+	case 'B':
+		return keyDown
+	case 'C':
+		return keyRight
+	case 'D':
+		return keyLeft
+	case 'H':
+		return keyHome
+	case 'F':
+		return keyEnd
+	case '~':
+		switch params {
+		case "1", "7":
+			return keyHome
+		case "4", "8":
+			return keyEnd
+		case "3":
+			return keyDelete
+		}
+	}
+	return keyUnknown
+}
+
+func (s *state) refresh() {
+	var out strings.Builder
+	out.WriteString("\r")
+	out.WriteString(s.prompt)
+	out.WriteString(string(s.buf))
+	out.WriteString("\x1b[K")
+	if back := len(s.buf) - s.pos; back > 0 {
+		fmt.Fprintf(&out, "\x1b[%dD", back)
+	}
+	io.WriteString(s.e.out, out.String())
+}
+
+func (s *state) insert(runes []rune) {
+	buf := make([]rune, 0, len(s.buf)+len(runes))
+	buf = append(buf, s.buf[:s.pos]...)
+	buf = append(buf, runes...)
+	buf = append(buf, s.buf[s.pos:]...)
+	s.buf = buf
+	s.pos += len(runes)
+}
+
+func (s *state) deleteRange(from, to int) {
+	if to > len(s.buf) {
+		to = len(s.buf)
+	}
+	if from >= to {
+		return
+	}
+	s.buf = append(s.buf[:from], s.buf[to:]...)
+	if s.pos > to {
+		s.pos -= to - from
+	} else if s.pos > from {
+		s.pos = from
+	}
+}
+
+func (s *state) setLine(line []rune) {
+	s.buf = append([]rune{}, line...)
+	s.pos = len(s.buf)
+}
+
+func (s *state) historyPrev() {
+	if s.historyIndex == 0 {
+		return
+	}
+	if s.historyIndex == len(s.e.History.Entries()) {
+		s.saved = s.buf
+	}
+	s.historyIndex--
+	s.setLine([]rune(s.e.History.Entries()[s.historyIndex]))
+}
+
+func (s *state) historyNext() {
+	entries := s.e.History.Entries()
+	if s.historyIndex >= len(entries) {
+		return
+	}
+	s.historyIndex++
+	if s.historyIndex == len(entries) {
+		s.setLine(s.saved)
+	} else {
+		s.setLine([]rune(entries[s.historyIndex]))
+	}
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == ':'
+}
+
+// complete completes the word in front of the cursor. A single candidate is
+// inserted, multiple candidates are completed up to their common prefix and
+// listed when there is nothing more to insert.
+func (s *state) complete() {
+	if s.e.Complete == nil {
+		return
+	}
+	start := s.pos
+	for start > 0 && isWordRune(s.buf[start-1]) {
+		start--
+	}
+	word := string(s.buf[start:s.pos])
+	candidates := s.e.Complete(word)
+	if len(candidates) == 0 {
+		io.WriteString(s.e.out, "\a")
+		return
+	}
+
+	prefix := commonPrefix(candidates)
+	if len(candidates) == 1 {
+		prefix += " "
+	}
+	if len(prefix) > len(word) && strings.HasPrefix(prefix, word) {
+		s.insert([]rune(prefix[len(word):]))
+		return
+	}
+
+	sort.Strings(candidates)
+	io.WriteString(s.e.out, "\r\n"+strings.Join(candidates, "  ")+"\r\n")
+}
+
+func commonPrefix(words []string) string {
+	prefix := words[0]
+	for _, w := range words[1:] {
+		for !strings.HasPrefix(w, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	return prefix
+}
+
+// reverseSearch searches history incrementally for lines containing typed
+// query. It returns true when the found line should be submitted right away.
+func (s *state) reverseSearch() (bool, error) {
+	entries := s.e.History.Entries()
+	original := s.buf
+	query := ""
+	match := -1
+	for {
+		found := ""
+		if match >= 0 {
+			found = entries[match]
+		}
+		fmt.Fprintf(s.e.out, "\r(reverse-i-search)`%s': %s\x1b[K", query, found)
+
+		key, err := s.e.readKey()
+		if err != nil {
+			return false, err
+		}
+		switch key {
+		case ctrlR:
+			if match >= 0 {
+				if older := s.e.History.search(query, match); older >= 0 {
+					match = older
+				}
+			}
+		case backspace, ctrlH:
+			if query != "" {
+				runes := []rune(query)
+				query = string(runes[:len(runes)-1])
+				match = s.e.History.search(query, len(entries))
+			}
+		case ctrlG, ctrlC:
+			s.setLine(original)
+			return false, nil
+		case enter, ctrlJ:
+			if match >= 0 {
+				s.setLine([]rune(found))
+			}
+			return true, nil
+		default:
+			if unicode.IsPrint(key) {
+				query += string(key)
+				from := len(entries)
+				if match >= 0 {
+					// keep the current match when it still matches
+					from = match + 1
+				}
+				match = s.e.History.search(query, from)
+				continue
+			}
+			// any other key ends the search and keeps the match for editing
+			if match >= 0 {
+				s.setLine([]rune(found))
+			}
+			return false, nil
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package lineedit
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadLine(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		history  []string
+		expected string
+	}{
+		{"plain", "let a = 1;\r", nil, "let a = 1;"},
+		{"backspace", "abd\x7fc\r", nil, "abc"},
+		{"cursor movement", "bc\x01a\x05d\r", nil, "abcd"},
+		{"arrow keys", "ac\x1b[Db\x1b[C\x1b[Cd\r", nil, "abcd"},
+		{"home, end and delete", "xabc\x1b[H\x1b[3~\x1b[Fd\r", nil, "abcd"},
+		{"kill to end", "abcdef\x02\x02\x02\x0b\r", nil, "abc"},
+		{"kill to start", "abcdef\x02\x02\x02\x15\r", nil, "def"},
+		{"delete word", "let abc\x17def\r", nil, "let def"},
+		{"history previous", "\x1b[A\x1b[A\r", []string{"first", "second"}, "first"},
+		{"history next restores line", "new\x1b[A\x1b[B\r", []string{"first"}, "new"},
+		{"reverse search", "\x12fir\r", []string{"first", "second", "third"}, "first"},
+		{"reverse search older", "\x12ir\x12\r", []string{"first", "second", "third"}, "first"},
+		{"reverse search edit", "\x12sec\x05!\r", []string{"first", "second"}, "second!"},
+		{"reverse search cancel", "abc\x12sec\x07\r", []string{"second"}, "abc"},
+		{"unicode", "žluť\x7fť\r", nil, "žluť"},
+	}
+	for _, tt := range tests {
+		e := newEditor(strings.NewReader(tt.input), ioutil.Discard)
+		e.History.entries = tt.history
+		line, err := e.ReadLine("> ")
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+			continue
+		}
+		if line != tt.expected {
+			t.Errorf("%s: expected=%q, got=%q", tt.name, tt.expected, line)
+		}
+	}
+}
+
+func TestReadLineEOF(t *testing.T) {
+	e := newEditor(strings.NewReader("\x04"), ioutil.Discard)
+	if _, err := e.ReadLine("> "); err != io.EOF {
+		t.Errorf("expected io.EOF on Ctrl-D, got %v", err)
+	}
+	e = newEditor(strings.NewReader("abc\x03"), ioutil.Discard)
+	if _, err := e.ReadLine("> "); err != ErrInterrupted {
+		t.Errorf("expected ErrInterrupted on Ctrl-C, got %v", err)
+	}
+}
+
+func TestComplete(t *testing.T) {
+	complete := func(word string) []string {
+		var result []string
+		for _, c := range []string{"let", "len", "last", "first"} {
+			if strings.HasPrefix(c, word) {
+				result = append(result, c)
+			}
+		}
+		return result
+	}
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"fi\t\r", "first "},
+		{"le\t\r", "le"},
+		{"x = la\t[1]\r", "x = last [1]"},
+		{"le\tt\t\r", "let "},
+		{"zz\t\r", "zz"},
+	}
+	for _, tt := range tests {
+		e := newEditor(strings.NewReader(tt.input), ioutil.Discard)
+		e.Complete = complete
+		line, _ := e.ReadLine("> ")
+		if line != tt.expected {
+			t.Errorf("%q: expected=%q, got=%q", tt.input, tt.expected, line)
+		}
+	}
+}
+
+func TestHistory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "history")
+
+	h, err := LoadHistory(file)
+	if err != nil {
+		t.Fatalf("unexpected error loading missing history: %v", err)
+	}
+	for _, line := range []string{"a", "", "b", "b", "c"} {
+		if err := h.Add(line); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	loaded, err := LoadHistory(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(loaded.Entries(), ",") != "a,b,c" {
+		t.Errorf("unexpected history entries %v", loaded.Entries())
+	}
+}
@@ -0,0 +1,98 @@
+package lineedit
+
+import (
+	"bufio"
+	"os"
+	"strings"
+)
+
+// MaxHistory is the number of entries kept in the history and its file.
+const MaxHistory = 1000
+
+// History holds previously entered lines, oldest first. When it is backed by
+// a file every added line is appended to the file as well.
+type History struct {
+	entries []string
+	file    string
+}
+
+// LoadHistory reads history from the file, a missing file means empty
+// history which is created with the first added line.
+func LoadHistory(file string) (*History, error) {
+	h := &History{file: file}
+	f, err := os.Open(file)
+	if os.IsNotExist(err) {
+		return h, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		h.entries = append(h.entries, scanner.Text())
+	}
+	if len(h.entries) > MaxHistory {
+		h.entries = h.entries[len(h.entries)-MaxHistory:]
+		// compact the file so that it does not grow forever
+		if err := h.save(); err != nil {
+			return nil, err
+		}
+	}
+	return h, scanner.Err()
+}
+
+// Add appends the line to the history, empty lines and repetitions of the
+// last entry are skipped.
+func (h *History) Add(line string) error {
+	if strings.TrimSpace(line) == "" || strings.ContainsAny(line, "\r\n") {
+		return nil
+	}
+	if len(h.entries) > 0 && h.entries[len(h.entries)-1] == line {
+		return nil
+	}
+	h.entries = append(h.entries, line)
+	if len(h.entries) > MaxHistory {
+		h.entries = h.entries[1:]
+	}
+	if h.file == "" {
+		return nil
+	}
+	f, err := os.OpenFile(h.file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.WriteString(line + "\n")
+	return err
+}
+
+// Entries returns the history, oldest entry first.
+func (h *History) Entries() []string {
+	return h.entries
+}
+
+// search returns index of the newest entry older than from which contains
+// the query, or -1.
+func (h *History) search(query string, from int) int {
+	for i := from - 1; i >= 0; i-- {
+		if strings.Contains(h.entries[i], query) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (h *History) save() error {
+	f, err := os.OpenFile(h.file, os.O_TRUNC|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	for _, e := range h.entries {
+		w.WriteString(e + "\n")
+	}
+	return w.Flush()
+}
@@ -0,0 +1,311 @@
+// Package lint implements static checks of Monkey programs.
+package lint
+
+import (
+	"fmt"
+	"github.com/alenkacz/interpreter-book/pkg/ast"
+	"github.com/alenkacz/interpreter-book/pkg/eval"
+	"github.com/alenkacz/interpreter-book/pkg/token"
+	"sort"
+	"strings"
+)
+
+// Rules reported by the linter
+const (
+	UNDEFINED        = "undefined"
+	UNUSED           = "unused"
+	SHADOWED_BUILTIN = "shadowed-builtin"
+	UNREACHABLE      = "unreachable"
+	ARITY            = "arity"
+)
+
+type Issue struct {
+	Pos     token.Position
+	Rule    string
+	Message string
+}
+
+func (i Issue) String() string {
+	return fmt.Sprintf("%s: %s: %s", i.Pos, i.Rule, i.Message)
+}
+
+type binding struct {
+	name string
+	pos  token.Position
+	kind string
+	used bool
+	// function literal bound by the binding, nil otherwise
+	fn *ast.FunctionLiteral
+}
+
+type scope struct {
+	outer    *scope
+	bindings map[string]*binding
+	order    []*binding
+}
+
+func newScope(outer *scope) *scope {
+	return &scope{outer: outer, bindings: make(map[string]*binding)}
+}
+
+func (s *scope) lookup(name string) *binding {
+	for current := s; current != nil; current = current.outer {
+		if b, ok := current.bindings[name]; ok {
+			return b
+		}
+	}
+	return nil
+}
+
+type linter struct {
+	issues   []Issue
+	builtins map[string]bool
+}
+
+// Lint checks the program and returns found issues ordered by position.
+//
+// Bodies of functions are checked once the whole enclosing scope is known,
+// so they can refer to bindings defined later, e.g. for recursion. Unused
+// top-level bindings are not reported as the program may be a library loaded
+// into a shared environment.
+func Lint(program *ast.Program) []Issue {
+	l := &linter{builtins: make(map[string]bool)}
+	for _, name := range eval.BuiltinNames() {
+		l.builtins[name] = true
+	}
+
+	l.lintScope(newScope(nil), nil, program.Statements)
+
+	sort.SliceStable(l.issues, func(i, j int) bool {
+		return l.issues[i].Pos.Before(l.issues[j].Pos)
+	})
+	return l.issues
+}
+
+func (l *linter) report(pos token.Position, rule string, format string, args ...interface{}) {
+	l.issues = append(l.issues, Issue{Pos: pos, Rule: rule, Message: fmt.Sprintf(format, args...)})
+}
+
+// lintScope checks parameters of the scope with their patterns and defaults,
+// statements of the scope and then bodies of function literals found in
+// them
+func (l *linter) lintScope(s *scope, params []ast.Node, statements []ast.Statement) {
+	v := &visitor{l: l, scope: s}
+	for _, param := range params {
+		ast.Walk(v, param)
+	}
+	l.checkReachability(statements)
+	for _, stmt := range statements {
+		if stmt != nil {
+			ast.Walk(v, stmt)
+		}
+	}
+
+	for _, f := range v.functions {
+		fnScope := newScope(f.scope)
+		var params []ast.Node
+		for i, param := range f.fn.Params {
+			if d := f.fn.ParamDefault(i); d != nil {
+				params = append(params, d)
+			}
+			if pattern := f.fn.ParamPattern(i); pattern != nil {
+				l.declarePattern(fnScope, pattern, "parameter")
+				params = append(params, pattern)
+				continue
+			}
+			l.declare(fnScope, param.Name, param.Position, "parameter", nil)
+		}
+		l.lintScope(fnScope, params, f.fn.Block.Statements)
+		l.checkUnused(fnScope)
+	}
+	// bindings of match arms can be used by functions in the arms
+	for _, arm := range v.arms {
+		l.checkUnused(arm)
+	}
+}
+
+func (l *linter) declare(s *scope, name string, pos token.Position, kind string, fn *ast.FunctionLiteral) {
+	if l.builtins[name] {
+		l.report(pos, SHADOWED_BUILTIN, "%s %s shadows builtin function", kind, name)
+	}
+	b := &binding{name: name, pos: pos, kind: kind, fn: fn}
+	s.bindings[name] = b
+	s.order = append(s.order, b)
+}
+
+func (l *linter) checkUnused(s *scope) {
+	for _, b := range s.order {
+		if !b.used && !strings.HasPrefix(b.name, "_") {
+			l.report(b.pos, UNUSED, "%s %s is never used", b.kind, b.name)
+		}
+	}
+}
+
+func (l *linter) checkReachability(statements []ast.Statement) {
+	for i, stmt := range statements {
+		if _, ok := stmt.(*ast.ReturnStatement); ok && i < len(statements)-1 && statements[i+1] != nil {
+			l.report(statements[i+1].Pos(), UNREACHABLE, "unreachable code after return")
+			return
+		}
+	}
+}
+
+func (l *linter) resolve(s *scope, ident *ast.Identifier) *binding {
+	b := s.lookup(ident.Name)
+	if b != nil {
+		b.used = true
+		return b
+	}
+	if !l.builtins[ident.Name] {
+		l.report(ident.Position, UNDEFINED, "%s is not defined", ident.Name)
+	}
+	return nil
+}
+
+// declarePattern declares names bound by the pattern
+func (l *linter) declarePattern(s *scope, pattern ast.Pattern, kind string) {
+	ast.Inspect(pattern, func(node ast.Node) bool {
+		if binding, ok := node.(*ast.BindingPattern); ok {
+			l.declare(s, binding.Name, binding.Position, kind, nil)
+		}
+		return true
+	})
+}
+
+// visitor resolves identifiers of a single scope, function literals and
+// scopes of match arms are collected to be checked after the scope
+type visitor struct {
+	l         *linter
+	scope     *scope
+	functions []pendingFunction
+	arms      []*scope
+}
+
+// pendingFunction is a function literal with the scope it is defined in
+type pendingFunction struct {
+	fn    *ast.FunctionLiteral
+	scope *scope
+}
+
+func (v *visitor) Visit(node ast.Node) ast.Visitor {
+	switch node := node.(type) {
+	case *ast.LetStatement:
+		if node.Value != nil {
+			ast.Walk(v, node.Value)
+		}
+		if node.Pattern != nil {
+			v.l.declarePattern(v.scope, node.Pattern, "variable")
+			// defaults can refer to names bound before them
+			ast.Walk(v, node.Pattern)
+			return nil
+		}
+		fn, _ := node.Value.(*ast.FunctionLiteral)
+		if b, ok := v.scope.bindings[node.Name()]; ok && !b.used && v.scope.outer != nil {
+			// the previous binding is replaced before it was ever read
+			v.l.report(b.pos, UNUSED, "%s %s is never used", b.kind, b.name)
+			// already reported, it should not be reported again at the end of the scope
+			b.used = true
+		}
+		v.l.declare(v.scope, node.Name(), node.Identifier.Pos, "variable", fn)
+		return nil
+	case *ast.FunctionLiteral:
+		v.functions = append(v.functions, pendingFunction{fn: node, scope: v.scope})
+		return nil
+	case *ast.MatchExpression:
+		if node.Value != nil {
+			ast.Walk(v, node.Value)
+		}
+		for _, arm := range node.Arms {
+			armVisitor := &visitor{l: v.l, scope: newScope(v.scope)}
+			v.l.declarePattern(armVisitor.scope, arm.Pattern, "variable")
+			ast.Walk(armVisitor, arm.Pattern)
+			if arm.Guard != nil {
+				ast.Walk(armVisitor, arm.Guard)
+			}
+			if arm.Body != nil {
+				ast.Walk(armVisitor, arm.Body)
+			}
+			v.functions = append(v.functions, armVisitor.functions...)
+			v.arms = append(v.arms, armVisitor.scope)
+			v.arms = append(v.arms, armVisitor.arms...)
+		}
+		return nil
+	case *ast.MacroLiteral:
+		// bodies of macros build code with quote and unquote, they are
+		// checked only after expansion
+		return nil
+	case *ast.BlockStatement:
+		v.l.checkReachability(node.Statements)
+		return v
+	case *ast.Identifier:
+		v.l.resolve(v.scope, node)
+		return nil
+	case *ast.CallExpression:
+		b := v.l.resolve(v.scope, node.Function)
+		if b != nil && b.fn != nil {
+			v.l.checkArity(node, b)
+		}
+		for _, p := range node.Params {
+			if p != nil {
+				ast.Walk(v, p)
+			}
+		}
+		return nil
+	}
+	return v
+}
+
+// checkArity reports calls with the wrong number of arguments, calls with
+// spread arguments are checked only for too many arguments. Named arguments
+// must name parameters not given by other arguments.
+func (l *linter) checkArity(call *ast.CallExpression, b *binding) {
+	min, max := b.fn.Arity()
+	args := 0
+	spread := false
+	named := make(map[string]bool)
+	for _, p := range call.Params {
+		switch p := p.(type) {
+		case *ast.SpreadExpression:
+			spread = true
+		case *ast.NamedArgument:
+			l.checkNamedArgument(call, b, p, args, named)
+			named[p.Name] = true
+		default:
+			args++
+		}
+	}
+	if len(named) != 0 && !spread && (max < 0 || args <= max) {
+		for i := args; i < min; i++ {
+			if param := b.fn.Params[i]; !named[param.Name] {
+				l.report(call.Position, ARITY, "%s is missing argument %s", b.name, param.Name)
+			}
+		}
+		return
+	}
+	if (args >= min || spread) && (max < 0 || args <= max) {
+		return
+	}
+	expected := fmt.Sprintf("%d", min)
+	switch {
+	case max < 0:
+		expected = fmt.Sprintf("at least %d", min)
+	case max > min:
+		expected = fmt.Sprintf("%d to %d", min, max)
+	}
+	l.report(call.Position, ARITY, "%s expects %s arguments, got %d", b.name, expected, args)
+}
+
+// checkNamedArgument reports named arguments of unknown parameters and of
+// parameters given by the preceding arguments
+func (l *linter) checkNamedArgument(call *ast.CallExpression, b *binding, arg *ast.NamedArgument, args int, named map[string]bool) {
+	for i, param := range b.fn.Params {
+		if param.Name != arg.Name || b.fn.Variadic && i == len(b.fn.Params)-1 {
+			continue
+		}
+		if i < args || named[arg.Name] {
+			l.report(arg.Position, ARITY, "argument %s of %s is given more than once", arg.Name, b.name)
+		}
+		return
+	}
+	l.report(arg.Position, ARITY, "%s has no parameter %s", b.name, arg.Name)
+}
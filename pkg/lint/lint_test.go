@@ -0,0 +1,107 @@
+package lint
+
+import (
+	"github.com/alenkacz/interpreter-book/pkg/parser"
+	"github.com/alenkacz/interpreter-book/pkg/tokenizer"
+	"strings"
+	"testing"
+)
+
+func TestLint(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{
+			"let a = 1; a + 1;",
+			nil,
+		},
+		{
+			"let a = b + 1;",
+			[]string{"1:9: undefined: b is not defined"},
+		},
+		{
+			"x; let x = 1;",
+			[]string{"1:1: undefined: x is not defined"},
+		},
+		{
+			"let f = fn(a, b) { let c = 1; a };",
+			[]string{"1:15: unused: parameter b is never used", "1:24: unused: variable c is never used"},
+		},
+		{
+			"let f = fn(_a, b) { b };",
+			nil,
+		},
+		{
+			"let unless = macro(c, a) { quote(if (!unquote(c)) { unquote(a) }) }; unless(false, 1);",
+			nil,
+		},
+		{
+			"let len = fn(first) { first };",
+			[]string{"1:5: shadowed-builtin: variable len shadows builtin function", "1:14: shadowed-builtin: parameter first shadows builtin function"},
+		},
+		{
+			"let f = fn(a) { return a; a + 1; };",
+			[]string{"1:27: unreachable: unreachable code after return"},
+		},
+		{
+			"if (true) { return 1; 2; }",
+			[]string{"1:23: unreachable: unreachable code after return"},
+		},
+		{
+			"let add = fn(a, b) { a + b }; add(1); add(1, 2); add(1, 2, 3);",
+			[]string{"1:31: arity: add expects 2 arguments, got 1", "1:50: arity: add expects 2 arguments, got 3"},
+		},
+		{
+			"let f = fn(a, b = a, ...c) { b }; f(); f(1, 2, 3); f(...c); let g = fn(a, b = 1) { a + b }; g(1, 2, 3); g(1, ...[2]);",
+			[]string{"1:25: unused: parameter c is never used", "1:35: arity: f expects at least 1 arguments, got 0",
+				"1:57: undefined: c is not defined", "1:93: arity: g expects 1 to 2 arguments, got 3"},
+		},
+		{
+			"let f = fn(a, b = 1) { a + b }; f(b: 2); f(1, b: 2); f(b: 2, a: 1, c: 3); f(1, a: 2); f(...y, a: x);",
+			[]string{"1:33: arity: f is missing argument a", "1:68: arity: f has no parameter c",
+				"1:80: arity: argument a of f is given more than once", "1:92: undefined: y is not defined",
+				"1:98: undefined: x is not defined"},
+		},
+		{
+			"let fact = fn(n) { if (n < 1) { 1 } else { n * fact(n - 1) } }; fact(5);",
+			nil,
+		},
+		{
+			"let even = fn(n) { if (n == 0) { true } else { odd(n - 1) } }; let odd = fn(n) { even(n) }; even(2);",
+			nil,
+		},
+		{
+			"let f = fn() { g() }; len([1]); push([], 1);",
+			[]string{"1:16: undefined: g is not defined"},
+		},
+		{
+			"let f = fn(a) { let a = 2; a };",
+			[]string{"1:12: unused: parameter a is never used"},
+		},
+		{
+			"let [a, b = a, ...c] = [1]; let f = fn([d, e], {g = h}) { d }; f(b, c);",
+			[]string{"1:44: unused: parameter e is never used", "1:49: unused: parameter g is never used", "1:53: undefined: h is not defined"},
+		},
+		{
+			"match ([1]) { [a, ...tail] if a > 0 => fn() { tail }, {b, c: [_d]} => b, e => f, _ => a };",
+			[]string{"1:74: unused: variable e is never used", "1:79: undefined: f is not defined", "1:87: undefined: a is not defined"},
+		},
+	}
+
+	for _, tt := range tests {
+		p := parser.New(tokenizer.New(tt.input))
+		program := p.ParseProgram()
+		if len(p.Errors) != 0 {
+			t.Fatalf("%q: parser errors %v", tt.input, p.Errors)
+		}
+
+		var actual []string
+		for _, issue := range Lint(program) {
+			actual = append(actual, issue.String())
+		}
+		if strings.Join(actual, "\n") != strings.Join(tt.expected, "\n") {
+			t.Errorf("%q:\nexpected=%q\ngot=     %q", tt.input, tt.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,283 @@
+package lsp
+
+import (
+	"github.com/alenkacz/interpreter-book/pkg/ast"
+	"github.com/alenkacz/interpreter-book/pkg/parser"
+	"github.com/alenkacz/interpreter-book/pkg/token"
+	"github.com/alenkacz/interpreter-book/pkg/tokenizer"
+	"github.com/alenkacz/interpreter-book/pkg/typecheck"
+)
+
+// symbol is a name bound by let statement, function parameter or pattern
+type symbol struct {
+	name string
+	// position of the name in the binding
+	pos token.Position
+	// let statement binding the name, nil for parameters and patterns
+	let *ast.LetStatement
+	// pattern is set for names bound by patterns of match arms
+	pattern bool
+	// type inferred by the type checker, nil when not known
+	typ typecheck.Type
+	// positions of identifiers referring to the symbol
+	refs []token.Position
+	// bindings in the body of the function bound by the let statement
+	children []*symbol
+}
+
+func (s *symbol) kind() string {
+	if s.pattern {
+		return "binding"
+	}
+	if s.let == nil {
+		return "parameter"
+	}
+	return "let"
+}
+
+// scope is a block of source code where the symbols are visible
+type scope struct {
+	outer   *scope
+	start   token.Position
+	end     token.Position
+	symbols map[string]*symbol
+}
+
+func (s *scope) lookup(name string) *symbol {
+	for current := s; current != nil; current = current.outer {
+		if sym, ok := current.symbols[name]; ok {
+			return sym
+		}
+	}
+	return nil
+}
+
+// contains reports whether the position is inside the scope, zero end means
+// the scope spans to the end of the document
+func (s *scope) contains(pos token.Position) bool {
+	return !pos.Before(s.start) && (s.end.Line == 0 || pos.Before(s.end))
+}
+
+// occurrence is an identifier in the source resolved to its symbol
+type occurrence struct {
+	pos    token.Position
+	symbol *symbol
+}
+
+// document is a parsed source file with resolved names
+type document struct {
+	uri     string
+	text    string
+	program *ast.Program
+	parser  *parser.Parser
+
+	// top-level symbols in the order of declaration
+	symbols     []*symbol
+	occurrences []occurrence
+	scopes      []*scope
+}
+
+func newDocument(uri string, text string) *document {
+	p := parser.New(tokenizer.New(text))
+	d := &document{uri: uri, text: text, parser: p, program: p.ParseProgram()}
+	d.resolve()
+	return d
+}
+
+// resolve binds identifiers to symbols. Scoping is lexical, bodies of
+// functions are resolved once the enclosing scope is complete so that they
+// can refer to bindings declared later, e.g. recursively.
+func (d *document) resolve() {
+	types := typecheck.Bindings(d.program)
+	r := &resolver{d: d, types: types}
+	top := &scope{symbols: make(map[string]*symbol)}
+	d.scopes = append(d.scopes, top)
+	d.symbols = r.resolveScope(top, nil, d.program.Statements)
+}
+
+type resolver struct {
+	d     *document
+	types map[token.Position]typecheck.Type
+}
+
+// pendingFunction is a function literal whose body is resolved after its
+// enclosing scope
+type pendingFunction struct {
+	fn *ast.FunctionLiteral
+	// scope where the function is defined
+	scope *scope
+	// symbol of the let statement binding the function, nil for anonymous
+	// functions
+	owner *symbol
+}
+
+func (r *resolver) newSymbol(name string, pos token.Position, let *ast.LetStatement) *symbol {
+	return &symbol{name: name, pos: pos, let: let, typ: r.types[pos]}
+}
+
+func (r *resolver) bind(s *scope, sym *symbol) {
+	s.symbols[sym.name] = sym
+	r.d.occurrences = append(r.d.occurrences, occurrence{pos: sym.pos, symbol: sym})
+}
+
+func (r *resolver) reference(s *scope, ident *ast.Identifier) {
+	if sym := s.lookup(ident.Name); sym != nil {
+		sym.refs = append(sym.refs, ident.Position)
+		r.d.occurrences = append(r.d.occurrences, occurrence{pos: ident.Position, symbol: sym})
+	}
+}
+
+// bindPattern binds names of the pattern in the scope
+func (r *resolver) bindPattern(s *scope, pattern ast.Pattern, let *ast.LetStatement) []*symbol {
+	var symbols []*symbol
+	ast.Inspect(pattern, func(node ast.Node) bool {
+		if binding, ok := node.(*ast.BindingPattern); ok {
+			sym := r.newSymbol(binding.Name, binding.Position, let)
+			r.bind(s, sym)
+			symbols = append(symbols, sym)
+		}
+		return true
+	})
+	return symbols
+}
+
+// resolveScope resolves parameters of the scope with their patterns and
+// defaults and its statements, it returns symbols declared by its let
+// statements
+func (r *resolver) resolveScope(s *scope, params []ast.Node, statements []ast.Statement) []*symbol {
+	var declared []*symbol
+	var functions []pendingFunction
+
+	var owner *symbol
+	// current is the scope of the visited node, it differs from s only in
+	// arms of match expressions
+	current := s
+	var visit func(node ast.Node) bool
+	visit = func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.MatchExpression:
+			if node.Value != nil {
+				ast.Inspect(node.Value, visit)
+			}
+			outer := current
+			for i, arm := range node.Arms {
+				end := node.EndPosition
+				if i < len(node.Arms)-1 {
+					end = node.Arms[i+1].Pos()
+				}
+				current = &scope{outer: outer, start: arm.Pos(), end: end, symbols: make(map[string]*symbol)}
+				r.d.scopes = append(r.d.scopes, current)
+				for _, sym := range r.bindPattern(current, arm.Pattern, nil) {
+					sym.pattern = true
+				}
+				ast.Inspect(arm.Pattern, visit)
+				if arm.Guard != nil {
+					ast.Inspect(arm.Guard, visit)
+				}
+				if arm.Body != nil {
+					ast.Inspect(arm.Body, visit)
+				}
+			}
+			current = outer
+			return false
+		case *ast.LetStatement:
+			if node.Pattern != nil {
+				if node.Value != nil {
+					ast.Inspect(node.Value, visit)
+				}
+				symbols := r.bindPattern(current, node.Pattern, node)
+				if current == s {
+					declared = append(declared, symbols...)
+				}
+				ast.Inspect(node.Pattern, visit)
+				return false
+			}
+			if node.Identifier == nil {
+				return false
+			}
+			sym := r.newSymbol(node.Name(), node.Identifier.Pos, node)
+			if node.Value != nil {
+				// the name is bound only after its value is evaluated
+				outer := owner
+				owner = sym
+				ast.Inspect(node.Value, visit)
+				owner = outer
+			}
+			r.bind(current, sym)
+			if current == s {
+				declared = append(declared, sym)
+			}
+			return false
+		case *ast.FunctionLiteral:
+			functions = append(functions, pendingFunction{fn: node, scope: current, owner: owner})
+			return false
+		case *ast.Identifier:
+			r.reference(current, node)
+		}
+		return true
+	}
+	for _, param := range params {
+		ast.Inspect(param, visit)
+	}
+	for _, stmt := range statements {
+		if stmt != nil {
+			ast.Inspect(stmt, visit)
+		}
+	}
+
+	for _, f := range functions {
+		if f.fn.Block == nil {
+			continue
+		}
+		inner := &scope{outer: f.scope, start: f.fn.Position, end: f.fn.Block.End(), symbols: make(map[string]*symbol)}
+		r.d.scopes = append(r.d.scopes, inner)
+		var params []ast.Node
+		for i, p := range f.fn.Params {
+			if d := f.fn.ParamDefault(i); d != nil {
+				params = append(params, d)
+			}
+			if pattern := f.fn.ParamPattern(i); pattern != nil {
+				r.bindPattern(inner, pattern, nil)
+				params = append(params, pattern)
+			} else if p != nil {
+				r.bind(inner, r.newSymbol(p.Name, p.Position, nil))
+			}
+		}
+		children := r.resolveScope(inner, params, f.fn.Block.Statements)
+		if f.owner != nil {
+			f.owner.children = append(f.owner.children, children...)
+		}
+	}
+	return declared
+}
+
+// symbolAt returns symbol of the identifier at the position
+func (d *document) symbolAt(pos token.Position) *symbol {
+	for _, o := range d.occurrences {
+		if o.pos.Line == pos.Line && o.pos.Column <= pos.Column && pos.Column <= o.pos.Column+len(o.symbol.name) {
+			return o.symbol
+		}
+	}
+	return nil
+}
+
+// visible returns symbols visible at the position, inner symbols shadow the
+// outer ones
+func (d *document) visible(pos token.Position) []*symbol {
+	seen := make(map[string]bool)
+	var result []*symbol
+	// scopes are ordered from the outermost, inner ones are found last
+	for i := len(d.scopes) - 1; i >= 0; i-- {
+		s := d.scopes[i]
+		if !s.contains(pos) {
+			continue
+		}
+		for name, sym := range s.symbols {
+			if !seen[name] {
+				seen[name] = true
+				result = append(result, sym)
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,388 @@
+// Package lsp implements a Language Server Protocol server for Monkey source
+// files communicating over a pair of streams, typically stdin and stdout.
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/alenkacz/interpreter-book/pkg/eval"
+	"github.com/alenkacz/interpreter-book/pkg/format"
+	"github.com/alenkacz/interpreter-book/pkg/lint"
+	"github.com/alenkacz/interpreter-book/pkg/typecheck"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Server keeps open documents and answers requests of a single client.
+// Documents are synchronized in full on every change.
+type Server struct {
+	in  *bufio.Reader
+	out io.Writer
+
+	documents map[string]*document
+	shutdown  bool
+}
+
+func New(in io.Reader, out io.Writer) *Server {
+	return &Server{
+		in:        bufio.NewReader(in),
+		out:       out,
+		documents: make(map[string]*document),
+	}
+}
+
+type handler func(s *Server, params json.RawMessage) (interface{}, error)
+
+var handlers map[string]handler
+
+func init() {
+	handlers = map[string]handler{
+		"initialize":                  (*Server).initialize,
+		"shutdown":                    (*Server).shutdownRequest,
+		"textDocument/didOpen":        (*Server).didOpen,
+		"textDocument/didChange":      (*Server).didChange,
+		"textDocument/didClose":       (*Server).didClose,
+		"textDocument/definition":     (*Server).definition,
+		"textDocument/references":     (*Server).references,
+		"textDocument/hover":          (*Server).hover,
+		"textDocument/documentSymbol": (*Server).documentSymbol,
+		"textDocument/completion":     (*Server).completion,
+		"textDocument/formatting":     (*Server).formatting,
+	}
+}
+
+// Serve handles messages until the exit notification or end of the input.
+// It returns error when the client exits without requesting shutdown first.
+func (s *Server) Serve() error {
+	for {
+		msg, err := readMessage(s.in)
+		if err == io.EOF {
+			return nil
+		}
+		if rpcErr, ok := err.(*responseError); ok {
+			s.reply(nil, nil, rpcErr)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if msg.Method == "exit" {
+			if !s.shutdown {
+				return fmt.Errorf("exit without shutdown")
+			}
+			return nil
+		}
+		if err := s.handle(msg); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *Server) handle(msg *message) error {
+	h, ok := handlers[msg.Method]
+	if !ok {
+		if msg.ID == nil {
+			// unknown notifications, e.g. initialized, are ignored
+			return nil
+		}
+		return s.reply(msg.ID, nil, &responseError{Code: methodNotFound, Message: "method not found: " + msg.Method})
+	}
+
+	result, err := h(s, msg.Params)
+	if msg.ID == nil {
+		return nil
+	}
+	if err != nil {
+		rpcErr, ok := err.(*responseError)
+		if !ok {
+			rpcErr = &responseError{Code: internalError, Message: err.Error()}
+		}
+		return s.reply(msg.ID, nil, rpcErr)
+	}
+	return s.reply(msg.ID, result, nil)
+}
+
+func (s *Server) reply(id *json.RawMessage, result interface{}, rpcErr *responseError) error {
+	response := &message{ID: id, Error: rpcErr}
+	if rpcErr == nil {
+		encoded, err := json.Marshal(result)
+		if err != nil {
+			return err
+		}
+		response.Result = encoded
+	}
+	if id == nil {
+		null := json.RawMessage("null")
+		response.ID = &null
+	}
+	return writeMessage(s.out, response)
+}
+
+func (s *Server) notify(method string, params interface{}) error {
+	encoded, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	return writeMessage(s.out, &message{Method: method, Params: encoded})
+}
+
+func decode(params json.RawMessage, v interface{}) error {
+	if err := json.Unmarshal(params, v); err != nil {
+		return &responseError{Code: invalidParams, Message: err.Error()}
+	}
+	return nil
+}
+
+func (s *Server) initialize(params json.RawMessage) (interface{}, error) {
+	return map[string]interface{}{
+		"capabilities": map[string]interface{}{
+			// full document is sent on every change
+			"textDocumentSync":           1,
+			"definitionProvider":         true,
+			"referencesProvider":         true,
+			"hoverProvider":              true,
+			"documentSymbolProvider":     true,
+			"documentFormattingProvider": true,
+			"completionProvider":         map[string]interface{}{},
+		},
+		"serverInfo": map[string]string{"name": "monkey"},
+	}, nil
+}
+
+func (s *Server) shutdownRequest(params json.RawMessage) (interface{}, error) {
+	s.shutdown = true
+	return nil, nil
+}
+
+func (s *Server) didOpen(params json.RawMessage) (interface{}, error) {
+	var p DidOpenTextDocumentParams
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	return nil, s.update(p.TextDocument.URI, p.TextDocument.Text)
+}
+
+func (s *Server) didChange(params json.RawMessage) (interface{}, error) {
+	var p DidChangeTextDocumentParams
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	if len(p.ContentChanges) == 0 {
+		return nil, nil
+	}
+	return nil, s.update(p.TextDocument.URI, p.ContentChanges[len(p.ContentChanges)-1].Text)
+}
+
+func (s *Server) didClose(params json.RawMessage) (interface{}, error) {
+	var p DidCloseTextDocumentParams
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	delete(s.documents, p.TextDocument.URI)
+	// diagnostics of closed documents are cleared
+	return nil, s.notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{URI: p.TextDocument.URI, Diagnostics: []Diagnostic{}})
+}
+
+func (s *Server) update(uri string, text string) error {
+	d := newDocument(uri, text)
+	s.documents[uri] = d
+	return s.notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{URI: uri, Diagnostics: diagnostics(d)})
+}
+
+// diagnostics returns parser errors of the document, lint issues and type
+// errors are reported only for documents without syntax errors
+func diagnostics(d *document) []Diagnostic {
+	result := []Diagnostic{}
+	for i, e := range d.parser.Errors {
+		result = append(result, Diagnostic{
+			Range:    charRange(d.parser.ErrorPositions[i]),
+			Severity: SeverityError,
+			Source:   "parser",
+			Message:  e,
+		})
+	}
+	if len(result) > 0 {
+		return result
+	}
+
+	for _, e := range typecheck.Check(d.program) {
+		result = append(result, Diagnostic{
+			Range:    charRange(e.Pos),
+			Severity: SeverityError,
+			Source:   "typecheck",
+			Message:  e.Message,
+		})
+	}
+	for _, issue := range lint.Lint(d.program) {
+		result = append(result, Diagnostic{
+			Range:    charRange(issue.Pos),
+			Severity: SeverityWarning,
+			Source:   "lint",
+			Code:     issue.Rule,
+			Message:  issue.Message,
+		})
+	}
+	return result
+}
+
+func (s *Server) document(uri string) (*document, error) {
+	d, ok := s.documents[uri]
+	if !ok {
+		return nil, &responseError{Code: invalidParams, Message: "document is not open: " + uri}
+	}
+	return d, nil
+}
+
+// symbolAt decodes position params and returns the symbol found there
+func (s *Server) symbolAt(params json.RawMessage, p *TextDocumentPositionParams) (*document, *symbol, error) {
+	if err := decode(params, p); err != nil {
+		return nil, nil, err
+	}
+	d, err := s.document(p.TextDocument.URI)
+	if err != nil {
+		return nil, nil, err
+	}
+	return d, d.symbolAt(fromPosition(p.Position)), nil
+}
+
+func (s *Server) definition(params json.RawMessage) (interface{}, error) {
+	var p TextDocumentPositionParams
+	d, sym, err := s.symbolAt(params, &p)
+	if err != nil || sym == nil {
+		return nil, err
+	}
+	return Location{URI: d.uri, Range: nameRange(sym.pos, sym.name)}, nil
+}
+
+func (s *Server) references(params json.RawMessage) (interface{}, error) {
+	var p ReferenceParams
+	d, sym, err := s.symbolAt(params, &p.TextDocumentPositionParams)
+	if err != nil || sym == nil {
+		return nil, err
+	}
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+
+	locations := []Location{}
+	if p.Context.IncludeDeclaration {
+		locations = append(locations, Location{URI: d.uri, Range: nameRange(sym.pos, sym.name)})
+	}
+	for _, ref := range sym.refs {
+		locations = append(locations, Location{URI: d.uri, Range: nameRange(ref, sym.name)})
+	}
+	return locations, nil
+}
+
+func (s *Server) hover(params json.RawMessage) (interface{}, error) {
+	var p TextDocumentPositionParams
+	_, sym, err := s.symbolAt(params, &p)
+	if err != nil || sym == nil {
+		return nil, err
+	}
+
+	typ := "any"
+	if sym.typ != nil {
+		typ = sym.typ.String()
+	}
+	return Hover{
+		Contents: MarkupContent{Kind: "plaintext", Value: fmt.Sprintf("%s %s: %s", sym.kind(), sym.name, typ)},
+	}, nil
+}
+
+func (s *Server) documentSymbol(params json.RawMessage) (interface{}, error) {
+	var p DocumentSymbolParams
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	d, err := s.document(p.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	return documentSymbols(d.symbols), nil
+}
+
+func documentSymbols(symbols []*symbol) []DocumentSymbol {
+	result := []DocumentSymbol{}
+	for _, sym := range symbols {
+		kind := SymbolKindVariable
+		if _, ok := sym.typ.(*typecheck.Function); ok {
+			kind = SymbolKindFunction
+		}
+		ds := DocumentSymbol{
+			Name:           sym.name,
+			Kind:           kind,
+			Range:          Range{Start: toPosition(sym.let.Pos()), End: toPosition(sym.let.End())},
+			SelectionRange: nameRange(sym.pos, sym.name),
+		}
+		if sym.typ != nil {
+			ds.Detail = sym.typ.String()
+		}
+		if len(sym.children) > 0 {
+			ds.Children = documentSymbols(sym.children)
+		}
+		result = append(result, ds)
+	}
+	return result
+}
+
+func (s *Server) completion(params json.RawMessage) (interface{}, error) {
+	var p TextDocumentPositionParams
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	d, err := s.document(p.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+
+	items := []CompletionItem{}
+	seen := make(map[string]bool)
+	for _, sym := range d.visible(fromPosition(p.Position)) {
+		item := CompletionItem{Label: sym.name, Kind: CompletionKindVariable}
+		if sym.typ != nil {
+			item.Detail = sym.typ.String()
+			if _, ok := sym.typ.(*typecheck.Function); ok {
+				item.Kind = CompletionKindFunction
+			}
+		}
+		items = append(items, item)
+		seen[sym.name] = true
+	}
+	for _, name := range eval.BuiltinNames() {
+		if !seen[name] {
+			items = append(items, CompletionItem{Label: name, Kind: CompletionKindFunction, Detail: "builtin"})
+		}
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].Label < items[j].Label
+	})
+	return items, nil
+}
+
+func (s *Server) formatting(params json.RawMessage) (interface{}, error) {
+	var p DocumentFormattingParams
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	d, err := s.document(p.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	formatted, err := format.Source([]byte(d.text))
+	if err != nil {
+		// documents with syntax errors are left unchanged
+		return []TextEdit{}, nil
+	}
+	if string(formatted) == d.text {
+		return []TextEdit{}, nil
+	}
+	lines := strings.Count(d.text, "\n")
+	return []TextEdit{{
+		Range:   Range{End: Position{Line: lines + 1}},
+		NewText: string(formatted),
+	}}, nil
+}
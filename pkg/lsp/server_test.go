@@ -0,0 +1,357 @@
+package lsp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const uri = "file:///test.mk"
+
+const source = `let max = 10;
+let add = fn(a, b) {
+  let sum = a + b;
+  sum
+};
+add(max, 1);
+`
+
+// session sends requests with ids given by their index and returns responses
+// by id and all notifications
+func session(t *testing.T, requests ...interface{}) (map[int]*message, []*message) {
+	var in bytes.Buffer
+	for i, r := range requests {
+		msg := r.(map[string]interface{})
+		msg["jsonrpc"] = "2.0"
+		if _, notification := msg["notification"]; notification {
+			delete(msg, "notification")
+		} else {
+			msg["id"] = i
+		}
+		body, err := json.Marshal(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fmt.Fprintf(&in, "Content-Length: %d\r\n\r\n%s", len(body), body)
+	}
+
+	var out bytes.Buffer
+	if err := New(&in, &out).Serve(); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	responses := make(map[int]*message)
+	var notifications []*message
+	r := bufio.NewReader(&out)
+	for {
+		msg, err := readMessage(r)
+		if err != nil {
+			break
+		}
+		if msg.ID == nil {
+			notifications = append(notifications, msg)
+			continue
+		}
+		var id int
+		json.Unmarshal(*msg.ID, &id)
+		responses[id] = msg
+	}
+	return responses, notifications
+}
+
+func open(text string) map[string]interface{} {
+	return map[string]interface{}{
+		"notification": true,
+		"method":       "textDocument/didOpen",
+		"params": map[string]interface{}{
+			"textDocument": map[string]interface{}{"uri": uri, "languageId": "monkey", "version": 1, "text": text},
+		},
+	}
+}
+
+func at(method string, line int, character int) map[string]interface{} {
+	return map[string]interface{}{
+		"method": method,
+		"params": map[string]interface{}{
+			"textDocument": map[string]interface{}{"uri": uri},
+			"position":     map[string]interface{}{"line": line, "character": character},
+			"context":      map[string]interface{}{"includeDeclaration": true},
+		},
+	}
+}
+
+func request(method string) map[string]interface{} {
+	return map[string]interface{}{
+		"method": method,
+		"params": map[string]interface{}{"textDocument": map[string]interface{}{"uri": uri}},
+	}
+}
+
+func result(t *testing.T, responses map[int]*message, id int, v interface{}) {
+	msg, ok := responses[id]
+	if !ok {
+		t.Fatalf("no response to request %d", id)
+	}
+	if msg.Error != nil {
+		t.Fatalf("request %d failed: %s", id, msg.Error.Message)
+	}
+	if err := json.Unmarshal(msg.Result, v); err != nil {
+		t.Fatalf("request %d: %v", id, err)
+	}
+}
+
+func TestLifecycle(t *testing.T) {
+	responses, _ := session(t,
+		map[string]interface{}{"method": "initialize", "params": map[string]interface{}{}},
+		map[string]interface{}{"method": "unknown"},
+		map[string]interface{}{"method": "shutdown"},
+		map[string]interface{}{"method": "exit", "notification": true},
+	)
+
+	var initialize struct {
+		Capabilities map[string]interface{} `json:"capabilities"`
+	}
+	result(t, responses, 0, &initialize)
+	if initialize.Capabilities["definitionProvider"] != true {
+		t.Errorf("unexpected capabilities %v", initialize.Capabilities)
+	}
+	if responses[1].Error == nil || responses[1].Error.Code != methodNotFound {
+		t.Errorf("expected method not found error, got %+v", responses[1])
+	}
+	if _, ok := responses[2]; !ok {
+		t.Errorf("no response to shutdown")
+	}
+
+	var out bytes.Buffer
+	in := "Content-Length: 33\r\n\r\n{\"jsonrpc\":\"2.0\",\"method\":\"exit\"}"
+	if err := New(strings.NewReader(in), &out).Serve(); err == nil {
+		t.Errorf("expected error for exit without shutdown")
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	_, notifications := session(t,
+		open("let x = 1;\nlet = 2;"),
+		open("let f = fn(a) { 1 };\nlet x: str = 1;"),
+	)
+	if len(notifications) != 2 {
+		t.Fatalf("expected 2 notifications, got %d", len(notifications))
+	}
+
+	expected := [][]Diagnostic{
+		{
+			{Range: Range{Start: Position{1, 4}, End: Position{1, 5}}, Severity: SeverityError, Source: "parser", Message: "expected next token to be ident, got = instead"},
+			{Range: Range{Start: Position{1, 4}, End: Position{1, 5}}, Severity: SeverityError, Source: "parser", Message: "Unknown token type =, no parseFn found"},
+		},
+		{
+			{Range: Range{Start: Position{1, 13}, End: Position{1, 14}}, Severity: SeverityError, Source: "typecheck", Message: "cannot use int as str in let x"},
+			{Range: Range{Start: Position{0, 11}, End: Position{0, 12}}, Severity: SeverityWarning, Source: "lint", Code: "unused", Message: "parameter a is never used"},
+		},
+	}
+	for i, n := range notifications {
+		var params PublishDiagnosticsParams
+		json.Unmarshal(n.Params, &params)
+		if n.Method != "textDocument/publishDiagnostics" || params.URI != uri {
+			t.Fatalf("unexpected notification %s %s", n.Method, n.Params)
+		}
+		if !reflect.DeepEqual(params.Diagnostics, expected[i]) {
+			t.Errorf("diagnostics %d: expected\n%+v\ngot\n%+v", i, expected[i], params.Diagnostics)
+		}
+	}
+}
+
+func TestNavigation(t *testing.T) {
+	responses, _ := session(t,
+		open(source),
+		// sum in the body of add
+		at("textDocument/definition", 3, 3),
+		// max in the call
+		at("textDocument/references", 5, 5),
+		at("textDocument/hover", 1, 5),
+		at("textDocument/hover", 2, 16),
+		// not an identifier
+		at("textDocument/definition", 0, 11),
+	)
+
+	var definition Location
+	result(t, responses, 1, &definition)
+	if definition.Range != (Range{Start: Position{2, 6}, End: Position{2, 9}}) {
+		t.Errorf("unexpected definition %+v", definition)
+	}
+
+	var references []Location
+	result(t, responses, 2, &references)
+	expected := []Range{
+		{Start: Position{0, 4}, End: Position{0, 7}},
+		{Start: Position{5, 4}, End: Position{5, 7}},
+	}
+	if len(references) != len(expected) {
+		t.Fatalf("expected %d references, got %+v", len(expected), references)
+	}
+	for i, r := range expected {
+		if references[i].Range != r || references[i].URI != uri {
+			t.Errorf("reference %d: expected %+v, got %+v", i, r, references[i])
+		}
+	}
+
+	for id, expected := range map[int]string{3: "let add: fn(any, any): any", 4: "parameter b: any"} {
+		var hover Hover
+		result(t, responses, id, &hover)
+		if hover.Contents.Value != expected {
+			t.Errorf("expected hover %q, got %q", expected, hover.Contents.Value)
+		}
+	}
+
+	if string(responses[5].Result) != "null" {
+		t.Errorf("expected no definition, got %s", responses[5].Result)
+	}
+}
+
+func TestDocumentSymbols(t *testing.T) {
+	responses, _ := session(t, open(source), request("textDocument/documentSymbol"))
+
+	var symbols []DocumentSymbol
+	result(t, responses, 1, &symbols)
+	var names []string
+	for _, s := range symbols {
+		names = append(names, fmt.Sprintf("%s:%d", s.Name, s.Kind))
+		for _, c := range s.Children {
+			names = append(names, fmt.Sprintf("%s.%s:%d", s.Name, c.Name, c.Kind))
+		}
+	}
+	expected := []string{"max:13", "add:12", "add.sum:13"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected symbols %v, got %v", expected, names)
+	}
+	if symbols[1].Range != (Range{Start: Position{1, 0}, End: Position{4, 1}}) {
+		t.Errorf("unexpected range of add %+v", symbols[1].Range)
+	}
+}
+
+func TestCompletion(t *testing.T) {
+	responses, _ := session(t,
+		open(source),
+		at("textDocument/completion", 3, 2),
+		at("textDocument/completion", 5, 0),
+	)
+
+	tests := []struct {
+		id       int
+		expected []string
+	}{
+		{1, []string{"a", "add", "assert", "assert_eq", "await", "b", "channel", "close", "first", "last", "len", "max", "push", "recv", "rest", "select", "send", "spawn", "sum"}},
+		{2, []string{"add", "assert", "assert_eq", "await", "channel", "close", "first", "last", "len", "max", "push", "recv", "rest", "select", "send", "spawn"}},
+	}
+	for _, tt := range tests {
+		var items []CompletionItem
+		result(t, responses, tt.id, &items)
+		var labels []string
+		for _, item := range items {
+			labels = append(labels, item.Label)
+		}
+		if !reflect.DeepEqual(labels, tt.expected) {
+			t.Errorf("request %d: expected %v, got %v", tt.id, tt.expected, labels)
+		}
+	}
+}
+
+func TestMatchArms(t *testing.T) {
+	text := `let f = fn(x) {
+  match (x) {
+    [a, ...r] if a > 0 => a + len(r),
+    n => n,
+  }
+};
+`
+	responses, _ := session(t,
+		open(text),
+		// a in the body of the first arm
+		at("textDocument/definition", 2, 26),
+		at("textDocument/hover", 3, 4),
+		at("textDocument/completion", 3, 9),
+	)
+
+	var definition Location
+	result(t, responses, 1, &definition)
+	if definition.Range != (Range{Start: Position{2, 5}, End: Position{2, 6}}) {
+		t.Errorf("unexpected definition %+v", definition)
+	}
+
+	var hover Hover
+	result(t, responses, 2, &hover)
+	if hover.Contents.Value != "binding n: any" {
+		t.Errorf("expected hover %q, got %q", "binding n: any", hover.Contents.Value)
+	}
+
+	var items []CompletionItem
+	result(t, responses, 3, &items)
+	var labels []string
+	for _, item := range items {
+		labels = append(labels, item.Label)
+	}
+	// bindings of the first arm are not visible in the second one
+	expected := []string{"assert", "assert_eq", "await", "channel", "close", "f", "first", "last", "len", "n", "push", "recv", "rest", "select", "send", "spawn", "x"}
+	if !reflect.DeepEqual(labels, expected) {
+		t.Errorf("expected %v, got %v", expected, labels)
+	}
+}
+
+func TestDestructuring(t *testing.T) {
+	text := `let [a, {b}] = [1, {"b": 2}];
+let f = fn([x, y = a]) { x + y + b };
+`
+	responses, _ := session(t,
+		open(text),
+		// b in the body of f
+		at("textDocument/definition", 1, 33),
+		at("textDocument/hover", 1, 12),
+		at("textDocument/references", 0, 5),
+		request("textDocument/documentSymbol"),
+	)
+
+	var definition Location
+	result(t, responses, 1, &definition)
+	if definition.Range != (Range{Start: Position{0, 9}, End: Position{0, 10}}) {
+		t.Errorf("unexpected definition %+v", definition)
+	}
+
+	var hover Hover
+	result(t, responses, 2, &hover)
+	if hover.Contents.Value != "parameter x: any" {
+		t.Errorf("expected hover %q, got %q", "parameter x: any", hover.Contents.Value)
+	}
+
+	// a is referred to by the default of y
+	var references []Location
+	result(t, responses, 3, &references)
+	if len(references) != 2 || references[1].Range.Start != (Position{1, 19}) {
+		t.Errorf("unexpected references %+v", references)
+	}
+
+	var symbols []DocumentSymbol
+	result(t, responses, 4, &symbols)
+	var names []string
+	for _, s := range symbols {
+		names = append(names, s.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"a", "b", "f"}) {
+		t.Errorf("expected symbols a, b and f, got %v", names)
+	}
+}
+
+func TestFormatting(t *testing.T) {
+	responses, _ := session(t,
+		open("let   x=1;\nx"),
+		request("textDocument/formatting"),
+	)
+
+	var edits []TextEdit
+	result(t, responses, 1, &edits)
+	if len(edits) != 1 || edits[0].NewText != "let x = 1;\nx;\n" || edits[0].Range.Start != (Position{}) {
+		t.Errorf("unexpected edits %+v", edits)
+	}
+}
@@ -0,0 +1,81 @@
+package object
+
+import "sync"
+
+// Task is a function running in its own goroutine, its result is returned
+// by Wait
+type Task struct {
+	done   chan struct{}
+	result Object
+}
+
+// NewTask starts run in a new goroutine
+func NewTask(run func() Object) *Task {
+	t := &Task{done: make(chan struct{})}
+	go func() {
+		t.result = run()
+		close(t.done)
+	}()
+	return t
+}
+
+func (*Task) Type() ObjectType { return TASK }
+func (t *Task) Print() string  { return "task" }
+
+// Wait blocks until the function of the task returns and returns its result
+func (t *Task) Wait() Object {
+	<-t.done
+	return t.result
+}
+
+// Channel passes values between tasks
+type Channel struct {
+	ch     chan Object
+	mu     sync.Mutex
+	closed bool
+}
+
+// NewChannel returns channel buffering up to capacity values
+func NewChannel(capacity int) *Channel {
+	return &Channel{ch: make(chan Object, capacity)}
+}
+
+func (*Channel) Type() ObjectType { return CHANNEL }
+func (c *Channel) Print() string  { return "channel" }
+
+// Chan returns the underlying Go channel, values must not be sent to it
+// without recovering from the panic of a closed channel
+func (c *Channel) Chan() chan Object {
+	return c.ch
+}
+
+// Send blocks until the value is received or buffered, it returns false
+// when the channel is closed
+func (c *Channel) Send(value Object) (ok bool) {
+	defer func() {
+		if recover() != nil {
+			ok = false
+		}
+	}()
+	c.ch <- value
+	return true
+}
+
+// Recv blocks until a value is sent, it returns false when the channel is
+// closed and all buffered values were received
+func (c *Channel) Recv() (Object, bool) {
+	value, ok := <-c.ch
+	return value, ok
+}
+
+// Close closes the channel, it returns false when it was already closed
+func (c *Channel) Close() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return false
+	}
+	c.closed = true
+	close(c.ch)
+	return true
+}
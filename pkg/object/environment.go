@@ -1,8 +1,23 @@
 package object
 
+import (
+	"sort"
+	"sync"
+)
+
+// Environment binds names to values. It is safe for concurrent use, so that
+// tasks can share the variables of their closures.
 type Environment struct {
+	mu sync.RWMutex
 	outer *Environment
 	values map[string]Object
+	// shared values are copied before they are written, see Snapshot
+	shared bool
+	// origin is the environment this one was forked from
+	origin *Environment
+	// names and values of slots of environments created by NewFrame
+	names []string
+	slots []Object
 }
 
 func NewEnvironment(outer *Environment) *Environment {
@@ -12,14 +27,187 @@ func NewEnvironment(outer *Environment) *Environment {
 	}
 }
 
+// NewFrame returns environment storing variables of resolved code in slots,
+// names are the names of the slots. Other names are stored as in
+// environments returned by NewEnvironment.
+func NewFrame(outer *Environment, names []string) *Environment {
+	return &Environment{
+		outer: outer,
+		names: names,
+		slots: make([]Object, len(names)),
+	}
+}
+
 func (e *Environment) Get(key string) (Object, bool) {
-	val, ok := e.values[key]
-	if !ok && e.outer != nil {
-		return e.outer.Get(key)
+	for ; e != nil; e = e.outer {
+		e.mu.RLock()
+		val, ok := e.get(key)
+		e.mu.RUnlock()
+		if ok {
+			return val, true
+		}
 	}
-	return val, ok
+	return nil, false
+}
+
+// get returns value bound in this environment, the caller holds the lock.
+// Slots are searched by name only for unresolved code, e.g. expressions
+// evaluated by debuggers.
+func (e *Environment) get(key string) (Object, bool) {
+	if e.values != nil {
+		if val, ok := e.values[key]; ok {
+			return val, true
+		}
+	}
+	for i, name := range e.names {
+		if name == key && e.slots[i] != nil {
+			return e.slots[i], true
+		}
+	}
+	return nil, false
 }
 
 func (e *Environment) Set(key string, value Object) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for i, name := range e.names {
+		if name == key {
+			e.slots[i] = value
+			return
+		}
+	}
+	if e.values == nil {
+		e.values = make(map[string]Object)
+	} else if e.shared {
+		values := make(map[string]Object, len(e.values)+1)
+		for name, value := range e.values {
+			values[name] = value
+		}
+		e.values = values
+		e.shared = false
+	}
 	e.values[key] = value
-}
\ No newline at end of file
+}
+
+// GetLocal returns value of the variable in the slot of the environment
+// depth levels up. The name is looked up from there when the slot is
+// negative or not set yet.
+func (e *Environment) GetLocal(depth int, slot int, name string) (Object, bool) {
+	for ; depth > 0 && e.outer != nil; depth-- {
+		e = e.outer
+	}
+	if slot < 0 {
+		// variables of the top-level are bound by name
+		return e.Get(name)
+	}
+	e.mu.RLock()
+	if slot >= 0 && slot < len(e.slots) && e.slots[slot] != nil {
+		value := e.slots[slot]
+		e.mu.RUnlock()
+		return value, true
+	}
+	e.mu.RUnlock()
+	return e.Get(name)
+}
+
+// SetLocal sets value of the slot
+func (e *Environment) SetLocal(slot int, value Object) {
+	e.mu.Lock()
+	e.slots[slot] = value
+	e.mu.Unlock()
+}
+
+// Names returns sorted names bound directly in this environment, bindings of
+// the outer environments are not included
+func (e *Environment) Names() []string {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	names := make([]string, 0, len(e.values)+len(e.names))
+	for name := range e.values {
+		names = append(names, name)
+	}
+	for i, name := range e.names {
+		if e.slots[i] != nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Bindings returns values bound directly in this environment by their names
+func (e *Environment) Bindings() map[string]Object {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	bindings := make(map[string]Object, len(e.values)+len(e.names))
+	for name, value := range e.values {
+		bindings[name] = value
+	}
+	for i, name := range e.names {
+		if e.slots[i] != nil {
+			bindings[name] = e.slots[i]
+		}
+	}
+	return bindings
+}
+
+// Snapshot is a copy of the bindings of an environment, it cannot be changed
+// but it can be forked into any number of environments
+type Snapshot struct {
+	origin *Environment
+	outer  *Environment
+	values map[string]Object
+	names  []string
+	slots  []Object
+}
+
+// Snapshot returns the bindings of the environment at the moment of the
+// call, outer environments are not copied. The bindings are copied only when
+// the environment is changed afterwards.
+func (e *Environment) Snapshot() *Snapshot {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.shared = true
+	slots := make([]Object, len(e.slots))
+	copy(slots, e.slots)
+	return &Snapshot{origin: e, outer: e.outer, values: e.values, names: e.names, slots: slots}
+}
+
+// Fork returns a new environment with the bindings of the snapshot, changes
+// of the environment do not affect the snapshot or other forks. Functions
+// bound in the snapshot keep referring to the environment they were defined
+// in.
+func (s *Snapshot) Fork() *Environment {
+	slots := make([]Object, len(s.slots))
+	copy(slots, s.slots)
+	return &Environment{
+		outer: s.outer,
+		values: s.values,
+		shared: true,
+		origin: s.origin,
+		names: s.names,
+		slots: slots,
+	}
+}
+
+// Fork returns a new environment with the current bindings of this one, it
+// is a shortcut for Snapshot().Fork()
+func (e *Environment) Fork() *Environment {
+	return e.Snapshot().Fork()
+}
+
+// ForkOf reports whether the environment is other or was forked from it,
+// directly or through other forks
+func (e *Environment) ForkOf(other *Environment) bool {
+	for ; e != nil; e = e.origin {
+		if e == other {
+			return true
+		}
+	}
+	return false
+}
+
+// Outer returns the enclosing environment, nil for the outermost one
+func (e *Environment) Outer() *Environment {
+	return e.outer
+}
@@ -0,0 +1,63 @@
+package object
+
+import (
+	"strings"
+)
+
+// HashKey identifies keys of hashes. Integers and big integers with the same
+// value are the same key.
+type HashKey struct {
+	Type  ObjectType
+	Value string
+}
+
+// Hashable is implemented by objects usable as keys of hashes
+type Hashable interface {
+	Object
+	HashKey() HashKey
+}
+
+func (i *Integer) HashKey() HashKey { return HashKey{Type: INTEGER, Value: i.Print()} }
+func (i *BigInt) HashKey() HashKey  { return HashKey{Type: INTEGER, Value: i.Print()} }
+func (s *String) HashKey() HashKey  { return HashKey{Type: STRING, Value: s.Value} }
+func (b *Boolean) HashKey() HashKey { return HashKey{Type: BOOLEAN, Value: b.Print()} }
+
+type HashPair struct {
+	Key   Object
+	Value Object
+}
+
+// Hash maps keys to values, pairs are kept in the order of insertion
+type Hash struct {
+	Pairs map[HashKey]HashPair
+	Keys  []HashKey
+}
+
+func NewHash() *Hash {
+	return &Hash{Pairs: make(map[HashKey]HashPair)}
+}
+
+func (*Hash) Type() ObjectType { return HASH }
+func (h *Hash) Print() string {
+	var pairs []string
+	for _, key := range h.Keys {
+		pair := h.Pairs[key]
+		pairs = append(pairs, pair.Key.Print()+": "+pair.Value.Print())
+	}
+	return "{" + strings.Join(pairs, ", ") + "}"
+}
+
+// Get returns value of the key
+func (h *Hash) Get(key Hashable) (Object, bool) {
+	pair, ok := h.Pairs[key.HashKey()]
+	return pair.Value, ok
+}
+
+// Set binds the key to the value, a key already present keeps its position
+func (h *Hash) Set(key Hashable, value Object) {
+	hashKey := key.HashKey()
+	if _, ok := h.Pairs[hashKey]; !ok {
+		h.Keys = append(h.Keys, hashKey)
+	}
+	h.Pairs[hashKey] = HashPair{Key: key, Value: value}
+}
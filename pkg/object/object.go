@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"github.com/alenkacz/interpreter-book/pkg/ast"
+	"math/big"
 	"strings"
 )
 
@@ -13,6 +14,7 @@ type BuiltinFunction func(args ...Object) Object
 
 const (
 	INTEGER = "INTEGER"
+	BIGINT = "BIGINT"
 	STRING = "STRING"
 	BOOLEAN = "BOOLEAN"
 	NULL_TYPE = "NULL"
@@ -21,6 +23,11 @@ const (
 	FUNCTION = "FUNCTION"
 	BUILTINFN = "BUILTINFN"
 	ARRAY = "ARRAY"
+	QUOTE = "QUOTE"
+	MACRO = "MACRO"
+	HASH = "HASH"
+	TASK = "TASK"
+	CHANNEL = "CHANNEL"
 	)
 
 var (
@@ -41,6 +48,15 @@ type Integer struct {
 func (*Integer) Type() ObjectType { return INTEGER }
 func (i *Integer) Print() string  { return fmt.Sprintf("%d", i.Value) }
 
+// BigInt is an arbitrary-precision integer. Integers are promoted to BigInt
+// when an arithmetic operation overflows int64.
+type BigInt struct {
+	Value *big.Int
+}
+
+func (*BigInt) Type() ObjectType { return BIGINT }
+func (i *BigInt) Print() string  { return i.Value.String() }
+
 type Boolean struct {
 	Value bool
 }
@@ -78,6 +94,14 @@ func (r *ReturnValue) Print() string  { return r.Value.Print() }
 type Function struct {
 	Environment *Environment
 	Params []*ast.Identifier
+	// ParamPatterns are patterns of destructured parameters as in
+	// ast.FunctionLiteral
+	ParamPatterns []ast.Pattern
+	// Defaults and Variadic are as in ast.FunctionLiteral
+	Defaults []ast.Expression
+	Variadic bool
+	// Locals are as in ast.FunctionLiteral
+	Locals []string
 	Block *ast.BlockStatement
 }
 
@@ -86,8 +110,18 @@ func (f *Function) Print() string  {
 	var out bytes.Buffer
 
 	params := []string{}
-	for _, p := range f.Params {
-		params = append(params, p.String())
+	for i, p := range f.Params {
+		param := p.String()
+		if i < len(f.ParamPatterns) && f.ParamPatterns[i] != nil {
+			param = f.ParamPatterns[i].String()
+		}
+		if f.Variadic && i == len(f.Params)-1 {
+			param = "..." + param
+		}
+		if i < len(f.Defaults) && f.Defaults[i] != nil {
+			param += " = " + f.Defaults[i].String()
+		}
+		params = append(params, param)
 	}
 
 	out.WriteString("fn")
@@ -100,6 +134,12 @@ func (f *Function) Print() string  {
 	return out.String()
 }
 
+// Arity returns the minimal and maximal number of arguments of the
+// function, the maximum is -1 for variadic functions
+func (f *Function) Arity() (int, int) {
+	return (&ast.FunctionLiteral{Params: f.Params, Defaults: f.Defaults, Variadic: f.Variadic}).Arity()
+}
+
 type BuiltIn struct {
 	Fn BuiltinFunction
 }
@@ -120,4 +160,27 @@ func (a *Array) Print() string  {
 	out.WriteString(strings.Join(elements, ", "))
 	out.WriteString("]")
 	return out.String()
-}
\ No newline at end of file
+}
+// Quote is unevaluated code produced by quote, it is spliced back into the
+// program by unquote and by expansion of macros
+type Quote struct {
+	Node ast.Node
+}
+func (*Quote) Type() ObjectType { return QUOTE }
+func (q *Quote) Print() string  { return "QUOTE(" + q.Node.String() + ")" }
+
+// Macro is a macro defined by a let statement, its parameters are bound to
+// quoted arguments of the call site
+type Macro struct {
+	Environment *Environment
+	Params []*ast.Identifier
+	Block *ast.BlockStatement
+}
+func (*Macro) Type() ObjectType { return MACRO }
+func (m *Macro) Print() string  {
+	params := []string{}
+	for _, p := range m.Params {
+		params = append(params, p.String())
+	}
+	return "macro(" + strings.Join(params, ", ") + ") {\n" + m.Block.String() + "\n}"
+}
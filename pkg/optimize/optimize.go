@@ -0,0 +1,295 @@
+// Package optimize implements optimisations of Monkey programs on the AST
+// level. The optimised program evaluates to the same values as the original
+// one, including errors.
+package optimize
+
+import (
+	"github.com/alenkacz/interpreter-book/pkg/ast"
+	"github.com/alenkacz/interpreter-book/pkg/eval"
+	"github.com/alenkacz/interpreter-book/pkg/object"
+)
+
+// Program optimises the program in place and returns it. It folds constant
+// expressions, prunes branches of if expressions with constant conditions and
+// inlines top-level let bindings of constants. Bodies of macros and quoted
+// code are kept as they are.
+//
+// The program is expected to be evaluated as a whole in a fresh environment,
+// constants are inlined also into function bodies so they would not see
+// bindings created by later evaluations in the same environment, e.g. in the
+// REPL.
+func Program(program *ast.Program) *ast.Program {
+	o := &optimizer{
+		bindings:  countBindings(program),
+		constants: make(map[string]ast.Expression),
+	}
+	for i, stmt := range program.Statements {
+		quoted := make(map[ast.Node]bool)
+		markQuoted(stmt, false, quoted)
+		stmt = o.inline(stmt, quoted)
+		stmt = ast.Modify(stmt, func(node ast.Node) ast.Node {
+			if quoted[node] {
+				return node
+			}
+			return fold(node)
+		}).(ast.Statement)
+		program.Statements[i] = stmt
+
+		let, ok := stmt.(*ast.LetStatement)
+		if ok && let.Pattern == nil && isConstant(let.Value) && o.bindings[let.Name()] == 1 {
+			o.constants[let.Name()] = let.Value
+		}
+	}
+	program.Statements = prune(program.Statements)
+	return program
+}
+
+type optimizer struct {
+	// number of let statements, parameters and patterns binding each name
+	bindings map[string]int
+	// constant values of top-level bindings
+	constants map[string]ast.Expression
+}
+
+// countBindings counts bindings of every name in the whole program, a name
+// bound just once cannot be shadowed
+func countBindings(program *ast.Program) map[string]int {
+	bindings := make(map[string]int)
+	ast.Inspect(program, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.LetStatement:
+			if node.Pattern == nil {
+				bindings[node.Name()]++
+			}
+		case *ast.FunctionLiteral:
+			for _, p := range node.Params {
+				bindings[p.Name]++
+			}
+		case *ast.MacroLiteral:
+			for _, p := range node.Params {
+				bindings[p.Name]++
+			}
+		case *ast.BindingPattern:
+			bindings[node.Name]++
+		}
+		return true
+	})
+	return bindings
+}
+
+// markQuoted adds nodes which are not evaluated as they are to nodes, they are
+// bodies of macros and arguments of quote outside of unquote
+func markQuoted(node ast.Node, quoted bool, nodes map[ast.Node]bool) {
+	ast.Inspect(node, func(child ast.Node) bool {
+		if child == nil {
+			return false
+		}
+		if quoted {
+			nodes[child] = true
+		}
+		switch child := child.(type) {
+		case *ast.MacroLiteral:
+			ast.Inspect(child, func(n ast.Node) bool {
+				if n != nil {
+					nodes[n] = true
+				}
+				return true
+			})
+			return false
+		case *ast.CallExpression:
+			if child.Function.Name == "quote" && !quoted || child.Function.Name == "unquote" && quoted {
+				for _, param := range child.Params {
+					markQuoted(param, !quoted, nodes)
+				}
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// inline replaces identifiers of known constants by their values, constants
+// can be inlined into functions only because their names are never bound
+// again.
+func (o *optimizer) inline(stmt ast.Statement, quoted map[ast.Node]bool) ast.Statement {
+	if len(o.constants) == 0 {
+		return stmt
+	}
+
+	// identifiers which are not expressions cannot be replaced
+	fixed := make(map[*ast.Identifier]bool)
+	ast.Inspect(stmt, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.FunctionLiteral:
+			for _, p := range node.Params {
+				fixed[p] = true
+			}
+		case *ast.MacroLiteral:
+			for _, p := range node.Params {
+				fixed[p] = true
+			}
+		case *ast.CallExpression:
+			fixed[node.Function] = true
+		}
+		return true
+	})
+
+	return ast.Modify(stmt, func(node ast.Node) ast.Node {
+		ident, ok := node.(*ast.Identifier)
+		if !ok || fixed[ident] || quoted[ident] {
+			return node
+		}
+		if value, ok := o.constants[ident.Name]; ok {
+			return literal(ident, value)
+		}
+		return node
+	}).(ast.Statement)
+}
+
+// folder evaluates constant expressions, integer overflow is an error so
+// that overflowing expressions are kept and fail at runtime for interpreters
+// checking overflow, others promote the result as before
+var folder = func() *eval.Interpreter {
+	in := eval.New()
+	in.CheckOverflow = true
+	return in
+}()
+
+// fold evaluates expressions whose operands are constants, expressions
+// failing at runtime are kept so that the error is reported when evaluated
+func fold(node ast.Node) ast.Node {
+	switch node := node.(type) {
+	case *ast.PrefixExpression:
+		if !isConstant(node.Right) {
+			return node
+		}
+	case *ast.InfixExpression:
+		if !isConstant(node.Left) || !isConstant(node.Right) {
+			return node
+		}
+	case *ast.IfExpression:
+		return pruneIf(node)
+	case *ast.BlockStatement:
+		node.Statements = prune(node.Statements)
+		return node
+	default:
+		return node
+	}
+
+	value := folder.Eval(node, object.NewEnvironment(nil))
+	if folded := toLiteral(node, value); folded != nil {
+		return folded
+	}
+	return node
+}
+
+// pruneIf replaces if expression with constant condition by its only
+// expression when the taken branch consists of one
+func pruneIf(exp *ast.IfExpression) ast.Expression {
+	truthy, ok := constantCondition(exp)
+	if !ok {
+		return exp
+	}
+	taken := exp.Alternative
+	if truthy {
+		taken = exp.Block
+	}
+	if taken == nil || len(taken.Statements) != 1 {
+		return exp
+	}
+	if stmt, ok := taken.Statements[0].(*ast.ExpressionStatement); ok && stmt.Expression != nil {
+		return stmt.Expression
+	}
+	return exp
+}
+
+// prune replaces if statements with constant condition by statements of the
+// taken branch, blocks of if expressions share the environment with the
+// enclosing block so they can be spliced into it. The last statement is the
+// value of the block, it is replaced only when the branch is not empty.
+func prune(statements []ast.Statement) []ast.Statement {
+	var result []ast.Statement
+	for i, stmt := range statements {
+		exp, ok := stmt.(*ast.ExpressionStatement)
+		if !ok {
+			result = append(result, stmt)
+			continue
+		}
+		ifExp, ok := exp.Expression.(*ast.IfExpression)
+		if !ok {
+			result = append(result, stmt)
+			continue
+		}
+		truthy, ok := constantCondition(ifExp)
+		if !ok {
+			result = append(result, stmt)
+			continue
+		}
+
+		var taken []ast.Statement
+		if truthy {
+			taken = ifExp.Block.Statements
+		} else if ifExp.Alternative != nil {
+			taken = ifExp.Alternative.Statements
+		}
+		if len(taken) == 0 && i == len(statements)-1 {
+			result = append(result, stmt)
+			continue
+		}
+		result = append(result, taken...)
+	}
+	return result
+}
+
+func constantCondition(exp *ast.IfExpression) (truthy bool, ok bool) {
+	switch cond := exp.Condition.(type) {
+	case *ast.Boolean:
+		return cond.Value, true
+	case *ast.IntegerLiteral, *ast.BigIntegerLiteral, *ast.StringLiteral:
+		// every value except false and null is truthy
+		return true, true
+	}
+	return false, false
+}
+
+func isConstant(exp ast.Expression) bool {
+	switch exp.(type) {
+	case *ast.IntegerLiteral, *ast.BigIntegerLiteral, *ast.StringLiteral, *ast.Boolean:
+		return true
+	}
+	return false
+}
+
+// toLiteral returns literal of the value positioned at the node, nil when
+// the value has no literal
+func toLiteral(node ast.Node, value object.Object) ast.Expression {
+	pos := node.Pos()
+	switch value := value.(type) {
+	case *object.Integer:
+		return &ast.IntegerLiteral{Position: pos, Value: value.Value}
+	case *object.BigInt:
+		return &ast.BigIntegerLiteral{Position: pos, Value: value.Value}
+	case *object.String:
+		return &ast.StringLiteral{Position: pos, Value: value.Value}
+	case *object.Boolean:
+		return &ast.Boolean{Position: pos, Value: value.Value}
+	}
+	return nil
+}
+
+// literal returns copy of the constant positioned at the node, nodes are
+// never shared so that later modifications do not affect other uses
+func literal(node ast.Node, constant ast.Expression) ast.Expression {
+	pos := node.Pos()
+	switch constant := constant.(type) {
+	case *ast.IntegerLiteral:
+		return &ast.IntegerLiteral{Position: pos, Value: constant.Value}
+	case *ast.BigIntegerLiteral:
+		return &ast.BigIntegerLiteral{Position: pos, Value: constant.Value}
+	case *ast.StringLiteral:
+		return &ast.StringLiteral{Position: pos, Value: constant.Value}
+	case *ast.Boolean:
+		return &ast.Boolean{Position: pos, Value: constant.Value}
+	}
+	return constant
+}
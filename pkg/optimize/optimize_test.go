@@ -0,0 +1,94 @@
+package optimize
+
+import (
+	"github.com/alenkacz/interpreter-book/pkg/ast"
+	"github.com/alenkacz/interpreter-book/pkg/eval"
+	"github.com/alenkacz/interpreter-book/pkg/format"
+	"github.com/alenkacz/interpreter-book/pkg/object"
+	"github.com/alenkacz/interpreter-book/pkg/parser"
+	"github.com/alenkacz/interpreter-book/pkg/tokenizer"
+	"testing"
+)
+
+func TestProgram(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"60 * 60 * 24", "86400;\n"},
+		{"x * 60 * 60", "x * 60 * 60;\n"},
+		{"-(2 + 3) % 3", "-2;\n"},
+		{"\"a\" + \"b\" + \"c\"", "\"abc\";\n"},
+		{"!true == (1 < 2)", "false;\n"},
+		{"\"a\" == 1", "false;\n"},
+		// integer overflow is left to the interpreter
+		{"9223372036854775807 + 1", "9223372036854775807 + 1;\n"},
+		{"-9223372036854775807 - 2", "-9223372036854775807 - 2;\n"},
+		{"9223372036854775808 - 1", "9223372036854775807n;\n"},
+		// errors are reported at runtime
+		{"1 / 0", "1 / 0;\n"},
+		{"match (x) { -1 => 2 * 3 }", "match (x) {\n  -1 => 6,\n};\n"},
+		// names bound by patterns are not replaced
+		{"let a = 1; match (2) { a => a }", "let a = 1;\nmatch (2) {\n  a => a,\n};\n"},
+		{"1 + \"a\"", "1 + \"a\";\n"},
+		{"let x = if (1 > 2) { 1 } else { 2 }; x", "let x = 2;\n2;\n"},
+		{"if (true) { let a = 1; a } else { 2 }", "let a = 1;\na;\n"},
+		{"if (0) { 1 }", "1;\n"},
+		{"if (false) { 1 }; 2", "2;\n"},
+		// value of the empty branch is kept
+		{"1; if (false) { 1 }", "1;\nif (false) {\n  1;\n}\n"},
+		{"let f = fn(a) { if (true) { return a; } 0 }; f(1)", "let f = fn(a) {\n  return a;\n  0;\n};\nf(1);\n"},
+		{
+			"let day = 60 * 60 * 24; let week = day * 7; let f = fn(n) { n * week }; f(2)",
+			"let day = 86400;\nlet week = 604800;\nlet f = fn(n) {\n  n * 604800;\n};\nf(2);\n",
+		},
+		{"let debug = false; if (debug) { \"debug\" } else { \"release\" }", "let debug = false;\n\"release\";\n"},
+		// names bound more than once are not inlined
+		{
+			"let x = 1; let f = fn() { x }; let g = fn() { let x = 2; f() }; g()",
+			"let x = 1;\nlet f = fn() {\n  x;\n};\nlet g = fn() {\n  let x = 2;\n  f();\n};\ng();\n",
+		},
+		{"let x = 1; let f = fn(x) { x }; f(2) + x", "let x = 1;\nlet f = fn(x) {\n  x;\n};\nf(2) + x;\n"},
+		// functions defined before the binding are not inlined
+		{"let f = fn() { x }; let x = 1; f()", "let f = fn() {\n  x;\n};\nlet x = 1;\nf();\n"},
+		{"let two = 2; len(\"ab\") == two", "let two = 2;\nlen(\"ab\") == 2;\n"},
+		// macros and quoted code are kept
+		{
+			"let a = 1; let m = macro(a) { quote(unquote(a)) }; m(2)",
+			"let a = 1;\nlet m = macro(a) {\n  quote(unquote(a));\n};\nm(2);\n",
+		},
+		{"let k = 2; let m = macro(x) { quote(unquote(x) * k * 3) };", "let k = 2;\nlet m = macro(x) {\n  quote(unquote(x) * k * 3);\n};\n"},
+		{"let x = 1; let q = quote(x + 2 * 3); q", "let x = 1;\nlet q = quote(x + 2 * 3);\nq;\n"},
+		{"let x = 1; quote(x + unquote(x + 2 * 3))", "let x = 1;\nquote(x + unquote(7));\n"},
+	}
+
+	for _, tt := range tests {
+		optimized := Program(parse(t, tt.input))
+		actual := format.Program(optimized)
+		if actual != tt.expected {
+			t.Errorf("%q: expected\n%s\ngot\n%s", tt.input, tt.expected, actual)
+		}
+
+		expectedValue := eval.Eval(parse(t, tt.input), object.NewEnvironment(nil))
+		actualValue := eval.Eval(optimized, object.NewEnvironment(nil))
+		if describe(actualValue) != describe(expectedValue) {
+			t.Errorf("%q: optimized program evaluated to %s, expected %s", tt.input, describe(actualValue), describe(expectedValue))
+		}
+	}
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	p := parser.New(tokenizer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors) != 0 {
+		t.Fatalf("%q: parser errors %v", input, p.Errors)
+	}
+	return program
+}
+
+func describe(obj object.Object) string {
+	if obj == nil {
+		return "nil"
+	}
+	return string(obj.Type()) + " " + obj.Print()
+}
@@ -5,6 +5,7 @@ import (
 	"github.com/alenkacz/interpreter-book/pkg/ast"
 	"github.com/alenkacz/interpreter-book/pkg/token"
 	"github.com/alenkacz/interpreter-book/pkg/tokenizer"
+	"math/big"
 	"strconv"
 )
 
@@ -34,10 +35,20 @@ var precedences = map[token.TokenType]int{
 	token.MINUS:    SUM,
 	token.SLASH:    PRODUCT,
 	token.ASTERISK: PRODUCT,
+	token.PERCENT:  PRODUCT,
 	token.LPAREN:   CALL,
 	token.LBRACKET: INDEX,
 }
 
+// OperatorPrecedence returns precedence of the infix operator, LOWEST for
+// unknown operators
+func OperatorPrecedence(operator string) int {
+	if p, ok := precedences[token.TokenType(operator)]; ok {
+		return p
+	}
+	return LOWEST
+}
+
 type Parser struct {
 	tokenizer *tokenizer.Tokenizer
 
@@ -45,6 +56,8 @@ type Parser struct {
 	nextToken    *token.Token
 
 	Errors []string
+	// ErrorPositions are source positions of Errors with the same index
+	ErrorPositions []token.Position
 
 	prefixParseFns map[token.TokenType]prefixParseFn
 	infixParseFns  map[token.TokenType]infixParseFn
@@ -57,6 +70,7 @@ func New(tokenizer *tokenizer.Tokenizer) *Parser {
 
 	p.prefixParseFns = make(map[token.TokenType]prefixParseFn)
 	p.prefixParseFns[token.INT] = p.parseIntegerLiteral
+	p.prefixParseFns[token.BIGINT] = p.parseBigIntegerLiteral
 	p.prefixParseFns[token.STRING] = p.parseStringLiteral
 	p.prefixParseFns[token.IDENT] = p.parseIdentifier
 	p.prefixParseFns[token.TRUE] = p.parseBoolean
@@ -67,13 +81,17 @@ func New(tokenizer *tokenizer.Tokenizer) *Parser {
 	p.prefixParseFns[token.LPAREN] = p.parseGroupedExpression
 	p.prefixParseFns[token.IF] = p.parseIfExpression
 	p.prefixParseFns[token.FUNC] = p.parseFuncExpression
+	p.prefixParseFns[token.MACRO] = p.parseMacroLiteral
 	p.prefixParseFns[token.LBRACKET] = p.parseArray
+	p.prefixParseFns[token.LBRACE] = p.parseHashLiteral
+	p.prefixParseFns[token.MATCH] = p.parseMatchExpression
 
 	p.infixParseFns = make(map[token.TokenType]infixParseFn)
 	p.infixParseFns[token.PLUS] = p.parseInfixExpression
 	p.infixParseFns[token.MINUS] = p.parseInfixExpression
 	p.infixParseFns[token.SLASH] = p.parseInfixExpression
 	p.infixParseFns[token.ASTERISK] = p.parseInfixExpression
+	p.infixParseFns[token.PERCENT] = p.parseInfixExpression
 	p.infixParseFns[token.EQ] = p.parseInfixExpression
 	p.infixParseFns[token.NOTEQ] = p.parseInfixExpression
 	p.infixParseFns[token.LT] = p.parseInfixExpression
@@ -101,6 +119,9 @@ func (p *Parser) ParseProgram() *ast.Program {
 		result.Statements = append(result.Statements, p.parseNextStatement())
 		p.readNextToken()
 	}
+	for _, c := range p.tokenizer.Comments() {
+		result.Comments = append(result.Comments, &ast.Comment{Position: c.Pos, Text: c.Literal})
+	}
 	return result
 }
 
@@ -120,21 +141,34 @@ func (p *Parser) parseNextStatement() ast.Statement {
 }
 
 func (p *Parser) parseReturnStatement() ast.Statement {
+	pos := p.currentToken.Pos
 	p.readNextToken()
 
 	expression := p.parseExpression(LOWEST)
 	if !p.readNextIfNextTypeIs(token.SEMICOLON) {
 		return nil
 	}
-	return &ast.ReturnStatement{ReturnValue: expression}
+	return &ast.ReturnStatement{Position: pos, EndPosition: p.currentToken.Pos, ReturnValue: expression}
 }
 
 func (p *Parser) parseLetStatement() ast.Statement {
+	pos := p.currentToken.Pos
+	if p.nextToken.Type == token.LBRACKET || p.nextToken.Type == token.LBRACE {
+		return p.parseDestructuringLetStatement()
+	}
 	if !p.readNextIfNextTypeIs(token.IDENT) {
 		return nil
 	}
 	identifier := p.currentToken
 
+	var typ *ast.TypeAnnotation
+	if p.nextToken.Type == token.COLON {
+		p.readNextToken()
+		if typ = p.parseTypeAnnotation(); typ == nil {
+			return nil
+		}
+	}
+
 	// assign sign
 	if !p.readNextIfNextTypeIs(token.ASSIGN) {
 		return nil
@@ -148,8 +182,11 @@ func (p *Parser) parseLetStatement() ast.Statement {
 	}
 
 	return &ast.LetStatement{
-		Identifier: identifier,
-		Value: expression,
+		Position:    pos,
+		EndPosition: p.currentToken.Pos,
+		Identifier:  identifier,
+		Type:        typ,
+		Value:       expression,
 	}
 }
 
@@ -161,6 +198,7 @@ func (p *Parser) parseExpressionStatement() ast.Statement {
 	if p.nextToken.Type == token.SEMICOLON {
 		p.readNextToken()
 	}
+	stmt.EndPosition = p.currentToken.Pos
 
 	return stmt
 }
@@ -168,7 +206,7 @@ func (p *Parser) parseExpressionStatement() ast.Statement {
 func (p *Parser) parseExpression(precedence int) ast.Expression {
 	parseFn, ok := p.prefixParseFns[p.currentToken.Type]
 	if !ok {
-		p.Errors = append(p.Errors, fmt.Sprintf("Unknown token type %s, no parseFn found", p.currentToken.Type))
+		p.errorf(p.currentToken.Pos, "Unknown token type %s, no parseFn found", p.currentToken.Type)
 		return nil
 	}
 	left := parseFn()
@@ -190,6 +228,7 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	precedence := p.currentPrecedence()
 
 	expression := &ast.InfixExpression{
+		Position: positionOf(left),
 		Operator: p.currentToken.Literal,
 		Left:     left,
 	}
@@ -200,6 +239,15 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	return expression
 }
 
+// positionOf returns position of the node which might be missing because of
+// a parse error
+func positionOf(node ast.Node) token.Position {
+	if node == nil {
+		return token.Position{}
+	}
+	return node.Pos()
+}
+
 func (p *Parser) currentPrecedence() int {
 	if p, ok := precedences[p.currentToken.Type]; ok {
 		return p
@@ -217,20 +265,43 @@ func (p *Parser) nextPrecedence() int {
 }
 
 func (p *Parser) parseIntegerLiteral() ast.Expression {
-	value, _ := strconv.ParseInt(p.currentToken.Literal, 0, 64)
+	value, err := strconv.ParseInt(p.currentToken.Literal, 0, 64)
+	if err != nil {
+		if err.(*strconv.NumError).Err == strconv.ErrRange {
+			// literals that do not fit into int64 become arbitrary-precision integers
+			return p.parseBigIntegerLiteral()
+		}
+		p.errorf(p.currentToken.Pos, "could not parse %q as integer", p.currentToken.Literal)
+		return nil
+	}
 	return &ast.IntegerLiteral{
+		Position: p.currentToken.Pos,
+		Value: value,
+	}
+}
+
+func (p *Parser) parseBigIntegerLiteral() ast.Expression {
+	value, ok := new(big.Int).SetString(p.currentToken.Literal, 0)
+	if !ok {
+		p.errorf(p.currentToken.Pos, "could not parse %q as integer", p.currentToken.Literal)
+		return nil
+	}
+	return &ast.BigIntegerLiteral{
+		Position: p.currentToken.Pos,
 		Value: value,
 	}
 }
 
 func (p *Parser) parseStringLiteral() ast.Expression {
 	return &ast.StringLiteral{
+		Position: p.currentToken.Pos,
 		Value: p.currentToken.Literal,
 	}
 }
 
 func (p *Parser) parseIdentifier() ast.Expression {
 	identifier := &ast.Identifier{
+		Position: p.currentToken.Pos,
 		Name: p.currentToken.Literal,
 	}
 	if p.nextToken.Type == token.LPAREN {
@@ -241,20 +312,23 @@ func (p *Parser) parseIdentifier() ast.Expression {
 }
 
 func (p *Parser) parseBoolean() ast.Expression {
-	return &ast.Boolean{Value: p.currentToken.Type == token.TRUE}
+	return &ast.Boolean{Position: p.currentToken.Pos, Value: p.currentToken.Type == token.TRUE}
 }
 
 func (p *Parser) parsePrefixExpression() ast.Expression {
 	operator := p.currentToken
 	p.readNextToken()
-	return &ast.PrefixExpression{Operator: operator.Literal, Right: p.parseExpression(PREFIX)}
+	return &ast.PrefixExpression{Position: operator.Pos, Operator: operator.Literal, Right: p.parseExpression(PREFIX)}
+}
+
+func (p *Parser) errorf(pos token.Position, format string, args ...interface{}) {
+	p.Errors = append(p.Errors, fmt.Sprintf(format, args...))
+	p.ErrorPositions = append(p.ErrorPositions, pos)
 }
 
 func (p *Parser) peekError(t token.TokenType) bool {
 	if p.nextToken.Type != t {
-		msg := fmt.Sprintf("expected next token to be %s, got %s instead",
-			t, p.nextToken.Type)
-		p.Errors = append(p.Errors, msg)
+		p.errorf(p.nextToken.Pos, "expected next token to be %s, got %s instead", t, p.nextToken.Type)
 		return true
 	}
 	return false
@@ -275,6 +349,7 @@ func (p *Parser) parseGroupedExpression() ast.Expression {
 }
 
 func (p *Parser) parseIfExpression() ast.Expression {
+	pos := p.currentToken.Pos
 	// we need to move the curToken pointer to start of expression
 	if !p.readNextIfNextTypeIs(token.LPAREN) {
 		return nil
@@ -290,6 +365,7 @@ func (p *Parser) parseIfExpression() ast.Expression {
 	}
 	block := p.parseBlockStatement()
 	expression := &ast.IfExpression{
+		Position: pos,
 		Condition: condition,
 		Block: block,
 	}
@@ -306,6 +382,7 @@ func (p *Parser) parseIfExpression() ast.Expression {
 }
 
 func (p *Parser) parseBlockStatement() *ast.BlockStatement {
+	pos := p.currentToken.Pos
 	result := make([]ast.Statement, 0)
 	p.readNextToken()
 	for p.currentToken.Type != token.EOF && p.currentToken.Type != token.RBRACE {
@@ -316,18 +393,29 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 		p.readNextToken()
 	}
 	return &ast.BlockStatement{
+		Position: pos,
+		EndPosition: p.currentToken.Pos,
 		Statements: result,
 	}
 }
 
 func (p *Parser) parseFuncExpression() ast.Expression {
-	lit := &ast.FunctionLiteral{}
+	lit := &ast.FunctionLiteral{Position: p.currentToken.Pos}
 
 	if !p.readNextIfNextTypeIs(token.LPAREN) {
 		return nil
 	}
 
-	lit.Params = p.parseFunctionParameters()
+	if !p.parseFunctionParameters(lit) {
+		return nil
+	}
+
+	if p.nextToken.Type == token.COLON {
+		p.readNextToken()
+		if lit.ReturnType = p.parseTypeAnnotation(); lit.ReturnType == nil {
+			return nil
+		}
+	}
 
 	if !p.readNextIfNextTypeIs(token.LBRACE) {
 		return nil
@@ -338,35 +426,141 @@ func (p *Parser) parseFuncExpression() ast.Expression {
 	return lit
 }
 
-func (p *Parser) parseFunctionParameters() []*ast.Identifier {
-	identifiers := []*ast.Identifier{}
+func (p *Parser) parseMacroLiteral() ast.Expression {
+	lit := &ast.MacroLiteral{Position: p.currentToken.Pos}
 
-	if p.nextToken.Type == token.RPAREN {
-		p.readNextToken()
-		return identifiers
+	if !p.readNextIfNextTypeIs(token.LPAREN) {
+		return nil
 	}
 
-	p.readNextToken()
+	var params ast.FunctionLiteral
+	if !p.parseFunctionParameters(&params) {
+		return nil
+	}
+	lit.Params = params.Params
+	if params.ParamTypes != nil {
+		p.errorf(lit.Position, "parameters of macros cannot have type annotations")
+		return nil
+	}
+	if params.ParamPatterns != nil {
+		p.errorf(lit.Position, "parameters of macros cannot be patterns")
+		return nil
+	}
+	if params.Defaults != nil || params.Variadic {
+		p.errorf(lit.Position, "parameters of macros cannot have default values or be variadic")
+		return nil
+	}
 
-	ident := &ast.Identifier{Name: p.currentToken.Literal}
-	identifiers = append(identifiers, ident)
+	if !p.readNextIfNextTypeIs(token.LBRACE) {
+		return nil
+	}
 
-	for p.nextToken.Type == token.COMMA {
+	lit.Block = p.parseBlockStatement()
+
+	return lit
+}
+
+// parseFunctionParameters parses parameters into the function literal, the
+// optional annotations, patterns and defaults are left nil when no parameter
+// has them
+func (p *Parser) parseFunctionParameters(fn *ast.FunctionLiteral) bool {
+	fn.Params = []*ast.Identifier{}
+	annotated := false
+	destructured := false
+	defaulted := false
+
+	if p.nextToken.Type == token.RPAREN {
+		p.readNextToken()
+		return true
+	}
+
+	for {
 		p.readNextToken()
+		if p.currentToken.Type == token.ELLIPSIS {
+			if !p.readNextIfNextTypeIs(token.IDENT) {
+				return false
+			}
+			fn.Variadic = true
+		}
+		var pattern ast.Pattern
+		ident := &ast.Identifier{Position: p.currentToken.Pos, Name: p.currentToken.Literal}
+		if !fn.Variadic && (p.currentToken.Type == token.LBRACKET || p.currentToken.Type == token.LBRACE) {
+			if pattern = p.parsePattern(); pattern == nil {
+				return false
+			}
+			ident.Name = ""
+			destructured = true
+		}
+		fn.Params = append(fn.Params, ident)
+		fn.ParamPatterns = append(fn.ParamPatterns, pattern)
+
+		var typ *ast.TypeAnnotation
+		if p.nextToken.Type == token.COLON {
+			p.readNextToken()
+			if typ = p.parseTypeAnnotation(); typ == nil {
+				return false
+			}
+			annotated = true
+		}
+		fn.ParamTypes = append(fn.ParamTypes, typ)
+
+		var value ast.Expression
+		if p.nextToken.Type == token.ASSIGN && !fn.Variadic {
+			p.readNextToken()
+			p.readNextToken()
+			if value = p.parseExpression(LOWEST); value == nil {
+				return false
+			}
+			defaulted = true
+		} else if defaulted && !fn.Variadic {
+			p.errorf(ident.Position, "parameter without default value follows parameter with default value")
+			return false
+		}
+		fn.Defaults = append(fn.Defaults, value)
+
+		if p.nextToken.Type != token.COMMA {
+			break
+		}
+		if fn.Variadic {
+			p.errorf(ident.Position, "rest parameter %s must be the last one", ident.Name)
+			return false
+		}
 		p.readNextToken()
-		ident := &ast.Identifier{Name: p.currentToken.Literal}
-		identifiers = append(identifiers, ident)
 	}
 
 	if !p.readNextIfNextTypeIs(token.RPAREN) {
-		return nil
+		return false
 	}
 
-	return identifiers
+	if !annotated {
+		fn.ParamTypes = nil
+	}
+	if !destructured {
+		fn.ParamPatterns = nil
+	}
+	if !defaulted {
+		fn.Defaults = nil
+	}
+	return true
+}
+
+// parseTypeAnnotation parses type name following the colon, fn keyword is
+// accepted as the type of functions
+func (p *Parser) parseTypeAnnotation() *ast.TypeAnnotation {
+	if p.nextToken.Type == token.LBRACKET {
+		p.errorf(p.nextToken.Pos, "types of elements cannot be annotated, use array")
+		return nil
+	}
+	if p.nextToken.Type == token.FUNC {
+		p.readNextToken()
+	} else if !p.readNextIfNextTypeIs(token.IDENT) {
+		return nil
+	}
+	return &ast.TypeAnnotation{Position: p.currentToken.Pos, Name: p.currentToken.Literal}
 }
 
 func (p *Parser) parseArrayIndexExpression(exp ast.Expression) ast.Expression {
-	result := &ast.IndexExpression{Left: exp}
+	result := &ast.IndexExpression{Position: positionOf(exp), Left: exp}
 	p.readNextToken()
 	result.Index = p.parseExpression(LOWEST)
 
@@ -378,11 +572,34 @@ func (p *Parser) parseArrayIndexExpression(exp ast.Expression) ast.Expression {
 }
 
 func (p *Parser) parseCallExpression(identifier *ast.Identifier) ast.Expression {
-	exp := &ast.CallExpression{Function: identifier}
+	exp := &ast.CallExpression{Position: identifier.Position, Function: identifier}
 	exp.Params = p.parseCallArguments()
 	return exp
 }
 
+// parseCallArgument parses an argument which can be spread with ... or
+// named as in name: value
+func (p *Parser) parseCallArgument() ast.Expression {
+	if p.currentToken.Type == token.IDENT && p.nextToken.Type == token.COLON {
+		named := &ast.NamedArgument{Position: p.currentToken.Pos, Name: p.currentToken.Literal}
+		p.readNextToken()
+		p.readNextToken()
+		if named.Value = p.parseExpression(LOWEST); named.Value == nil {
+			return nil
+		}
+		return named
+	}
+	if p.currentToken.Type != token.ELLIPSIS {
+		return p.parseExpression(LOWEST)
+	}
+	spread := &ast.SpreadExpression{Position: p.currentToken.Pos}
+	p.readNextToken()
+	if spread.Value = p.parseExpression(LOWEST); spread.Value == nil {
+		return nil
+	}
+	return spread
+}
+
 func (p *Parser) parseCallArguments() []ast.Expression {
 	args := []ast.Expression{}
 
@@ -393,12 +610,19 @@ func (p *Parser) parseCallArguments() []ast.Expression {
 	}
 
 	p.readNextToken()
-	args = append(args, p.parseExpression(LOWEST))
+	args = append(args, p.parseCallArgument())
 
 	for p.nextToken.Type == token.COMMA {
 		p.readNextToken()
 		p.readNextToken()
-		args = append(args, p.parseExpression(LOWEST))
+		pos := p.currentToken.Pos
+		arg := p.parseCallArgument()
+		if _, named := args[len(args)-1].(*ast.NamedArgument); named {
+			if _, ok := arg.(*ast.NamedArgument); !ok && arg != nil {
+				p.errorf(pos, "positional argument after named argument")
+			}
+		}
+		args = append(args, arg)
 	}
 
 	if !p.readNextIfNextTypeIs(token.RPAREN) {
@@ -410,9 +634,7 @@ func (p *Parser) parseCallArguments() []ast.Expression {
 
 func (p *Parser) readNextIfNextTypeIs(t token.TokenType) bool {
 	if p.nextToken.Type != t {
-		msg := fmt.Sprintf("expected next token to be %s, got %s instead",
-			t, p.nextToken.Type)
-		p.Errors = append(p.Errors, msg)
+		p.errorf(p.nextToken.Pos, "expected next token to be %s, got %s instead", t, p.nextToken.Type)
 		return false
 	}
 	p.readNextToken()
@@ -421,9 +643,7 @@ func (p *Parser) readNextIfNextTypeIs(t token.TokenType) bool {
 
 func (p *Parser) readNextIfCurrentTypeIs(t token.TokenType) bool {
 	if p.currentToken.Type != t {
-		msg := fmt.Sprintf("expected next token to be %s, got %s instead",
-			t, p.nextToken.Type)
-		p.Errors = append(p.Errors, msg)
+		p.errorf(p.currentToken.Pos, "expected next token to be %s, got %s instead", t, p.nextToken.Type)
 		return false
 	}
 	p.readNextToken()
@@ -431,12 +651,14 @@ func (p *Parser) readNextIfCurrentTypeIs(t token.TokenType) bool {
 }
 
 func (p *Parser) parseArray() ast.Expression {
+	pos := p.currentToken.Pos
 	items := []ast.Expression{}
 
 	if p.nextToken.Type == token.RBRACKET {
 		// empty args
 		p.readNextToken()
 		return &ast.Array{
+			Position: pos,
 			Items: items,
 		}
 	}
@@ -455,6 +677,7 @@ func (p *Parser) parseArray() ast.Expression {
 	}
 
 	return &ast.Array{
+		Position: pos,
 		Items: items,
 	}
 }
\ No newline at end of file
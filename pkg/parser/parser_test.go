@@ -2,6 +2,7 @@ package parser
 
 import (
 	"github.com/alenkacz/interpreter-book/pkg/ast"
+	"github.com/alenkacz/interpreter-book/pkg/token"
 	"github.com/alenkacz/interpreter-book/pkg/tokenizer"
 	"reflect"
 	"strings"
@@ -297,6 +298,18 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"a * b * c",
 			"((a * b) * c)",
 		},
+		{
+			"5n + 100000000000000000000",
+			"(5n + 100000000000000000000n)",
+		},
+		{
+			"a * b % c",
+			"((a * b) % c)",
+		},
+		{
+			"a + b % c",
+			"(a + (b % c))",
+		},
 		{
 			"a * b / c",
 			"((a * b) / c)",
@@ -635,6 +648,46 @@ func TestFunctionLiteralParsing(t *testing.T) {
 	testInfixExpression(t, bodyStmt.Expression, "x", "+", "y")
 }
 
+func TestMacroLiteralParsing(t *testing.T) {
+	input := `macro(x, y) { x + y; }`
+
+	p := New(tokenizer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors) > 0 {
+		t.Fatalf("%s: Error(s) in ParseProgram(): %v", input, strings.Join(p.Errors, ","))
+	}
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statement. got=%d", len(program.Statements))
+	}
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T", program.Statements[0])
+	}
+	macro, ok := stmt.Expression.(*ast.MacroLiteral)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.MacroLiteral. got=%T", stmt.Expression)
+	}
+	if len(macro.Params) != 2 {
+		t.Fatalf("macro literal parameters wrong. want 2, got=%d", len(macro.Params))
+	}
+	testLiteralExpression(t, macro.Params[0], "x")
+	testLiteralExpression(t, macro.Params[1], "y")
+	if len(macro.Block.Statements) != 1 {
+		t.Fatalf("macro.Block.Statements has not 1 statement. got=%d", len(macro.Block.Statements))
+	}
+	body, ok := macro.Block.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("macro body stmt is not ast.ExpressionStatement. got=%T", macro.Block.Statements[0])
+	}
+	testInfixExpression(t, body.Expression, "x", "+", "y")
+
+	p = New(tokenizer.New(`macro(x: int) { x }`))
+	p.ParseProgram()
+	if len(p.Errors) == 0 || p.Errors[0] != "parameters of macros cannot have type annotations" {
+		t.Errorf("expected error for annotated parameter, got %v", p.Errors)
+	}
+}
+
 func TestFunctionParameterParsing(t *testing.T) {
 	tests := []struct {
 		input          string
@@ -747,4 +800,324 @@ func TestParsingIndexExpressions(t *testing.T) {
 	if !testInfixExpression(t, indexExp.Index, 1, "+", 1) {
 		return
 	}
-}
\ No newline at end of file
+}
+func TestPositionsAndComments(t *testing.T) {
+	input := `// comment
+let add = fn(x, y) {
+  return x + y;
+};
+add(1, 2) // call
+`
+	p := New(tokenizer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors) > 0 {
+		t.Fatalf("Error(s) in ParseProgram(): %v", strings.Join(p.Errors, ","))
+	}
+
+	let := program.Statements[0].(*ast.LetStatement)
+	fn := let.Value.(*ast.FunctionLiteral)
+	ret := fn.Block.Statements[0].(*ast.ReturnStatement)
+	call := program.Statements[1].(*ast.ExpressionStatement)
+	tests := []struct {
+		node     string
+		actual   token.Position
+		expected token.Position
+	}{
+		{"let", let.Pos(), token.Position{Line: 2, Column: 1}},
+		{"let end", let.End(), token.Position{Line: 4, Column: 2}},
+		{"function", fn.Pos(), token.Position{Line: 2, Column: 11}},
+		{"param", fn.Params[1].Pos(), token.Position{Line: 2, Column: 17}},
+		{"block", fn.Block.Pos(), token.Position{Line: 2, Column: 20}},
+		{"block end", fn.Block.End(), token.Position{Line: 4, Column: 1}},
+		{"return", ret.Pos(), token.Position{Line: 3, Column: 3}},
+		{"return end", ret.End(), token.Position{Line: 3, Column: 15}},
+		{"infix", ret.ReturnValue.Pos(), token.Position{Line: 3, Column: 10}},
+		{"call", call.Pos(), token.Position{Line: 5, Column: 1}},
+		{"call end", call.End(), token.Position{Line: 5, Column: 9}},
+	}
+	for _, tt := range tests {
+		if tt.actual != tt.expected {
+			t.Errorf("%s: expected position %s, got %s", tt.node, tt.expected, tt.actual)
+		}
+	}
+
+	if len(program.Comments) != 2 || program.Comments[0].Text != "// comment" || program.Comments[1].Text != "// call" {
+		t.Errorf("unexpected comments %v", program.Comments)
+	}
+	if let.String() != "let add = fn(x,y){ return (x + y); };" {
+		t.Errorf("unexpected let statement string %q", let.String())
+	}
+}
+
+func TestTypeAnnotations(t *testing.T) {
+	input := `let x: int = 1;
+let f = fn(a: str, b, g: fn): bool { true };`
+
+	p := New(tokenizer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors) > 0 {
+		t.Fatalf("Error(s) in ParseProgram(): %v", strings.Join(p.Errors, ","))
+	}
+
+	let := program.Statements[0].(*ast.LetStatement)
+	if let.Type == nil || let.Type.Name != "int" || let.Type.Position != (token.Position{Line: 1, Column: 8}) {
+		t.Errorf("unexpected let type %+v", let.Type)
+	}
+	fn := program.Statements[1].(*ast.LetStatement).Value.(*ast.FunctionLiteral)
+	expected := []string{"str", "", "fn"}
+	for i, name := range expected {
+		actual := ""
+		if typ := fn.ParamType(i); typ != nil {
+			actual = typ.Name
+		}
+		if actual != name {
+			t.Errorf("param %d: expected type %q, got %q", i, name, actual)
+		}
+	}
+	if fn.ReturnType == nil || fn.ReturnType.Name != "bool" {
+		t.Errorf("unexpected return type %+v", fn.ReturnType)
+	}
+
+	p = New(tokenizer.New("let x: = 1;"))
+	p.ParseProgram()
+	if len(p.Errors) == 0 {
+		t.Errorf("expected error for missing type name")
+	}
+
+	p = New(tokenizer.New("let x: [int] = [1];"))
+	p.ParseProgram()
+	if len(p.Errors) == 0 || p.Errors[0] != "types of elements cannot be annotated, use array" {
+		t.Errorf("expected error for element type, got %v", p.Errors)
+	}
+}
+
+func TestErrorPositions(t *testing.T) {
+	p := New(tokenizer.New("let x = 1;\nlet = 2;\n)"))
+	p.ParseProgram()
+
+	expected := []token.Position{{Line: 2, Column: 5}, {Line: 2, Column: 5}, {Line: 3, Column: 1}}
+	if len(p.ErrorPositions) != len(p.Errors) {
+		t.Fatalf("expected position for every error, got %d positions for %v", len(p.ErrorPositions), p.Errors)
+	}
+	if len(p.Errors) != len(expected) {
+		t.Fatalf("expected %d errors, got %v", len(expected), p.Errors)
+	}
+	for i, pos := range expected {
+		if p.ErrorPositions[i] != pos {
+			t.Errorf("expected positions %v, got %v for %v", expected, p.ErrorPositions, p.Errors)
+			break
+		}
+	}
+}
+
+func TestIntegerLiteralBases(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		err      string
+	}{
+		{"010", "8", ""},
+		{"01000000000000000000000", "9223372036854775808n", ""},
+		{"08", "", `could not parse "08" as integer`},
+		{"09 - 1", "", `could not parse "09" as integer`},
+		{"0999999999999999999999", "", `could not parse "0999999999999999999999" as integer`},
+	}
+	for _, tt := range tests {
+		p := New(tokenizer.New(tt.input))
+		program := p.ParseProgram()
+		if tt.err != "" {
+			if len(p.Errors) == 0 || p.Errors[0] != tt.err {
+				t.Errorf("%s: expected error %q, got %v", tt.input, tt.err, p.Errors)
+			}
+			continue
+		}
+		if len(p.Errors) > 0 {
+			t.Fatalf("%s: Error(s) in ParseProgram(): %v", tt.input, strings.Join(p.Errors, ","))
+		}
+		if actual := program.String(); actual != tt.expected {
+			t.Errorf("%s: expected %q, got %q", tt.input, tt.expected, actual)
+		}
+	}
+}
+
+func TestHashLiteralParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{}`, "{}"},
+		{`{"one": 1, "two": 1 + 1}`, "{one: 1, two: (1 + 1)}"},
+		{`{1: [true], x: y[0]}`, "{1: [true], x: (y[0])}"},
+		{`{"a": {"b": 2}}["a"]`, "({a: {b: 2}}[a])"},
+	}
+	for _, tt := range tests {
+		p := New(tokenizer.New(tt.input))
+		program := p.ParseProgram()
+		if len(p.Errors) > 0 {
+			t.Fatalf("%s: Error(s) in ParseProgram(): %v", tt.input, strings.Join(p.Errors, ","))
+		}
+		if actual := program.String(); actual != tt.expected {
+			t.Errorf("%s: expected %q, got %q", tt.input, tt.expected, actual)
+		}
+	}
+}
+
+func TestMatchExpressionParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`match (x) { 1 => "one", _ => "other" }`, "match(x) { 1 => one, _ => other }"},
+		{`match (x) { -1 => a, 2n => b, true => c, "s" => d, }`, "match(x) { (-1) => a, 2n => b, true => c, s => d }"},
+		{`match (x) { n if n > 1 => n * 2 }`, "match(x) { n if (n > 1) => (n * 2) }"},
+		{`match (xs) { [] => 0, [a] => a, [a, ...rest] => rest, [_, ...] => 1 }`, "match(xs) { [] => 0, [a] => a, [a, ...rest] => rest, [_, ..._] => 1 }"},
+		{`match (h) { {name, "age": [a, b], 1: true} => name }`, "match(h) { {name: name, age: [a, b], 1: true} => name }"},
+		{`match (x) { {a: 1} => {"b": 2} }`, "match(x) { {a: 1} => {b: 2} }"},
+	}
+	for _, tt := range tests {
+		p := New(tokenizer.New(tt.input))
+		program := p.ParseProgram()
+		if len(p.Errors) > 0 {
+			t.Fatalf("%s: Error(s) in ParseProgram(): %v", tt.input, strings.Join(p.Errors, ","))
+		}
+		if actual := program.String(); actual != tt.expected {
+			t.Errorf("%s: expected %q, got %q", tt.input, tt.expected, actual)
+		}
+	}
+
+	stmt := New(tokenizer.New(`match (x) { [a, ...r] if a => r }`)).ParseProgram().Statements[0].(*ast.ExpressionStatement)
+	match, ok := stmt.Expression.(*ast.MatchExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.MatchExpression. got=%T", stmt.Expression)
+	}
+	if match.EndPosition != (token.Position{Line: 1, Column: 33}) {
+		t.Errorf("expected end at 1:33, got %s", match.EndPosition)
+	}
+	pattern, ok := match.Arms[0].Pattern.(*ast.ArrayPattern)
+	if !ok {
+		t.Fatalf("pattern is not ast.ArrayPattern. got=%T", match.Arms[0].Pattern)
+	}
+	if len(pattern.Elements) != 1 || pattern.Rest.(*ast.BindingPattern).Name != "r" {
+		t.Errorf("unexpected array pattern %s", pattern)
+	}
+	testLiteralExpression(t, match.Arms[0].Guard, "a")
+}
+
+func TestPatternErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`match (x) { }`, "match expression has no arms"},
+		{`match (x) { x + 1 => 1 }`, "expected next token to be =>, got + instead"},
+		{`match (x) { (1) => 1 }`, "unexpected ( in pattern"},
+		{`match (x) { [...r, a] => 1 }`, "expected next token to be ], got , instead"},
+		{`match (x) { {[1]: a} => 1 }`, "unexpected [ as key of hash pattern"},
+		{`match (x) { {1} => 1 }`, "expected next token to be :, got } instead"},
+		{`match (x) { -a => 1 }`, "expected integer after - in pattern, got ident instead"},
+	}
+	for _, tt := range tests {
+		p := New(tokenizer.New(tt.input))
+		p.ParseProgram()
+		if len(p.Errors) == 0 || p.Errors[0] != tt.expected {
+			t.Errorf("%s: expected error %q, got %v", tt.input, tt.expected, p.Errors)
+		}
+	}
+}
+
+func TestDestructuringParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let [a, b, ...rest] = arr;`, "let [a, b, ...rest] = arr;"},
+		{`let {name, age} = person;`, "let {name: name, age: age} = person;"},
+		{`let {name: [first, _], "age": age = 18} = person;`, "let {name: [first, _], age: age = 18} = person;"},
+		{`let [a = 1, [b, c] = [2, 3]] = [];`, "let [a = 1, [b, c] = [2, 3]] = [];"},
+		{`let f = fn([a, b], {c = a + b}: hash, d) { c };`, "let f = fn([a, b],{c: c = (a + b)}: hash,d){ c };"},
+	}
+	for _, tt := range tests {
+		p := New(tokenizer.New(tt.input))
+		program := p.ParseProgram()
+		if len(p.Errors) > 0 {
+			t.Fatalf("%s: Error(s) in ParseProgram(): %v", tt.input, strings.Join(p.Errors, ","))
+		}
+		if actual := program.String(); actual != tt.expected {
+			t.Errorf("%s: expected %q, got %q", tt.input, tt.expected, actual)
+		}
+	}
+
+	fn := New(tokenizer.New(`fn(x, [y]) { x }`)).ParseProgram().Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+	if len(fn.Params) != 2 || fn.Params[1].Name != "" || fn.ParamPattern(0) != nil || fn.ParamPattern(1) == nil {
+		t.Errorf("unexpected parameters %v with patterns %v", fn.Params, fn.ParamPatterns)
+	}
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{`let [a] = 1`, "expected next token to be ;, got eof instead"},
+		{`let [a]: array = b;`, "expected next token to be =, got : instead"},
+		{`let [...a = 1] = b;`, "expected next token to be ], got = instead"},
+		{`macro([a]) { a }`, "parameters of macros cannot be patterns"},
+	}
+	for _, tt := range errors {
+		p := New(tokenizer.New(tt.input))
+		p.ParseProgram()
+		if len(p.Errors) == 0 || p.Errors[0] != tt.expected {
+			t.Errorf("%s: expected error %q, got %v", tt.input, tt.expected, p.Errors)
+		}
+	}
+}
+
+func TestVariadicParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		min      int
+		max      int
+	}{
+		{`fn(a, b = 1) { a }`, "fn(a,b = 1){ a }", 1, 2},
+		{`fn(a: int = 1, b: str = "b") { a }`, "fn(a: int = 1,b: str = b){ a }", 0, 2},
+		{`fn(a, ...rest) { rest }`, "fn(a,...rest){ rest }", 1, -1},
+		{`fn([a, b] = [1, 2], ...rest: array) { a }`, "fn([a, b] = [1, 2],...rest: array){ a }", 0, -1},
+		{`fn() { f(1, ...args, ...[2]) }`, "fn(){ f(1, ...args, ...[2]) }", 0, 0},
+		{`fn(a, b = 1) { f(a, b: a + 1, c: {"k": b}) }`, "fn(a,b = 1){ f(a, b: (a + 1), c: {k: b}) }", 1, 2},
+	}
+	for _, tt := range tests {
+		p := New(tokenizer.New(tt.input))
+		program := p.ParseProgram()
+		if len(p.Errors) > 0 {
+			t.Fatalf("%s: Error(s) in ParseProgram(): %v", tt.input, strings.Join(p.Errors, ","))
+		}
+		if actual := program.String(); actual != tt.expected {
+			t.Errorf("%s: expected %q, got %q", tt.input, tt.expected, actual)
+		}
+		fn := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+		if min, max := fn.Arity(); min != tt.min || max != tt.max {
+			t.Errorf("%s: expected arity %d..%d, got %d..%d", tt.input, tt.min, tt.max, min, max)
+		}
+	}
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{`fn(a = 1, b) { a }`, "parameter without default value follows parameter with default value"},
+		{`fn(...a, b) { a }`, "rest parameter a must be the last one"},
+		{`fn(...a = []) { a }`, "expected next token to be ), got = instead"},
+		{`fn(...[a]) { a }`, "expected next token to be ident, got [ instead"},
+		{`macro(...a) { a }`, "parameters of macros cannot have default values or be variadic"},
+		{`[...a]`, "Unknown token type ..., no parseFn found"},
+		{`f(a: 1, 2)`, "positional argument after named argument"},
+		{`f(a: 1, ...b)`, "positional argument after named argument"},
+		{`f(a:)`, "Unknown token type ), no parseFn found"},
+	}
+	for _, tt := range errors {
+		p := New(tokenizer.New(tt.input))
+		p.ParseProgram()
+		if len(p.Errors) == 0 || p.Errors[0] != tt.expected {
+			t.Errorf("%s: expected error %q, got %v", tt.input, tt.expected, p.Errors)
+		}
+	}
+}
@@ -0,0 +1,231 @@
+package parser
+
+import (
+	"github.com/alenkacz/interpreter-book/pkg/ast"
+	"github.com/alenkacz/interpreter-book/pkg/token"
+)
+
+func (p *Parser) parseHashLiteral() ast.Expression {
+	hash := &ast.HashLiteral{Position: p.currentToken.Pos}
+	for p.nextToken.Type != token.RBRACE {
+		p.readNextToken()
+		key := p.parseExpression(LOWEST)
+		if !p.readNextIfNextTypeIs(token.COLON) {
+			return nil
+		}
+		p.readNextToken()
+		hash.Pairs = append(hash.Pairs, &ast.HashPair{Key: key, Value: p.parseExpression(LOWEST)})
+		if p.nextToken.Type != token.RBRACE && !p.readNextIfNextTypeIs(token.COMMA) {
+			return nil
+		}
+	}
+	p.readNextToken()
+	return hash
+}
+
+func (p *Parser) parseMatchExpression() ast.Expression {
+	match := &ast.MatchExpression{Position: p.currentToken.Pos}
+	if !p.readNextIfNextTypeIs(token.LPAREN) {
+		return nil
+	}
+	p.readNextToken()
+	match.Value = p.parseExpression(LOWEST)
+	if !p.readNextIfNextTypeIs(token.RPAREN) || !p.readNextIfNextTypeIs(token.LBRACE) {
+		return nil
+	}
+
+	for p.nextToken.Type != token.RBRACE {
+		p.readNextToken()
+		arm := p.parseMatchArm()
+		if arm == nil {
+			return nil
+		}
+		match.Arms = append(match.Arms, arm)
+		// the comma is optional after the last arm
+		if p.nextToken.Type != token.RBRACE && !p.readNextIfNextTypeIs(token.COMMA) {
+			return nil
+		}
+	}
+	p.readNextToken()
+	match.EndPosition = p.currentToken.Pos
+	if len(match.Arms) == 0 {
+		p.errorf(match.Position, "match expression has no arms")
+	}
+	return match
+}
+
+func (p *Parser) parseMatchArm() *ast.MatchArm {
+	pattern := p.parsePattern()
+	if pattern == nil {
+		return nil
+	}
+	arm := &ast.MatchArm{Pattern: pattern}
+	if p.nextToken.Type == token.IF {
+		p.readNextToken()
+		p.readNextToken()
+		arm.Guard = p.parseExpression(LOWEST)
+	}
+	if !p.readNextIfNextTypeIs(token.ARROW) {
+		return nil
+	}
+	p.readNextToken()
+	arm.Body = p.parseExpression(LOWEST)
+	return arm
+}
+
+// parsePattern parses the pattern starting at the current token, nil is
+// returned after a parse error
+func (p *Parser) parsePattern() ast.Pattern {
+	switch p.currentToken.Type {
+	case token.IDENT:
+		if p.currentToken.Literal == "_" {
+			return &ast.WildcardPattern{Position: p.currentToken.Pos}
+		}
+		return &ast.BindingPattern{Position: p.currentToken.Pos, Name: p.currentToken.Literal}
+	case token.INT, token.BIGINT, token.STRING, token.TRUE, token.FALSE:
+		if value := p.parseLiteral(); value != nil {
+			return &ast.LiteralPattern{Value: value}
+		}
+		return nil
+	case token.MINUS:
+		pos := p.currentToken.Pos
+		if p.nextToken.Type != token.INT && p.nextToken.Type != token.BIGINT {
+			p.errorf(p.nextToken.Pos, "expected integer after - in pattern, got %s instead", p.nextToken.Type)
+			return nil
+		}
+		p.readNextToken()
+		if value := p.parseLiteral(); value != nil {
+			return &ast.LiteralPattern{Value: &ast.PrefixExpression{Position: pos, Operator: "-", Right: value}}
+		}
+		return nil
+	case token.LBRACKET:
+		return p.parseArrayPattern()
+	case token.LBRACE:
+		return p.parseHashPattern()
+	}
+	p.errorf(p.currentToken.Pos, "unexpected %s in pattern", p.currentToken.Type)
+	return nil
+}
+
+// parseLiteral parses the current integer, string or boolean literal
+func (p *Parser) parseLiteral() ast.Expression {
+	switch p.currentToken.Type {
+	case token.INT:
+		return p.parseIntegerLiteral()
+	case token.BIGINT:
+		return p.parseBigIntegerLiteral()
+	case token.STRING:
+		return p.parseStringLiteral()
+	}
+	return p.parseBoolean()
+}
+
+// parseDestructuringLetStatement parses let statement binding names of an
+// array or hash pattern
+func (p *Parser) parseDestructuringLetStatement() ast.Statement {
+	pos := p.currentToken.Pos
+	p.readNextToken()
+	pattern := p.parsePattern()
+	if pattern == nil || !p.readNextIfNextTypeIs(token.ASSIGN) {
+		return nil
+	}
+	p.readNextToken()
+	value := p.parseExpression(LOWEST)
+	if !p.readNextIfNextTypeIs(token.SEMICOLON) {
+		return nil
+	}
+	return &ast.LetStatement{Position: pos, EndPosition: p.currentToken.Pos, Pattern: pattern, Value: value}
+}
+
+// parseElementPattern parses an element of an array pattern or a value of a
+// hash pattern which can be followed by a default
+func (p *Parser) parseElementPattern() ast.Pattern {
+	pattern := p.parsePattern()
+	if pattern == nil {
+		return nil
+	}
+	return p.parseDefault(pattern)
+}
+
+func (p *Parser) parseDefault(pattern ast.Pattern) ast.Pattern {
+	if p.nextToken.Type != token.ASSIGN {
+		return pattern
+	}
+	p.readNextToken()
+	p.readNextToken()
+	value := p.parseExpression(LOWEST)
+	if value == nil {
+		return nil
+	}
+	return &ast.DefaultPattern{Pattern: pattern, Default: value}
+}
+
+func (p *Parser) parseArrayPattern() ast.Pattern {
+	pattern := &ast.ArrayPattern{Position: p.currentToken.Pos}
+	for p.nextToken.Type != token.RBRACKET {
+		p.readNextToken()
+		if p.currentToken.Type == token.ELLIPSIS {
+			pattern.Rest = &ast.WildcardPattern{Position: p.currentToken.Pos}
+			if p.nextToken.Type == token.IDENT {
+				p.readNextToken()
+				pattern.Rest = p.parsePattern()
+			}
+			// the rest must be the last element
+			if !p.readNextIfNextTypeIs(token.RBRACKET) {
+				return nil
+			}
+			return pattern
+		}
+		element := p.parseElementPattern()
+		if element == nil {
+			return nil
+		}
+		pattern.Elements = append(pattern.Elements, element)
+		if p.nextToken.Type != token.RBRACKET && !p.readNextIfNextTypeIs(token.COMMA) {
+			return nil
+		}
+	}
+	p.readNextToken()
+	return pattern
+}
+
+func (p *Parser) parseHashPattern() ast.Pattern {
+	pattern := &ast.HashPattern{Position: p.currentToken.Pos}
+	for p.nextToken.Type != token.RBRACE {
+		p.readNextToken()
+		var key ast.Expression
+		switch p.currentToken.Type {
+		case token.IDENT:
+			// names are keys, they are not evaluated
+			key = &ast.StringLiteral{Position: p.currentToken.Pos, Value: p.currentToken.Literal}
+		case token.INT, token.BIGINT, token.STRING, token.TRUE, token.FALSE:
+			key = p.parseLiteral()
+		default:
+			p.errorf(p.currentToken.Pos, "unexpected %s as key of hash pattern", p.currentToken.Type)
+			return nil
+		}
+		if key == nil {
+			return nil
+		}
+
+		var value ast.Pattern
+		if p.nextToken.Type == token.COLON {
+			p.readNextToken()
+			p.readNextToken()
+			value = p.parseElementPattern()
+		} else if p.currentToken.Type == token.IDENT {
+			value = p.parseDefault(&ast.BindingPattern{Position: p.currentToken.Pos, Name: p.currentToken.Literal})
+		} else {
+			p.errorf(p.nextToken.Pos, "expected next token to be %s, got %s instead", token.COLON, p.nextToken.Type)
+		}
+		if value == nil {
+			return nil
+		}
+		pattern.Pairs = append(pattern.Pairs, &ast.HashPatternPair{Key: key, Value: value})
+		if p.nextToken.Type != token.RBRACE && !p.readNextIfNextTypeIs(token.COMMA) {
+			return nil
+		}
+	}
+	p.readNextToken()
+	return pattern
+}
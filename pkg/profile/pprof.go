@@ -0,0 +1,179 @@
+package profile
+
+import (
+	"compress/gzip"
+	"io"
+)
+
+// field numbers of the messages of profile.proto used by pprof
+const (
+	profileSampleType    = 1
+	profileSample        = 2
+	profileLocation      = 4
+	profileFunction      = 5
+	profileStringTable   = 6
+	profileTimeNanos     = 9
+	profileDurationNanos = 10
+
+	valueTypeType = 1
+	valueTypeUnit = 2
+
+	sampleLocationID = 1
+	sampleValue      = 2
+
+	locationID   = 1
+	locationLine = 4
+
+	lineFunctionID = 1
+	lineLine       = 2
+
+	functionID        = 1
+	functionName      = 2
+	functionFilename  = 4
+	functionStartLine = 5
+)
+
+// buffer encodes protocol buffers messages
+type buffer struct {
+	data []byte
+}
+
+func (b *buffer) varint(x uint64) {
+	for x >= 0x80 {
+		b.data = append(b.data, byte(x)|0x80)
+		x >>= 7
+	}
+	b.data = append(b.data, byte(x))
+}
+
+func (b *buffer) key(field int, wireType int) {
+	b.varint(uint64(field)<<3 | uint64(wireType))
+}
+
+func (b *buffer) int(field int, x int64) {
+	if x == 0 {
+		return
+	}
+	b.key(field, 0)
+	b.varint(uint64(x))
+}
+
+func (b *buffer) bytes(field int, data []byte) {
+	b.key(field, 2)
+	b.varint(uint64(len(data)))
+	b.data = append(b.data, data...)
+}
+
+func (b *buffer) message(field int, encode func(m *buffer)) {
+	var m buffer
+	encode(&m)
+	b.bytes(field, m.data)
+}
+
+// packed encodes repeated integers
+func (b *buffer) packed(field int, xs []int64) {
+	var m buffer
+	for _, x := range xs {
+		m.varint(uint64(x))
+	}
+	b.bytes(field, m.data)
+}
+
+// stringTable is the string table of the profile, the first string is empty
+type stringTable struct {
+	table []string
+	index map[string]int64
+}
+
+func (s *stringTable) id(str string) int64 {
+	if i, ok := s.index[str]; ok {
+		return i
+	}
+	s.index[str] = int64(len(s.table))
+	s.table = append(s.table, str)
+	return s.index[str]
+}
+
+// WritePprof writes gzipped profile in the protocol buffers format of pprof.
+// Samples are the unique stacks with number of calls and time spent in the
+// innermost function, locations are lines of functions in the file.
+func (p *Profiler) WritePprof(w io.Writer, filename string) error {
+	s := &stringTable{table: []string{""}, index: map[string]int64{"": 0}}
+	var b buffer
+
+	for _, t := range [][2]string{{"calls", "count"}, {"time", "nanoseconds"}} {
+		b.message(profileSampleType, func(m *buffer) {
+			m.int(valueTypeType, s.id(t[0]))
+			m.int(valueTypeUnit, s.id(t[1]))
+		})
+	}
+
+	functions := p.Functions()
+	for i, f := range functions {
+		f.id = uint64(i + 1)
+	}
+
+	// locations are identified by function and line
+	type location struct {
+		function *Function
+		line     int
+	}
+	locations := make(map[location]uint64)
+	var order []location
+	locationOf := func(l location) int64 {
+		id, ok := locations[l]
+		if !ok {
+			id = uint64(len(order) + 1)
+			locations[l] = id
+			order = append(order, l)
+		}
+		return int64(id)
+	}
+
+	for _, stack := range p.Stacks() {
+		// the innermost location goes first
+		ids := make([]int64, len(stack.Functions))
+		for i, f := range stack.Functions {
+			ids[len(ids)-1-i] = locationOf(location{f, stack.Lines[i]})
+		}
+		b.message(profileSample, func(m *buffer) {
+			m.packed(sampleLocationID, ids)
+			m.packed(sampleValue, []int64{int64(stack.Calls), stack.Self.Nanoseconds()})
+		})
+	}
+
+	for _, l := range order {
+		l := l
+		b.message(profileLocation, func(m *buffer) {
+			m.int(locationID, int64(locations[l]))
+			m.message(locationLine, func(line *buffer) {
+				line.int(lineFunctionID, int64(l.function.id))
+				line.int(lineLine, int64(l.line))
+			})
+		})
+	}
+
+	for _, f := range functions {
+		f := f
+		b.message(profileFunction, func(m *buffer) {
+			m.int(functionID, int64(f.id))
+			m.int(functionName, s.id(f.Name))
+			if !f.Builtin {
+				m.int(functionFilename, s.id(filename))
+			}
+			m.int(functionStartLine, int64(f.Pos.Line))
+		})
+	}
+
+	for _, str := range s.table {
+		b.bytes(profileStringTable, []byte(str))
+	}
+	b.int(profileTimeNanos, p.started.UnixNano())
+	b.int(profileDurationNanos, p.Duration.Nanoseconds())
+
+	gz := gzip.NewWriter(w)
+	if _, err := gz.Write(b.data); err != nil {
+		return err
+	}
+	return gz.Close()
+}
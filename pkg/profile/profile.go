@@ -0,0 +1,304 @@
+// Package profile implements an instrumenting profiler of Monkey programs. It
+// attributes time and number of calls to function literals, builtin functions
+// and call sites using the tracing hooks of the evaluator.
+package profile
+
+import (
+	"fmt"
+	"github.com/alenkacz/interpreter-book/pkg/ast"
+	"github.com/alenkacz/interpreter-book/pkg/eval"
+	"github.com/alenkacz/interpreter-book/pkg/object"
+	"github.com/alenkacz/interpreter-book/pkg/token"
+	"sync"
+	"time"
+)
+
+// MainFunction is the name of the top-level code of the program
+const MainFunction = "<main>"
+
+// TaskFunction is the name of the caller of functions called by spawned
+// tasks, its own time is not measured
+const TaskFunction = "<task>"
+
+// Function is a function literal or a builtin function
+type Function struct {
+	// Name is the name of the let binding of the function literal, anonymous
+	// functions are named by their position
+	Name string
+	// Pos is the position of the function literal, zero for builtins and
+	// the main function
+	Pos     token.Position
+	Builtin bool
+
+	Calls int
+	// Total is the time spent in the function including called functions,
+	// recursive calls are counted once
+	Total time.Duration
+	// Self is the time spent in the function itself
+	Self time.Duration
+
+	// number of frames of the function on the call stack
+	active int
+	id     uint64
+}
+
+// CallSite is a call expression in the source
+type CallSite struct {
+	Pos    token.Position
+	Caller *Function
+	Callee *Function
+	Calls  int
+	// Total is the time spent in calls made by the call site, recursive
+	// calls are counted once
+	Total time.Duration
+
+	active int
+}
+
+// Stack is a unique call stack with time spent directly in its innermost
+// function
+type Stack struct {
+	// Functions of the stack starting with the main function
+	Functions []*Function
+	// Lines of the calls in the callers, the last one is the line of the
+	// innermost function
+	Lines []int
+	Calls int
+	Self  time.Duration
+}
+
+type frame struct {
+	function *Function
+	site     *CallSite
+	stack    *Stack
+	key      string
+	start    time.Time
+	// time spent in functions called from the frame
+	children time.Duration
+}
+
+// goroutine is the call stack of the program or of a spawned task
+type goroutine struct {
+	p      *Profiler
+	frames []*frame
+}
+
+// Profiler collects the profile while the program is evaluated.
+type Profiler struct {
+	// Now returns the current time, it can be replaced in tests
+	Now func() time.Time
+
+	// mu guards the profile changed by goroutines of spawned tasks
+	mu        sync.Mutex
+	main      *Function
+	task      *Function
+	functions map[*ast.BlockStatement]*Function
+	builtins  map[string]*Function
+	sites     map[*ast.CallExpression]*CallSite
+	stacks    map[string]*Stack
+	// names of function literals by their bodies
+	names map[*ast.BlockStatement]*ast.FunctionLiteral
+
+	started  time.Time
+	Duration time.Duration
+	order    []*Function
+	siteList []*CallSite
+	stackKey []string
+}
+
+// New returns profiler of the program.
+func New(program *ast.Program) *Profiler {
+	p := &Profiler{
+		Now:       time.Now,
+		functions: make(map[*ast.BlockStatement]*Function),
+		builtins:  make(map[string]*Function),
+		sites:     make(map[*ast.CallExpression]*CallSite),
+		stacks:    make(map[string]*Stack),
+		names:     make(map[*ast.BlockStatement]*ast.FunctionLiteral),
+	}
+	p.main = p.newFunction(MainFunction, token.Position{}, false)
+	p.task = p.newFunction(TaskFunction, token.Position{}, false)
+	p.nameFunctions(program)
+	return p
+}
+
+// nameFunctions names function literals by let statements binding them
+func (p *Profiler) nameFunctions(program *ast.Program) {
+	ast.Inspect(program, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.LetStatement:
+			if fn, ok := node.Value.(*ast.FunctionLiteral); ok && fn.Block != nil {
+				p.functions[fn.Block] = p.newFunction(node.Name(), fn.Position, false)
+			}
+		case *ast.FunctionLiteral:
+			if _, ok := p.functions[node.Block]; !ok && node.Block != nil {
+				p.functions[node.Block] = p.newFunction(fmt.Sprintf("fn@%s", node.Position), node.Position, false)
+			}
+		}
+		return true
+	})
+}
+
+func (p *Profiler) newFunction(name string, pos token.Position, builtin bool) *Function {
+	return &Function{Name: name, Pos: pos, Builtin: builtin}
+}
+
+// Run evaluates the program collecting the profile.
+func (p *Profiler) Run(program *ast.Program, env *object.Environment) object.Object {
+	main := &goroutine{p: p}
+	in := eval.New()
+	in.Trace = main.tracer()
+
+	p.started = p.Now()
+	root := &frame{function: p.main, start: p.started, key: MainFunction}
+	root.stack = p.stack(root.key, nil, p.main, 0)
+	main.enter(root)
+
+	result := in.Eval(program, env)
+
+	// frames of functions interrupted by errors are closed too
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	end := p.Now()
+	for len(main.frames) > 0 {
+		main.exit(end)
+	}
+	p.Duration = end.Sub(p.started)
+	return result
+}
+
+func (g *goroutine) tracer() *eval.Tracer {
+	return &eval.Tracer{
+		Call:   g.call,
+		Return: g.ret,
+		Spawn: func() *eval.Tracer {
+			// the root frame of the task is never entered nor exited
+			root := &frame{function: g.p.task, key: TaskFunction}
+			root.stack = &Stack{Functions: []*Function{g.p.task}, Lines: []int{0}}
+			task := &goroutine{p: g.p, frames: []*frame{root}}
+			return task.tracer()
+		},
+	}
+}
+
+func (p *Profiler) function(call *ast.CallExpression, fn object.Object) *Function {
+	switch fn := fn.(type) {
+	case *object.Function:
+		if f, ok := p.functions[fn.Block]; ok {
+			return f
+		}
+		// literals created outside of the program, e.g. by the REPL
+		f := p.newFunction(call.Function.Name, token.Position{}, false)
+		p.functions[fn.Block] = f
+		return f
+	}
+	f, ok := p.builtins[call.Function.Name]
+	if !ok {
+		f = p.newFunction(call.Function.Name, token.Position{}, true)
+		p.builtins[call.Function.Name] = f
+	}
+	return f
+}
+
+func (p *Profiler) stack(key string, parent *Stack, fn *Function, line int) *Stack {
+	s, ok := p.stacks[key]
+	if !ok {
+		s = &Stack{}
+		if parent != nil {
+			s.Functions = append(s.Functions, parent.Functions...)
+			s.Lines = append(s.Lines, parent.Lines[:len(parent.Lines)-1]...)
+			// the caller is at the line of the call
+			s.Lines = append(s.Lines, line)
+		}
+		s.Functions = append(s.Functions, fn)
+		s.Lines = append(s.Lines, fn.Pos.Line)
+		p.stacks[key] = s
+		p.stackKey = append(p.stackKey, key)
+	}
+	return s
+}
+
+func (g *goroutine) call(call *ast.CallExpression, fn object.Object, env *object.Environment) {
+	p := g.p
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := p.Now()
+	callee := p.function(call, fn)
+	caller := g.frames[len(g.frames)-1]
+
+	site, ok := p.sites[call]
+	if !ok {
+		site = &CallSite{Pos: call.Position, Caller: caller.function, Callee: callee}
+		p.sites[call] = site
+		p.siteList = append(p.siteList, site)
+	}
+
+	site.active++
+
+	key := fmt.Sprintf("%s;%p@%d", caller.key, callee, call.Position.Line)
+	f := &frame{function: callee, site: site, key: key, start: now}
+	f.stack = p.stack(key, caller.stack, callee, call.Position.Line)
+	g.enter(f)
+}
+
+func (g *goroutine) ret(call *ast.CallExpression, fn object.Object, result object.Object) {
+	g.p.mu.Lock()
+	defer g.p.mu.Unlock()
+	g.exit(g.p.Now())
+}
+
+func (g *goroutine) enter(f *frame) {
+	p := g.p
+	if f.function.Calls == 0 && f.function.active == 0 {
+		p.order = append(p.order, f.function)
+	}
+	f.function.active++
+	g.frames = append(g.frames, f)
+}
+
+func (g *goroutine) exit(now time.Time) {
+	f := g.frames[len(g.frames)-1]
+	g.frames = g.frames[:len(g.frames)-1]
+
+	elapsed := now.Sub(f.start)
+	self := elapsed - f.children
+	fn := f.function
+	fn.active--
+	fn.Calls++
+	fn.Self += self
+	if fn.active == 0 {
+		fn.Total += elapsed
+	}
+	f.stack.Calls++
+	f.stack.Self += self
+	if f.site != nil {
+		f.site.active--
+		f.site.Calls++
+		if f.site.active == 0 {
+			f.site.Total += elapsed
+		}
+	}
+	if len(g.frames) > 0 {
+		g.frames[len(g.frames)-1].children += elapsed
+	}
+}
+
+// Functions returns profiled functions including the main function in the
+// order of their first call.
+func (p *Profiler) Functions() []*Function {
+	return p.order
+}
+
+// CallSites returns call sites in the order of their first call.
+func (p *Profiler) CallSites() []*CallSite {
+	return p.siteList
+}
+
+// Stacks returns unique call stacks in the order they were first seen.
+func (p *Profiler) Stacks() []*Stack {
+	stacks := make([]*Stack, len(p.stackKey))
+	for i, key := range p.stackKey {
+		stacks[i] = p.stacks[key]
+	}
+	return stacks
+}
@@ -0,0 +1,161 @@
+package profile
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"github.com/alenkacz/interpreter-book/pkg/object"
+	"github.com/alenkacz/interpreter-book/pkg/parser"
+	"github.com/alenkacz/interpreter-book/pkg/tokenizer"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+const source = `let square = fn(x) { x * x };
+let sum = fn(n) {
+  if (n < 1) { 0 } else { square(n) + sum(n - 1) }
+};
+sum(2);
+len("abc");`
+
+// run profiles the source with clock advancing by a millisecond on each read
+func run(t *testing.T) *Profiler {
+	program := parser.New(tokenizer.New(source)).ParseProgram()
+	p := New(program)
+	now := time.Unix(0, 0)
+	p.Now = func() time.Time {
+		now = now.Add(time.Millisecond)
+		return now
+	}
+	if result := p.Run(program, object.NewEnvironment(nil)); result.Print() != "3" {
+		t.Fatalf("unexpected result %s", result.Print())
+	}
+	return p
+}
+
+func TestFunctions(t *testing.T) {
+	p := run(t)
+
+	var self time.Duration
+	var actual []string
+	for _, f := range p.Functions() {
+		actual = append(actual, fmt.Sprintf("%s %d", f, f.Calls))
+		self += f.Self
+	}
+	expected := []string{"<main> 1", "sum (2:11) 3", "square (1:14) 2", "len (builtin) 1"}
+	if strings.Join(actual, ", ") != strings.Join(expected, ", ") {
+		t.Errorf("expected functions %v, got %v", expected, actual)
+	}
+
+	main := p.Functions()[0]
+	if main.Total != p.Duration || self != p.Duration {
+		t.Errorf("expected total of main %s and sum of self times %s to be the duration %s", main.Total, self, p.Duration)
+	}
+	sum := p.Functions()[1]
+	// recursive calls are counted once, the outermost call is entered at
+	// the second read of the clock and returns at the eleventh
+	if sum.Total != 9*time.Millisecond {
+		t.Errorf("unexpected total time of sum %s", sum.Total)
+	}
+
+	var sites []string
+	for _, s := range p.CallSites() {
+		sites = append(sites, fmt.Sprintf("%s %s->%s %d", s.Pos, s.Caller.Name, s.Callee.Name, s.Calls))
+	}
+	expectedSites := []string{"5:1 <main>->sum 1", "3:27 sum->square 2", "3:39 sum->sum 2", "6:1 <main>->len 1"}
+	if strings.Join(sites, ", ") != strings.Join(expectedSites, ", ") {
+		t.Errorf("expected call sites %v, got %v", expectedSites, sites)
+	}
+}
+
+func TestReports(t *testing.T) {
+	p := run(t)
+
+	var text bytes.Buffer
+	if err := p.WriteText(&text); err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{"square (1:14)", "3:39: sum -> sum", "len (builtin)"} {
+		if !strings.Contains(text.String(), expected) {
+			t.Errorf("text report does not contain %q:\n%s", expected, text.String())
+		}
+	}
+
+	var collapsed bytes.Buffer
+	if err := p.WriteCollapsed(&collapsed); err != nil {
+		t.Fatal(err)
+	}
+	var stacks []string
+	for _, line := range strings.Split(strings.TrimSpace(collapsed.String()), "\n") {
+		stacks = append(stacks, line[:strings.LastIndex(line, " ")])
+	}
+	expected := []string{"<main>", "<main>;len", "<main>;sum", "<main>;sum;square", "<main>;sum;sum", "<main>;sum;sum;square", "<main>;sum;sum;sum"}
+	if strings.Join(stacks, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected stacks\n%s\ngot\n%s", strings.Join(expected, "\n"), collapsed.String())
+	}
+
+	var pprof bytes.Buffer
+	if err := p.WritePprof(&pprof, "test.mk"); err != nil {
+		t.Fatal(err)
+	}
+	r, err := gzip.NewReader(&pprof)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"nanoseconds", "square", "test.mk"} {
+		if !bytes.Contains(data, []byte(s)) {
+			t.Errorf("pprof profile does not contain %q", s)
+		}
+	}
+}
+
+func TestAnonymousFunctions(t *testing.T) {
+	program := parser.New(tokenizer.New("let apply = fn(f) { f(1) }; apply(fn(x) { x });")).ParseProgram()
+	p := New(program)
+	p.Run(program, object.NewEnvironment(nil))
+
+	var names []string
+	for _, f := range p.Functions() {
+		names = append(names, f.Name)
+	}
+	if strings.Join(names, " ") != "<main> apply fn@1:35" {
+		t.Errorf("unexpected functions %v", names)
+	}
+}
+
+func TestSpawn(t *testing.T) {
+	input := `let square = fn(x) { x * x };
+let work = fn(n) {
+  let s = square(n);
+  s + 1
+};
+let tasks = [spawn(work, 1), spawn(work, 2), spawn(work, 3)];
+[await(tasks[0]), await(tasks[1]), await(tasks[2])]`
+	program := parser.New(tokenizer.New(input)).ParseProgram()
+	p := New(program)
+	if result := p.Run(program, object.NewEnvironment(nil)); result.Print() != "[2, 5, 10]" {
+		t.Fatalf("unexpected result %s", result.Print())
+	}
+
+	var sites []string
+	for _, s := range p.CallSites() {
+		sites = append(sites, fmt.Sprintf("%s %s->%s %d", s.Pos, s.Caller.Name, s.Callee.Name, s.Calls))
+	}
+	expected := []string{"6:14 <main>->spawn 1", "6:30 <main>->spawn 1", "6:46 <main>->spawn 1", "3:11 <task>->square 3",
+		"7:2 <main>->await 1", "7:19 <main>->await 1", "7:36 <main>->await 1"}
+	sort.Strings(sites)
+	sort.Strings(expected)
+	if strings.Join(sites, ", ") != strings.Join(expected, ", ") {
+		t.Errorf("expected call sites %v, got %v", expected, sites)
+	}
+	if main := p.Functions()[0]; main.Total != p.Duration {
+		t.Errorf("expected total of main %s to be the duration %s", main.Total, p.Duration)
+	}
+}
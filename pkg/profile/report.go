@@ -0,0 +1,86 @@
+package profile
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+func (f *Function) String() string {
+	switch {
+	case f.Builtin:
+		return f.Name + " (builtin)"
+	case f.Pos.Line == 0:
+		return f.Name
+	}
+	return fmt.Sprintf("%s (%s)", f.Name, f.Pos)
+}
+
+func percent(part time.Duration, total time.Duration) float64 {
+	if total == 0 {
+		return 0
+	}
+	return 100 * float64(part) / float64(total)
+}
+
+// WriteText writes flat profile of functions ordered by self time followed
+// by call sites ordered by total time.
+func (p *Profiler) WriteText(w io.Writer) error {
+	functions := append([]*Function(nil), p.Functions()...)
+	sort.SliceStable(functions, func(i, j int) bool {
+		return functions[i].Self > functions[j].Self
+	})
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "self\tself%%\ttotal\ttotal%%\tcalls\t\t\n")
+	for _, f := range functions {
+		fmt.Fprintf(tw, "%s\t%.2f%%\t%s\t%.2f%%\t%d\t\t%s\n",
+			f.Self, percent(f.Self, p.Duration), f.Total, percent(f.Total, p.Duration), f.Calls, f)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	sites := append([]*CallSite(nil), p.CallSites()...)
+	sort.SliceStable(sites, func(i, j int) bool {
+		return sites[i].Total > sites[j].Total
+	})
+	fmt.Fprintf(w, "\n")
+	tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "total\ttotal%%\tcalls\t\t\n")
+	for _, s := range sites {
+		fmt.Fprintf(tw, "%s\t%.2f%%\t%d\t\t%s: %s -> %s\n",
+			s.Total, percent(s.Total, p.Duration), s.Calls, s.Pos, s.Caller.Name, s.Callee.Name)
+	}
+	return tw.Flush()
+}
+
+// WriteCollapsed writes stacks in the collapsed format of flamegraph tools,
+// each line is a stack of function names separated by semicolons followed
+// by microseconds spent in the innermost function.
+func (p *Profiler) WriteCollapsed(w io.Writer) error {
+	self := make(map[string]time.Duration)
+	var keys []string
+	for _, s := range p.Stacks() {
+		names := make([]string, len(s.Functions))
+		for i, f := range s.Functions {
+			names[i] = f.Name
+		}
+		key := strings.Join(names, ";")
+		if _, ok := self[key]; !ok {
+			keys = append(keys, key)
+		}
+		self[key] += s.Self
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if _, err := fmt.Fprintf(w, "%s %d\n", key, self[key].Microseconds()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
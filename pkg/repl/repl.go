@@ -2,43 +2,213 @@ package repl
 
 import (
 	"bufio"
+	"bytes"
 	"fmt"
 	"github.com/alenkacz/interpreter-book/pkg/eval"
+	"github.com/alenkacz/interpreter-book/pkg/format"
+	"github.com/alenkacz/interpreter-book/pkg/lineedit"
 	"github.com/alenkacz/interpreter-book/pkg/object"
 	"github.com/alenkacz/interpreter-book/pkg/parser"
+	"github.com/alenkacz/interpreter-book/pkg/token"
 	"github.com/alenkacz/interpreter-book/pkg/tokenizer"
 	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 )
 
+const (
+	PROMPT              = ">> "
+	CONTINUATION_PROMPT = ".. "
+)
+
+// HISTORY_FILE is name of the file in user's home directory where history of
+// interactive sessions is kept
+const HISTORY_FILE = ".monkey_history"
+
+type session struct {
+	out io.Writer
+	env *object.Environment
+	// macros are kept apart from env as they are expanded before evaluation
+	macros *object.Environment
+}
+
+func newSession(out io.Writer) *session {
+	return &session{out: out, env: object.NewEnvironment(nil), macros: object.NewEnvironment(nil)}
+}
+
+type lineReader interface {
+	ReadLine(prompt string) (string, error)
+}
+
+// scannerReader reads lines from input that is not an interactive terminal
+type scannerReader struct {
+	scanner *bufio.Scanner
+	out     io.Writer
+}
+
+func (r *scannerReader) ReadLine(prompt string) (string, error) {
+	io.WriteString(r.out, prompt)
+	if !r.scanner.Scan() {
+		if r.scanner.Err() != nil {
+			return "", r.scanner.Err()
+		}
+		return "", io.EOF
+	}
+	return r.scanner.Text(), nil
+}
+
 func Start(in io.Reader, out io.Writer) {
-	scanner := bufio.NewScanner(in)
-	env := object.NewEnvironment(nil)
+	s := newSession(out)
+
+	var reader lineReader = &scannerReader{scanner: bufio.NewScanner(in), out: out}
+	var history *lineedit.History
+	if f, ok := in.(*os.File); ok && lineedit.IsTerminal(f) {
+		editor := lineedit.New(f, out)
+		history = loadHistory(out)
+		editor.History = history
+		editor.Complete = s.complete
+		reader = editor
+	}
 
+	var input bytes.Buffer
 	for {
-		fmt.Print(">> ")
-		scanned := scanner.Scan()
-		if !scanned {
-			if scanner.Err() != nil {
-				fmt.Fprintf(out, "Error when reading input: %v", scanner.Err())
+		prompt := PROMPT
+		if input.Len() != 0 {
+			prompt = CONTINUATION_PROMPT
+		}
+		line, err := reader.ReadLine(prompt)
+		if err == lineedit.ErrInterrupted {
+			input.Reset()
+			continue
+		}
+		if err != nil {
+			if err != io.EOF {
+				fmt.Fprintf(out, "Error when reading input: %v", err)
+			}
+			return
+		}
+		if history != nil {
+			history.Add(line)
+		}
+
+		if input.Len() == 0 && strings.HasPrefix(strings.TrimSpace(line), ":") {
+			if !s.runCommand(strings.TrimSpace(line)) {
 				return
 			}
+			continue
 		}
 
-		line := scanner.Text()
-		t := tokenizer.New(line)
-		p := parser.New(t)
-		ast := p.ParseProgram()
+		// an empty line submits incomplete input so that the parser can tell
+		// what is missing
+		if line != "" || input.Len() == 0 {
+			input.WriteString(line)
+			input.WriteString("\n")
+			if isIncomplete(input.String()) {
+				continue
+			}
+		}
 
-		if len(p.Errors) != 0 {
-			printParserErrors(out, p.Errors)
-			continue
+		s.eval(input.String())
+		input.Reset()
+	}
+}
+
+func loadHistory(out io.Writer) *lineedit.History {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return &lineedit.History{}
+	}
+	history, err := lineedit.LoadHistory(filepath.Join(home, HISTORY_FILE))
+	if err != nil {
+		fmt.Fprintf(out, "Error when loading history: %v\n", err)
+		return &lineedit.History{}
+	}
+	return history
+}
+
+// complete returns commands, keywords, builtins and names bound in the
+// session starting with the word
+func (s *session) complete(word string) []string {
+	var names []string
+	if strings.HasPrefix(word, ":") {
+		for name := range commands {
+			names = append(names, name)
+		}
+	} else {
+		names = append(names, token.Keywords()...)
+		names = append(names, eval.BuiltinNames()...)
+		names = append(names, s.env.Names()...)
+	}
+
+	seen := map[string]bool{}
+	var result []string
+	for _, name := range names {
+		if strings.HasPrefix(name, word) && !seen[name] {
+			seen[name] = true
+			result = append(result, name)
 		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+func (s *session) eval(input string) {
+	p := parser.New(tokenizer.New(input))
+	program := p.ParseProgram()
+
+	if len(p.Errors) != 0 {
+		printParserErrors(s.out, p.Errors)
+		return
+	}
+	eval.DefineMacros(program, s.macros)
+	if err := eval.ExpandMacros(program, s.macros); err != nil {
+		fmt.Fprintf(s.out, "%s\n", err)
+		return
+	}
+	// functions can refer to names bound by later input, undefined names
+	// are reported when evaluated
+	eval.Resolve(program, s.env)
+
+	result := eval.Eval(program, s.env)
+	if result != nil {
+		fmt.Fprintf(s.out, "%s\n", result.Print())
+	}
+}
 
-		result := eval.Eval(ast, env)
-		if result != nil {
-			fmt.Fprintf(out, "%s\n", eval.Eval(ast, env).Print())
+// isIncomplete reports whether the input cannot be complete program yet
+// because it has unclosed braces, parens, brackets or string or because it
+// ends with an operator
+func isIncomplete(input string) bool {
+	t := tokenizer.New(input)
+	depth := 0
+	last := token.Token{Type: token.EOF}
+	for tok := t.NextToken(); tok.Type != token.EOF; tok = t.NextToken() {
+		switch tok.Type {
+		case token.LPAREN, token.LBRACE, token.LBRACKET:
+			depth++
+		case token.RPAREN, token.RBRACE, token.RBRACKET:
+			depth--
+		case token.ILLEGAL:
+			if strings.HasPrefix(tok.Literal, "\"") {
+				// unterminated string
+				return true
+			}
 		}
+		last = tok
+	}
+	if depth > 0 {
+		return true
 	}
+	switch last.Type {
+	case token.PLUS, token.MINUS, token.ASTERISK, token.SLASH, token.PERCENT,
+		token.ASSIGN, token.EQ, token.NOTEQ, token.LT, token.GT, token.BANG,
+		token.COMMA, token.ELSE:
+		return true
+	}
+	return false
 }
 
 func printParserErrors(out io.Writer, errors []string) {
@@ -48,3 +218,121 @@ func printParserErrors(out io.Writer, errors []string) {
 		io.WriteString(out, "\t"+msg+"\n")
 	}
 }
+
+type command struct {
+	usage string
+	help  string
+	// run executes the command with the rest of the line as argument and
+	// returns false when the REPL should stop
+	run func(s *session, arg string) bool
+}
+
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		":load":   {":load file", "evaluate file in the current session", (*session).load},
+		":save":   {":save file", "write bindings of the session to file, :load restores them", (*session).save},
+		":reset":  {":reset", "forget all bindings of the session", (*session).reset},
+		":env":    {":env", "list bindings of the session", (*session).printEnv},
+		":ast":    {":ast expr", "print parsed AST of the expression", (*session).printAst},
+		":tokens": {":tokens expr", "print tokens of the expression", (*session).printTokens},
+		":help":   {":help", "print this help", (*session).printHelp},
+		":quit":   {":quit", "exit the REPL", func(*session, string) bool { return false }},
+	}
+}
+
+func (s *session) runCommand(line string) bool {
+	name, arg := line, ""
+	if i := strings.IndexAny(line, " \t"); i >= 0 {
+		name, arg = line[:i], strings.TrimSpace(line[i:])
+	}
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(s.out, "unknown command %s, type :help to list commands\n", name)
+		return true
+	}
+	return cmd.run(s, arg)
+}
+
+func (s *session) load(file string) bool {
+	if file == "" {
+		fmt.Fprintf(s.out, "usage: %s\n", commands[":load"].usage)
+		return true
+	}
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		fmt.Fprintf(s.out, "Error when loading file: %v\n", err)
+		return true
+	}
+	s.eval(string(content))
+	return true
+}
+
+// save writes macros and bindings of the session as let statements, values
+// that cannot be saved are reported and left out
+func (s *session) save(file string) bool {
+	if file == "" {
+		fmt.Fprintf(s.out, "usage: %s\n", commands[":save"].usage)
+		return true
+	}
+	var content strings.Builder
+	for _, env := range []*object.Environment{s.macros, s.env} {
+		program, err := eval.Save(env)
+		if err != nil {
+			fmt.Fprintf(s.out, "%v\n", err)
+		}
+		content.WriteString(format.Program(program))
+	}
+	if err := ioutil.WriteFile(file, []byte(content.String()), 0644); err != nil {
+		fmt.Fprintf(s.out, "Error when saving file: %v\n", err)
+	}
+	return true
+}
+
+func (s *session) reset(string) bool {
+	s.env = object.NewEnvironment(nil)
+	s.macros = object.NewEnvironment(nil)
+	return true
+}
+
+func (s *session) printEnv(string) bool {
+	for _, name := range s.env.Names() {
+		value, _ := s.env.Get(name)
+		fmt.Fprintf(s.out, "%s = %s\n", name, value.Print())
+	}
+	return true
+}
+
+func (s *session) printAst(input string) bool {
+	p := parser.New(tokenizer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors) != 0 {
+		printParserErrors(s.out, p.Errors)
+		return true
+	}
+	for _, stmt := range program.Statements {
+		fmt.Fprintf(s.out, "%T %s\n", stmt, stmt.String())
+	}
+	return true
+}
+
+func (s *session) printTokens(input string) bool {
+	t := tokenizer.New(input)
+	for tok := t.NextToken(); tok.Type != token.EOF; tok = t.NextToken() {
+		fmt.Fprintf(s.out, "%-8s %q\n", tok.Type, tok.Literal)
+	}
+	return true
+}
+
+func (s *session) printHelp(string) bool {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(s.out, "%-14s %s\n", commands[name].usage, commands[name].help)
+	}
+	return true
+}
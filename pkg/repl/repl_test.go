@@ -0,0 +1,113 @@
+package repl
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestIsIncomplete(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"let a = 5;", false},
+		{"let add = fn(a, b) {", true},
+		{"let add = fn(a, b) {\n a + b\n};", false},
+		{"add(1,", true},
+		{"[1, 2", true},
+		{"1 +", true},
+		{"let a =", true},
+		{"if (true) { 1 } else", true},
+		{"\"abc", true},
+		{"\"abc\"", false},
+		{"1 + 2)", false},
+	}
+	for _, tt := range tests {
+		if actual := isIncomplete(tt.input); actual != tt.expected {
+			t.Errorf("%q: expected incomplete=%t, got=%t", tt.input, tt.expected, actual)
+		}
+	}
+}
+
+func TestStart(t *testing.T) {
+	input := `let add = fn(a, b) {
+  a +
+  b
+};
+add(1, 2)
+:env
+:ast 1 + 2 * 3
+let twice = macro(x) { quote(unquote(x) + unquote(x)) };
+twice(add(1, 1))
+:reset
+:env
+:unknown
+:quit
+add(1, 2)
+`
+	var out bytes.Buffer
+	Start(strings.NewReader(input), &out)
+
+	expected := `>> .. .. .. >> 3
+>> add = fn(a, b) {
+(a + b)
+}
+>> *ast.ExpressionStatement (1 + (2 * 3))
+>> >> 4
+>> >> >> unknown command :unknown, type :help to list commands
+>> `
+	if out.String() != expected {
+		t.Errorf("unexpected output. expected=%q, got=%q", expected, out.String())
+	}
+}
+
+func TestComplete(t *testing.T) {
+	s := newSession(&bytes.Buffer{})
+	s.eval("let length = 5;")
+
+	tests := []struct {
+		word     string
+		expected string
+	}{
+		{"le", "len,length,let"},
+		{"fi", "first"},
+		{"re", "recv,rest,return"},
+		{":l", ":load"},
+		{"xyz", ""},
+	}
+	for _, tt := range tests {
+		actual := strings.Join(s.complete(tt.word), ",")
+		if actual != tt.expected {
+			t.Errorf("%q: expected=%q, got=%q", tt.word, tt.expected, actual)
+		}
+	}
+}
+
+func TestSave(t *testing.T) {
+	dir, err := ioutil.TempDir("", "repl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "session.monkey")
+
+	input := `let twice = macro(x) { quote(unquote(x) + unquote(x)) };
+let add = fn(a, b) { a + b };
+let ch = channel();
+:save ` + file + `
+:reset
+:load ` + file + `
+add(twice(2), 1)
+`
+	var out bytes.Buffer
+	Start(strings.NewReader(input), &out)
+
+	expected := ">> >> >> >> cannot save ch\n>> >> >> 5\n>> "
+	if out.String() != expected {
+		t.Errorf("unexpected output. expected=%q, got=%q", expected, out.String())
+	}
+}
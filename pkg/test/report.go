@@ -0,0 +1,106 @@
+package test
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// WriteText writes failed tests with their messages followed by a summary,
+// passed tests are listed only when verbose is set.
+func WriteText(w io.Writer, results []Result, verbose bool) error {
+	failed := 0
+	for _, r := range results {
+		status := "PASS"
+		if !r.Passed() {
+			status = "FAIL"
+			failed++
+		} else if !verbose {
+			continue
+		}
+		if _, err := fmt.Fprintf(w, "--- %s: %s (%s:%s, %.3fs)\n", status, r.Name, r.File, r.Pos, r.Duration.Seconds()); err != nil {
+			return err
+		}
+		if r.Passed() {
+			continue
+		}
+		for _, line := range strings.Split(r.Failure, "\n") {
+			if _, err := fmt.Fprintf(w, "    %s\n", line); err != nil {
+				return err
+			}
+		}
+	}
+
+	var err error
+	if failed > 0 {
+		_, err = fmt.Fprintf(w, "FAIL: %d of %d tests failed\n", failed, len(results))
+	} else {
+		_, err = fmt.Fprintf(w, "PASS: %d tests\n", len(results))
+	}
+	return err
+}
+
+type junitSuites struct {
+	XMLName xml.Name     `xml:"testsuites"`
+	Suites  []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Time     string      `xml:"time,attr"`
+	Cases    []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// WriteJUnit writes the results in the JUnit XML format with a test suite
+// for each file.
+func WriteJUnit(w io.Writer, results []Result) error {
+	var suites junitSuites
+	index := make(map[string]int)
+	var seconds []float64
+	for _, r := range results {
+		i, ok := index[r.File]
+		if !ok {
+			i = len(suites.Suites)
+			index[r.File] = i
+			suites.Suites = append(suites.Suites, junitSuite{Name: r.File})
+			seconds = append(seconds, 0)
+		}
+		suite := &suites.Suites[i]
+		c := junitCase{Name: r.Name, Classname: r.File, Time: fmt.Sprintf("%.3f", r.Duration.Seconds())}
+		if !r.Passed() {
+			message := strings.SplitN(r.Failure, "\n", 2)[0]
+			c.Failure = &junitFailure{Message: message, Text: fmt.Sprintf("%s:%s\n%s", r.File, r.Pos, r.Failure)}
+			suite.Failures++
+		}
+		suite.Tests++
+		suite.Cases = append(suite.Cases, c)
+		seconds[i] += r.Duration.Seconds()
+		suite.Time = fmt.Sprintf("%.3f", seconds[i])
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	e := xml.NewEncoder(w)
+	e.Indent("", "  ")
+	if err := e.Encode(suites); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,157 @@
+// Package test runs tests written in Monkey. Test files end with _test.mk
+// and tests are top-level functions named test_*, failures are reported by
+// the assert and assert_eq builtins or any other runtime error.
+package test
+
+import (
+	"errors"
+	"fmt"
+	"github.com/alenkacz/interpreter-book/pkg/ast"
+	"github.com/alenkacz/interpreter-book/pkg/eval"
+	"github.com/alenkacz/interpreter-book/pkg/object"
+	"github.com/alenkacz/interpreter-book/pkg/parser"
+	"github.com/alenkacz/interpreter-book/pkg/token"
+	"github.com/alenkacz/interpreter-book/pkg/tokenizer"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// FileSuffix is the suffix of test files
+const FileSuffix = "_test.mk"
+
+// Prefix is the prefix of names of test functions
+const Prefix = "test_"
+
+// Result is the outcome of a single test
+type Result struct {
+	File string
+	Name string
+	Pos  token.Position
+	// Failure is the message of the error failing the test, empty when the
+	// test passed
+	Failure  string
+	Duration time.Duration
+}
+
+func (r Result) Passed() bool {
+	return r.Failure == ""
+}
+
+// Discover returns test files of the paths, directories are searched
+// recursively and files are returned even without the suffix.
+func Discover(paths []string) ([]string, error) {
+	var files []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		err = filepath.Walk(path, func(file string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !info.IsDir() && strings.HasSuffix(file, FileSuffix) {
+				files = append(files, file)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// Tests returns let statements binding test functions of the program in
+// the order of the source.
+func Tests(program *ast.Program) []*ast.LetStatement {
+	var tests []*ast.LetStatement
+	for _, stmt := range program.Statements {
+		let, ok := stmt.(*ast.LetStatement)
+		if !ok || !strings.HasPrefix(let.Name(), Prefix) {
+			continue
+		}
+		if _, ok := let.Value.(*ast.FunctionLiteral); ok {
+			tests = append(tests, let)
+		}
+	}
+	return tests
+}
+
+// Runner runs tests of files
+type Runner struct {
+	// Filter selects tests by their names, all tests are run when nil
+	Filter *regexp.Regexp
+	// Now returns the current time, it can be replaced in tests
+	Now func() time.Time
+}
+
+// RunFile runs tests of the file selected by the filter. Each test runs in
+// a new environment where the whole file is evaluated first, so tests do
+// not share state. The error is returned only when the file cannot be
+// parsed or its macros cannot be expanded.
+func (r *Runner) RunFile(filename string, source string) ([]Result, error) {
+	p := parser.New(tokenizer.New(source))
+	program := p.ParseProgram()
+	if len(p.Errors) != 0 {
+		var messages []string
+		for i, e := range p.Errors {
+			messages = append(messages, fmt.Sprintf("%s:%s: %s", filename, p.ErrorPositions[i], e))
+		}
+		return nil, errors.New(strings.Join(messages, "\n"))
+	}
+	if err := eval.Expand(program); err != nil {
+		return nil, fmt.Errorf("%s:%s", filename, err)
+	}
+	// undefined names fail only the tests evaluating them
+	eval.Resolve(program, nil)
+
+	now := r.Now
+	if now == nil {
+		now = time.Now
+	}
+	var results []Result
+	for _, test := range Tests(program) {
+		if r.Filter != nil && !r.Filter.MatchString(test.Name()) {
+			continue
+		}
+		start := now()
+		failure := run(program, test)
+		results = append(results, Result{
+			File:     filename,
+			Name:     test.Name(),
+			Pos:      test.Pos(),
+			Failure:  failure,
+			Duration: now().Sub(start),
+		})
+	}
+	return results, nil
+}
+
+// run evaluates the program in a new environment and calls the test
+// function, it returns message of the failure
+func run(program *ast.Program, test *ast.LetStatement) string {
+	env := object.NewEnvironment(nil)
+	if err, ok := eval.Eval(program, env).(*object.Error); ok {
+		return "evaluation of the file failed: " + err.Message
+	}
+	call := &ast.CallExpression{
+		Position: test.Pos(),
+		Function: &ast.Identifier{Position: test.Pos(), Name: test.Name()},
+	}
+	result := eval.Eval(call, env)
+	if r, ok := result.(*object.ReturnValue); ok {
+		result = r.Value
+	}
+	if err, ok := result.(*object.Error); ok {
+		return err.Message
+	}
+	return ""
+}
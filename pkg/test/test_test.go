@@ -0,0 +1,170 @@
+package test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+const source = `let counter = [];
+let add = fn(a, b) { a + b };
+let test_add = fn() {
+  assert_eq(add(1, 2), 3);
+  assert(add(1, 1) == 2, "one and one");
+};
+let test_isolated = fn() {
+  let counter = push(counter, 1);
+  assert_eq(len(counter), 1);
+};
+let test_isolated_again = fn() {
+  let counter = push(counter, 1);
+  assert_eq(counter, [1]);
+};
+let test_failing = fn() {
+  assert_eq([add(1, 2), 4], [3, 5]);
+  assert(false);
+};
+let test_error = fn() { missing };
+let helper = fn() { assert(false) };
+`
+
+// clock returns time advancing by a millisecond on each read
+func clock() func() time.Time {
+	now := time.Unix(0, 0)
+	return func() time.Time {
+		now = now.Add(time.Millisecond)
+		return now
+	}
+}
+
+func TestRunFile(t *testing.T) {
+	tests := []struct {
+		filter   string
+		expected []Result
+	}{
+		{"", []Result{
+			{Name: "test_add"},
+			{Name: "test_isolated"},
+			{Name: "test_isolated_again"},
+			{Name: "test_failing", Failure: "assert_eq failed:\n[1]: expected 5, got 4"},
+			{Name: "test_error", Failure: "identifier not found: missing"},
+		}},
+		{"isolated", []Result{
+			{Name: "test_isolated"},
+			{Name: "test_isolated_again"},
+		}},
+		{"^test_add$", []Result{
+			{Name: "test_add"},
+		}},
+	}
+	for _, tt := range tests {
+		r := &Runner{Now: clock()}
+		if tt.filter != "" {
+			r.Filter = regexp.MustCompile(tt.filter)
+		}
+		results, err := r.RunFile("math_test.mk", source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range results {
+			if results[i].File != "math_test.mk" || results[i].Duration != time.Millisecond {
+				t.Errorf("unexpected result %+v", results[i])
+			}
+			results[i] = Result{Name: results[i].Name, Failure: results[i].Failure}
+		}
+		if !reflect.DeepEqual(results, tt.expected) {
+			t.Errorf("filter %q: expected %+v, got %+v", tt.filter, tt.expected, results)
+		}
+	}
+}
+
+func TestRunFileErrors(t *testing.T) {
+	r := &Runner{}
+	if _, err := r.RunFile("bad_test.mk", "let x = ;"); err == nil || !strings.HasPrefix(err.Error(), "bad_test.mk:1:9: ") {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	results, err := r.RunFile("setup_test.mk", "let test_a = fn() { 1 }; missing;")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Failure != "evaluation of the file failed: identifier not found: missing" {
+		t.Errorf("unexpected results %+v", results)
+	}
+}
+
+func TestDiscover(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"a_test.mk", "a.mk", "sub/b_test.mk", "sub/c.txt"} {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := ioutil.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files, err := Discover([]string{dir, filepath.Join(dir, "a.mk")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{filepath.Join(dir, "a_test.mk"), filepath.Join(dir, "sub/b_test.mk"), filepath.Join(dir, "a.mk")}
+	if !reflect.DeepEqual(files, expected) {
+		t.Errorf("expected %v, got %v", expected, files)
+	}
+	if _, err := Discover([]string{filepath.Join(dir, "missing")}); err == nil {
+		t.Errorf("expected error for missing path")
+	}
+}
+
+func TestReports(t *testing.T) {
+	results := []Result{
+		{File: "a_test.mk", Name: "test_a", Duration: 2 * time.Millisecond},
+		{File: "a_test.mk", Name: "test_b", Failure: "assert_eq failed:\nexpected 1, got 2", Duration: time.Millisecond},
+		{File: "b_test.mk", Name: "test_c", Duration: time.Millisecond},
+	}
+	results[1].Pos.Line, results[1].Pos.Column = 3, 1
+
+	var text bytes.Buffer
+	if err := WriteText(&text, results, false); err != nil {
+		t.Fatal(err)
+	}
+	expected := `--- FAIL: test_b (a_test.mk:3:1, 0.001s)
+    assert_eq failed:
+    expected 1, got 2
+FAIL: 1 of 3 tests failed
+`
+	if text.String() != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, text.String())
+	}
+
+	var junit bytes.Buffer
+	if err := WriteJUnit(&junit, results); err != nil {
+		t.Fatal(err)
+	}
+	expected = `<?xml version="1.0" encoding="UTF-8"?>
+<testsuites>
+  <testsuite name="a_test.mk" tests="2" failures="1" time="0.003">
+    <testcase name="test_a" classname="a_test.mk" time="0.002"></testcase>
+    <testcase name="test_b" classname="a_test.mk" time="0.001">
+      <failure message="assert_eq failed:">a_test.mk:3:1&#xA;assert_eq failed:&#xA;expected 1, got 2</failure>
+    </testcase>
+  </testsuite>
+  <testsuite name="b_test.mk" tests="1" failures="0" time="0.001">
+    <testcase name="test_c" classname="b_test.mk" time="0.001"></testcase>
+  </testsuite>
+</testsuites>
+`
+	if junit.String() != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, junit.String())
+	}
+}
@@ -1,13 +1,17 @@
 package token
 
+import "fmt"
+
 type TokenType string
 
 const (
 	ILLEGAL = "illegal"
 	EOF = "eof"
+	COMMENT = "comment"
 
 	IDENT = "ident"
 	INT = "int"
+	BIGINT = "bigint"
 	STRING = "string"
 
 	SEMICOLON = ";"
@@ -19,10 +23,14 @@ const (
 	LBRACKET = "["
 	RBRACKET = "]"
 	COMMA = ","
+	COLON = ":"
+	ARROW = "=>"
+	ELLIPSIS = "..."
 	PLUS = "+"
 	MINUS = "-"
 	SLASH = "/"
 	ASTERISK = "*"
+	PERCENT = "%"
 	BANG = "!"
 	LT = "<"
 	GT = ">"
@@ -37,21 +45,51 @@ const (
 	RETURN = "return"
 	TRUE = "true"
 	FALSE = "false"
+	MACRO = "macro"
+	MATCH = "match"
 )
 
 var keywords = map[string]Token {
-	"let": Token{LET, "let"},
-	"fn": Token{FUNC, "fn"},
-	"if": Token{IF, "if"},
-	"else": Token{ELSE, "else"},
-	"return": Token{RETURN, "return"},
-	"true": Token{TRUE, "true"},
-	"false": Token{FALSE, "false"},
+	"let": Token{Type: LET, Literal: "let"},
+	"fn": Token{Type: FUNC, Literal: "fn"},
+	"if": Token{Type: IF, Literal: "if"},
+	"else": Token{Type: ELSE, Literal: "else"},
+	"return": Token{Type: RETURN, Literal: "return"},
+	"true": Token{Type: TRUE, Literal: "true"},
+	"false": Token{Type: FALSE, Literal: "false"},
+	"macro": Token{Type: MACRO, Literal: "macro"},
+	"match": Token{Type: MATCH, Literal: "match"},
 }
 
 type Token struct {
 	Type TokenType
 	Literal string
+	Pos Position
+}
+
+// Position is line and column of the first character of a token, both
+// starting at 1. Zero Position means the position is not known.
+type Position struct {
+	Line int
+	Column int
+}
+
+func (p Position) String() string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
+}
+
+// Before reports whether p is located in front of other
+func (p Position) Before(other Position) bool {
+	return p.Line < other.Line || (p.Line == other.Line && p.Column < other.Column)
+}
+
+// Keywords returns all keywords of the language
+func Keywords() []string {
+	result := make([]string, 0, len(keywords))
+	for k := range keywords {
+		result = append(result, k)
+	}
+	return result
 }
 
 func GetKeyword(token string) *Token {
@@ -3,6 +3,7 @@ package tokenizer
 import (
 	"bytes"
 	"github.com/alenkacz/interpreter-book/pkg/token"
+	"strings"
 )
 
 type Tokenizer struct {
@@ -10,15 +11,26 @@ type Tokenizer struct {
 
 	nextPos     int
 	currentChar byte
+
+	// position of currentChar
+	line   int
+	column int
+
+	comments []token.Token
 }
 
 func New(input string) *Tokenizer {
-	t := &Tokenizer{input: input}
+	t := &Tokenizer{input: input, line: 1}
 	t.readChar()
 	return t
 }
 
 func (t *Tokenizer) readChar() {
+	if t.currentChar == '\n' {
+		t.line++
+		t.column = 0
+	}
+	t.column++
 	if t.nextPos >= len(t.input) {
 		t.currentChar = 0 // ascii code for NUL
 	} else {
@@ -27,6 +39,14 @@ func (t *Tokenizer) readChar() {
 	t.nextPos += 1
 }
 
+// peekCharAt returns the character following the next one by offset
+func (t *Tokenizer) peekCharAt(offset int) byte {
+	if t.nextPos+offset >= len(t.input) {
+		return 0 // ascii code for NUL
+	}
+	return t.input[t.nextPos+offset]
+}
+
 func (t *Tokenizer) peekChar() byte {
 	if t.nextPos >= len(t.input) {
 		return 0 // ascii code for NUL
@@ -35,62 +55,114 @@ func (t *Tokenizer) peekChar() byte {
 	}
 }
 
+// skipWhitespace skips whitespace and comments, comments are collected so
+// that tools like formatter can keep them
 func (t *Tokenizer) skipWhitespace() {
-	for t.currentChar == ' ' || t.currentChar == '\t' || t.currentChar == '\n' || t.currentChar == '\r' {
+	for {
+		switch {
+		case t.currentChar == ' ' || t.currentChar == '\t' || t.currentChar == '\n' || t.currentChar == '\r':
+			t.readChar()
+		case t.currentChar == '/' && t.peekChar() == '/':
+			t.readComment()
+		default:
+			return
+		}
+	}
+}
+
+func (t *Tokenizer) readComment() {
+	pos := t.position()
+	start := t.nextPos - 1
+	for t.currentChar != '\n' && t.currentChar != 0 {
 		t.readChar()
 	}
+	end := t.nextPos - 1
+	if end > len(t.input) {
+		end = len(t.input)
+	}
+	text := strings.TrimRight(t.input[start:end], " \t\r")
+	t.comments = append(t.comments, token.Token{Type: token.COMMENT, Literal: text, Pos: pos})
+}
+
+// Comments returns comments read so far, in the order of appearance
+func (t *Tokenizer) Comments() []token.Token {
+	return t.comments
+}
+
+func (t *Tokenizer) position() token.Position {
+	return token.Position{Line: t.line, Column: t.column}
 }
 
 func (t *Tokenizer) NextToken() token.Token {
 	result := token.Token{}
 	t.skipWhitespace()
+	pos := t.position()
 
 	switch t.currentChar {
 	case '=':
 		if t.peekChar() == '=' {
 			t.readChar()
-			result = token.Token{token.EQ, "=="}
+			result = token.Token{Type: token.EQ, Literal: "=="}
+		} else if t.peekChar() == '>' {
+			t.readChar()
+			result = token.Token{Type: token.ARROW, Literal: "=>"}
 		} else {
-			result = token.Token{token.ASSIGN, "="}
+			result = token.Token{Type: token.ASSIGN, Literal: "="}
 		}
 	case '!':
 		if t.peekChar() == '=' {
 			t.readChar()
-			result = token.Token{token.NOTEQ, "!="}
+			result = token.Token{Type: token.NOTEQ, Literal: "!="}
 		} else {
-			result = token.Token{token.BANG, "!"}
+			result = token.Token{Type: token.BANG, Literal: "!"}
 		}
 	case ';':
-		result = token.Token{token.SEMICOLON, ";"}
+		result = token.Token{Type: token.SEMICOLON, Literal: ";"}
 	case '(':
-		result = token.Token{token.LPAREN, "("}
+		result = token.Token{Type: token.LPAREN, Literal: "("}
 	case ')':
-		result = token.Token{token.RPAREN, ")"}
+		result = token.Token{Type: token.RPAREN, Literal: ")"}
 	case '{':
-		result = token.Token{token.LBRACE, "{"}
+		result = token.Token{Type: token.LBRACE, Literal: "{"}
 	case '}':
-		result = token.Token{token.RBRACE, "}"}
+		result = token.Token{Type: token.RBRACE, Literal: "}"}
 	case '[':
-		result = token.Token{token.LBRACKET, "["}
+		result = token.Token{Type: token.LBRACKET, Literal: "["}
 	case ']':
-		result = token.Token{token.RBRACKET, "]"}
+		result = token.Token{Type: token.RBRACKET, Literal: "]"}
 	case ',':
-		result = token.Token{token.COMMA, ","}
+		result = token.Token{Type: token.COMMA, Literal: ","}
+	case ':':
+		result = token.Token{Type: token.COLON, Literal: ":"}
+	case '.':
+		if t.peekChar() == '.' && t.peekCharAt(1) == '.' {
+			t.readChar()
+			t.readChar()
+			result = token.Token{Type: token.ELLIPSIS, Literal: "..."}
+		} else {
+			result = token.Token{Type: token.ILLEGAL, Literal: "."}
+		}
 	case '+':
-		result = token.Token{token.PLUS, "+"}
+		result = token.Token{Type: token.PLUS, Literal: "+"}
 	case '-':
-		result = token.Token{token.MINUS, "-"}
+		result = token.Token{Type: token.MINUS, Literal: "-"}
 	case '/':
-		result = token.Token{token.SLASH, "/"}
+		result = token.Token{Type: token.SLASH, Literal: "/"}
 	case '*':
-		result = token.Token{token.ASTERISK, "*"}
+		result = token.Token{Type: token.ASTERISK, Literal: "*"}
+	case '%':
+		result = token.Token{Type: token.PERCENT, Literal: "%"}
 	case '<':
-		result = token.Token{token.LT, "<"}
+		result = token.Token{Type: token.LT, Literal: "<"}
 	case '>':
-		result = token.Token{token.GT, ">"}
+		result = token.Token{Type: token.GT, Literal: ">"}
 	case '"':
-		str := t.readString()
-		result = token.Token{ token.STRING, str}
+		str, terminated := t.readString()
+		if terminated {
+			result = token.Token{Type: token.STRING, Literal: str}
+		} else {
+			result = token.Token{Type: token.ILLEGAL, Literal: "\"" + str}
+		}
 	case 0:
 		result = token.Token{Type: token.EOF}
 	default:
@@ -101,11 +173,17 @@ func (t *Tokenizer) NextToken() token.Token {
 			if keyword != nil {
 				result = *keyword
 			} else {
-				result = token.Token{token.IDENT, literal}
+				result = token.Token{Type: token.IDENT, Literal: literal}
 			}
 		} else if isNumber(t.currentChar) {
 			number := t.readWhole(isNumber)
-			result = token.Token{token.INT, number}
+			if t.peekChar() == 'n' {
+				// 123n is an arbitrary-precision integer literal
+				t.readChar()
+				result = token.Token{Type: token.BIGINT, Literal: number}
+			} else {
+				result = token.Token{Type: token.INT, Literal: number}
+			}
 		} else {
 			result = token.Token{Type: token.ILLEGAL}
 		}
@@ -113,16 +191,22 @@ func (t *Tokenizer) NextToken() token.Token {
 
 	t.readChar()
 
+	result.Pos = pos
 	return result
 }
 
-func (t *Tokenizer) readString() string {
+// readString reads string literal up to the closing quote, it returns false
+// when the input ends before the string is terminated
+func (t *Tokenizer) readString() (string, bool) {
 	// TODO support escape sequences
 	var out bytes.Buffer
 	for {
+		if t.peekChar() == 0 {
+			return out.String(), false
+		}
 		t.readChar()
 		if t.currentChar == '"' {
-			return out.String()
+			return out.String(), true
 		}
 		out.WriteByte(t.currentChar)
 	}
@@ -27,98 +27,185 @@ if (5 < 10) {
 10 != 9;
 "aaa";
 [1, 2];
+10 % 3;
+12n;
+match (x) { [a, ...r] => a }
 `
 
  result := []token.Token{
-	 {token.LET, "let"},
-	 {token.IDENT, "five"},
-	 {token.ASSIGN, "="},
-	 {token.INT, "5"},
-	 {token.SEMICOLON, ";"},
-	 {token.LET, "let"},
-	 {token.IDENT, "ten"},
-	 {token.ASSIGN, "="},
-	 {token.INT, "10"},
-	 {token.SEMICOLON, ";"},
-	 {token.LET, "let"},
-	 {token.IDENT, "add"},
-	 {token.ASSIGN, "="},
-	 {token.FUNC, "fn"},
-	 {token.LPAREN, "("},
-	 {token.IDENT, "x"},
-	 {token.COMMA, ","},
-	 {token.IDENT, "y"},
-	 {token.RPAREN, ")"},
-	 {token.LBRACE, "{"},
-	 {token.IDENT, "x"},
-	 {token.PLUS, "+"},
-	 {token.IDENT, "y"},
-	 {token.SEMICOLON, ";"},
-	 {token.RBRACE, "}"},
-	 {token.SEMICOLON, ";"},
-	 {token.LET, "let"},
-	 {token.IDENT, "result"},
-	 {token.ASSIGN, "="},
-	 {token.IDENT, "add"},
-	 {token.LPAREN, "("},
-	 {token.IDENT, "five"},
-	 {token.COMMA, ","},
-	 {token.IDENT, "ten"},
-	 {token.RPAREN, ")"},
-	 {token.SEMICOLON, ";"},
-	 {token.BANG, "!"},
-	 {token.MINUS, "-"},
-	 {token.SLASH, "/"},
-	 {token.ASTERISK, "*"},
-	 {token.INT, "5"},
-	 {token.SEMICOLON, ";"},
-	 {token.INT, "5"},
-	 {token.LT, "<"},
-	 {token.INT, "10"},
-	 {token.GT, ">"},
-	 {token.INT, "5"},
-	 {token.SEMICOLON, ";"},
-	 {token.IF, "if"},
-	 {token.LPAREN, "("},
-	 {token.INT, "5"},
-	 {token.LT, "<"},
-	 {token.INT, "10"},
-	 {token.RPAREN, ")"},
-	 {token.LBRACE, "{"},
-	 {token.RETURN, "return"},
-	 {token.TRUE, "true"},
-	 {token.SEMICOLON, ";"},
-	 {token.RBRACE, "}"},
-	 {token.ELSE, "else"},
-	 {token.LBRACE, "{"},
-	 {token.RETURN, "return"},
-	 {token.FALSE, "false"},
-	 {token.SEMICOLON, ";"},
-	 {token.RBRACE, "}"},
-	 {token.INT, "10"},
-	 {token.EQ, "=="},
-	 {token.INT, "10"},
-	 {token.SEMICOLON, ";"},
-	 {token.INT, "10"},
-	 {token.NOTEQ, "!="},
-	 {token.INT, "9"},
-	 {token.SEMICOLON, ";"},
-	 {token.STRING, "aaa"},
-	 {token.SEMICOLON, ";"},
-	 {token.LBRACKET, "["},
-	 {token.INT, "1"},
-	 {token.COMMA, ","},
-	 {token.INT, "2"},
-	 {token.RBRACKET, "]"},
-	 {token.SEMICOLON, ";"},
-	 {token.EOF, ""},
+	 {Type: token.LET, Literal: "let"},
+	 {Type: token.IDENT, Literal: "five"},
+	 {Type: token.ASSIGN, Literal: "="},
+	 {Type: token.INT, Literal: "5"},
+	 {Type: token.SEMICOLON, Literal: ";"},
+	 {Type: token.LET, Literal: "let"},
+	 {Type: token.IDENT, Literal: "ten"},
+	 {Type: token.ASSIGN, Literal: "="},
+	 {Type: token.INT, Literal: "10"},
+	 {Type: token.SEMICOLON, Literal: ";"},
+	 {Type: token.LET, Literal: "let"},
+	 {Type: token.IDENT, Literal: "add"},
+	 {Type: token.ASSIGN, Literal: "="},
+	 {Type: token.FUNC, Literal: "fn"},
+	 {Type: token.LPAREN, Literal: "("},
+	 {Type: token.IDENT, Literal: "x"},
+	 {Type: token.COMMA, Literal: ","},
+	 {Type: token.IDENT, Literal: "y"},
+	 {Type: token.RPAREN, Literal: ")"},
+	 {Type: token.LBRACE, Literal: "{"},
+	 {Type: token.IDENT, Literal: "x"},
+	 {Type: token.PLUS, Literal: "+"},
+	 {Type: token.IDENT, Literal: "y"},
+	 {Type: token.SEMICOLON, Literal: ";"},
+	 {Type: token.RBRACE, Literal: "}"},
+	 {Type: token.SEMICOLON, Literal: ";"},
+	 {Type: token.LET, Literal: "let"},
+	 {Type: token.IDENT, Literal: "result"},
+	 {Type: token.ASSIGN, Literal: "="},
+	 {Type: token.IDENT, Literal: "add"},
+	 {Type: token.LPAREN, Literal: "("},
+	 {Type: token.IDENT, Literal: "five"},
+	 {Type: token.COMMA, Literal: ","},
+	 {Type: token.IDENT, Literal: "ten"},
+	 {Type: token.RPAREN, Literal: ")"},
+	 {Type: token.SEMICOLON, Literal: ";"},
+	 {Type: token.BANG, Literal: "!"},
+	 {Type: token.MINUS, Literal: "-"},
+	 {Type: token.SLASH, Literal: "/"},
+	 {Type: token.ASTERISK, Literal: "*"},
+	 {Type: token.INT, Literal: "5"},
+	 {Type: token.SEMICOLON, Literal: ";"},
+	 {Type: token.INT, Literal: "5"},
+	 {Type: token.LT, Literal: "<"},
+	 {Type: token.INT, Literal: "10"},
+	 {Type: token.GT, Literal: ">"},
+	 {Type: token.INT, Literal: "5"},
+	 {Type: token.SEMICOLON, Literal: ";"},
+	 {Type: token.IF, Literal: "if"},
+	 {Type: token.LPAREN, Literal: "("},
+	 {Type: token.INT, Literal: "5"},
+	 {Type: token.LT, Literal: "<"},
+	 {Type: token.INT, Literal: "10"},
+	 {Type: token.RPAREN, Literal: ")"},
+	 {Type: token.LBRACE, Literal: "{"},
+	 {Type: token.RETURN, Literal: "return"},
+	 {Type: token.TRUE, Literal: "true"},
+	 {Type: token.SEMICOLON, Literal: ";"},
+	 {Type: token.RBRACE, Literal: "}"},
+	 {Type: token.ELSE, Literal: "else"},
+	 {Type: token.LBRACE, Literal: "{"},
+	 {Type: token.RETURN, Literal: "return"},
+	 {Type: token.FALSE, Literal: "false"},
+	 {Type: token.SEMICOLON, Literal: ";"},
+	 {Type: token.RBRACE, Literal: "}"},
+	 {Type: token.INT, Literal: "10"},
+	 {Type: token.EQ, Literal: "=="},
+	 {Type: token.INT, Literal: "10"},
+	 {Type: token.SEMICOLON, Literal: ";"},
+	 {Type: token.INT, Literal: "10"},
+	 {Type: token.NOTEQ, Literal: "!="},
+	 {Type: token.INT, Literal: "9"},
+	 {Type: token.SEMICOLON, Literal: ";"},
+	 {Type: token.STRING, Literal: "aaa"},
+	 {Type: token.SEMICOLON, Literal: ";"},
+	 {Type: token.LBRACKET, Literal: "["},
+	 {Type: token.INT, Literal: "1"},
+	 {Type: token.COMMA, Literal: ","},
+	 {Type: token.INT, Literal: "2"},
+	 {Type: token.RBRACKET, Literal: "]"},
+	 {Type: token.SEMICOLON, Literal: ";"},
+	 {Type: token.INT, Literal: "10"},
+	 {Type: token.PERCENT, Literal: "%"},
+	 {Type: token.INT, Literal: "3"},
+	 {Type: token.SEMICOLON, Literal: ";"},
+	 {Type: token.BIGINT, Literal: "12"},
+	 {Type: token.SEMICOLON, Literal: ";"},
+	 {Type: token.MATCH, Literal: "match"},
+	 {Type: token.LPAREN, Literal: "("},
+	 {Type: token.IDENT, Literal: "x"},
+	 {Type: token.RPAREN, Literal: ")"},
+	 {Type: token.LBRACE, Literal: "{"},
+	 {Type: token.LBRACKET, Literal: "["},
+	 {Type: token.IDENT, Literal: "a"},
+	 {Type: token.COMMA, Literal: ","},
+	 {Type: token.ELLIPSIS, Literal: "..."},
+	 {Type: token.IDENT, Literal: "r"},
+	 {Type: token.RBRACKET, Literal: "]"},
+	 {Type: token.ARROW, Literal: "=>"},
+	 {Type: token.IDENT, Literal: "a"},
+	 {Type: token.RBRACE, Literal: "}"},
+	 {Type: token.EOF, Literal: ""},
  }
 
  	tokenizer := New(input)
 	for i, expected := range result {
 		tok := tokenizer.NextToken()
-		if expected != tok {
+		if expected.Type != tok.Type || expected.Literal != tok.Literal {
 			t.Errorf("%d: Expecting token %v but got %v", i, expected, tok)
 		}
 	}
 }
+
+func TestUnterminatedString(t *testing.T) {
+	tokenizer := New(`let a = "abc`)
+	expected := []token.Token{
+		{Type: token.LET, Literal: "let"},
+		{Type: token.IDENT, Literal: "a"},
+		{Type: token.ASSIGN, Literal: "="},
+		{Type: token.ILLEGAL, Literal: "\"abc"},
+		{Type: token.EOF, Literal: ""},
+	}
+	for i, e := range expected {
+		tok := tokenizer.NextToken()
+		if e.Type != tok.Type || e.Literal != tok.Literal {
+			t.Errorf("%d: Expecting token %v but got %v", i, e, tok)
+		}
+	}
+}
+
+func TestPositionsAndComments(t *testing.T) {
+	input := `// adds numbers
+let add = fn(x, y) {
+  x + y; // trailing
+};
+`
+	tokenizer := New(input)
+	expected := []token.Token{
+		{Type: token.LET, Literal: "let", Pos: token.Position{Line: 2, Column: 1}},
+		{Type: token.IDENT, Literal: "add", Pos: token.Position{Line: 2, Column: 5}},
+		{Type: token.ASSIGN, Literal: "=", Pos: token.Position{Line: 2, Column: 9}},
+		{Type: token.FUNC, Literal: "fn", Pos: token.Position{Line: 2, Column: 11}},
+		{Type: token.LPAREN, Literal: "(", Pos: token.Position{Line: 2, Column: 13}},
+		{Type: token.IDENT, Literal: "x", Pos: token.Position{Line: 2, Column: 14}},
+		{Type: token.COMMA, Literal: ",", Pos: token.Position{Line: 2, Column: 15}},
+		{Type: token.IDENT, Literal: "y", Pos: token.Position{Line: 2, Column: 17}},
+		{Type: token.RPAREN, Literal: ")", Pos: token.Position{Line: 2, Column: 18}},
+		{Type: token.LBRACE, Literal: "{", Pos: token.Position{Line: 2, Column: 20}},
+		{Type: token.IDENT, Literal: "x", Pos: token.Position{Line: 3, Column: 3}},
+		{Type: token.PLUS, Literal: "+", Pos: token.Position{Line: 3, Column: 5}},
+		{Type: token.IDENT, Literal: "y", Pos: token.Position{Line: 3, Column: 7}},
+		{Type: token.SEMICOLON, Literal: ";", Pos: token.Position{Line: 3, Column: 8}},
+		{Type: token.RBRACE, Literal: "}", Pos: token.Position{Line: 4, Column: 1}},
+		{Type: token.SEMICOLON, Literal: ";", Pos: token.Position{Line: 4, Column: 2}},
+		{Type: token.EOF, Literal: "", Pos: token.Position{Line: 5, Column: 1}},
+	}
+	for i, e := range expected {
+		tok := tokenizer.NextToken()
+		if e != tok {
+			t.Errorf("%d: Expecting token %v but got %v", i, e, tok)
+		}
+	}
+
+	comments := []token.Token{
+		{Type: token.COMMENT, Literal: "// adds numbers", Pos: token.Position{Line: 1, Column: 1}},
+		{Type: token.COMMENT, Literal: "// trailing", Pos: token.Position{Line: 3, Column: 10}},
+	}
+	if len(tokenizer.Comments()) != len(comments) {
+		t.Fatalf("expected %d comments, got %v", len(comments), tokenizer.Comments())
+	}
+	for i, c := range comments {
+		if c != tokenizer.Comments()[i] {
+			t.Errorf("%d: Expecting comment %v but got %v", i, c, tokenizer.Comments()[i])
+		}
+	}
+}
@@ -0,0 +1,466 @@
+// Package typecheck implements static type checking of optionally annotated
+// Monkey programs. Types of unannotated bindings are inferred from their
+// values, expressions whose type cannot be inferred get type any which is
+// never reported. Arrays and hashes are not typed by their elements.
+package typecheck
+
+import (
+	"fmt"
+	"github.com/alenkacz/interpreter-book/pkg/ast"
+	"github.com/alenkacz/interpreter-book/pkg/token"
+	"sort"
+)
+
+type Error struct {
+	Pos     token.Position
+	Message string
+}
+
+func (e Error) String() string {
+	return fmt.Sprintf("%s: %s", e.Pos, e.Message)
+}
+
+var builtins = map[string]Type{
+	"len":       &Function{Params: []Type{Any}, Return: Int},
+	"first":     &Function{Params: []Type{Array}, Return: Any},
+	"last":      &Function{Params: []Type{Array}, Return: Any},
+	"rest":      &Function{Params: []Type{Array}, Return: Array},
+	"push":      &Function{Params: []Type{Array, Any}, Return: Array},
+	"assert":    &Function{Params: []Type{Any, Any}, Optional: 1, Return: Null},
+	"assert_eq": &Function{Params: []Type{Any, Any}, Return: Null},
+	"spawn":     &Function{Params: []Type{anyFunction, Array}, Variadic: true, Return: Any},
+	"await":     &Function{Params: []Type{Any}, Return: Any},
+	"channel":   &Function{Params: []Type{Int}, Optional: 1, Return: Any},
+	"send":      &Function{Params: []Type{Any, Any}, Return: Null},
+	"recv":      &Function{Params: []Type{Any}, Return: Any},
+	"close":     &Function{Params: []Type{Any}, Return: Null},
+	"select":    &Function{Params: []Type{Array, Array}, Variadic: true, Return: Array},
+}
+
+type scope struct {
+	outer *scope
+	types map[string]Type
+}
+
+func (s *scope) lookup(name string) Type {
+	for current := s; current != nil; current = current.outer {
+		if t, ok := current.types[name]; ok {
+			return t
+		}
+	}
+	if t, ok := builtins[name]; ok {
+		return t
+	}
+	return Any
+}
+
+// function holds state of the function literal being checked
+type function struct {
+	returnType Type
+	// join of types of all return statements
+	returned Type
+}
+
+type checker struct {
+	errors []Error
+	fn     *function
+	// types of let bindings and parameters by position of their names
+	bindings map[token.Position]Type
+}
+
+func check(program *ast.Program) *checker {
+	c := &checker{bindings: make(map[token.Position]Type)}
+	s := &scope{types: make(map[string]Type)}
+	c.statements(program.Statements, s)
+	return c
+}
+
+// Check returns type errors of the program ordered by position.
+func Check(program *ast.Program) []Error {
+	c := check(program)
+	sort.SliceStable(c.errors, func(i, j int) bool {
+		return c.errors[i].Pos.Before(c.errors[j].Pos)
+	})
+	return c.errors
+}
+
+// Bindings returns types of let bindings and function parameters of the
+// program keyed by positions of their names.
+func Bindings(program *ast.Program) map[token.Position]Type {
+	return check(program).bindings
+}
+
+func (c *checker) report(pos token.Position, format string, args ...interface{}) {
+	c.errors = append(c.errors, Error{Pos: pos, Message: fmt.Sprintf(format, args...)})
+}
+
+func (c *checker) annotation(t *ast.TypeAnnotation) Type {
+	if t == nil {
+		return nil
+	}
+	typ, ok := typeNames[t.Name]
+	if !ok {
+		c.report(t.Position, "unknown type %s", t.Name)
+		return Any
+	}
+	return typ
+}
+
+// statements checks the statements and returns type of the last one, which
+// is the value of a block
+func (c *checker) statements(statements []ast.Statement, s *scope) Type {
+	var result Type = Null
+	for _, stmt := range statements {
+		result = c.statement(stmt, s)
+	}
+	return result
+}
+
+func (c *checker) statement(stmt ast.Statement, s *scope) Type {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		if stmt.Pattern != nil {
+			c.destructure(stmt.Pattern, c.expression(stmt.Value, s), s)
+			return Null
+		}
+		declared := c.annotation(stmt.Type)
+		if fn, ok := stmt.Value.(*ast.FunctionLiteral); ok && declared == nil {
+			// declare the signature before checking the body so that
+			// recursive calls are checked too
+			s.types[stmt.Name()] = c.signature(fn)
+		}
+		value := c.expression(stmt.Value, s)
+		if declared != nil {
+			if !assignable(value, declared) {
+				c.report(stmt.Value.Pos(), "cannot use %s as %s in let %s", value, declared, stmt.Name())
+			}
+			s.types[stmt.Name()] = declared
+		} else {
+			s.types[stmt.Name()] = value
+		}
+		c.bindings[stmt.Identifier.Pos] = s.types[stmt.Name()]
+		return Null
+	case *ast.ReturnStatement:
+		value := c.expression(stmt.ReturnValue, s)
+		if c.fn != nil {
+			c.checkReturn(stmt.ReturnValue, value)
+			c.fn.returned = join(c.fn.returned, value)
+		}
+		return never
+	case *ast.ExpressionStatement:
+		return c.expression(stmt.Expression, s)
+	case *ast.BlockStatement:
+		return c.statements(stmt.Statements, s)
+	}
+	return Any
+}
+
+func (c *checker) checkReturn(exp ast.Expression, value Type) {
+	if c.fn.returnType != nil && !assignable(value, c.fn.returnType) {
+		c.report(exp.Pos(), "cannot return %s from function returning %s", value, c.fn.returnType)
+	}
+}
+
+// signature returns function type declared by annotations of the literal
+func (c *checker) signature(fn *ast.FunctionLiteral) *Function {
+	params := make([]Type, len(fn.Params))
+	optional := 0
+	for i := range fn.Params {
+		params[i] = Any
+		if fn.Variadic && i == len(fn.Params)-1 {
+			params[i] = Array
+		}
+		if t := fn.ParamType(i); t != nil {
+			if typ, ok := typeNames[t.Name]; ok {
+				params[i] = typ
+			}
+		}
+		if fn.ParamDefault(i) != nil {
+			optional++
+		}
+	}
+	var ret Type = Any
+	if fn.ReturnType != nil {
+		if typ, ok := typeNames[fn.ReturnType.Name]; ok {
+			ret = typ
+		}
+	}
+	return &Function{Params: params, Optional: optional, Variadic: fn.Variadic, Return: ret}
+}
+
+func (c *checker) expression(exp ast.Expression, s *scope) Type {
+	switch exp := exp.(type) {
+	case *ast.IntegerLiteral:
+		return Int
+	case *ast.BigIntegerLiteral:
+		return BigInt
+	case *ast.StringLiteral:
+		return Str
+	case *ast.Boolean:
+		return Bool
+	case *ast.Array:
+		for _, item := range exp.Items {
+			c.expression(item, s)
+		}
+		return Array
+	case *ast.Identifier:
+		return s.lookup(exp.Name)
+	case *ast.PrefixExpression:
+		right := c.expression(exp.Right, s)
+		switch exp.Operator {
+		case "!":
+			return Bool
+		case "-":
+			if right != Any && !isInteger(right) {
+				c.report(exp.Position, "operator - not defined on %s", right)
+				return Any
+			}
+			return right
+		}
+		return Any
+	case *ast.InfixExpression:
+		return c.infix(exp, c.expression(exp.Left, s), c.expression(exp.Right, s))
+	case *ast.IfExpression:
+		c.expression(exp.Condition, s)
+		consequence := c.statement(exp.Block, s)
+		if exp.Alternative == nil {
+			return join(consequence, Null)
+		}
+		return join(consequence, c.statement(exp.Alternative, s))
+	case *ast.IndexExpression:
+		left := c.expression(exp.Left, s)
+		index := c.expression(exp.Index, s)
+		switch left {
+		case Any:
+		case Array:
+			if index != Any && index != Int {
+				c.report(exp.Index.Pos(), "array index must be int, got %s", index)
+			}
+		case Hash:
+			c.hashKey(exp.Index, index)
+		default:
+			c.report(exp.Position, "index operator not defined on %s", left)
+		}
+		return Any
+	case *ast.HashLiteral:
+		for _, pair := range exp.Pairs {
+			c.hashKey(pair.Key, c.expression(pair.Key, s))
+			c.expression(pair.Value, s)
+		}
+		return Hash
+	case *ast.MatchExpression:
+		return c.match(exp, s)
+	case *ast.FunctionLiteral:
+		return c.functionLiteral(exp, s)
+	case *ast.CallExpression:
+		return c.call(exp, s)
+	}
+	return Any
+}
+
+func (c *checker) hashKey(key ast.Expression, t Type) {
+	if t != Any && t != Int && t != BigInt && t != Str && t != Bool {
+		c.report(key.Pos(), "unusable as hash key: %s", t)
+	}
+}
+
+// match checks arms of the match expression each in its own scope, its type
+// is the join of types of the bodies
+func (c *checker) match(match *ast.MatchExpression, s *scope) Type {
+	value := c.expression(match.Value, s)
+	var result Type
+	for _, arm := range match.Arms {
+		inner := &scope{outer: s, types: make(map[string]Type)}
+		c.pattern(arm.Pattern, value, inner)
+		if arm.Guard != nil {
+			c.expression(arm.Guard, inner)
+		}
+		result = join(result, c.expression(arm.Body, inner))
+	}
+	if result == nil {
+		return Any
+	}
+	return result
+}
+
+// destructure checks that the value of type t can be destructured by the
+// pattern of a let statement or a parameter and declares its names
+func (c *checker) destructure(pattern ast.Pattern, t Type, s *scope) {
+	switch pattern.(type) {
+	case *ast.ArrayPattern:
+		if t != Any && t != Array {
+			c.report(pattern.Pos(), "cannot destructure %s with array pattern", t)
+		}
+	case *ast.HashPattern:
+		if t != Any && t != Hash {
+			c.report(pattern.Pos(), "cannot destructure %s with hash pattern", t)
+		}
+	}
+	c.pattern(pattern, t, s)
+}
+
+// pattern declares names bound by the pattern matched against a value of
+// type t, parts of arrays and hashes have type any
+func (c *checker) pattern(pattern ast.Pattern, t Type, s *scope) {
+	switch pattern := pattern.(type) {
+	case *ast.BindingPattern:
+		s.types[pattern.Name] = t
+		c.bindings[pattern.Position] = t
+	case *ast.LiteralPattern:
+		c.expression(pattern.Value, s)
+	case *ast.ArrayPattern:
+		for _, element := range pattern.Elements {
+			c.pattern(element, Any, s)
+		}
+		if pattern.Rest != nil {
+			c.pattern(pattern.Rest, Array, s)
+		}
+	case *ast.HashPattern:
+		for _, pair := range pattern.Pairs {
+			c.pattern(pair.Value, Any, s)
+		}
+	case *ast.DefaultPattern:
+		c.pattern(pattern.Pattern, join(t, c.expression(pattern.Default, s)), s)
+	}
+}
+
+func (c *checker) infix(exp *ast.InfixExpression, left Type, right Type) Type {
+	if left == Any || right == Any {
+		switch exp.Operator {
+		case "==", "!=", "<", ">":
+			return Bool
+		}
+		if exp.Operator == "+" && (left == Str || right == Str) {
+			return Str
+		}
+		return Any
+	}
+
+	switch exp.Operator {
+	case "+":
+		if left == Str && right == Str {
+			return Str
+		}
+		if isInteger(left) && isInteger(right) {
+			return join(left, right)
+		}
+	case "-", "*", "/", "%":
+		if isInteger(left) && isInteger(right) {
+			return join(left, right)
+		}
+	case "<", ">":
+		if isInteger(left) && isInteger(right) {
+			return Bool
+		}
+	case "==", "!=":
+		return Bool
+	}
+	c.report(exp.Position, "operator %s not defined on %s and %s", exp.Operator, left, right)
+	return Any
+}
+
+func (c *checker) functionLiteral(fn *ast.FunctionLiteral, s *scope) Type {
+	signature := c.signature(fn)
+	for i := range fn.Params {
+		c.annotation(fn.ParamType(i))
+	}
+	declaredReturn := c.annotation(fn.ReturnType)
+
+	inner := &scope{outer: s, types: make(map[string]Type)}
+	for i, p := range fn.Params {
+		if fn.Variadic && i == len(fn.Params)-1 && !assignable(Array, signature.Params[i]) {
+			c.report(p.Position, "rest parameter %s must be array, got %s", p.Name, signature.Params[i])
+		}
+		if d := fn.ParamDefault(i); d != nil {
+			// defaults are evaluated after the previous parameters are bound
+			if t := c.expression(d, inner); !assignable(t, signature.Params[i]) {
+				c.report(d.Pos(), "cannot use %s as default value of %s", t, signature.Params[i])
+			}
+		}
+		if pattern := fn.ParamPattern(i); pattern != nil {
+			c.destructure(pattern, signature.Params[i], inner)
+			continue
+		}
+		inner.types[p.Name] = signature.Params[i]
+		c.bindings[p.Position] = signature.Params[i]
+	}
+
+	outerFn := c.fn
+	c.fn = &function{returnType: declaredReturn}
+	last := c.statements(fn.Block.Statements, inner)
+	if n := len(fn.Block.Statements); n > 0 {
+		if stmt, ok := fn.Block.Statements[n-1].(*ast.ExpressionStatement); ok {
+			// value of the last expression is returned implicitly
+			c.checkReturn(stmt.Expression, last)
+			c.fn.returned = join(c.fn.returned, last)
+		}
+	}
+	returned := c.fn.returned
+	c.fn = outerFn
+
+	if declaredReturn != nil {
+		signature.Return = declaredReturn
+	} else if returned != nil {
+		signature.Return = returned
+	} else {
+		signature.Return = Null
+	}
+	return signature
+}
+
+func (c *checker) call(exp *ast.CallExpression, s *scope) Type {
+	args := make([]Type, len(exp.Params))
+	spread, named := false, false
+	for i, p := range exp.Params {
+		switch p := p.(type) {
+		case *ast.SpreadExpression:
+			if t := c.expression(p.Value, s); !assignable(t, Array) {
+				c.report(p.Value.Pos(), "cannot spread %s, expected array", t)
+			}
+			spread = true
+			continue
+		case *ast.NamedArgument:
+			c.expression(p.Value, s)
+			named = true
+			continue
+		}
+		args[i] = c.expression(p, s)
+	}
+
+	callee := s.lookup(exp.Function.Name)
+	if callee == Any {
+		return Any
+	}
+	fn, ok := callee.(*Function)
+	if !ok {
+		c.report(exp.Position, "cannot call %s of type %s", exp.Function.Name, callee)
+		return Any
+	}
+	if fn.Params == nil || spread || named {
+		// spread arrays have unknown length, types of functions do not
+		// record names of parameters
+		return fn.Return
+	}
+	min, max := fn.arity()
+	if len(args) < min || (max >= 0 && len(args) > max) {
+		expected := fmt.Sprintf("%d", min)
+		switch {
+		case max < 0:
+			expected = fmt.Sprintf("at least %d", min)
+		case max > min:
+			expected = fmt.Sprintf("%d to %d", min, max)
+		}
+		c.report(exp.Position, "%s expects %s arguments, got %d", exp.Function.Name, expected, len(args))
+		return fn.Return
+	}
+	for i, arg := range args {
+		if fn.Variadic && i >= len(fn.Params)-1 {
+			// elements of the rest array are not typed
+			break
+		}
+		if !assignable(arg, fn.Params[i]) {
+			c.report(exp.Params[i].Pos(), "cannot use %s as %s in argument %d of %s", arg, fn.Params[i], i+1, exp.Function.Name)
+		}
+	}
+	return fn.Return
+}
@@ -0,0 +1,146 @@
+package typecheck
+
+import (
+	"github.com/alenkacz/interpreter-book/pkg/parser"
+	"github.com/alenkacz/interpreter-book/pkg/token"
+	"github.com/alenkacz/interpreter-book/pkg/tokenizer"
+	"strings"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"let x: int = 1; let y: str = \"a\" + \"b\"; let z: bool = x > 1;", nil},
+		{"let x: int = \"a\";", []string{"1:14: cannot use str as int in let x"}},
+		{"let x: bigint = 1; let y: int = 2n;", []string{"1:33: cannot use bigint as int in let y"}},
+		{"let x: foo = 1;", []string{"1:8: unknown type foo"}},
+		{"let x = 1; let y: str = x;", []string{"1:25: cannot use int as str in let y"}},
+		{"1 + \"a\";", []string{"1:1: operator + not defined on int and str"}},
+		{"\"a\" - \"b\";", []string{"1:1: operator - not defined on str and str"}},
+		{"-true;", []string{"1:1: operator - not defined on bool"}},
+		{"true < false;", []string{"1:1: operator < not defined on bool and bool"}},
+		{"let a = [1]; a[\"x\"]; 1[0];", []string{"1:16: array index must be int, got str", "1:22: index operator not defined on int"}},
+		{
+			"let add = fn(a: int, b: int): int { a + b }; add(1, \"2\"); add(1);",
+			[]string{"1:53: cannot use str as int in argument 2 of add", "1:59: add expects 2 arguments, got 1"},
+		},
+		{
+			`let f = fn(a: int, b: int = a, ...c) { a }; f(); f(1, 2, "c"); f(..."a"); let g = fn(a: str = 1, ...b: int) { a }; g(1);`,
+			[]string{"1:45: f expects at least 1 arguments, got 0", "1:69: cannot spread str, expected array",
+				"1:95: cannot use int as default value of str", "1:101: rest parameter b must be array, got int",
+				"1:118: cannot use int as str in argument 1 of g"},
+		},
+		{
+			`let f = fn(a: int, b: int = 1) { a }; f(b: 2, a: "a"); f(1, b: -true);`,
+			[]string{"1:64: operator - not defined on bool"},
+		},
+		{
+			`let f = fn(a, b = 1) { a }; f(1, 2, 3); assert(f(1)); assert(true, "m", 1); let g: fn = f;`,
+			[]string{"1:29: f expects 1 to 2 arguments, got 3", "1:55: assert expects 1 to 2 arguments, got 3"},
+		},
+		{
+			"let f = fn(a: int): str { a };",
+			[]string{"1:27: cannot return int from function returning str"},
+		},
+		{
+			"let f = fn(a: int): str { if (a > 1) { return \"big\"; } return a; };",
+			[]string{"1:63: cannot return int from function returning str"},
+		},
+		{
+			"let f = fn(a: int): str { if (a > 1) { return \"big\"; } else { return \"small\"; } };",
+			nil,
+		},
+		{
+			// inferred return type is used by callers
+			"let f = fn(a) { a + \"!\" }; let x: int = f(1);",
+			[]string{"1:41: cannot use str as int in let x"},
+		},
+		{
+			"let fact = fn(n: int): int { if (n < 1) { 1 } else { n * fact(n - 1) } }; fact(\"x\");",
+			[]string{"1:80: cannot use str as int in argument 1 of fact"},
+		},
+		{
+			"let apply = fn(f: fn, x) { f(x) }; apply(fn(a) { a }, 1); apply(1, 1);",
+			[]string{"1:65: cannot use int as fn in argument 1 of apply"},
+		},
+		{
+			"let x = 5; x(1);",
+			[]string{"1:12: cannot call x of type int"},
+		},
+		{
+			"len(\"abc\") + 1; push(1, 2);",
+			[]string{"1:22: cannot use int as array in argument 1 of push"},
+		},
+		{
+			"let h: hash = {\"a\": 1, 2: true}; h[\"a\"]; h[1n]; {[1]: 1}; h[[1]];",
+			[]string{"1:50: unusable as hash key: array", "1:61: unusable as hash key: array"},
+		},
+		{
+			"let x: int = match (1) { 1 => 2, n if n > 1 => n + 1, [a, ...r] => len(r) };",
+			nil,
+		},
+		{
+			"let x: int = match (\"a\") { s => s }; match (1) { n => n + \"a\" };",
+			[]string{"1:14: cannot use str as int in let x", "1:55: operator + not defined on int and str"},
+		},
+		{
+			"let [a, ...b] = [1]; let {c} = 1; let [d] = {}; let f = fn([x], {y = 1}: hash) { x }; let z: int = f([1], {});",
+			[]string{"1:26: cannot destructure int with hash pattern", "1:39: cannot destructure hash with array pattern"},
+		},
+		{
+			// unknown types are never reported
+			"let f = fn(a, b) { a + b }; f(1, \"a\") - 1; unknown + 1;",
+			nil,
+		},
+	}
+
+	for _, tt := range tests {
+		p := parser.New(tokenizer.New(tt.input))
+		program := p.ParseProgram()
+		if len(p.Errors) != 0 {
+			t.Fatalf("%q: parser errors %v", tt.input, p.Errors)
+		}
+
+		var actual []string
+		for _, e := range Check(program) {
+			actual = append(actual, e.String())
+		}
+		if strings.Join(actual, "\n") != strings.Join(tt.expected, "\n") {
+			t.Errorf("%q:\nexpected=%q\ngot=     %q", tt.input, tt.expected, actual)
+		}
+	}
+}
+
+func TestBindings(t *testing.T) {
+	input := `let x = 1 + 2n;
+let f = fn(a: str, b) { a + "!" };
+let g = fn(a, b = 1, ...c) { c };`
+
+	program := parser.New(tokenizer.New(input)).ParseProgram()
+	bindings := Bindings(program)
+
+	tests := []struct {
+		pos      token.Position
+		expected string
+	}{
+		{token.Position{Line: 1, Column: 5}, "bigint"},
+		{token.Position{Line: 2, Column: 5}, "fn(str, any): str"},
+		{token.Position{Line: 2, Column: 12}, "str"},
+		{token.Position{Line: 2, Column: 20}, "any"},
+		{token.Position{Line: 3, Column: 5}, "fn(any, any?, ...array): array"},
+		{token.Position{Line: 3, Column: 25}, "array"},
+	}
+	for _, tt := range tests {
+		typ, ok := bindings[tt.pos]
+		if !ok {
+			t.Errorf("no binding at %s", tt.pos)
+			continue
+		}
+		if typ.String() != tt.expected {
+			t.Errorf("binding at %s: expected %s, got %s", tt.pos, tt.expected, typ)
+		}
+	}
+}
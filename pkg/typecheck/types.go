@@ -0,0 +1,140 @@
+package typecheck
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Type is a static type of an expression
+type Type interface {
+	String() string
+}
+
+// Basic is a type without any structure, it is identified by its name
+type Basic string
+
+func (b Basic) String() string { return string(b) }
+
+const (
+	Int    Basic = "int"
+	BigInt Basic = "bigint"
+	Str    Basic = "str"
+	Bool   Basic = "bool"
+	Array  Basic = "array"
+	Hash   Basic = "hash"
+	Null   Basic = "null"
+	// Any is the type of expressions that cannot be inferred, it is
+	// compatible with every other type
+	Any Basic = "any"
+
+	// never is the type of return statements, control never continues
+	// after them so they do not contribute to the type of a block
+	never Basic = "never"
+)
+
+// Function is type of a function, Params is nil when the signature is not
+// known, e.g. for parameters annotated just as fn
+type Function struct {
+	Params []Type
+	// Optional is the number of parameters with default values, they come
+	// before the variadic one
+	Optional int
+	// Variadic functions collect the remaining arguments into an array
+	// bound to the last parameter
+	Variadic bool
+	Return   Type
+}
+
+func (f *Function) String() string {
+	if f.Params == nil {
+		return "fn"
+	}
+	min, _ := f.arity()
+	params := make([]string, len(f.Params))
+	for i, p := range f.Params {
+		params[i] = p.String()
+		if f.Variadic && i == len(f.Params)-1 {
+			params[i] = "..." + params[i]
+		} else if i >= min {
+			params[i] += "?"
+		}
+	}
+	return fmt.Sprintf("fn(%s): %s", strings.Join(params, ", "), f.Return)
+}
+
+// arity returns the minimal and maximal number of arguments, the maximum is
+// -1 for variadic functions
+func (f *Function) arity() (int, int) {
+	fixed := len(f.Params)
+	if f.Variadic {
+		fixed--
+	}
+	if f.Variadic {
+		return fixed - f.Optional, -1
+	}
+	return fixed - f.Optional, fixed
+}
+
+// anyFunction is the type of the fn annotation
+var anyFunction = &Function{Return: Any}
+
+// typeNames are types that can be used in annotations
+var typeNames = map[string]Type{
+	"int":    Int,
+	"bigint": BigInt,
+	"str":    Str,
+	"bool":   Bool,
+	"array":  Array,
+	"hash":   Hash,
+	"null":   Null,
+	"any":    Any,
+	"fn":     anyFunction,
+}
+
+// assignable reports whether value of type from can be used where type to is
+// expected
+func assignable(from Type, to Type) bool {
+	if from == Any || to == Any || from == never || from == to {
+		return true
+	}
+	if from == Int && to == BigInt {
+		// integers are promoted to BigInt on overflow
+		return true
+	}
+	fromFn, fromOk := from.(*Function)
+	toFn, toOk := to.(*Function)
+	if fromOk && toOk {
+		if fromFn.Params == nil || toFn.Params == nil {
+			return true
+		}
+		if len(fromFn.Params) != len(toFn.Params) || fromFn.Optional != toFn.Optional || fromFn.Variadic != toFn.Variadic {
+			return false
+		}
+		for i := range fromFn.Params {
+			if !assignable(toFn.Params[i], fromFn.Params[i]) {
+				return false
+			}
+		}
+		return assignable(fromFn.Return, toFn.Return)
+	}
+	return false
+}
+
+func isInteger(t Type) bool {
+	return t == Int || t == BigInt
+}
+
+// join returns type of value which can be of either type
+func join(a Type, b Type) Type {
+	switch {
+	case a == nil || a == never:
+		return b
+	case b == nil || b == never:
+		return a
+	case a == b:
+		return a
+	case isInteger(a) && isInteger(b):
+		return BigInt
+	}
+	return Any
+}